@@ -3,7 +3,11 @@ package config
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -19,14 +23,75 @@ type Config struct {
 	ServerPort string
 	Environment string
 
+	// Browser origins allowed to make credentialed (cookie) requests
+	CORSAllowedOrigins []string
+
 	// JWT Configuration
-	JWTSecretKey string
+	JWTSecretKey           string
+	JWTSigningAlgorithm    string
+	JWTKeyRotationInterval time.Duration
+	JWTKeyOverlap          time.Duration
+	JWTLegacyHS256Until    time.Time
+	// Secret the private signing keys are encrypted with in the database; defaults to JWTSecretKey
+	JWTKeyEncryptionKey string
 
 	// Google OAuth Configuration
 	GoogleClientID     string
 	GoogleClientSecret string
 	GoogleRedirectURL  string
 
+	// Additional OpenID Connect / OAuth2 login providers
+	OIDCProviders []OIDCProviderConfig
+
+	// Who may create an account on first login
+	SignupPolicy SignupPolicyConfig
+
+	// Public URL of the frontend, used for links in emails
+	AppBaseURL string
+
+	// Public URL of this API, the issuer of the OAuth 2.0 / OpenID Connect server for partner apps
+	OAuthIssuer string
+
+	// Users holding any of these roles must use multi-factor authentication
+	MFARequiredRoles []string
+	// Issuer shown in authenticator apps
+	MFAIssuer string
+
+	// WebAuthn relying party: the domain passkeys are bound to and the origins allowed to use them
+	WebAuthnRPID    string
+	WebAuthnRPName  string
+	WebAuthnOrigins []string
+	// Refuse sensitive operations to users without a passkey instead of letting their session suffice
+	StepUpRequirePasskey bool
+
+	// Keep browser sessions in HttpOnly cookies instead of handing the tokens to JavaScript.
+	// AuthCookieDomain is only needed when the API and the frontend are on different subdomains.
+	AuthCookies      bool
+	AuthCookieDomain string
+
+	// One-time token for promoting the first admin, given directly or in a file.
+	// If neither is set a token is generated and logged at startup.
+	SetupToken     string
+	SetupTokenFile string
+
+	// Proxies (CIDRs) whose X-Forwarded-For, X-Real-IP and visitor location headers are trusted.
+	// Requests from anywhere else are attributed to their peer address.
+	TrustedProxies []string
+	// How long login history is kept; 0 keeps it forever
+	LoginHistoryRetention time.Duration
+	// How long the roles, permissions and organization memberships of a user are cached.
+	// Changes made through the API reach every replica at once; this bounds other changes.
+	AuthorizationCacheTTL time.Duration
+	// How long policy decisions are kept for audits; 0 keeps them forever
+	PolicyDecisionRetention time.Duration
+
+	// SMTP Configuration for outgoing email (emails are only logged if SMTPHost is empty)
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
 	// Stripe Configuration
 	StripeSecretKey      string
 	StripePublishableKey string
@@ -34,6 +99,42 @@ type Config struct {
 	StripeEndpointSecret string
 }
 
+// OIDCProviderConfig configures a generic OpenID Connect (or plain OAuth2) login provider.
+// Endpoints are discovered from Issuer; AuthURL, TokenURL and UserInfoURL
+// override discovery and allow providers without OIDC support such as GitHub.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+
+	// Claim names used to map the provider's profile onto a user
+	ClaimSubject       string
+	ClaimEmail         string
+	ClaimEmailVerified string
+	ClaimName          string
+	ClaimPicture       string
+}
+
+// SignupPolicyConfig controls which first-time logins may create an account
+type SignupPolicyConfig struct {
+	// Refuse sign-ups whose email the identity provider has not verified
+	RequireVerifiedEmail bool
+	// Only allow sign-ups from these email domains (any domain if empty)
+	AllowedDomains []string
+	// Only allow sign-ups with an open invitation for the email address
+	InviteOnly bool
+	// Create new accounts inactive until an admin approves them (invited users skip approval)
+	RequireApproval bool
+	// How long an invitation stays valid
+	InvitationTTL time.Duration
+}
+
 // LoadConfig loads configuration from environment variables
 func LoadConfig() *Config {
 	// Check if we're in production (have environment variables set)
@@ -62,8 +163,15 @@ func LoadConfig() *Config {
 		ServerPort: getEnv("SERVER_PORT", "8080"),
 		Environment: getEnv("ENVIRONMENT", "production"),
 
+		CORSAllowedOrigins: getEnvList("CORS_ALLOWED_ORIGINS", []string{"http://localhost:3000"}),
+
 		// JWT Configuration
-		JWTSecretKey: getEnv("JWT_SECRET_KEY", "your-secret-key-change-in-production"),
+		JWTSecretKey:           getEnv("JWT_SECRET_KEY", "your-secret-key-change-in-production"),
+		JWTSigningAlgorithm:    getEnv("JWT_SIGNING_ALGORITHM", "RS256"),
+		JWTKeyRotationInterval: getEnvDuration("JWT_KEY_ROTATION_INTERVAL", 30*24*time.Hour),
+		JWTKeyOverlap:          getEnvDuration("JWT_KEY_OVERLAP", 24*time.Hour),
+		JWTLegacyHS256Until:    getEnvTime("JWT_LEGACY_HS256_UNTIL"),
+		JWTKeyEncryptionKey:    getEnv("JWT_KEY_ENCRYPTION_KEY", ""),
 
 		// Google OAuth Configuration
 		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
@@ -75,6 +183,64 @@ func LoadConfig() *Config {
 		StripePublishableKey: getEnv("STRIPE_PUBLISHABLE_KEY", ""),
 		StripeWebhookSecret:  getEnv("STRIPE_WEBHOOK_SECRET", ""),
 		StripeEndpointSecret: getEnv("STRIPE_ENDPOINT_SECRET", ""),
+
+		// Sign-up Policy
+		SignupPolicy: SignupPolicyConfig{
+			RequireVerifiedEmail: getEnvBool("SIGNUP_REQUIRE_VERIFIED_EMAIL", true),
+			AllowedDomains:       getEnvList("SIGNUP_ALLOWED_DOMAINS", nil),
+			InviteOnly:           getEnvBool("SIGNUP_INVITE_ONLY", false),
+			RequireApproval:      getEnvBool("SIGNUP_REQUIRE_APPROVAL", false),
+			InvitationTTL:        getEnvDuration("SIGNUP_INVITATION_TTL", 7*24*time.Hour),
+		},
+
+		AppBaseURL: getEnv("APP_BASE_URL", "http://localhost:3000"),
+
+		OAuthIssuer: getEnv("OAUTH_ISSUER", "http://localhost:8080"),
+
+		// Multi-factor Authentication
+		MFARequiredRoles: getEnvList("MFA_REQUIRED_ROLES", []string{"admin"}),
+		MFAIssuer:        getEnv("MFA_ISSUER", "Hackaton Demo"),
+
+		// WebAuthn (passkeys)
+		WebAuthnRPName:       getEnv("WEBAUTHN_RP_NAME", "Hackaton Demo"),
+		StepUpRequirePasskey: getEnvBool("STEP_UP_REQUIRE_PASSKEY", false),
+
+		// Cookie sessions
+		AuthCookies:      getEnvBool("AUTH_COOKIES", false),
+		AuthCookieDomain: getEnv("AUTH_COOKIE_DOMAIN", ""),
+
+		// First admin bootstrap
+		SetupToken:     getEnv("SETUP_TOKEN", ""),
+		SetupTokenFile: getEnv("SETUP_TOKEN_FILE", ""),
+
+		// Client IP addresses and login history
+		TrustedProxies:        getEnvList("TRUSTED_PROXIES", []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}),
+		LoginHistoryRetention: getEnvDuration("LOGIN_HISTORY_RETENTION", 90*24*time.Hour),
+		AuthorizationCacheTTL: getEnvDuration("AUTHZ_CACHE_TTL", time.Minute),
+
+		// Audit log of access policy decisions
+		PolicyDecisionRetention: getEnvDuration("POLICY_DECISION_RETENTION", 90*24*time.Hour),
+
+		// SMTP Configuration
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "no-reply@localhost"),
+	}
+
+	if config.JWTKeyEncryptionKey == "" {
+		log.Println("JWT_KEY_ENCRYPTION_KEY not set, encrypting signing keys with JWT_SECRET_KEY")
+		config.JWTKeyEncryptionKey = config.JWTSecretKey
+	}
+
+	// Passkeys default to the domain and origin of the frontend
+	config.WebAuthnRPID = getEnv("WEBAUTHN_RP_ID", hostOf(config.AppBaseURL))
+	config.WebAuthnOrigins = getEnvList("WEBAUTHN_ORIGINS", []string{strings.TrimRight(config.AppBaseURL, "/")})
+
+	// Providers are listed in OIDC_PROVIDERS and configured with OIDC_<NAME>_* variables
+	for _, name := range getEnvList("OIDC_PROVIDERS", nil) {
+		config.OIDCProviders = append(config.OIDCProviders, loadOIDCProviderConfig(name))
 	}
 
 	// Debug logging for OAuth configuration
@@ -95,6 +261,28 @@ func (c *Config) GetDSN() string {
 	)
 }
 
+// loadOIDCProviderConfig reads the OIDC_<NAME>_* variables of a login provider
+func loadOIDCProviderConfig(name string) OIDCProviderConfig {
+	prefix := "OIDC_" + strings.ToUpper(name) + "_"
+	return OIDCProviderConfig{
+		Name:         strings.ToLower(name),
+		Issuer:       getEnv(prefix+"ISSUER", ""),
+		ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+		ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+		RedirectURL:  getEnv(prefix+"REDIRECT_URL", ""),
+		Scopes:       getEnvList(prefix+"SCOPES", []string{"openid", "email", "profile"}),
+		AuthURL:      getEnv(prefix+"AUTH_URL", ""),
+		TokenURL:     getEnv(prefix+"TOKEN_URL", ""),
+		UserInfoURL:  getEnv(prefix+"USERINFO_URL", ""),
+
+		ClaimSubject:       getEnv(prefix+"CLAIM_SUBJECT", "sub"),
+		ClaimEmail:         getEnv(prefix+"CLAIM_EMAIL", "email"),
+		ClaimEmailVerified: getEnv(prefix+"CLAIM_EMAIL_VERIFIED", "email_verified"),
+		ClaimName:          getEnv(prefix+"CLAIM_NAME", "name"),
+		ClaimPicture:       getEnv(prefix+"CLAIM_PICTURE", "picture"),
+	}
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -102,3 +290,73 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvList gets a comma-separated environment variable or returns a default value
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// hostOf returns the host name of a URL without port, or "localhost" if it cannot be parsed
+func hostOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		return "localhost"
+	}
+	return parsed.Hostname()
+}
+
+// getEnvBool gets a boolean environment variable (e.g. "true", "0") or returns a default value
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean for %s: %v, using default %t", key, err, defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
+// getEnvDuration gets a duration environment variable (e.g. "720h") or returns a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s: %v, using default %s", key, err, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+// getEnvTime gets an RFC 3339 timestamp environment variable, returning the zero time if unset
+func getEnvTime(key string) time.Time {
+	value := os.Getenv(key)
+	if value == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Printf("Invalid timestamp for %s: %v, ignoring", key, err)
+		return time.Time{}
+	}
+	return t
+}
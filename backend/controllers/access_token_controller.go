@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/frallan97/hackaton-demo-backend/middleware"
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/services"
+	"github.com/frallan97/hackaton-demo-backend/utils"
+)
+
+// AccessTokensHandler lists, creates or revokes personal access tokens of the current user
+// @Summary     Manage personal access tokens
+// @Description GET lists the active tokens of the current user. POST creates a token, which is only shown in this response; it carries the MFA state of the session creating it and needs a step-up token in the X-Step-Up-Token header. Tokens are revoked when the password is changed or reset and when an admin signs the user out everywhere. DELETE revokes the token given by the id query parameter. Tokens can only be managed from a login session, not with another token.
+// @Tags        auth
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       token  body   models.AccessTokenCreateInput  false  "Token name, scopes (read, write, admin) and lifetime in days (POST only)"
+// @Param       id     query  int                            false  "Token ID (DELETE only)"
+// @Success     200   {object}  utils.APIResponse{data=[]models.AccessToken}
+// @Success     201   {object}  utils.APIResponse{data=models.AccessTokenCreated}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     403   {string}  string  "Step-up authentication required"
+// @Failure     404   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/tokens [get]
+// @Router      /api/auth/tokens [post]
+// @Router      /api/auth/tokens [delete]
+func (ac *AuthController) AccessTokensHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			utils.WriteMethodNotAllowed(w, "GET, POST, DELETE")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			tokens, err := ac.accessTokenService.ListTokens(claims.UserID)
+			if err != nil {
+				utils.WriteInternalServerError(w, "Failed to retrieve access tokens", err)
+				return
+			}
+			utils.WriteOK(w, tokens, "Access tokens retrieved successfully")
+
+		case http.MethodPost:
+			var input models.AccessTokenCreateInput
+			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+				utils.WriteBadRequest(w, "Invalid request body", err)
+				return
+			}
+
+			if validationErrors := services.ValidateAccessTokenInput(&input); len(validationErrors) > 0 {
+				utils.WriteValidationError(w, validationErrors)
+				return
+			}
+
+			token, err := ac.accessTokenService.CreateToken(claims.UserID, &input, claims.UserID, claims.MFA)
+			if err != nil {
+				utils.WriteInternalServerError(w, "Failed to create access token", err)
+				return
+			}
+
+			ac.publishAccessTokenChanged(claims.UserID, claims.Email, token.ID, true)
+			utils.WriteCreated(w, token, "Access token created. Copy it now, it will not be shown again.")
+
+		case http.MethodDelete:
+			tokenID, err := strconv.Atoi(r.URL.Query().Get("id"))
+			if err != nil {
+				utils.WriteBadRequest(w, "Invalid access token ID", err)
+				return
+			}
+
+			if err := ac.accessTokenService.RevokeToken(claims.UserID, tokenID); err != nil {
+				if errors.Is(err, services.ErrAccessTokenNotFound) {
+					utils.WriteNotFound(w, "Access token not found")
+					return
+				}
+				utils.WriteInternalServerError(w, "Failed to revoke access token", err)
+				return
+			}
+
+			ac.publishAccessTokenChanged(claims.UserID, claims.Email, tokenID, false)
+			utils.WriteOK(w, nil, "Access token revoked")
+		}
+	}
+}
+
+// claimsFromRequestOrAccessToken is claimsFromRequest for endpoints that also accept personal
+// access tokens and tokens delegated to OAuth clients, within their scope
+func (ac *AuthController) claimsFromRequestOrAccessToken(r *http.Request) (*services.Claims, error) {
+	var claims *services.Claims
+	var err error
+
+	tokenString, _ := middleware.BearerToken(r)
+	if strings.HasPrefix(tokenString, services.AccessTokenPrefix) {
+		claims, err = ac.accessTokenService.Authenticate(tokenString, middleware.ClientIP(r))
+		if err != nil {
+			return nil, errors.New("Invalid token")
+		}
+	} else {
+		claims, err = ac.bearerClaimsFromRequest(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !claims.AllowsMethod(r.Method) {
+		return nil, errors.New("Token scope does not allow this request")
+	}
+
+	return claims, nil
+}
+
+// publishAccessTokenChanged publishes the creation or revocation of an access token
+func (ac *AuthController) publishAccessTokenChanged(userID int, email string, tokenID int, created bool) {
+	if ac.eventService == nil {
+		return
+	}
+
+	if err := ac.eventService.PublishAccessTokenChanged(userID, email, tokenID, created); err != nil {
+		fmt.Printf("Warning: Failed to publish access token event: %v\n", err)
+	}
+}
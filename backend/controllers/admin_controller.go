@@ -2,10 +2,15 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/frallan97/hackaton-demo-backend/database"
+	"github.com/frallan97/hackaton-demo-backend/events"
 	"github.com/frallan97/hackaton-demo-backend/middleware"
 	"github.com/frallan97/hackaton-demo-backend/models"
 	"github.com/frallan97/hackaton-demo-backend/services"
@@ -16,14 +21,21 @@ type AdminController struct {
 	adminService *services.AdminService
 	roleService  *services.RoleService
 	orgService   *services.OrganizationService
+
+	revocationService   *services.TokenRevocationService
+	signupPolicyService *services.SignupPolicyService
+	eventService        *events.EventService
 }
 
 // NewAdminController creates a new admin controller
-func NewAdminController(dbManager *database.DBManager) *AdminController {
+func NewAdminController(dbManager *database.DBManager, revocationService *services.TokenRevocationService, signupPolicyService *services.SignupPolicyService, eventService *events.EventService) *AdminController {
 	return &AdminController{
-		adminService: services.NewAdminService(dbManager.DB),
-		roleService:  services.NewRoleService(dbManager.DB),
-		orgService:   services.NewOrganizationService(dbManager.DB),
+		adminService:        services.NewAdminService(dbManager.DB),
+		roleService:         services.NewRoleService(dbManager.DB),
+		orgService:          services.NewOrganizationService(dbManager.DB),
+		revocationService:   revocationService,
+		signupPolicyService: signupPolicyService,
+		eventService:        eventService,
 	}
 }
 
@@ -98,6 +110,12 @@ func (ac *AdminController) AssignRoleHandler() http.HandlerFunc {
 			return
 		}
 
+		if ac.eventService != nil {
+			if err := ac.eventService.PublishRoleAssigned(req.UserID, req.RoleID, ""); err != nil {
+				fmt.Printf("Warning: Failed to publish role assigned event: %v\n", err)
+			}
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"message": "Role assigned successfully"})
 	}
@@ -141,6 +159,12 @@ func (ac *AdminController) RemoveRoleHandler() http.HandlerFunc {
 			return
 		}
 
+		if ac.eventService != nil {
+			if err := ac.eventService.PublishRoleRemoved(req.UserID, req.RoleID, ""); err != nil {
+				fmt.Printf("Warning: Failed to publish role removed event: %v\n", err)
+			}
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"message": "Role removed successfully"})
 	}
@@ -148,7 +172,7 @@ func (ac *AdminController) RemoveRoleHandler() http.HandlerFunc {
 
 // AssignOrganizationHandler adds a user to an organization
 // @Summary Add user to organization
-// @Description Add a user to an organization with a specific role (Admin only)
+// @Description Add a user to an organization with a role of owner, admin, member or viewer (Admin only)
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -174,6 +198,11 @@ func (ac *AdminController) AssignOrganizationHandler() http.HandlerFunc {
 			return
 		}
 
+		if !slices.Contains(services.OrgRoles, req.Role) {
+			http.Error(w, "Role must be one of "+strings.Join(services.OrgRoles, ", "), http.StatusBadRequest)
+			return
+		}
+
 		err := ac.adminService.AddUserToOrganization(req.UserID, req.OrganizationID, req.Role)
 		if err != nil {
 			if err.Error() == "user is already a member of this organization" {
@@ -184,6 +213,12 @@ func (ac *AdminController) AssignOrganizationHandler() http.HandlerFunc {
 			return
 		}
 
+		if ac.eventService != nil {
+			if err := ac.eventService.PublishUserAddedToOrg(req.UserID, req.OrganizationID, ""); err != nil {
+				fmt.Printf("Warning: Failed to publish organization membership event: %v\n", err)
+			}
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"message": "User added to organization successfully"})
 	}
@@ -227,19 +262,322 @@ func (ac *AdminController) RemoveOrganizationHandler() http.HandlerFunc {
 			return
 		}
 
+		if ac.eventService != nil {
+			if err := ac.eventService.PublishUserRemovedFromOrg(req.UserID, req.OrganizationID, ""); err != nil {
+				fmt.Printf("Warning: Failed to publish organization membership event: %v\n", err)
+			}
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"message": "User removed from organization successfully"})
 	}
 }
 
+// DeactivateUserHandler deactivates a user and revokes all of their tokens
+// @Summary Deactivate user
+// @Description Deactivate a user account and immediately revoke all of its sessions (Admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.UserStatusRequest true "User status request"
+// @Success 200 {string} string "User deactivated successfully"
+// @Router /api/admin/deactivate-user [post]
+func (ac *AdminController) DeactivateUserHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req models.UserStatusRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.UserID == 0 {
+			http.Error(w, "User ID is required", http.StatusBadRequest)
+			return
+		}
+
+		err := ac.adminService.SetUserActive(req.UserID, false)
+		if err != nil {
+			if err.Error() == "user not found" {
+				http.Error(w, err.Error(), http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if err := ac.revocationService.RevokeAllForUser(req.UserID, "user_deactivated"); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "User deactivated successfully"})
+	}
+}
+
+// GetPendingUsersHandler lists users waiting for sign-up approval
+// @Summary Get pending users
+// @Description Get all users whose sign-up is waiting for admin approval (Admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.User
+// @Router /api/admin/pending-users [get]
+func (ac *AdminController) GetPendingUsersHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		users, err := ac.adminService.GetPendingUsers()
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(users)
+	}
+}
+
+// ApproveUserHandler activates a user waiting for sign-up approval
+// @Summary Approve user
+// @Description Approve a pending sign-up and activate the user account (Admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.UserStatusRequest true "User status request"
+// @Success 200 {string} string "User approved successfully"
+// @Router /api/admin/approve-user [post]
+func (ac *AdminController) ApproveUserHandler() http.HandlerFunc {
+	return ac.reviewSignupHandler(true)
+}
+
+// RejectUserHandler deletes a user waiting for sign-up approval
+// @Summary Reject user
+// @Description Reject a pending sign-up and delete the user account (Admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.UserStatusRequest true "User status request"
+// @Success 200 {string} string "User rejected successfully"
+// @Router /api/admin/reject-user [post]
+func (ac *AdminController) RejectUserHandler() http.HandlerFunc {
+	return ac.reviewSignupHandler(false)
+}
+
+// reviewSignupHandler approves or rejects a pending sign-up
+func (ac *AdminController) reviewSignupHandler(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req models.UserStatusRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.UserID == 0 {
+			http.Error(w, "User ID is required", http.StatusBadRequest)
+			return
+		}
+
+		adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		review := ac.adminService.RejectUser
+		message := "User rejected successfully"
+		if approve {
+			review = ac.adminService.ApproveUser
+			message = "User approved successfully"
+		}
+
+		email, err := review(req.UserID)
+		if err != nil {
+			if err.Error() == "pending user not found" {
+				http.Error(w, err.Error(), http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if ac.eventService != nil {
+			if err := ac.eventService.PublishSignupReviewed(req.UserID, email, approve, adminUserID); err != nil {
+				fmt.Printf("Warning: Failed to publish sign-up review event: %v\n", err)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": message})
+	}
+}
+
+// InvitationsHandler lists, creates and revokes sign-up invitations
+// @Summary Manage sign-up invitations
+// @Description GET lists invitations, POST invites an email address, DELETE revokes the unused invitation given by the id query parameter (Admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.SignupInvitationRequest false "Invitation request (POST only)"
+// @Param id query int false "Invitation ID (DELETE only)"
+// @Success 200 {array} models.SignupInvitation
+// @Router /api/admin/invitations [get]
+// @Router /api/admin/invitations [post]
+// @Router /api/admin/invitations [delete]
+func (ac *AdminController) InvitationsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			invitations, err := ac.signupPolicyService.GetInvitations()
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(invitations)
+		case http.MethodPost:
+			var req models.SignupInvitationRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if !strings.Contains(req.Email, "@") {
+				http.Error(w, "A valid email is required", http.StatusBadRequest)
+				return
+			}
+
+			adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			invitation, err := ac.signupPolicyService.CreateInvitation(req.Email, adminUserID)
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(invitation)
+		case http.MethodDelete:
+			invitationID, err := strconv.Atoi(r.URL.Query().Get("id"))
+			if err != nil {
+				http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+				return
+			}
+
+			if err := ac.signupPolicyService.RevokeInvitation(invitationID); err != nil {
+				if errors.Is(err, services.ErrInvitationNotFound) {
+					http.Error(w, err.Error(), http.StatusNotFound)
+				} else {
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": "Invitation revoked successfully"})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// MergeUsersHandler merges one user into another
+// @Summary Merge users
+// @Description Move the login identities, roles, organization memberships, Stripe customer, subscriptions and payments of the source user to the target user, then delete the source user (Admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.MergeUsersRequest true "Merge users request"
+// @Success 200 {string} string "Users merged successfully"
+// @Router /api/admin/merge-users [post]
+func (ac *AdminController) MergeUsersHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req models.MergeUsersRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.SourceUserID == 0 || req.TargetUserID == 0 {
+			http.Error(w, "Source and target user IDs are required", http.StatusBadRequest)
+			return
+		}
+
+		if req.SourceUserID == req.TargetUserID {
+			http.Error(w, "Cannot merge a user into itself", http.StatusBadRequest)
+			return
+		}
+
+		adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		err := ac.adminService.MergeUsers(req.SourceUserID, req.TargetUserID)
+		if err != nil {
+			if err.Error() == "user not found" {
+				http.Error(w, err.Error(), http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// Deny the access tokens the source user still holds; its refresh tokens were deleted with it
+		if err := ac.revocationService.RevokeAllForUser(req.SourceUserID, "user_merged"); err != nil {
+			http.Error(w, "Users merged, but failed to revoke the source user's tokens", http.StatusInternalServerError)
+			return
+		}
+
+		if ac.eventService != nil {
+			if err := ac.eventService.PublishUsersMerged(req.TargetUserID, req.SourceUserID, adminUserID); err != nil {
+				fmt.Printf("Warning: Failed to publish users merged event: %v\n", err)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Users merged successfully"})
+	}
+}
+
 // GetUserRolesHandler gets roles for a specific user
 // @Summary Get user roles
-// @Description Get all roles assigned to a specific user (Admin only)
+// @Description Get the roles of a specific user: those assigned directly and, marked as inherited, those their parent roles pass on (Admin only)
 // @Tags admin
 // @Produce json
 // @Security BearerAuth
 // @Param id query int true "User ID"
-// @Success 200 {array} models.Role
+// @Success 200 {array} models.EffectiveRole
 // @Router /api/admin/user-roles [get]
 func (ac *AdminController) GetUserRolesHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -2,12 +2,16 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/frallan97/hackaton-demo-backend/database"
 	"github.com/frallan97/hackaton-demo-backend/events"
+	"github.com/frallan97/hackaton-demo-backend/middleware"
 	"github.com/frallan97/hackaton-demo-backend/models"
 	"github.com/frallan97/hackaton-demo-backend/services"
 	"github.com/frallan97/hackaton-demo-backend/utils"
@@ -15,117 +19,134 @@ import (
 
 // AuthController handles authentication-related endpoints
 type AuthController struct {
-	dbManager          *database.DBManager
-	userService        *services.UserService
-	jwtService         *services.JWTService
-	googleOAuthService *services.GoogleOAuthService
-	eventService       *events.EventService
-	roleService        *services.RoleService
-	adminService       *services.AdminService
+	dbManager           *database.DBManager
+	userService         *services.UserService
+	jwtService          *services.JWTService
+	refreshTokenService *services.RefreshTokenService
+	identityProviders   *services.IdentityProviderRegistry
+	eventService        *events.EventService
+	roleService         *services.RoleService
+	adminService        *services.AdminService
+	revocationService   *services.TokenRevocationService
+	oauthStateService   *services.OAuthStateService
+	identityLinkService *services.IdentityLinkService
+	signupPolicyService *services.SignupPolicyService
+	localAuthService    *services.LocalAuthService
+	mfaService          *services.MFAService
+	webAuthnService     *services.WebAuthnService
+	accessTokenService  *services.AccessTokenService
+	deviceAuthService   *services.DeviceAuthService
+	oauthServerService  *services.OAuthServerService
+	sessionCookies      *middleware.SessionCookies
+	securityService     *services.SecurityService
+	loginHistoryService *services.LoginHistoryService
+	userProfileService  *services.UserProfileService
 }
 
+// oauthNonceCookie binds an OAuth state to the browser that started the login
+const oauthNonceCookie = "oauth_nonce"
+
 // NewAuthController creates a new auth controller
-func NewAuthController(dbManager *database.DBManager, userService *services.UserService, jwtService *services.JWTService, googleOAuthService *services.GoogleOAuthService, eventService *events.EventService, roleService *services.RoleService, adminService *services.AdminService) *AuthController {
+func NewAuthController(dbManager *database.DBManager, userService *services.UserService, jwtService *services.JWTService, refreshTokenService *services.RefreshTokenService, identityProviders *services.IdentityProviderRegistry, eventService *events.EventService, roleService *services.RoleService, adminService *services.AdminService, revocationService *services.TokenRevocationService, oauthStateService *services.OAuthStateService, identityLinkService *services.IdentityLinkService, signupPolicyService *services.SignupPolicyService, localAuthService *services.LocalAuthService, mfaService *services.MFAService, webAuthnService *services.WebAuthnService, accessTokenService *services.AccessTokenService, deviceAuthService *services.DeviceAuthService, oauthServerService *services.OAuthServerService, sessionCookies *middleware.SessionCookies, securityService *services.SecurityService, loginHistoryService *services.LoginHistoryService, userProfileService *services.UserProfileService) *AuthController {
 	return &AuthController{
-		dbManager:          dbManager,
-		userService:        userService,
-		jwtService:         jwtService,
-		googleOAuthService: googleOAuthService,
-		eventService:       eventService,
-		roleService:        roleService,
-		adminService:       adminService,
+		dbManager:           dbManager,
+		userService:         userService,
+		jwtService:          jwtService,
+		refreshTokenService: refreshTokenService,
+		identityProviders:   identityProviders,
+		eventService:        eventService,
+		roleService:         roleService,
+		adminService:        adminService,
+		revocationService:   revocationService,
+		oauthStateService:   oauthStateService,
+		identityLinkService: identityLinkService,
+		signupPolicyService: signupPolicyService,
+		localAuthService:    localAuthService,
+		mfaService:          mfaService,
+		webAuthnService:     webAuthnService,
+		accessTokenService:  accessTokenService,
+		deviceAuthService:   deviceAuthService,
+		oauthServerService:  oauthServerService,
+		sessionCookies:      sessionCookies,
+		securityService:     securityService,
+		loginHistoryService: loginHistoryService,
+		userProfileService:  userProfileService,
 	}
 }
 
-// GoogleLoginHandler handles Google OAuth login
-// @Summary     Google OAuth Login
-// @Description Authenticate user with Google OAuth
+// LoginHandler handles OAuth/OIDC login with any configured provider
+// @Summary     OAuth Login
+// @Description Authenticate user with an identity provider (google, or any configured OIDC provider). The state must be the one issued by /api/auth/{provider}/url to the same browser. Users with MFA enabled get a models.MFAChallenge instead of tokens.
 // @Tags        auth
 // @Accept      json
 // @Produce     json
-// @Param       login  body   models.LoginRequest  true  "Google OAuth code"
+// @Param       provider  path   string               true  "Identity provider"
+// @Param       login     body   models.LoginRequest  true  "OAuth code and state"
 // @Success     200   {object}  utils.APIResponse{data=models.AuthResponse}
+// @Success     202   {object}  utils.APIResponse{data=models.SignupPendingResponse}
 // @Failure     400   {object}  utils.APIResponse
+// @Failure     403   {object}  utils.APIResponse
+// @Failure     404   {object}  utils.APIResponse
 // @Failure     405   {object}  utils.APIResponse
+// @Failure     409   {object}  utils.APIResponse{data=models.IdentityLinkRequired}
 // @Failure     500   {object}  utils.APIResponse
-// @Router      /api/auth/google/login [post]
-func (ac *AuthController) GoogleLoginHandler() http.HandlerFunc {
+// @Router      /api/auth/{provider}/login [post]
+func (ac *AuthController) LoginHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			utils.WriteMethodNotAllowed(w, "POST")
 			return
 		}
 
-		var req models.LoginRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			utils.WriteBadRequest(w, "Invalid request body", err)
-			return
-		}
-
-		// Validate input
-		if req.Code == "" {
-			utils.WriteValidationError(w, map[string]string{
-				"code": "Authorization code is required",
-			})
+		provider, ok := ac.identityProviders.Get(r.PathValue("provider"))
+		if !ok {
+			utils.WriteNotFound(w, "Unknown identity provider")
 			return
 		}
+		action := provider.Name() + "_login"
 
-		// Exchange authorization code for access token
-		token, err := ac.googleOAuthService.ExchangeCodeForToken(req.Code)
-		if err != nil {
-			utils.WriteBadRequest(w, "Failed to exchange authorization code", err)
-			return
-		}
-
-		// Get user info from Google
-		googleUserInfo, err := ac.googleOAuthService.GetUserInfo(token)
-		if err != nil {
-			utils.WriteBadRequest(w, "Failed to get user info from Google", err)
+		identity, ok := ac.completeProviderLogin(w, r, provider, action)
+		if !ok {
 			return
 		}
 
 		// Check if user exists in our database
-		user, err := ac.userService.GetUserByGoogleID(googleUserInfo.ID)
+		user, err := ac.userService.GetUserByIdentity(identity.Provider, identity.Subject)
 		if err != nil {
 			// Log the actual error for debugging
-			fmt.Printf("Database error getting user by Google ID: %v\n", err)
+			fmt.Printf("Database error getting user by identity: %v\n", err)
 			utils.WriteInternalServerError(w, "Database error while retrieving user", err)
 			return
 		}
 
-		if user == nil {
-			// Create new user
-			userData := &models.UserCreate{
-				Email:    googleUserInfo.Email,
-				Name:     googleUserInfo.Name,
-				Picture:  googleUserInfo.Picture,
-				GoogleID: googleUserInfo.ID,
-			}
+		if user != nil && !user.IsActive {
+			ac.writeInactiveUser(w, r, user, action)
+			return
+		}
 
-			user, err = ac.userService.CreateUser(userData)
+		if user == nil && identity.Email != "" {
+			// The identity is new, but its email may already belong to an account
+			existing, err := ac.userService.GetUserByEmail(identity.Email)
 			if err != nil {
-				// Log the actual error for debugging
-				fmt.Printf("Failed to create user: %v\n", err)
-				utils.WriteInternalServerError(w, "Failed to create user account", err)
+				utils.WriteInternalServerError(w, "Database error while retrieving user", err)
 				return
 			}
 
-			// Assign default "user" role to new user
-			userRole, err := ac.roleService.GetRoleByName("user")
-			if err != nil {
-				fmt.Printf("Warning: Failed to get user role: %v\n", err)
-			} else {
-				err = ac.adminService.AssignRoleToUser(user.ID, userRole.ID, user.ID)
-				if err != nil {
-					fmt.Printf("Warning: Failed to assign user role: %v\n", err)
-				}
+			if existing != nil {
+				ac.writeIdentityConflict(w, r, existing, identity, action)
+				return
 			}
+		}
 
-			// Publish user created event
-			if ac.eventService != nil {
-				if err := ac.eventService.PublishUserCreated(user.ID, user.Email, user.Name); err != nil {
-					fmt.Printf("Warning: Failed to publish user created event: %v\n", err)
-				}
+		if user == nil {
+			var pending bool
+			user, pending, ok = ac.signUp(w, identity, action)
+			if !ok {
+				return
+			}
+			if pending {
+				writeSignupPending(w, user)
+				return
 			}
 		} else {
 			// Update last login time
@@ -135,83 +156,150 @@ func (ac *AuthController) GoogleLoginHandler() http.HandlerFunc {
 				fmt.Printf("failed to update last login: %v\n", err)
 			}
 
-			// Update profile if needed
-			if user.Name != googleUserInfo.Name || user.Picture != googleUserInfo.Picture {
-				user, err = ac.userService.UpdateUserProfile(user.ID, googleUserInfo.Name, googleUserInfo.Picture)
+			if err := ac.userService.UpdateIdentityLogin(identity); err != nil {
+				// Log error but don't fail the login
+				fmt.Printf("failed to update identity login: %v\n", err)
+			}
+
+			// Mirror the provider's profile, except for what the user edited themselves
+			if user.Name != identity.Name || user.Picture != identity.Picture {
+				synced, err := ac.userService.SyncProviderProfile(user.ID, identity.Name, identity.Picture)
 				if err != nil {
 					// Log error but don't fail the login
 					fmt.Printf("failed to update profile: %v\n", err)
+				} else if synced != nil {
+					user = synced
 				}
 			}
 		}
 
-		// Publish user login event
-		if ac.eventService != nil {
-			if err := ac.eventService.PublishUserLogin(user.ID, user.Email, user.Name); err != nil {
-				fmt.Printf("Warning: Failed to publish user login event: %v\n", err)
-			}
+		ac.writeLoginSuccess(w, r, user, action)
+	}
+}
+
+// GetAuthURLHandler returns the authorization URL of an identity provider
+// @Summary     Get OAuth URL
+// @Description Get the authorization URL of an identity provider. Sets a short-lived nonce cookie that the login request must carry.
+// @Tags        auth
+// @Produce     json
+// @Param       provider  path   string  true  "Identity provider"
+// @Success     200   {object}  utils.APIResponse{data=map[string]string}
+// @Failure     404   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/{provider}/url [get]
+func (ac *AuthController) GetAuthURLHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.WriteMethodNotAllowed(w, "GET")
+			return
+		}
+
+		provider, ok := ac.identityProviders.Get(r.PathValue("provider"))
+		if !ok {
+			utils.WriteNotFound(w, "Unknown identity provider")
+			return
 		}
 
-		// Generate JWT tokens
-		accessToken, refreshToken, err := ac.jwtService.GenerateTokens(user)
+		start, err := ac.oauthStateService.Begin(provider.Name())
 		if err != nil {
-			utils.WriteInternalServerError(w, "Failed to generate authentication tokens", err)
+			utils.WriteInternalServerError(w, "Failed to start OAuth login", err)
 			return
 		}
 
-		// Create response
-		response := models.AuthResponse{
-			User:         user,
-			AccessToken:  accessToken,
-			RefreshToken: refreshToken,
-			TokenType:    "Bearer",
-			ExpiresIn:    int(ac.jwtService.GetTokenExpiry().Seconds()),
+		authURL, err := provider.AuthURL(r.Context(), start.State, start.CodeVerifier)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to build authorization URL", err)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     oauthNonceCookie,
+			Value:    start.Nonce,
+			Path:     "/api/auth",
+			Expires:  start.ExpiresAt,
+			MaxAge:   int(ac.oauthStateService.GetStateExpiry().Seconds()),
+			HttpOnly: true,
+			Secure:   isSecureRequest(r),
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		response := map[string]string{
+			"provider": provider.Name(),
+			"auth_url": authURL,
+			"state":    start.State,
 		}
 
-		utils.WriteOK(w, response, "Login successful")
+		utils.WriteOK(w, response, "OAuth URL generated successfully")
 	}
 }
 
-// GetAuthURLHandler returns the Google OAuth authorization URL
-// @Summary     Get Google OAuth URL
-// @Description Get the Google OAuth authorization URL
+// ProvidersResponse lists the identity providers users can log in with
+type ProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+// GetProvidersHandler lists the configured identity providers
+// @Summary     List identity providers
+// @Description List the identity providers users can log in with
 // @Tags        auth
 // @Produce     json
-// @Success     200   {object}  utils.APIResponse{data=map[string]string}
-// @Router      /api/auth/google/url [get]
-func (ac *AuthController) GetAuthURLHandler() http.HandlerFunc {
+// @Success     200   {object}  utils.APIResponse{data=ProvidersResponse}
+// @Failure     405   {object}  utils.APIResponse
+// @Router      /api/auth/providers [get]
+func (ac *AuthController) GetProvidersHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			utils.WriteMethodNotAllowed(w, "GET")
 			return
 		}
 
-		state := "random-state-string" // In production, generate a secure random state
-		authURL := ac.googleOAuthService.GetAuthURL(state)
+		response := &ProvidersResponse{
+			Providers: ac.identityProviders.Names(),
+		}
 
-		response := map[string]string{
-			"auth_url": authURL,
-			"state":    state,
+		utils.WriteOK(w, response, "Identity providers retrieved successfully")
+	}
+}
+
+// JWKSHandler publishes the public keys used to verify access tokens
+// @Summary     JSON Web Key Set
+// @Description Public keys (by kid) that other services can use to verify access tokens
+// @Tags        auth
+// @Produce     json
+// @Success     200   {object}  services.JWKS
+// @Failure     405   {object}  utils.APIResponse
+// @Router      /.well-known/jwks.json [get]
+func (ac *AuthController) JWKSHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.WriteMethodNotAllowed(w, "GET")
+			return
 		}
 
-		utils.WriteOK(w, response, "Google OAuth URL generated successfully")
+		// Verifiers cache the key set; new keys are published well before they are used
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(ac.jwtService.JWKS())
 	}
 }
 
 // RefreshTokenResponse represents the response for token refresh
 type RefreshTokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   string `json:"expires_in"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    string `json:"expires_in"`
+	// CSRFToken replaces the tokens for browser sessions kept in cookies
+	CSRFToken string `json:"csrf_token,omitempty"`
 }
 
-// RefreshTokenHandler refreshes an access token using a refresh token
+// RefreshTokenHandler rotates a refresh token and issues a new token pair
 // @Summary     Refresh Token
-// @Description Refresh access token using refresh token
+// @Description Exchange a refresh token for a new access token and a new refresh token. Each refresh token can only be used once; replaying a used token revokes the whole session. Browser sessions kept in cookies send no body; the refresh token cookie is used and rotated, and the X-CSRF-Token header is required.
 // @Tags        auth
 // @Accept      json
 // @Produce     json
-// @Param       refresh  body   models.RefreshTokenRequest  true  "Refresh token"
+// @Param       refresh  body   models.RefreshTokenRequest  false  "Refresh token (omitted by cookie sessions)"
 // @Success     200   {object}  utils.APIResponse{data=RefreshTokenResponse}
 // @Failure     400   {object}  utils.APIResponse
 // @Failure     405   {object}  utils.APIResponse
@@ -224,11 +312,20 @@ func (ac *AuthController) RefreshTokenHandler() http.HandlerFunc {
 		}
 
 		var req models.RefreshTokenRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
 			utils.WriteBadRequest(w, "Invalid request body", err)
 			return
 		}
 
+		// Browser sessions send the refresh token as a cookie instead
+		fromCookie := false
+		if req.RefreshToken == "" {
+			if cookie, err := r.Cookie(middleware.RefreshTokenCookie); err == nil {
+				req.RefreshToken = cookie.Value
+				fromCookie = true
+			}
+		}
+
 		// Validate input
 		if req.RefreshToken == "" {
 			utils.WriteValidationError(w, map[string]string{
@@ -237,17 +334,59 @@ func (ac *AuthController) RefreshTokenHandler() http.HandlerFunc {
 			return
 		}
 
-		// Refresh the access token
-		newAccessToken, err := ac.jwtService.RefreshToken(req.RefreshToken)
+		// Rotate the refresh token
+		newRefreshToken, family, err := ac.refreshTokenService.Rotate(req.RefreshToken, "", sessionDevice(r))
+		if err != nil {
+			if errors.Is(err, services.ErrRefreshTokenReused) {
+				ac.publishTokenRefresh(r, family.UserID, "", "refresh_token_reuse", false, "refresh token family "+family.FamilyID+" revoked after reuse")
+			}
+			if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+				utils.WriteBadRequest(w, "Invalid refresh token", err)
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to refresh token", err)
+			return
+		}
+
+		user, err := ac.userService.GetUserByID(family.UserID)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+			return
+		}
+
+		if user == nil {
+			// The account is gone or deactivated, so the session must not live on
+			if err := ac.refreshTokenService.RevokeFamily(family.FamilyID, "user_inactive"); err != nil {
+				fmt.Printf("Warning: Failed to revoke refresh token family: %v\n", err)
+			}
+			utils.WriteUnauthorized(w, "User account is not active")
+			return
+		}
+
+		newAccessToken, err := ac.jwtService.GenerateAccessToken(user, family.FamilyID, family.MFA)
 		if err != nil {
-			utils.WriteBadRequest(w, "Invalid refresh token", err)
+			utils.WriteInternalServerError(w, "Failed to generate authentication tokens", err)
 			return
 		}
 
+		ac.publishTokenRefresh(r, user.ID, user.Email, "refresh", true, "")
+
 		response := &RefreshTokenResponse{
-			AccessToken: newAccessToken,
-			TokenType:   "Bearer",
-			ExpiresIn:   fmt.Sprintf("%d", int(ac.jwtService.GetTokenExpiry().Seconds())),
+			AccessToken:  newAccessToken,
+			RefreshToken: newRefreshToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    fmt.Sprintf("%d", int(ac.jwtService.GetTokenExpiry().Seconds())),
+		}
+
+		if fromCookie && ac.sessionCookies.Enabled {
+			csrfToken, err := ac.sessionCookies.Set(w, r, newAccessToken, ac.jwtService.GetTokenExpiry(), newRefreshToken, ac.refreshTokenService.GetRefreshTokenExpiry())
+			if err != nil {
+				utils.WriteInternalServerError(w, "Failed to set session cookies", err)
+				return
+			}
+			response.AccessToken = ""
+			response.RefreshToken = ""
+			response.CSRFToken = csrfToken
 		}
 
 		utils.WriteOK(w, response, "Token refreshed successfully")
@@ -256,7 +395,7 @@ func (ac *AuthController) RefreshTokenHandler() http.HandlerFunc {
 
 // GetMeHandler returns the current user's information
 // @Summary     Get Current User
-// @Description Get current user information
+// @Description Get current user information. Accepts personal access tokens and tokens of OAuth clients with the read scope as well as login sessions.
 // @Tags        auth
 // @Produce     json
 // @Security    BearerAuth
@@ -273,23 +412,9 @@ func (ac *AuthController) GetMeHandler() http.HandlerFunc {
 			return
 		}
 
-		// Extract token from Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			utils.WriteUnauthorized(w, "Authorization header required")
-			return
-		}
-
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			utils.WriteUnauthorized(w, "Invalid authorization header format")
-			return
-		}
-
-		// Validate token
-		claims, err := ac.jwtService.ValidateToken(tokenString)
+		claims, err := ac.claimsFromRequestOrAccessToken(r)
 		if err != nil {
-			utils.WriteUnauthorized(w, "Invalid token")
+			utils.WriteUnauthorized(w, err.Error())
 			return
 		}
 
@@ -305,6 +430,10 @@ func (ac *AuthController) GetMeHandler() http.HandlerFunc {
 			return
 		}
 
+		if claims.IsImpersonation() {
+			user.ImpersonatedBy = claims.Actor.Subject
+		}
+
 		utils.WriteOK(w, user, "User information retrieved successfully")
 	}
 }
@@ -316,12 +445,13 @@ type LogoutResponse struct {
 
 // LogoutHandler handles user logout
 // @Summary     Logout
-// @Description Logout user (client should discard tokens)
+// @Description Logout user by revoking the presented access token and its refresh token session
 // @Tags        auth
 // @Produce     json
 // @Security    BearerAuth
 // @Success     200   {object}  utils.APIResponse{data=LogoutResponse}
 // @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
 // @Router      /api/auth/logout [post]
 func (ac *AuthController) LogoutHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -330,37 +460,18 @@ func (ac *AuthController) LogoutHandler() http.HandlerFunc {
 			return
 		}
 
-		// Extract token from Authorization header to get user info for event publishing
-		authHeader := r.Header.Get("Authorization")
-		var userID int
-		var userEmail string
-		var userName string
-
-		if authHeader != "" {
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			if tokenString != authHeader {
-				// Validate token to get user info
-				if claims, err := ac.jwtService.ValidateToken(tokenString); err == nil {
-					userID = claims.UserID
-					// Get user details for event
-					if user, err := ac.userService.GetUserByID(userID); err == nil && user != nil {
-						userEmail = user.Email
-						userName = user.Name
-					}
-				}
+		// Logging out with a missing or already invalid token is a no-op
+		claims, err := ac.claimsFromRequest(r)
+		if err == nil {
+			if err := ac.revocationService.RevokeSession(claims, "logout"); err != nil {
+				utils.WriteInternalServerError(w, "Failed to revoke session", err)
+				return
 			}
-		}
 
-		// Publish logout event if we have user info
-		if ac.eventService != nil && userID > 0 {
-			if err := ac.eventService.PublishUserLogout(userID, userEmail, userName); err != nil {
-				fmt.Printf("Warning: Failed to publish user logout event: %v\n", err)
-			}
+			ac.publishLogout(r, claims.UserID)
 		}
 
-		// In a stateless JWT system, logout is handled client-side
-		// The server can't invalidate JWT tokens, so we just return success
-		// For enhanced security, you could implement a token blacklist using Redis
+		ac.clearSessionCookies(w, r)
 
 		response := &LogoutResponse{
 			Message: "Logged out successfully",
@@ -369,3 +480,718 @@ func (ac *AuthController) LogoutHandler() http.HandlerFunc {
 		utils.WriteOK(w, response, "Logout successful")
 	}
 }
+
+// LogoutAllHandler revokes every session of the current user
+// @Summary     Logout everywhere
+// @Description Revoke all access and refresh tokens of the current user on every device
+// @Tags        auth
+// @Produce     json
+// @Security    BearerAuth
+// @Success     200   {object}  utils.APIResponse{data=LogoutResponse}
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/logout-all [post]
+func (ac *AuthController) LogoutAllHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		if err := ac.revocationService.RevokeAllForUser(claims.UserID, "logout_all"); err != nil {
+			utils.WriteInternalServerError(w, "Failed to revoke sessions", err)
+			return
+		}
+
+		ac.publishLogout(r, claims.UserID)
+		ac.clearSessionCookies(w, r)
+
+		response := &LogoutResponse{
+			Message: "Logged out from all devices",
+		}
+
+		utils.WriteOK(w, response, "Logout successful")
+	}
+}
+
+// LinkIdentityHandler attaches another login identity to the current user
+// @Summary     Link identity
+// @Description Attach an identity from another provider to the current user. Start with /api/auth/{provider}/url and post the callback code and state here instead of to the login endpoint.
+// @Tags        auth
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       provider  path   string               true  "Identity provider"
+// @Param       login     body   models.LoginRequest  true  "OAuth code and state"
+// @Success     200   {object}  utils.APIResponse{data=[]models.UserIdentity}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     404   {object}  utils.APIResponse
+// @Failure     409   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/{provider}/link [post]
+func (ac *AuthController) LinkIdentityHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		provider, ok := ac.identityProviders.Get(r.PathValue("provider"))
+		if !ok {
+			utils.WriteNotFound(w, "Unknown identity provider")
+			return
+		}
+
+		identity, ok := ac.completeProviderLogin(w, r, provider, provider.Name()+"_link")
+		if !ok {
+			return
+		}
+
+		if err := ac.userService.LinkIdentity(claims.UserID, identity); err != nil {
+			if errors.Is(err, services.ErrIdentityInUse) {
+				utils.WriteConflict(w, "This login is already linked to another account", nil)
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to link identity", err)
+			return
+		}
+
+		ac.respondIdentityLinked(w, claims.UserID, identity)
+	}
+}
+
+// ConfirmIdentityLinkHandler links an identity that was parked because its email already belonged to the current user
+// @Summary     Confirm identity link
+// @Description Confirm a pending identity link returned by a login with a new provider. Must be called by the account that owns the email address.
+// @Tags        auth
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       link  body   models.ConfirmIdentityLinkRequest  true  "Link token"
+// @Success     200   {object}  utils.APIResponse{data=[]models.UserIdentity}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     409   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/link/confirm [post]
+func (ac *AuthController) ConfirmIdentityLinkHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		var req models.ConfirmIdentityLinkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteBadRequest(w, "Invalid request body", err)
+			return
+		}
+
+		if req.LinkToken == "" {
+			utils.WriteValidationError(w, map[string]string{
+				"link_token": "Link token is required",
+			})
+			return
+		}
+
+		identity, err := ac.identityLinkService.Confirm(req.LinkToken, claims.UserID)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidIdentityLink) {
+				utils.WriteBadRequest(w, "Invalid link token", err)
+				return
+			}
+			if errors.Is(err, services.ErrIdentityInUse) {
+				utils.WriteConflict(w, "This login is already linked to another account", nil)
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to link identity", err)
+			return
+		}
+
+		ac.respondIdentityLinked(w, claims.UserID, identity)
+	}
+}
+
+// IdentitiesHandler lists or removes the login identities of the current user
+// @Summary     Linked identities
+// @Description GET lists the login identities linked to the current user. DELETE removes the identity given by the id query parameter; the last identity cannot be removed.
+// @Tags        auth
+// @Produce     json
+// @Security    BearerAuth
+// @Param       id    query  int  false  "Identity ID (DELETE only)"
+// @Success     200   {object}  utils.APIResponse{data=[]models.UserIdentity}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     404   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     409   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/identities [get]
+// @Router      /api/auth/identities [delete]
+func (ac *AuthController) IdentitiesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			utils.WriteMethodNotAllowed(w, "GET, DELETE")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		message := "Identities retrieved successfully"
+		if r.Method == http.MethodDelete {
+			identityID, err := strconv.Atoi(r.URL.Query().Get("id"))
+			if err != nil {
+				utils.WriteBadRequest(w, "Invalid identity ID", err)
+				return
+			}
+
+			identity, err := ac.userService.UnlinkIdentity(claims.UserID, identityID)
+			if err != nil {
+				if errors.Is(err, services.ErrIdentityNotFound) {
+					utils.WriteNotFound(w, "Identity not found")
+					return
+				}
+				if errors.Is(err, services.ErrLastIdentity) {
+					utils.WriteConflict(w, "Cannot remove the only login method of an account", nil)
+					return
+				}
+				utils.WriteInternalServerError(w, "Failed to unlink identity", err)
+				return
+			}
+
+			if ac.eventService != nil {
+				if err := ac.eventService.PublishIdentityUnlinked(claims.UserID, claims.Email, identity.Provider); err != nil {
+					fmt.Printf("Warning: Failed to publish identity unlinked event: %v\n", err)
+				}
+			}
+			message = "Identity unlinked successfully"
+		}
+
+		identities, err := ac.userService.GetUserIdentities(claims.UserID)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to retrieve identities", err)
+			return
+		}
+
+		utils.WriteOK(w, identities, message)
+	}
+}
+
+// respondIdentityLinked publishes an identity linked event and writes the user's identities
+func (ac *AuthController) respondIdentityLinked(w http.ResponseWriter, userID int, identity *models.ExternalIdentity) {
+	var email string
+	if user, err := ac.userService.GetUserByID(userID); err == nil && user != nil {
+		email = user.Email
+	}
+
+	if ac.eventService != nil {
+		if err := ac.eventService.PublishIdentityLinked(userID, email, identity.Provider); err != nil {
+			fmt.Printf("Warning: Failed to publish identity linked event: %v\n", err)
+		}
+	}
+
+	identities, err := ac.userService.GetUserIdentities(userID)
+	if err != nil {
+		utils.WriteInternalServerError(w, "Failed to retrieve identities", err)
+		return
+	}
+
+	utils.WriteOK(w, identities, "Identity linked successfully")
+}
+
+// signUp creates an account for a new identity if the sign-up policy allows it and reports
+// whether the account still needs approval by an administrator. On refusal or error it writes
+// the response itself and reports that the caller cannot continue.
+func (ac *AuthController) signUp(w http.ResponseWriter, identity *models.ExternalIdentity, action string) (*models.User, bool, bool) {
+	decision, err := ac.signupPolicyService.Evaluate(identity)
+	if err != nil {
+		utils.WriteInternalServerError(w, "Failed to evaluate sign-up policy", err)
+		return nil, false, false
+	}
+
+	if !decision.Allowed {
+		if ac.eventService != nil {
+			if err := ac.eventService.PublishSignupDenied(identity.Email, action, decision.Reason); err != nil {
+				fmt.Printf("Warning: Failed to publish auth failure event: %v\n", err)
+			}
+		}
+		utils.WriteForbidden(w, signupDeniedMessage(decision.Reason))
+		return nil, false, false
+	}
+
+	// Create new user
+	userData := &models.UserCreate{
+		Email:           identity.Email,
+		Name:            identity.Name,
+		Picture:         identity.Picture,
+		PendingApproval: decision.PendingApproval,
+	}
+	if identity.Provider == "google" {
+		userData.GoogleID = identity.Subject
+	}
+
+	user, err := ac.userService.CreateUserWithIdentity(userData, identity)
+	if err != nil {
+		// Log the actual error for debugging
+		fmt.Printf("Failed to create user: %v\n", err)
+		utils.WriteInternalServerError(w, "Failed to create user account", err)
+		return nil, false, false
+	}
+
+	if decision.Invitation != nil {
+		if err := ac.signupPolicyService.AcceptInvitation(decision.Invitation.ID, user.ID); err != nil {
+			fmt.Printf("Warning: Failed to accept invitation: %v\n", err)
+		}
+	}
+
+	// Assign default "user" role to new user
+	userRole, err := ac.roleService.GetRoleByName("user")
+	if err != nil {
+		fmt.Printf("Warning: Failed to get user role: %v\n", err)
+	} else {
+		err = ac.adminService.AssignRoleToUser(user.ID, userRole.ID, user.ID)
+		if err != nil {
+			fmt.Printf("Warning: Failed to assign user role: %v\n", err)
+		}
+	}
+
+	// Publish user created event
+	if ac.eventService != nil {
+		if err := ac.eventService.PublishSignupAllowed(user.ID, user.Email, user.Name, decision.Reason, decision.PendingApproval); err != nil {
+			fmt.Printf("Warning: Failed to publish user created event: %v\n", err)
+		}
+	}
+
+	return user, decision.PendingApproval, true
+}
+
+// writeSignupPending answers a sign-up that created an account still waiting for approval
+func writeSignupPending(w http.ResponseWriter, user *models.User) {
+	response := &models.SignupPendingResponse{
+		User:            user,
+		PendingApproval: true,
+	}
+	utils.WriteSuccess(w, http.StatusAccepted, response, "Account created and awaiting approval by an administrator")
+}
+
+// writeLoginSuccess finishes a login that passed the first factor. Users with MFA enabled
+// get a challenge to answer at /api/auth/mfa/verify instead of tokens.
+func (ac *AuthController) writeLoginSuccess(w http.ResponseWriter, r *http.Request, user *models.User, action string) {
+	enabled, err := ac.mfaService.IsEnabled(user.ID)
+	if err != nil {
+		utils.WriteInternalServerError(w, "Failed to check multi-factor authentication", err)
+		return
+	}
+
+	if enabled {
+		challenge, err := ac.mfaService.CreateChallenge(user.ID)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to start multi-factor authentication", err)
+			return
+		}
+		utils.WriteOK(w, challenge, "Multi-factor authentication required")
+		return
+	}
+
+	ac.completeLogin(w, r, user, false, action)
+}
+
+// completeLogin publishes a login event and issues a new token pair for the user.
+// action is the security event action of the login method, such as "google_login".
+func (ac *AuthController) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, mfa bool, action string) {
+	ac.publishLogin(r, user, action)
+
+	response, err := ac.newAuthResponse(r, user, mfa)
+	if err != nil {
+		utils.WriteInternalServerError(w, "Failed to generate authentication tokens", err)
+		return
+	}
+
+	if err := ac.useSessionCookies(w, r, response); err != nil {
+		utils.WriteInternalServerError(w, "Failed to set session cookies", err)
+		return
+	}
+
+	if !mfa {
+		// Let the client send users who must use MFA straight to enrollment
+		required, err := ac.mfaService.IsRequired(user.ID)
+		if err != nil {
+			fmt.Printf("Warning: Failed to check MFA policy: %v\n", err)
+		}
+		response.MFAEnrollmentRequired = required
+	}
+
+	utils.WriteOK(w, response, "Login successful")
+}
+
+// newAuthResponse generates a new access and refresh token pair for the user
+func (ac *AuthController) newAuthResponse(r *http.Request, user *models.User, mfa bool) (*models.AuthResponse, error) {
+	accessToken, refreshToken, err := ac.jwtService.GenerateTokens(user, mfa, sessionDevice(r))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthResponse{
+		User:         user,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(ac.jwtService.GetTokenExpiry().Seconds()),
+	}, nil
+}
+
+// useSessionCookies moves the tokens of a login response into HttpOnly cookies when cookie
+// sessions are enabled, leaving the frontend only the CSRF token to echo back
+func (ac *AuthController) useSessionCookies(w http.ResponseWriter, r *http.Request, response *models.AuthResponse) error {
+	if ac.sessionCookies == nil || !ac.sessionCookies.Enabled {
+		return nil
+	}
+
+	csrfToken, err := ac.sessionCookies.Set(w, r, response.AccessToken, ac.jwtService.GetTokenExpiry(), response.RefreshToken, ac.refreshTokenService.GetRefreshTokenExpiry())
+	if err != nil {
+		return err
+	}
+
+	response.AccessToken = ""
+	response.RefreshToken = ""
+	response.CSRFToken = csrfToken
+	return nil
+}
+
+// clearSessionCookies removes the cookies of a browser session on logout
+func (ac *AuthController) clearSessionCookies(w http.ResponseWriter, r *http.Request) {
+	if ac.sessionCookies != nil && ac.sessionCookies.Enabled {
+		ac.sessionCookies.Clear(w, r)
+	}
+}
+
+// writeInactiveUser refuses a login to an account that is deactivated or still waiting for approval
+func (ac *AuthController) writeInactiveUser(w http.ResponseWriter, r *http.Request, user *models.User, action string) {
+	pending, err := ac.userService.IsPendingApproval(user.ID)
+	if err != nil {
+		utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+		return
+	}
+
+	if pending {
+		ac.publishAuthFailure(r, "", action, services.SignupReasonPendingApproval)
+		utils.WriteForbidden(w, "Your account is awaiting approval by an administrator")
+		return
+	}
+
+	ac.publishAuthFailure(r, "", action, "account_inactive")
+	utils.WriteForbidden(w, "User account is not active")
+}
+
+// signupDeniedMessage explains a sign-up policy refusal to the user
+func signupDeniedMessage(reason string) string {
+	switch reason {
+	case services.SignupReasonEmailMissing:
+		return "Sign-up requires the identity provider to share your email address"
+	case services.SignupReasonEmailNotVerified:
+		return "Sign-up requires an email address verified by the identity provider"
+	case services.SignupReasonDomainNotAllowed:
+		return "Sign-up is not open to your email domain"
+	case services.SignupReasonInviteRequired:
+		return "Sign-up is by invitation only"
+	default:
+		return "Sign-up is not allowed"
+	}
+}
+
+// writeIdentityConflict answers a login with a new identity whose email already belongs to an account.
+// A verified email gets a link token the account owner can confirm; anything else is refused.
+func (ac *AuthController) writeIdentityConflict(w http.ResponseWriter, r *http.Request, existing *models.User, identity *models.ExternalIdentity, action string) {
+	if !services.CanConfirmLink(existing, identity) {
+		ac.publishAuthFailure(r, "", action, "email already registered to another account")
+		utils.WriteConflict(w, "An account with this email already exists", nil)
+		return
+	}
+
+	link, err := ac.identityLinkService.Create(existing.ID, identity)
+	if err != nil {
+		utils.WriteInternalServerError(w, "Failed to start account linking", err)
+		return
+	}
+
+	ac.publishAuthFailure(r, "", action, "identity link required")
+
+	response := utils.ErrorResponse("An account with this email already exists. Log in with your existing login method to link this one.", nil)
+	response.Data = &models.IdentityLinkRequired{
+		LinkToken: link.Token,
+		Provider:  link.Provider,
+		Email:     link.Email,
+		ExpiresAt: link.ExpiresAt,
+	}
+	utils.WriteJSON(w, http.StatusConflict, response)
+}
+
+// claimsFromRequest extracts and validates the bearer token of a request, rejecting revoked tokens.
+// Tokens delegated to OAuth clients are refused, so partner apps can not manage the account.
+func (ac *AuthController) claimsFromRequest(r *http.Request) (*services.Claims, error) {
+	claims, err := ac.bearerClaimsFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ClientID != "" {
+		return nil, errors.New("Token scope does not allow this request")
+	}
+
+	return claims, nil
+}
+
+// bearerClaimsFromRequest is claimsFromRequest that also accepts tokens delegated to OAuth clients.
+// The token is taken from the Authorization header or the session cookie.
+func (ac *AuthController) bearerClaimsFromRequest(r *http.Request) (*services.Claims, error) {
+	tokenString, ok := middleware.BearerToken(r)
+	if !ok {
+		if r.Header.Get("Authorization") != "" {
+			return nil, errors.New("Invalid authorization header format")
+		}
+		return nil, errors.New("Authorization header required")
+	}
+
+	claims, err := ac.jwtService.ValidateToken(tokenString)
+	if err != nil {
+		return nil, errors.New("Invalid token")
+	}
+
+	if ac.revocationService.IsRevoked(claims) {
+		return nil, errors.New("Token has been revoked")
+	}
+
+	return claims, nil
+}
+
+// completeProviderLogin verifies the OAuth state of a provider callback and exchanges the code for the user's identity.
+// It writes the error response itself and reports whether the caller can continue.
+func (ac *AuthController) completeProviderLogin(w http.ResponseWriter, r *http.Request, provider services.IdentityProvider, action string) (*models.ExternalIdentity, bool) {
+	var req models.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteBadRequest(w, "Invalid request body", err)
+		return nil, false
+	}
+
+	// Validate input
+	validationErrors := map[string]string{}
+	if req.Code == "" {
+		validationErrors["code"] = "Authorization code is required"
+	}
+	if req.State == "" {
+		validationErrors["state"] = "OAuth state is required"
+	}
+	if len(validationErrors) > 0 {
+		ac.publishAuthFailure(r, "", action, "missing code or state")
+		utils.WriteValidationError(w, validationErrors)
+		return nil, false
+	}
+
+	// Verify the state was issued to this browser for this provider and has not been used yet
+	var nonce string
+	if cookie, err := r.Cookie(oauthNonceCookie); err == nil {
+		nonce = cookie.Value
+	}
+	clearOAuthNonceCookie(w, r)
+
+	codeVerifier, err := ac.oauthStateService.Consume(req.State, nonce, provider.Name())
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidOAuthState) || errors.Is(err, services.ErrOAuthStateExpired) || errors.Is(err, services.ErrOAuthStateReplayed) {
+			ac.publishAuthFailure(r, "", action, err.Error())
+			utils.WriteBadRequest(w, "Invalid OAuth state", err)
+			return nil, false
+		}
+		utils.WriteInternalServerError(w, "Failed to verify OAuth state", err)
+		return nil, false
+	}
+
+	// Exchange the authorization code for the user's verified identity
+	identity, err := provider.Exchange(r.Context(), req.Code, codeVerifier)
+	if err != nil {
+		ac.publishAuthFailure(r, "", action, err.Error())
+		utils.WriteBadRequest(w, "Failed to authenticate with identity provider", err)
+		return nil, false
+	}
+
+	return identity, true
+}
+
+// clearOAuthNonceCookie removes the OAuth nonce cookie so a state cannot be retried from the same browser
+func clearOAuthNonceCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthNonceCookie,
+		Value:    "",
+		Path:     "/api/auth",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// isSecureRequest reports whether the request reached us over HTTPS, directly or through a proxy
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// publishLogin publishes the login events of a user and adds the login to the login history
+func (ac *AuthController) publishLogin(r *http.Request, user *models.User, action string) {
+	provider, _ := loginProvider(action)
+	ac.recordLoginEvent(r, &models.LoginEvent{
+		UserID:    &user.ID,
+		Email:     user.Email,
+		EventType: services.LoginEventLogin,
+		Success:   true,
+		Provider:  provider,
+	})
+
+	if ac.eventService == nil {
+		return
+	}
+
+	client := middleware.RequestClientInfo(r)
+	if err := ac.eventService.PublishUserLogin(user.ID, user.Email, user.Name, client); err != nil {
+		fmt.Printf("Warning: Failed to publish user login event: %v\n", err)
+	}
+	// The security service clears failed logins and compares the login with the user's history
+	if err := ac.eventService.PublishAuthSuccess(user.ID, user.Email, action, client); err != nil {
+		fmt.Printf("Warning: Failed to publish auth success event: %v\n", err)
+	}
+}
+
+// recordLoginEvent adds an entry with the client IP address and user agent of the request to the login history
+func (ac *AuthController) recordLoginEvent(r *http.Request, event *models.LoginEvent) {
+	if ac.loginHistoryService == nil {
+		return
+	}
+
+	event.IPAddress = middleware.ClientIP(r)
+	event.UserAgent = r.UserAgent()
+	if err := ac.loginHistoryService.Record(event); err != nil {
+		fmt.Printf("Warning: Failed to record login event: %v\n", err)
+	}
+}
+
+// loginProvider returns the login method of a security event action such as "google_login",
+// or false if the action is not a login
+func loginProvider(action string) (string, bool) {
+	if action == mfaVerifyAction {
+		return "mfa", true
+	}
+	return strings.CutSuffix(action, "_login")
+}
+
+// refuseLockedOut answers 429 and returns true when the account with the given email or the client
+// IP address is locked out. A locked account is refused even with the right secret, so guessing can
+// not go on. A failed check is logged and lets the login go on.
+func (ac *AuthController) refuseLockedOut(w http.ResponseWriter, r *http.Request, email string) bool {
+	lockedUntil, locked, err := ac.securityService.LockedUntil(email, middleware.ClientIP(r))
+	if err != nil {
+		fmt.Printf("Warning: Failed to check lockout: %v\n", err)
+		return false
+	}
+	if locked {
+		middleware.WriteLockedOut(w, lockedUntil)
+	}
+	return locked
+}
+
+// publishAuthFailure publishes an auth.failure security event for an unauthenticated request.
+// Failures count towards the lockout of the client IP address, and of the account if email is given.
+// Failed logins are also added to the login history.
+func (ac *AuthController) publishAuthFailure(r *http.Request, email, action, details string) {
+	if provider, ok := loginProvider(action); ok {
+		ac.recordLoginEvent(r, &models.LoginEvent{
+			Email:         email,
+			EventType:     services.LoginEventLogin,
+			Provider:      provider,
+			FailureReason: details,
+		})
+	}
+
+	if ac.eventService == nil {
+		return
+	}
+
+	if err := ac.eventService.PublishAuthFailure(0, email, action, details, middleware.RequestClientInfo(r)); err != nil {
+		fmt.Printf("Warning: Failed to publish auth failure event: %v\n", err)
+	}
+}
+
+// publishLogout publishes a user logout event and adds the logout to the login history
+func (ac *AuthController) publishLogout(r *http.Request, userID int) {
+	var userEmail, userName string
+	if user, err := ac.userService.GetUserByID(userID); err == nil && user != nil {
+		userEmail = user.Email
+		userName = user.Name
+	}
+
+	ac.recordLoginEvent(r, &models.LoginEvent{
+		UserID:    &userID,
+		Email:     userEmail,
+		EventType: services.LoginEventLogout,
+		Success:   true,
+	})
+
+	if ac.eventService == nil {
+		return
+	}
+
+	if err := ac.eventService.PublishUserLogout(userID, userEmail, userName, middleware.RequestClientInfo(r)); err != nil {
+		fmt.Printf("Warning: Failed to publish user logout event: %v\n", err)
+	}
+}
+
+// publishTokenRefresh publishes an auth.token_refresh security event and adds the refresh to the login history
+func (ac *AuthController) publishTokenRefresh(r *http.Request, userID int, email, action string, success bool, details string) {
+	if email == "" {
+		if user, err := ac.userService.GetUserByID(userID); err == nil && user != nil {
+			email = user.Email
+		}
+	}
+
+	event := &models.LoginEvent{
+		Email:     email,
+		EventType: services.LoginEventRefresh,
+		Success:   success,
+	}
+	if userID != 0 {
+		event.UserID = &userID
+	}
+	if !success {
+		event.FailureReason = details
+	}
+	ac.recordLoginEvent(r, event)
+
+	if ac.eventService == nil {
+		return
+	}
+
+	if err := ac.eventService.PublishTokenRefresh(userID, email, action, success, details, middleware.RequestClientInfo(r)); err != nil {
+		fmt.Printf("Warning: Failed to publish token refresh event: %v\n", err)
+	}
+}
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/frallan97/hackaton-demo-backend/middleware"
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/services"
+	"github.com/frallan97/hackaton-demo-backend/utils"
+)
+
+// deviceLoginAction is the security event action of logins approved for a device
+const deviceLoginAction = "device_login"
+
+// DeviceCodeHandler starts a device login (RFC 8628 section 3.1)
+// @Summary     Device authorization request
+// @Description Start a login for a device that cannot open a browser, such as a CLI or editor plugin. Show the user_code and verification_uri to the user, then poll /api/auth/device/token. Accepts form or query parameters and answers in OAuth format.
+// @Tags        device
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       client_id  formData  string  true  "Name of the client, shown to the user when approving"
+// @Success     200   {object}  models.DeviceAuthorization
+// @Failure     400   {object}  models.OAuthError
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     429   {object}  models.OAuthError
+// @Router      /api/auth/device/code [post]
+func (ac *AuthController) DeviceCodeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed request body")
+			return
+		}
+
+		authorization, err := ac.deviceAuthService.StartAuthorization(r.FormValue("client_id"), middleware.ClientIP(r))
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrInvalidDeviceClient):
+				writeOAuthError(w, http.StatusBadRequest, "invalid_client", err.Error())
+			case errors.Is(err, services.ErrTooManyDeviceCodes):
+				writeOAuthError(w, http.StatusTooManyRequests, "slow_down", "Too many pending device logins, finish or let one expire first")
+			default:
+				utils.WriteInternalServerError(w, "Failed to start device login", err)
+			}
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		utils.WriteJSON(w, http.StatusOK, authorization)
+	}
+}
+
+// DeviceTokenHandler exchanges an approved device code for tokens (RFC 8628 section 3.4)
+// @Summary     Device access token request
+// @Description Poll with the device code until the user approved the login. Answers authorization_pending while waiting and slow_down when polled faster than the interval. Tokens can be fetched once per device code and are refreshed with /api/auth/refresh.
+// @Tags        device
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       grant_type   formData  string  true  "urn:ietf:params:oauth:grant-type:device_code"
+// @Param       device_code  formData  string  true  "Device code from /api/auth/device/code"
+// @Param       client_id    formData  string  true  "Client ID used to start the login"
+// @Success     200   {object}  models.AuthResponse
+// @Failure     400   {object}  models.OAuthError
+// @Failure     405   {object}  utils.APIResponse
+// @Router      /api/auth/device/token [post]
+func (ac *AuthController) DeviceTokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed request body")
+			return
+		}
+
+		if r.FormValue("grant_type") != services.DeviceCodeGrantType {
+			writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be "+services.DeviceCodeGrantType)
+			return
+		}
+		if r.FormValue("device_code") == "" {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "device_code is required")
+			return
+		}
+
+		grant, err := ac.deviceAuthService.Poll(r.FormValue("device_code"), r.FormValue("client_id"))
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrAuthorizationPending):
+				writeOAuthError(w, http.StatusBadRequest, err.Error(), "The user has not approved the login yet")
+			case errors.Is(err, services.ErrSlowDown):
+				writeOAuthError(w, http.StatusBadRequest, err.Error(), "Polling too fast, wait five seconds longer between requests")
+			case errors.Is(err, services.ErrDeviceAccessDenied):
+				writeOAuthError(w, http.StatusBadRequest, err.Error(), "The user denied the login")
+			case errors.Is(err, services.ErrDeviceCodeExpired):
+				writeOAuthError(w, http.StatusBadRequest, err.Error(), "The device code has expired, start a new login")
+			case errors.Is(err, services.ErrInvalidDeviceCode):
+				writeOAuthError(w, http.StatusBadRequest, err.Error(), "Invalid or already used device code")
+			default:
+				utils.WriteInternalServerError(w, "Failed to check device login", err)
+			}
+			return
+		}
+
+		user, err := ac.userService.GetUserByID(grant.UserID)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+			return
+		}
+		if user == nil {
+			writeOAuthError(w, http.StatusBadRequest, "access_denied", "Account is not active")
+			return
+		}
+
+		response, err := ac.newAuthResponse(r, user, grant.MFA)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to generate authentication tokens", err)
+			return
+		}
+
+		ac.publishLogin(r, user, deviceLoginAction)
+
+		w.Header().Set("Cache-Control", "no-store")
+		utils.WriteJSON(w, http.StatusOK, response)
+	}
+}
+
+// DeviceLoginHandler shows or decides a pending device login for the current user
+// @Summary     Approve device login
+// @Description GET returns the pending device login for the user_code query parameter, so the user can check which client asks. POST approves or denies it; an approved device gets a session with the MFA state of the current one.
+// @Tags        device
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       user_code  query  string                        false  "User code shown by the device (GET only)"
+// @Param       approval   body   models.DeviceApprovalRequest  false  "User code and decision (POST only)"
+// @Success     200   {object}  utils.APIResponse{data=models.DeviceLogin}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     404   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/device [get]
+// @Router      /api/auth/device [post]
+func (ac *AuthController) DeviceLoginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "GET, POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			login, err := ac.deviceAuthService.GetPendingLogin(r.URL.Query().Get("user_code"))
+			if err != nil {
+				if errors.Is(err, services.ErrUserCodeNotFound) {
+					utils.WriteNotFound(w, "Invalid or expired code")
+					return
+				}
+				utils.WriteInternalServerError(w, "Failed to retrieve device login", err)
+				return
+			}
+			utils.WriteOK(w, login, "Device login retrieved successfully")
+
+		case http.MethodPost:
+			var req models.DeviceApprovalRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				utils.WriteBadRequest(w, "Invalid request body", err)
+				return
+			}
+
+			if req.UserCode == "" {
+				utils.WriteValidationError(w, map[string]string{
+					"user_code": "User code is required",
+				})
+				return
+			}
+
+			if err := ac.deviceAuthService.Decide(req.UserCode, claims.UserID, claims.MFA, req.Approve); err != nil {
+				if errors.Is(err, services.ErrUserCodeNotFound) {
+					utils.WriteNotFound(w, "Invalid or expired code")
+					return
+				}
+				utils.WriteInternalServerError(w, "Failed to update device login", err)
+				return
+			}
+
+			if req.Approve {
+				utils.WriteOK(w, nil, "Device login approved. You can return to your device.")
+			} else {
+				utils.WriteOK(w, nil, "Device login denied")
+			}
+		}
+	}
+}
+
+// writeOAuthError writes an error response in the format of RFC 6749 section 5.2
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteJSON(w, status, &models.OAuthError{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/middleware"
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/utils"
+)
+
+// impersonationTTL is how long an admin can act as a user before having to start again
+const impersonationTTL = 15 * time.Minute
+
+// ImpersonateHandler lets an admin act as another user
+// @Summary     Impersonate a user
+// @Description Issue a short-lived access token for the given user that names the admin in its act claim (Admin only). The token can not be refreshed and never carries the admin role. Every request made with it is logged and recorded as an admin action, and billing, role changes, credential management and other sensitive endpoints refuse it. End it with /api/auth/impersonation/stop.
+// @Tags        admin
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       request  body  models.ImpersonationRequest  true  "User to impersonate and the reason"
+// @Success     200   {object}  utils.APIResponse{data=models.ImpersonationResponse}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     404   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/admin/impersonate [post]
+func (ac *AuthController) ImpersonateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			utils.WriteUnauthorized(w, "Unauthorized")
+			return
+		}
+
+		var req models.ImpersonationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteBadRequest(w, "Invalid request body", err)
+			return
+		}
+
+		if req.UserID == adminUserID {
+			utils.WriteBadRequest(w, "You can not impersonate yourself", nil)
+			return
+		}
+
+		admin, err := ac.userService.GetUserByID(adminUserID)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+			return
+		}
+		if admin == nil {
+			utils.WriteUnauthorized(w, "Unauthorized")
+			return
+		}
+
+		user, err := ac.userService.GetUserByID(req.UserID)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+			return
+		}
+		if user == nil {
+			utils.WriteNotFound(w, "User not found")
+			return
+		}
+
+		accessToken, _, err := ac.jwtService.GenerateImpersonationToken(user, admin, impersonationTTL)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to generate impersonation token", err)
+			return
+		}
+
+		details := fmt.Sprintf("Started impersonating %s (%d)", user.Email, user.ID)
+		if reason := strings.TrimSpace(req.Reason); reason != "" {
+			details += ": " + reason
+		}
+		ac.publishAdminAction(adminUserID, "impersonation_started", details)
+
+		user.ImpersonatedBy = admin.Email
+		response := &models.ImpersonationResponse{
+			User:        user,
+			AccessToken: accessToken,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(impersonationTTL.Seconds()),
+		}
+
+		utils.WriteOK(w, response, "Impersonation started")
+	}
+}
+
+// StopImpersonationHandler ends an impersonation by revoking its token
+// @Summary     Stop impersonating
+// @Description Revoke the impersonation token the request is made with. The admin continues with their own tokens.
+// @Tags        auth
+// @Produce     json
+// @Security    BearerAuth
+// @Success     200   {object}  utils.APIResponse{data=LogoutResponse}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/impersonation/stop [post]
+func (ac *AuthController) StopImpersonationHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		if !claims.IsImpersonation() {
+			utils.WriteBadRequest(w, "The current token is not an impersonation token", nil)
+			return
+		}
+
+		if err := ac.revocationService.RevokeToken(claims, "impersonation_stopped"); err != nil {
+			utils.WriteInternalServerError(w, "Failed to revoke impersonation token", err)
+			return
+		}
+
+		ac.publishAdminAction(claims.Actor.UserID, "impersonation_stopped", fmt.Sprintf("Stopped impersonating %s (%d)", claims.Email, claims.UserID))
+
+		response := &LogoutResponse{
+			Message: "Stopped impersonating",
+		}
+
+		utils.WriteOK(w, response, "Impersonation stopped")
+	}
+}
@@ -0,0 +1,441 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/services"
+	"github.com/frallan97/hackaton-demo-backend/utils"
+)
+
+// localLoginAction is the security event action of email/password logins
+const localLoginAction = services.LocalProvider + "_login"
+
+// RegisterHandler starts an email/password sign-up
+// @Summary     Register with email and password
+// @Description Start an email/password sign-up. A confirmation link is emailed to the address; the account is only created once it is confirmed through /api/auth/local/verify-email. The response is the same whether or not the address is already registered.
+// @Tags        auth
+// @Accept      json
+// @Produce     json
+// @Param       register  body   models.RegisterInput  true  "Email, password and name"
+// @Success     202   {object}  utils.APIResponse
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/local/register [post]
+func (ac *AuthController) RegisterHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		var req models.RegisterInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteBadRequest(w, "Invalid request body", err)
+			return
+		}
+
+		// Validate input
+		validationErrors := map[string]string{}
+		if !strings.Contains(req.Email, "@") {
+			validationErrors["email"] = "A valid email is required"
+		}
+		if err := services.ValidatePassword(req.Password); err != nil {
+			validationErrors["password"] = err.Error()
+		}
+		if len(validationErrors) > 0 {
+			utils.WriteValidationError(w, validationErrors)
+			return
+		}
+
+		if err := ac.localAuthService.Register(req.Email, strings.TrimSpace(req.Name), req.Password); err != nil {
+			utils.WriteInternalServerError(w, "Failed to start registration", err)
+			return
+		}
+
+		utils.WriteSuccess(w, http.StatusAccepted, nil, "Check your email to confirm your address")
+	}
+}
+
+// VerifyEmailHandler finishes an email/password sign-up
+// @Summary     Confirm email address
+// @Description Finish an email/password sign-up with the token from the confirmation email. The sign-up policy applies as for any other first login. If the address already has an account, the password is added to it.
+// @Tags        auth
+// @Accept      json
+// @Produce     json
+// @Param       token  body   models.EmailTokenInput  true  "Verification token"
+// @Success     200   {object}  utils.APIResponse{data=models.AuthResponse}
+// @Success     202   {object}  utils.APIResponse{data=models.SignupPendingResponse}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     403   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/local/verify-email [post]
+func (ac *AuthController) VerifyEmailHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		var req models.EmailTokenInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteBadRequest(w, "Invalid request body", err)
+			return
+		}
+
+		if req.Token == "" {
+			utils.WriteValidationError(w, map[string]string{
+				"token": "Verification token is required",
+			})
+			return
+		}
+
+		registration, err := ac.localAuthService.VerifyRegistration(req.Token)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidEmailToken) {
+				ac.publishAuthFailure(r, "", localLoginAction, err.Error())
+				utils.WriteBadRequest(w, "Invalid or expired verification link", err)
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to verify email", err)
+			return
+		}
+		identity := registration.Identity
+
+		// The address may have been registered through another provider since the link was sent.
+		// Whoever confirmed the link controls the address, just like with a password reset.
+		user, err := ac.userService.GetUserByEmail(identity.Email)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+			return
+		}
+
+		if user == nil {
+			user, pending, ok := ac.signUp(w, identity, localLoginAction)
+			if !ok {
+				return
+			}
+			if err := ac.localAuthService.SetPassword(user.ID, identity.Email, registration.PasswordHash); err != nil {
+				utils.WriteInternalServerError(w, "Failed to store password", err)
+				return
+			}
+			if pending {
+				writeSignupPending(w, user)
+				return
+			}
+			ac.writeLoginSuccess(w, r, user, localLoginAction)
+			return
+		}
+
+		if err := ac.localAuthService.SetPassword(user.ID, identity.Email, registration.PasswordHash); err != nil {
+			if errors.Is(err, services.ErrIdentityInUse) {
+				utils.WriteConflict(w, "This email is already used to log in to another account", nil)
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to store password", err)
+			return
+		}
+
+		if !user.IsActive {
+			ac.writeInactiveUser(w, r, user, localLoginAction)
+			return
+		}
+
+		ac.writeLoginSuccess(w, r, user, localLoginAction)
+	}
+}
+
+// LocalLoginHandler handles email/password login
+// @Summary     Login with email and password
+// @Description Authenticate with an email address and password. Issues the same tokens as the provider logins, or a models.MFAChallenge for users with MFA enabled.
+// @Tags        auth
+// @Accept      json
+// @Produce     json
+// @Param       login  body   models.LoginInput  true  "Email and password"
+// @Success     200   {object}  utils.APIResponse{data=models.AuthResponse}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     403   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/local/login [post]
+func (ac *AuthController) LocalLoginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		var req models.LoginInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteBadRequest(w, "Invalid request body", err)
+			return
+		}
+
+		// Validate input
+		validationErrors := map[string]string{}
+		if req.Email == "" {
+			validationErrors["email"] = "Email is required"
+		}
+		if req.Password == "" {
+			validationErrors["password"] = "Password is required"
+		}
+		if len(validationErrors) > 0 {
+			ac.publishAuthFailure(r, "", localLoginAction, "missing email or password")
+			utils.WriteValidationError(w, validationErrors)
+			return
+		}
+
+		if ac.refuseLockedOut(w, r, req.Email) {
+			return
+		}
+
+		user, err := ac.localAuthService.Authenticate(req.Email, req.Password)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidCredentials) {
+				ac.publishAuthFailure(r, req.Email, localLoginAction, err.Error())
+				utils.WriteUnauthorized(w, "Invalid email or password")
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to authenticate", err)
+			return
+		}
+
+		if !user.IsActive {
+			ac.writeInactiveUser(w, r, user, localLoginAction)
+			return
+		}
+
+		// Update last login time
+		if err := ac.userService.UpdateUserLastLogin(user.ID); err != nil {
+			// Log error but don't fail the login
+			fmt.Printf("failed to update last login: %v\n", err)
+		}
+
+		if err := ac.userService.UpdateIdentityLogin(services.LocalIdentity(req.Email, "")); err != nil {
+			// Log error but don't fail the login
+			fmt.Printf("failed to update identity login: %v\n", err)
+		}
+
+		ac.writeLoginSuccess(w, r, user, localLoginAction)
+	}
+}
+
+// ForgotPasswordHandler emails a password reset link
+// @Summary     Forgot password
+// @Description Email a password reset link to an active account. The response is the same whether or not the address is registered. Accounts that only use external logins can use this to add a password.
+// @Tags        auth
+// @Accept      json
+// @Produce     json
+// @Param       email  body   models.ForgotPasswordInput  true  "Email address"
+// @Success     202   {object}  utils.APIResponse
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Router      /api/auth/local/forgot-password [post]
+func (ac *AuthController) ForgotPasswordHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		var req models.ForgotPasswordInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteBadRequest(w, "Invalid request body", err)
+			return
+		}
+
+		if !strings.Contains(req.Email, "@") {
+			utils.WriteValidationError(w, map[string]string{
+				"email": "A valid email is required",
+			})
+			return
+		}
+
+		// Failures are only logged, an error response would reveal that the address is registered
+		if err := ac.localAuthService.RequestPasswordReset(req.Email); err != nil {
+			fmt.Printf("Warning: Failed to send password reset email: %v\n", err)
+		}
+
+		utils.WriteSuccess(w, http.StatusAccepted, nil, "If the address belongs to an account, a reset link has been sent")
+	}
+}
+
+// ResetPasswordHandler sets a new password with a reset token
+// @Summary     Reset password
+// @Description Set a new password with the token from a reset email. Signs the user out everywhere.
+// @Tags        auth
+// @Accept      json
+// @Produce     json
+// @Param       reset  body   models.ResetPasswordInput  true  "Reset token and new password"
+// @Success     200   {object}  utils.APIResponse
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/local/reset-password [post]
+func (ac *AuthController) ResetPasswordHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		var req models.ResetPasswordInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteBadRequest(w, "Invalid request body", err)
+			return
+		}
+
+		// Validate before the token is used up
+		validationErrors := map[string]string{}
+		if req.Token == "" {
+			validationErrors["token"] = "Reset token is required"
+		}
+		if err := services.ValidatePassword(req.Password); err != nil {
+			validationErrors["password"] = err.Error()
+		}
+		if len(validationErrors) > 0 {
+			utils.WriteValidationError(w, validationErrors)
+			return
+		}
+
+		userID, err := ac.localAuthService.ResetPassword(req.Token, req.Password)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidEmailToken) {
+				ac.publishAuthFailure(r, "", "password_reset", err.Error())
+				utils.WriteBadRequest(w, "Invalid or expired reset link", err)
+				return
+			}
+			if errors.Is(err, services.ErrIdentityInUse) {
+				utils.WriteConflict(w, "This email is already used to log in to another account", nil)
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to reset password", err)
+			return
+		}
+
+		// Whoever knew the old password must not stay logged in
+		if err := ac.revokeCredentials(userID, "password_reset"); err != nil {
+			utils.WriteInternalServerError(w, "Failed to revoke sessions", err)
+			return
+		}
+
+		ac.publishPasswordChanged(userID, "reset")
+
+		utils.WriteOK(w, nil, "Password reset successfully, please log in")
+	}
+}
+
+// ChangePasswordHandler changes the password of the current user
+// @Summary     Change password
+// @Description Change the password of the current user. Every other session is signed out and a new token pair is returned.
+// @Tags        auth
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       change  body   models.ChangePasswordInput  true  "Current and new password"
+// @Success     200   {object}  utils.APIResponse{data=models.AuthResponse}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     409   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/local/change-password [post]
+func (ac *AuthController) ChangePasswordHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		var req models.ChangePasswordInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteBadRequest(w, "Invalid request body", err)
+			return
+		}
+
+		// Validate input
+		validationErrors := map[string]string{}
+		if req.CurrentPassword == "" {
+			validationErrors["current_password"] = "Current password is required"
+		}
+		if err := services.ValidatePassword(req.NewPassword); err != nil {
+			validationErrors["new_password"] = err.Error()
+		}
+		if len(validationErrors) > 0 {
+			utils.WriteValidationError(w, validationErrors)
+			return
+		}
+
+		if err := ac.localAuthService.ChangePassword(claims.UserID, req.CurrentPassword, req.NewPassword); err != nil {
+			if errors.Is(err, services.ErrInvalidCredentials) {
+				ac.publishAuthFailure(r, claims.Email, "password_change", "wrong current password")
+				utils.WriteValidationError(w, map[string]string{
+					"current_password": "Current password is incorrect",
+				})
+				return
+			}
+			if errors.Is(err, services.ErrNoPassword) {
+				utils.WriteConflict(w, "This account has no password yet, use the password reset to set one", nil)
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to change password", err)
+			return
+		}
+
+		if err := ac.revokeCredentials(claims.UserID, "password_changed"); err != nil {
+			utils.WriteInternalServerError(w, "Failed to revoke sessions", err)
+			return
+		}
+
+		ac.publishPasswordChanged(claims.UserID, "change")
+
+		// The current session was revoked with the others, so hand out a fresh one
+		user, err := ac.userService.GetUserByID(claims.UserID)
+		if err != nil || user == nil {
+			utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+			return
+		}
+
+		response, err := ac.newAuthResponse(r, user, claims.MFA)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to generate authentication tokens", err)
+			return
+		}
+
+		if err := ac.useSessionCookies(w, r, response); err != nil {
+			utils.WriteInternalServerError(w, "Failed to set session cookies", err)
+			return
+		}
+
+		utils.WriteOK(w, response, "Password changed successfully")
+	}
+}
+
+// publishPasswordChanged publishes a user.password_changed event
+func (ac *AuthController) publishPasswordChanged(userID int, action string) {
+	if ac.eventService == nil {
+		return
+	}
+
+	var email string
+	if user, err := ac.userService.GetUserByID(userID); err == nil && user != nil {
+		email = user.Email
+	}
+
+	if err := ac.eventService.PublishPasswordChanged(userID, email, action); err != nil {
+		fmt.Printf("Warning: Failed to publish password changed event: %v\n", err)
+	}
+}
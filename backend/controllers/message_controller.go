@@ -1,23 +1,29 @@
 package controllers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/frallan97/hackaton-demo-backend/database"
+	"github.com/frallan97/hackaton-demo-backend/middleware"
 	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/services"
 	"github.com/frallan97/hackaton-demo-backend/utils"
 )
 
 // MessageController handles message-related endpoints
 type MessageController struct {
-	dbManager *database.DBManager
+	dbManager     *database.DBManager
+	policyService *services.PolicyService
 }
 
 // NewMessageController creates a new message controller
-func NewMessageController(dbManager *database.DBManager) *MessageController {
+func NewMessageController(dbManager *database.DBManager, policyService *services.PolicyService) *MessageController {
 	return &MessageController{
-		dbManager: dbManager,
+		dbManager:     dbManager,
+		policyService: policyService,
 	}
 }
 
@@ -26,7 +32,7 @@ type CreateMessageResponse struct {
 	ID int `json:"id"`
 }
 
-// MessagesHandler lists or creates messages
+// MessagesHandler lists, creates or deletes messages
 // @Summary     List messages
 // @Description Get all messages
 // @Tags        messages
@@ -37,7 +43,7 @@ type CreateMessageResponse struct {
 // @Router      /api/messages [get]
 //
 // @Summary     Create message
-// @Description Insert a new message
+// @Description Insert a new message. Messages posted while signed in are owned by the user.
 // @Tags        messages
 // @Accept      json
 // @Produce     json
@@ -46,6 +52,18 @@ type CreateMessageResponse struct {
 // @Failure     400   {object}  utils.APIResponse
 // @Failure     500   {object}  utils.APIResponse
 // @Router      /api/messages [post]
+//
+// @Summary     Delete message
+// @Description Delete the message given by the id query parameter, if the access policies allow it. By default users may delete their own messages and admins any message.
+// @Tags        messages
+// @Produce     json
+// @Security    BearerAuth
+// @Param       id   query  int  true  "Message ID"
+// @Success     200  {object}  utils.APIResponse
+// @Failure     401  {object}  utils.APIResponse
+// @Failure     403  {object}  utils.APIResponse
+// @Failure     404  {object}  utils.APIResponse
+// @Router      /api/messages [delete]
 func (mc *MessageController) MessagesHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !mc.dbManager.IsConnected() {
@@ -58,15 +76,17 @@ func (mc *MessageController) MessagesHandler() http.HandlerFunc {
 			mc.handleGetMessages(w, r)
 		case http.MethodPost:
 			mc.handleCreateMessage(w, r)
+		case http.MethodDelete:
+			mc.handleDeleteMessage(w, r)
 		default:
-			utils.WriteMethodNotAllowed(w, "GET, POST")
+			utils.WriteMethodNotAllowed(w, "GET, POST, DELETE")
 		}
 	}
 }
 
 // handleGetMessages handles GET requests to retrieve all messages
 func (mc *MessageController) handleGetMessages(w http.ResponseWriter, r *http.Request) {
-	rows, err := mc.dbManager.DB.Query(`SELECT id, content, created_at FROM messages ORDER BY id`)
+	rows, err := mc.dbManager.DB.Query(`SELECT id, content, user_id, created_at FROM messages ORDER BY id`)
 	if err != nil {
 		utils.WriteInternalServerError(w, "Failed to query messages", err)
 		return
@@ -76,10 +96,15 @@ func (mc *MessageController) handleGetMessages(w http.ResponseWriter, r *http.Re
 	var msgs []models.Message
 	for rows.Next() {
 		var m models.Message
-		if err := rows.Scan(&m.ID, &m.Content, &m.CreatedAt); err != nil {
+		var userID sql.NullInt64
+		if err := rows.Scan(&m.ID, &m.Content, &userID, &m.CreatedAt); err != nil {
 			utils.WriteInternalServerError(w, "Failed to scan message data", err)
 			return
 		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			m.UserID = &id
+		}
 		msgs = append(msgs, m)
 	}
 
@@ -102,9 +127,15 @@ func (mc *MessageController) handleCreateMessage(w http.ResponseWriter, r *http.
 		return
 	}
 
+	// Anonymous messages have no owner
+	var ownerID *int
+	if userID, ok := middleware.GetUserIDFromContext(r.Context()); ok {
+		ownerID = &userID
+	}
+
 	var id int
 	err := mc.dbManager.DB.QueryRow(
-		`INSERT INTO messages(content) VALUES($1) RETURNING id`, in.Content,
+		`INSERT INTO messages(content, user_id) VALUES($1, $2) RETURNING id`, in.Content, ownerID,
 	).Scan(&id)
 	if err != nil {
 		utils.WriteInternalServerError(w, "Failed to create message", err)
@@ -114,3 +145,50 @@ func (mc *MessageController) handleCreateMessage(w http.ResponseWriter, r *http.
 	response := &CreateMessageResponse{ID: id}
 	utils.WriteCreated(w, response, "Message created successfully")
 }
+
+// handleDeleteMessage handles DELETE requests, allowed to the users the access policies let delete the message
+func (mc *MessageController) handleDeleteMessage(w http.ResponseWriter, r *http.Request) {
+	authz, ok := middleware.AuthorizationFromContext(r.Context())
+	if !ok {
+		utils.WriteUnauthorized(w, "Authentication required")
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.WriteBadRequest(w, "Invalid message ID", err)
+		return
+	}
+
+	var ownerID sql.NullInt64
+	err = mc.dbManager.DB.QueryRow(`SELECT user_id FROM messages WHERE id = $1`, id).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		utils.WriteNotFound(w, "Message not found")
+		return
+	} else if err != nil {
+		utils.WriteInternalServerError(w, "Failed to query message", err)
+		return
+	}
+
+	resource := map[string]interface{}{"type": "message", "id": id}
+	if ownerID.Valid {
+		resource["owner_id"] = int(ownerID.Int64)
+	}
+
+	decision, err := mc.policyService.Authorize(authz, services.PolicyActionMessageDelete, resource)
+	if err != nil {
+		utils.WriteInternalServerError(w, "Failed to evaluate access policies", err)
+		return
+	}
+	if !decision.Allowed {
+		utils.WriteForbidden(w, "Forbidden: "+decision.Reason)
+		return
+	}
+
+	if _, err := mc.dbManager.DB.Exec(`DELETE FROM messages WHERE id = $1`, id); err != nil {
+		utils.WriteInternalServerError(w, "Failed to delete message", err)
+		return
+	}
+
+	utils.WriteOK(w, nil, "Message deleted successfully")
+}
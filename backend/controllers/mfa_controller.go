@@ -0,0 +1,398 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/services"
+	"github.com/frallan97/hackaton-demo-backend/utils"
+)
+
+// mfaVerifyAction is the security event action of logins completed with a second factor
+const mfaVerifyAction = "mfa_verify"
+
+// MFAStatusHandler returns the MFA state of the current user
+// @Summary     MFA status
+// @Description Whether the current user has MFA enabled, whether their roles require it, and how many recovery codes are left
+// @Tags        mfa
+// @Produce     json
+// @Security    BearerAuth
+// @Success     200   {object}  utils.APIResponse{data=models.MFAStatus}
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/mfa [get]
+func (ac *AuthController) MFAStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.WriteMethodNotAllowed(w, "GET")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		status, err := ac.mfaService.GetStatus(claims.UserID)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to retrieve MFA status", err)
+			return
+		}
+
+		utils.WriteOK(w, status, "MFA status retrieved successfully")
+	}
+}
+
+// MFAEnrollHandler starts TOTP enrollment for the current user
+// @Summary     Start MFA enrollment
+// @Description Create a TOTP secret and the otpauth:// provisioning URI to show as a QR code. MFA is turned on once a code is confirmed at /api/auth/mfa/confirm.
+// @Tags        mfa
+// @Produce     json
+// @Security    BearerAuth
+// @Success     200   {object}  utils.APIResponse{data=models.MFAEnrollment}
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     409   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/mfa/enroll [post]
+func (ac *AuthController) MFAEnrollHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		enrollment, err := ac.mfaService.BeginEnrollment(claims.UserID, claims.Email)
+		if err != nil {
+			if errors.Is(err, services.ErrMFAAlreadyEnabled) {
+				utils.WriteConflict(w, "Multi-factor authentication is already enabled", nil)
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to start MFA enrollment", err)
+			return
+		}
+
+		utils.WriteOK(w, enrollment, "Scan the QR code with your authenticator app and confirm a code")
+	}
+}
+
+// MFAConfirmHandler turns MFA on for the current user
+// @Summary     Confirm MFA enrollment
+// @Description Turn MFA on with a code from the authenticator app. Returns recovery codes, which are only shown once, and a new token pair carrying the mfa claim. Other sessions are signed out.
+// @Tags        mfa
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       code  body   models.MFACodeInput  true  "TOTP code"
+// @Success     200   {object}  utils.APIResponse{data=models.MFAEnabledResponse}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     409   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/mfa/confirm [post]
+func (ac *AuthController) MFAConfirmHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		req, ok := decodeMFACode(w, r)
+		if !ok {
+			return
+		}
+
+		recoveryCodes, err := ac.mfaService.ConfirmEnrollment(claims.UserID, req.Code)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrInvalidMFACode):
+				writeInvalidMFACode(w)
+			case errors.Is(err, services.ErrMFANotEnabled):
+				utils.WriteConflict(w, "Start an enrollment first", nil)
+			case errors.Is(err, services.ErrMFAAlreadyEnabled):
+				utils.WriteConflict(w, "Multi-factor authentication is already enabled", nil)
+			default:
+				utils.WriteInternalServerError(w, "Failed to enable MFA", err)
+			}
+			return
+		}
+
+		// Sessions started without the second factor must not outlive its introduction
+		if err := ac.revocationService.RevokeAllForUser(claims.UserID, "mfa_enabled"); err != nil {
+			utils.WriteInternalServerError(w, "Failed to revoke sessions", err)
+			return
+		}
+
+		ac.publishMFAChanged(claims.UserID, claims.Email, true)
+
+		user, err := ac.userService.GetUserByID(claims.UserID)
+		if err != nil || user == nil {
+			utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+			return
+		}
+
+		auth, err := ac.newAuthResponse(r, user, true)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to generate authentication tokens", err)
+			return
+		}
+
+		if err := ac.useSessionCookies(w, r, auth); err != nil {
+			utils.WriteInternalServerError(w, "Failed to set session cookies", err)
+			return
+		}
+
+		response := &models.MFAEnabledResponse{
+			RecoveryCodes: recoveryCodes,
+			Auth:          auth,
+		}
+
+		utils.WriteOK(w, response, "Multi-factor authentication enabled")
+	}
+}
+
+// MFAVerifyHandler completes a login that needs a second factor
+// @Summary     Verify MFA code
+// @Description Answer the MFA challenge returned by a login with a TOTP or recovery code. Issues tokens carrying the mfa claim.
+// @Tags        mfa
+// @Accept      json
+// @Produce     json
+// @Param       verify  body   models.MFAVerifyInput  true  "Challenge token and code"
+// @Success     200   {object}  utils.APIResponse{data=models.AuthResponse}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/mfa/verify [post]
+func (ac *AuthController) MFAVerifyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		var req models.MFAVerifyInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteBadRequest(w, "Invalid request body", err)
+			return
+		}
+
+		// Validate input
+		validationErrors := map[string]string{}
+		if req.MFAToken == "" {
+			validationErrors["mfa_token"] = "MFA token is required"
+		}
+		if req.Code == "" {
+			validationErrors["code"] = "Code is required"
+		}
+		if len(validationErrors) > 0 {
+			utils.WriteValidationError(w, validationErrors)
+			return
+		}
+
+		// Wrong codes count against the challenged account, which is refused while locked out
+		email, err := ac.mfaService.ChallengeEmail(req.MFAToken)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidMFAChallenge) {
+				ac.publishAuthFailure(r, "", mfaVerifyAction, err.Error())
+				utils.WriteUnauthorized(w, err.Error())
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to verify code", err)
+			return
+		}
+
+		if ac.refuseLockedOut(w, r, email) {
+			return
+		}
+
+		userID, err := ac.mfaService.CompleteChallenge(req.MFAToken, req.Code)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidMFACode) || errors.Is(err, services.ErrInvalidMFAChallenge) {
+				ac.publishAuthFailure(r, email, mfaVerifyAction, err.Error())
+				utils.WriteUnauthorized(w, err.Error())
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to verify code", err)
+			return
+		}
+
+		user, err := ac.userService.GetUserByID(userID)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+			return
+		}
+
+		if user == nil {
+			ac.publishAuthFailure(r, "", mfaVerifyAction, "account_inactive")
+			utils.WriteUnauthorized(w, "User account is not active")
+			return
+		}
+
+		ac.completeLogin(w, r, user, true, mfaVerifyAction)
+	}
+}
+
+// MFADisableHandler turns MFA off for the current user
+// @Summary     Disable MFA
+// @Description Turn MFA off after confirming a TOTP or recovery code. Not allowed for users whose roles require MFA.
+// @Tags        mfa
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       code  body   models.MFACodeInput  true  "TOTP or recovery code"
+// @Success     200   {object}  utils.APIResponse{data=models.MFAStatus}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     403   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     409   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/mfa/disable [post]
+func (ac *AuthController) MFADisableHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		req, ok := decodeMFACode(w, r)
+		if !ok {
+			return
+		}
+
+		if err := ac.mfaService.Disable(claims.UserID, req.Code); err != nil {
+			switch {
+			case errors.Is(err, services.ErrInvalidMFACode):
+				writeInvalidMFACode(w)
+			case errors.Is(err, services.ErrMFARequired):
+				utils.WriteForbidden(w, "Multi-factor authentication is required for your roles")
+			case errors.Is(err, services.ErrMFANotEnabled):
+				utils.WriteConflict(w, "Multi-factor authentication is not enabled", nil)
+			default:
+				utils.WriteInternalServerError(w, "Failed to disable MFA", err)
+			}
+			return
+		}
+
+		ac.publishMFAChanged(claims.UserID, claims.Email, false)
+
+		status, err := ac.mfaService.GetStatus(claims.UserID)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to retrieve MFA status", err)
+			return
+		}
+
+		utils.WriteOK(w, status, "Multi-factor authentication disabled")
+	}
+}
+
+// MFARecoveryCodesHandler replaces the recovery codes of the current user
+// @Summary     Regenerate recovery codes
+// @Description Replace all recovery codes after confirming a TOTP or recovery code. The new codes are only shown once.
+// @Tags        mfa
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       code  body   models.MFACodeInput  true  "TOTP or recovery code"
+// @Success     200   {object}  utils.APIResponse{data=[]string}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     409   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/mfa/recovery-codes [post]
+func (ac *AuthController) MFARecoveryCodesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		req, ok := decodeMFACode(w, r)
+		if !ok {
+			return
+		}
+
+		recoveryCodes, err := ac.mfaService.RegenerateRecoveryCodes(claims.UserID, req.Code)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrInvalidMFACode):
+				writeInvalidMFACode(w)
+			case errors.Is(err, services.ErrMFANotEnabled):
+				utils.WriteConflict(w, "Multi-factor authentication is not enabled", nil)
+			default:
+				utils.WriteInternalServerError(w, "Failed to regenerate recovery codes", err)
+			}
+			return
+		}
+
+		utils.WriteOK(w, recoveryCodes, "Recovery codes regenerated")
+	}
+}
+
+// decodeMFACode reads a request carrying a single code, writing the error response itself
+func decodeMFACode(w http.ResponseWriter, r *http.Request) (*models.MFACodeInput, bool) {
+	var req models.MFACodeInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteBadRequest(w, "Invalid request body", err)
+		return nil, false
+	}
+
+	if req.Code == "" {
+		utils.WriteValidationError(w, map[string]string{
+			"code": "Code is required",
+		})
+		return nil, false
+	}
+
+	return &req, true
+}
+
+// writeInvalidMFACode reports a wrong code as a validation error on the code field
+func writeInvalidMFACode(w http.ResponseWriter) {
+	utils.WriteValidationError(w, map[string]string{
+		"code": "Invalid authentication code",
+	})
+}
+
+// publishMFAChanged publishes a user.mfa_enabled or user.mfa_disabled event
+func (ac *AuthController) publishMFAChanged(userID int, email string, enabled bool) {
+	if ac.eventService == nil {
+		return
+	}
+
+	if err := ac.eventService.PublishMFAChanged(userID, email, enabled); err != nil {
+		fmt.Printf("Warning: Failed to publish MFA event: %v\n", err)
+	}
+}
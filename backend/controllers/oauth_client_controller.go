@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/frallan97/hackaton-demo-backend/events"
+	"github.com/frallan97/hackaton-demo-backend/middleware"
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/services"
+)
+
+// OAuthClientController handles admin management of the partner apps registered as OAuth clients
+type OAuthClientController struct {
+	oauthServerService *services.OAuthServerService
+	eventService       *events.EventService
+}
+
+// NewOAuthClientController creates a new OAuth client controller
+func NewOAuthClientController(oauthServerService *services.OAuthServerService, eventService *events.EventService) *OAuthClientController {
+	return &OAuthClientController{
+		oauthServerService: oauthServerService,
+		eventService:       eventService,
+	}
+}
+
+// OAuthClientsHandler lists, registers and deletes OAuth clients
+// @Summary Manage OAuth clients
+// @Description GET lists the registered clients, POST registers one, DELETE deletes the client given by the id query parameter together with its consents and refresh tokens (Admin only). The secret of a confidential client is only shown in the POST response. Clients can be allowed openid, profile, email, offline_access, read and write; never admin.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.OAuthClientCreateInput false "Client name, redirect URIs, allowed scopes and whether it is confidential (POST only)"
+// @Param id query int false "Client ID (DELETE only)"
+// @Success 200 {array} models.OAuthClient
+// @Success 201 {object} models.OAuthClientCreated
+// @Router /api/admin/oauth-clients [get]
+// @Router /api/admin/oauth-clients [post]
+// @Router /api/admin/oauth-clients [delete]
+func (oc *OAuthClientController) OAuthClientsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			clients, err := oc.oauthServerService.ListClients()
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(clients)
+		case http.MethodPost:
+			var req models.OAuthClientCreateInput
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if validationErrors := services.ValidateOAuthClientInput(&req); len(validationErrors) > 0 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(validationErrors)
+				return
+			}
+
+			client, err := oc.oauthServerService.CreateClient(&req, adminUserID)
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			oc.publishAdminAction(adminUserID, "oauth_client_created", fmt.Sprintf("Registered OAuth client %s (%s)", client.Name, client.ClientID))
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(client)
+		case http.MethodDelete:
+			id, err := strconv.Atoi(r.URL.Query().Get("id"))
+			if err != nil {
+				http.Error(w, "Invalid client ID", http.StatusBadRequest)
+				return
+			}
+
+			client, err := oc.oauthServerService.DeleteClient(id)
+			if err != nil {
+				if errors.Is(err, services.ErrOAuthClientNotFound) {
+					http.Error(w, err.Error(), http.StatusNotFound)
+				} else {
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			oc.publishAdminAction(adminUserID, "oauth_client_deleted", fmt.Sprintf("Deleted OAuth client %s (%s)", client.Name, client.ClientID))
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": "OAuth client deleted successfully"})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// publishAdminAction records an OAuth client change in the admin audit stream
+func (oc *OAuthClientController) publishAdminAction(adminUserID int, action, details string) {
+	if oc.eventService == nil {
+		return
+	}
+
+	if err := oc.eventService.PublishAdminEvent(adminUserID, action, details, nil); err != nil {
+		fmt.Printf("Warning: Failed to publish admin event: %v\n", err)
+	}
+}
@@ -0,0 +1,640 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/services"
+	"github.com/frallan97/hackaton-demo-backend/utils"
+)
+
+// OAuthAuthorizeHandler backs the consent screen of the authorization code flow
+// @Summary     OAuth authorization request
+// @Description GET checks the authorization request given as query parameters and returns what the consent screen should show; consented is set if the user already granted every scope. POST approves or denies the request and returns the client redirect URI carrying the code or error. If the request is invalid in a way the client must hear about, redirect_to is set instead. PKCE with S256 is required. Only login sessions can authorize clients.
+// @Tags        oauth
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       response_type          query  string                         false  "Must be code (GET only)"
+// @Param       client_id              query  string                         false  "Client ID (GET only)"
+// @Param       redirect_uri           query  string                         false  "Registered redirect URI (GET only)"
+// @Param       scope                  query  string                         false  "Space separated scopes (GET only)"
+// @Param       state                  query  string                         false  "Opaque value returned to the client (GET only)"
+// @Param       nonce                  query  string                         false  "Nonce copied into the ID token (GET only)"
+// @Param       code_challenge         query  string                         false  "PKCE code challenge (GET only)"
+// @Param       code_challenge_method  query  string                         false  "Must be S256 (GET only)"
+// @Param       decision               body   models.OAuthAuthorizeDecision  false  "Authorization request and decision (POST only)"
+// @Success     200   {object}  utils.APIResponse{data=models.OAuthConsentRequest}
+// @Success     200   {object}  utils.APIResponse{data=models.OAuthAuthorizeResult}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/oauth/authorize [get]
+// @Router      /api/oauth/authorize [post]
+func (ac *AuthController) OAuthAuthorizeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "GET, POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		var decision models.OAuthAuthorizeDecision
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+				utils.WriteBadRequest(w, "Invalid request body", err)
+				return
+			}
+		} else {
+			query := r.URL.Query()
+			decision.OAuthAuthorizeRequest = models.OAuthAuthorizeRequest{
+				ResponseType:        query.Get("response_type"),
+				ClientID:            query.Get("client_id"),
+				RedirectURI:         query.Get("redirect_uri"),
+				Scope:               query.Get("scope"),
+				State:               query.Get("state"),
+				Nonce:               query.Get("nonce"),
+				CodeChallenge:       query.Get("code_challenge"),
+				CodeChallengeMethod: query.Get("code_challenge_method"),
+			}
+		}
+		req := &decision.OAuthAuthorizeRequest
+
+		client, scopes, err := ac.oauthServerService.ValidateAuthorizeRequest(req)
+		if err != nil {
+			var authorizeErr *services.AuthorizeError
+			switch {
+			case errors.As(err, &authorizeErr):
+				redirectTo := authorizeRedirect(req.RedirectURI, req.State, url.Values{
+					"error":             {authorizeErr.Code},
+					"error_description": {authorizeErr.Description},
+				})
+				if r.Method == http.MethodGet {
+					utils.WriteOK(w, &models.OAuthConsentRequest{RedirectTo: redirectTo}, "Authorization request rejected")
+				} else {
+					utils.WriteOK(w, &models.OAuthAuthorizeResult{RedirectTo: redirectTo}, "Authorization request rejected")
+				}
+			case errors.Is(err, services.ErrOAuthClientNotFound):
+				utils.WriteBadRequest(w, "Unknown client", err)
+			case errors.Is(err, services.ErrInvalidRedirectURI):
+				utils.WriteBadRequest(w, "Invalid redirect URI", err)
+			default:
+				utils.WriteInternalServerError(w, "Failed to check authorization request", err)
+			}
+			return
+		}
+
+		consented, err := ac.oauthServerService.HasConsent(claims.UserID, client.ClientID, scopes)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to check consent", err)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			utils.WriteOK(w, &models.OAuthConsentRequest{
+				ClientID:   client.ClientID,
+				ClientName: client.Name,
+				Scopes:     scopes,
+				Consented:  consented,
+			}, "Authorization request retrieved successfully")
+			return
+		}
+
+		if !decision.Approve {
+			redirectTo := authorizeRedirect(req.RedirectURI, req.State, url.Values{
+				"error":             {"access_denied"},
+				"error_description": {"The user denied the request"},
+			})
+			utils.WriteOK(w, &models.OAuthAuthorizeResult{RedirectTo: redirectTo}, "Authorization denied")
+			return
+		}
+
+		code, err := ac.oauthServerService.Authorize(claims.UserID, claims.MFA, req, scopes)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to authorize client", err)
+			return
+		}
+
+		if !consented {
+			ac.publishOAuthConsentChanged(claims.UserID, claims.Email, client.ClientID, strings.Join(scopes, " "), true)
+		}
+
+		redirectTo := authorizeRedirect(req.RedirectURI, req.State, url.Values{"code": {code}})
+		utils.WriteOK(w, &models.OAuthAuthorizeResult{RedirectTo: redirectTo}, "Authorization granted")
+	}
+}
+
+// OAuthTokenHandler issues tokens to OAuth clients (RFC 6749 section 3.2)
+// @Summary     OAuth token request
+// @Description Exchange an authorization code (with its PKCE verifier) or a refresh token for tokens. Confidential clients authenticate with HTTP Basic or client_secret in the body, public clients send only client_id. Access tokens are limited to the granted scope; a refresh token is only issued for offline_access and an ID token only for openid.
+// @Tags        oauth
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       grant_type     formData  string  true   "authorization_code or refresh_token"
+// @Param       code           formData  string  false  "Authorization code (authorization_code only)"
+// @Param       redirect_uri   formData  string  false  "Redirect URI of the authorization request (authorization_code only)"
+// @Param       code_verifier  formData  string  false  "PKCE code verifier (authorization_code only)"
+// @Param       refresh_token  formData  string  false  "Refresh token (refresh_token only)"
+// @Param       scope          formData  string  false  "Narrower scope for the new access token (refresh_token only)"
+// @Param       client_id      formData  string  false  "Client ID, unless sent with HTTP Basic"
+// @Param       client_secret  formData  string  false  "Client secret of confidential clients, unless sent with HTTP Basic"
+// @Success     200   {object}  models.OAuthTokenResponse
+// @Failure     400   {object}  models.OAuthError
+// @Failure     401   {object}  models.OAuthError
+// @Failure     405   {object}  utils.APIResponse
+// @Router      /oauth/token [post]
+func (ac *AuthController) OAuthTokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed request body")
+			return
+		}
+
+		client, ok := ac.authenticateOAuthClient(w, r)
+		if !ok {
+			return
+		}
+
+		switch r.FormValue("grant_type") {
+		case services.AuthorizationCodeGrantType:
+			ac.exchangeAuthorizationCode(w, r, client)
+		case services.RefreshTokenGrantType:
+			ac.refreshClientToken(w, r, client)
+		default:
+			writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+		}
+	}
+}
+
+// OAuthIntrospectHandler tells a client whether a token it holds is active (RFC 7662)
+// @Summary     OAuth token introspection
+// @Description Returns the state, scope and subject of an access or refresh token. Only confidential clients may introspect, and only tokens issued to themselves; any other token is reported as inactive.
+// @Tags        oauth
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       token          formData  string  true   "Access or refresh token"
+// @Param       client_id      formData  string  false  "Client ID, unless sent with HTTP Basic"
+// @Param       client_secret  formData  string  false  "Client secret, unless sent with HTTP Basic"
+// @Success     200   {object}  models.OAuthIntrospection
+// @Failure     400   {object}  models.OAuthError
+// @Failure     401   {object}  models.OAuthError
+// @Failure     405   {object}  utils.APIResponse
+// @Router      /oauth/introspect [post]
+func (ac *AuthController) OAuthIntrospectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed request body")
+			return
+		}
+
+		client, ok := ac.authenticateOAuthClient(w, r)
+		if !ok {
+			return
+		}
+		if !client.Confidential {
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Only confidential clients may introspect tokens")
+			return
+		}
+
+		token := r.FormValue("token")
+		if token == "" {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+			return
+		}
+
+		introspection := &models.OAuthIntrospection{}
+		if claims, family := ac.lookupClientToken(client, token); claims != nil {
+			introspection = &models.OAuthIntrospection{
+				Active:    true,
+				Scope:     claims.Scope,
+				ClientID:  claims.ClientID,
+				Username:  claims.Email,
+				TokenType: "Bearer",
+				Exp:       claims.ExpiresAt.Unix(),
+				Iat:       claims.IssuedAt.Unix(),
+				Sub:       strconv.Itoa(claims.UserID),
+				Iss:       claims.Issuer,
+			}
+		} else if family != nil {
+			introspection = &models.OAuthIntrospection{
+				Active:   true,
+				Scope:    family.Scope,
+				ClientID: family.ClientID,
+				Exp:      family.ExpiresAt.Unix(),
+				Iat:      family.CreatedAt.Unix(),
+				Sub:      strconv.Itoa(family.UserID),
+				Iss:      ac.oauthServerService.Issuer(),
+			}
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		utils.WriteJSON(w, http.StatusOK, introspection)
+	}
+}
+
+// OAuthRevokeHandler lets a client revoke a token it holds (RFC 7009)
+// @Summary     OAuth token revocation
+// @Description Revokes an access token or a refresh token. Access tokens already refreshed from a revoked refresh token stay valid until they expire. Answers 200 for unknown tokens and tokens of other clients too, as the RFC requires.
+// @Tags        oauth
+// @Accept      x-www-form-urlencoded
+// @Param       token          formData  string  true   "Access or refresh token"
+// @Param       client_id      formData  string  false  "Client ID, unless sent with HTTP Basic"
+// @Param       client_secret  formData  string  false  "Client secret of confidential clients, unless sent with HTTP Basic"
+// @Success     200
+// @Failure     400   {object}  models.OAuthError
+// @Failure     401   {object}  models.OAuthError
+// @Failure     405   {object}  utils.APIResponse
+// @Router      /oauth/revoke [post]
+func (ac *AuthController) OAuthRevokeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed request body")
+			return
+		}
+
+		client, ok := ac.authenticateOAuthClient(w, r)
+		if !ok {
+			return
+		}
+
+		token := r.FormValue("token")
+		if token == "" {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+			return
+		}
+
+		claims, family := ac.lookupClientToken(client, token)
+		switch {
+		case claims != nil:
+			if err := ac.revocationService.RevokeToken(claims, "client_revoked"); err != nil {
+				utils.WriteInternalServerError(w, "Failed to revoke token", err)
+				return
+			}
+		case family != nil:
+			if err := ac.refreshTokenService.RevokeFamily(family.FamilyID, "client_revoked"); err != nil {
+				utils.WriteInternalServerError(w, "Failed to revoke token", err)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// OAuthUserInfoHandler returns the claims about the user behind an access token (OpenID Connect Core section 5.3)
+// @Summary     OpenID Connect userinfo
+// @Description Returns the subject and, depending on the granted scopes, the email, name and picture of the user. Needs the openid scope.
+// @Tags        oauth
+// @Produce     json
+// @Security    BearerAuth
+// @Success     200   {object}  models.OIDCUserInfo
+// @Failure     401   {object}  models.OAuthError
+// @Failure     403   {object}  models.OAuthError
+// @Failure     405   {object}  utils.APIResponse
+// @Router      /oauth/userinfo [get]
+// @Router      /oauth/userinfo [post]
+func (ac *AuthController) OAuthUserInfoHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "GET, POST")
+			return
+		}
+
+		claims, err := ac.bearerClaimsFromRequest(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_token", err.Error())
+			return
+		}
+		if !claims.HasScope(services.OAuthScopeOpenID) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+			writeOAuthError(w, http.StatusForbidden, "insufficient_scope", "The openid scope is required")
+			return
+		}
+
+		user, err := ac.userService.GetUserByID(claims.UserID)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+			return
+		}
+		if user == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_token", "User account is not active")
+			return
+		}
+
+		userInfo := &models.OIDCUserInfo{Sub: strconv.Itoa(user.ID)}
+		if claims.HasScope(services.OAuthScopeEmail) {
+			userInfo.Email = user.Email
+		}
+		if claims.HasScope(services.OAuthScopeProfile) {
+			userInfo.Name = user.Name
+			userInfo.Picture = user.Picture
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		utils.WriteJSON(w, http.StatusOK, userInfo)
+	}
+}
+
+// OpenIDConfigurationHandler publishes the OpenID Connect discovery document
+// @Summary     OpenID Connect discovery
+// @Description Endpoints, scopes and algorithms of the authorization server for partner apps
+// @Tags        oauth
+// @Produce     json
+// @Success     200   {object}  models.OpenIDConfiguration
+// @Failure     405   {object}  utils.APIResponse
+// @Router      /.well-known/openid-configuration [get]
+func (ac *AuthController) OpenIDConfigurationHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.WriteMethodNotAllowed(w, "GET")
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		utils.WriteJSON(w, http.StatusOK, ac.oauthServerService.Discovery())
+	}
+}
+
+// OAuthConsentsHandler lists or revokes the apps the current user granted access to
+// @Summary     Manage connected apps
+// @Description GET lists the OAuth clients the current user granted access to, with their scopes. DELETE revokes the consent for the client given by the client_id query parameter along with the client's refresh tokens.
+// @Tags        oauth
+// @Produce     json
+// @Security    BearerAuth
+// @Param       client_id  query  string  false  "Client ID (DELETE only)"
+// @Success     200   {object}  utils.APIResponse{data=[]models.OAuthConsent}
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     404   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/oauth/consents [get]
+// @Router      /api/oauth/consents [delete]
+func (ac *AuthController) OAuthConsentsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			utils.WriteMethodNotAllowed(w, "GET, DELETE")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			consents, err := ac.oauthServerService.ListConsents(claims.UserID)
+			if err != nil {
+				utils.WriteInternalServerError(w, "Failed to retrieve connected apps", err)
+				return
+			}
+			utils.WriteOK(w, consents, "Connected apps retrieved successfully")
+
+		case http.MethodDelete:
+			clientID := r.URL.Query().Get("client_id")
+			if err := ac.oauthServerService.RevokeConsent(claims.UserID, clientID); err != nil {
+				if errors.Is(err, services.ErrOAuthConsentNotFound) {
+					utils.WriteNotFound(w, "Connected app not found")
+					return
+				}
+				utils.WriteInternalServerError(w, "Failed to revoke access", err)
+				return
+			}
+
+			ac.publishOAuthConsentChanged(claims.UserID, claims.Email, clientID, "", false)
+			utils.WriteOK(w, nil, "Access revoked")
+		}
+	}
+}
+
+// exchangeAuthorizationCode answers an authorization_code grant
+func (ac *AuthController) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client *models.OAuthClient) {
+	code, redirectURI, codeVerifier := r.FormValue("code"), r.FormValue("redirect_uri"), r.FormValue("code_verifier")
+	if code == "" || redirectURI == "" || codeVerifier == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "code, redirect_uri and code_verifier are required")
+		return
+	}
+
+	grant, err := ac.oauthServerService.ExchangeCode(client, code, redirectURI, codeVerifier)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAuthorizationCode) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid, expired or already used authorization code")
+			return
+		}
+		utils.WriteInternalServerError(w, "Failed to exchange authorization code", err)
+		return
+	}
+
+	user, err := ac.userService.GetUserByID(grant.UserID)
+	if err != nil {
+		utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+		return
+	}
+	if user == nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "User account is not active")
+		return
+	}
+
+	response := &models.OAuthTokenResponse{
+		TokenType: "Bearer",
+		ExpiresIn: int(ac.jwtService.GetTokenExpiry().Seconds()),
+		Scope:     grant.Scope,
+	}
+
+	// Refresh tokens are only handed out for offline access
+	var sessionID string
+	if slices.Contains(strings.Fields(grant.Scope), services.OAuthScopeOfflineAccess) {
+		refreshToken, family, err := ac.refreshTokenService.IssueForClient(user.ID, grant.MFA, client.ClientID, grant.Scope, sessionDevice(r))
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to generate authentication tokens", err)
+			return
+		}
+		response.RefreshToken = refreshToken
+		sessionID = family.FamilyID
+	}
+
+	response.AccessToken, err = ac.jwtService.GenerateClientAccessToken(user, sessionID, grant.MFA, client.ClientID, grant.Scope)
+	if err != nil {
+		utils.WriteInternalServerError(w, "Failed to generate authentication tokens", err)
+		return
+	}
+
+	if slices.Contains(strings.Fields(grant.Scope), services.OAuthScopeOpenID) {
+		response.IDToken, err = ac.jwtService.GenerateIDToken(user, ac.oauthServerService.Issuer(), client.ClientID, grant.Nonce, grant.Scope, grant.AuthTime)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to generate ID token", err)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// refreshClientToken answers a refresh_token grant. The new access token keeps the
+// scope of the session, or the narrower scope the client asks for.
+func (ac *AuthController) refreshClientToken(w http.ResponseWriter, r *http.Request, client *models.OAuthClient) {
+	if r.FormValue("refresh_token") == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "refresh_token is required")
+		return
+	}
+
+	newRefreshToken, family, err := ac.refreshTokenService.Rotate(r.FormValue("refresh_token"), client.ClientID, sessionDevice(r))
+	if err != nil {
+		if errors.Is(err, services.ErrRefreshTokenReused) {
+			ac.publishTokenRefresh(r, family.UserID, "", "refresh_token_reuse", false, "refresh token family "+family.FamilyID+" of client "+client.ClientID+" revoked after reuse")
+		}
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+			return
+		}
+		utils.WriteInternalServerError(w, "Failed to refresh token", err)
+		return
+	}
+
+	scope, ok := services.NarrowScope(family.Scope, r.FormValue("scope"))
+	if !ok {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "The requested scope exceeds the granted scope")
+		return
+	}
+
+	user, err := ac.userService.GetUserByID(family.UserID)
+	if err != nil {
+		utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+		return
+	}
+	if user == nil {
+		// The account is gone or deactivated, so the session must not live on
+		if err := ac.refreshTokenService.RevokeFamily(family.FamilyID, "user_inactive"); err != nil {
+			fmt.Printf("Warning: Failed to revoke refresh token family: %v\n", err)
+		}
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "User account is not active")
+		return
+	}
+
+	accessToken, err := ac.jwtService.GenerateClientAccessToken(user, family.FamilyID, family.MFA, client.ClientID, scope)
+	if err != nil {
+		utils.WriteInternalServerError(w, "Failed to generate authentication tokens", err)
+		return
+	}
+
+	ac.publishTokenRefresh(r, user.ID, user.Email, "oauth_refresh", true, "")
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteJSON(w, http.StatusOK, &models.OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(ac.jwtService.GetTokenExpiry().Seconds()),
+		RefreshToken: newRefreshToken,
+		Scope:        scope,
+	})
+}
+
+// authenticateOAuthClient authenticates the client of a token, introspection or revocation
+// request with HTTP Basic (RFC 6749 section 2.3.1) or client_id and client_secret in the body.
+// It writes the error response itself and reports whether the caller can continue.
+func (ac *AuthController) authenticateOAuthClient(w http.ResponseWriter, r *http.Request) (*models.OAuthClient, bool) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// Credentials in the Basic header are form-encoded first
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+
+	client, err := ac.oauthServerService.AuthenticateClient(clientID, secret)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidOAuthClient) {
+			if basic {
+				w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+			}
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+			return nil, false
+		}
+		utils.WriteInternalServerError(w, "Failed to authenticate client", err)
+		return nil, false
+	}
+
+	return client, true
+}
+
+// lookupClientToken resolves a token presented by a client. It returns the claims of a valid
+// access token or the family of a valid refresh token, provided the token was issued to the client.
+func (ac *AuthController) lookupClientToken(client *models.OAuthClient, token string) (*services.Claims, *models.RefreshToken) {
+	// Access tokens are JWTs with three parts; refresh tokens are "<family_id>.<secret>"
+	if strings.Count(token, ".") == 2 {
+		claims, err := ac.jwtService.ValidateToken(token)
+		if err != nil || claims.ClientID != client.ClientID || ac.revocationService.IsRevoked(claims) {
+			return nil, nil
+		}
+		return claims, nil
+	}
+
+	family, err := ac.refreshTokenService.Lookup(token)
+	if err != nil || family.ClientID != client.ClientID {
+		return nil, nil
+	}
+	return nil, family
+}
+
+// publishOAuthConsentChanged publishes the grant or revocation of a user's consent to a client
+func (ac *AuthController) publishOAuthConsentChanged(userID int, email, clientID, scope string, granted bool) {
+	if ac.eventService == nil {
+		return
+	}
+
+	if err := ac.eventService.PublishOAuthConsentChanged(userID, email, clientID, scope, granted); err != nil {
+		fmt.Printf("Warning: Failed to publish OAuth consent event: %v\n", err)
+	}
+}
+
+// authorizeRedirect adds the response parameters and state to a client's redirect URI
+func authorizeRedirect(redirectURI, state string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
@@ -2,30 +2,37 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/frallan97/hackaton-demo-backend/database"
+	"github.com/frallan97/hackaton-demo-backend/events"
+	"github.com/frallan97/hackaton-demo-backend/middleware"
 	"github.com/frallan97/hackaton-demo-backend/models"
 	"github.com/frallan97/hackaton-demo-backend/services"
 )
 
 // OrganizationController handles organization-related HTTP requests
 type OrganizationController struct {
-	orgService *services.OrganizationService
+	orgService       *services.OrganizationService
+	orgMemberService *services.OrganizationMemberService
+	eventService     *events.EventService
 }
 
 // NewOrganizationController creates a new organization controller
-func NewOrganizationController(dbManager *database.DBManager) *OrganizationController {
+func NewOrganizationController(dbManager *database.DBManager, eventService *events.EventService) *OrganizationController {
 	return &OrganizationController{
-		orgService: services.NewOrganizationService(dbManager.DB),
+		orgService:       services.NewOrganizationService(dbManager.DB),
+		orgMemberService: services.NewOrganizationMemberService(dbManager.DB),
+		eventService:     eventService,
 	}
 }
 
 // OrganizationsHandler handles organization CRUD operations
 // @Summary Organization operations
-// @Description Handle organization CRUD operations
+// @Description Handle organization CRUD operations. Users see the organizations they are a member of, update those they are an admin or owner of and delete those they own; the creator of an organization becomes its owner. Users with the org:manage permission can do this with every organization.
 // @Tags organizations
 // @Accept json
 // @Produce json
@@ -73,8 +80,20 @@ func (oc *OrganizationController) handleGetOrganizations(w http.ResponseWriter,
 		return
 	}
 
-	// Get all organizations
-	orgs, err := oc.orgService.GetAllOrganizations()
+	authz, ok := middleware.AuthorizationFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get all organizations, or only those of the user when they may not access all
+	var orgs []models.Organization
+	var err error
+	if authz.HasPermission(services.PermissionOrgManage) {
+		orgs, err = oc.orgService.GetAllOrganizations()
+	} else {
+		orgs, err = oc.orgMemberService.GetMemberOrganizations(authz.UserID)
+	}
 	if err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -85,6 +104,12 @@ func (oc *OrganizationController) handleGetOrganizations(w http.ResponseWriter,
 }
 
 func (oc *OrganizationController) handleCreateOrganization(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var orgCreate models.OrganizationCreate
 	if err := json.NewDecoder(r.Body).Decode(&orgCreate); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -101,7 +126,7 @@ func (oc *OrganizationController) handleCreateOrganization(w http.ResponseWriter
 		orgCreate.Metadata = make(map[string]interface{})
 	}
 
-	org, err := oc.orgService.CreateOrganization(orgCreate)
+	org, err := oc.orgService.CreateOrganization(orgCreate, userID)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
 			http.Error(w, "Organization name already exists", http.StatusConflict)
@@ -111,6 +136,13 @@ func (oc *OrganizationController) handleCreateOrganization(w http.ResponseWriter
 		return
 	}
 
+	// The creator is now the owner
+	if oc.eventService != nil {
+		if err := oc.eventService.PublishUserAddedToOrg(userID, org.ID, org.Name); err != nil {
+			fmt.Printf("Warning: Failed to publish organization membership event: %v\n", err)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(org)
@@ -184,5 +216,14 @@ func (oc *OrganizationController) handleDeleteOrganization(w http.ResponseWriter
 		return
 	}
 
+	// The memberships went with it
+	if oc.eventService != nil {
+		if userID, ok := middleware.GetUserIDFromContext(r.Context()); ok {
+			if err := oc.eventService.PublishOrgEvent(events.EventTypeOrgDeleted, userID, orgID, "", nil); err != nil {
+				fmt.Printf("Warning: Failed to publish organization deleted event: %v\n", err)
+			}
+		}
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
\ No newline at end of file
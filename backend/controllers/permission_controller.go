@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/frallan97/hackaton-demo-backend/events"
+	"github.com/frallan97/hackaton-demo-backend/middleware"
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/services"
+)
+
+// PermissionController handles admin management of the permissions roles grant
+type PermissionController struct {
+	permissionService *services.PermissionService
+	eventService      *events.EventService
+}
+
+// NewPermissionController creates a new permission controller
+func NewPermissionController(permissionService *services.PermissionService, eventService *events.EventService) *PermissionController {
+	return &PermissionController{
+		permissionService: permissionService,
+		eventService:      eventService,
+	}
+}
+
+// PermissionsHandler lists the permission catalogue
+// @Summary List permissions
+// @Description Lists every permission routes can require, such as org:write or billing:read (Admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Permission
+// @Router /api/admin/permissions [get]
+func (pc *PermissionController) PermissionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		permissions, err := pc.permissionService.ListPermissions()
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(permissions)
+	}
+}
+
+// RolePermissionsHandler lists, grants and revokes the permissions of a role
+// @Summary Manage role permissions
+// @Description GET lists the permissions granted to the role given by the role_id query parameter. POST grants a permission to a role, DELETE revokes the permission given by the permission query parameter from the role given by role_id. Changes apply to the next request of every user with the role. The admin role always keeps permissions:manage (Admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param role_id query int false "Role ID (GET and DELETE)"
+// @Param permission query string false "Permission name (DELETE only)"
+// @Param request body models.RolePermissionRequest false "Grant (POST only)"
+// @Success 200 {array} models.RolePermission
+// @Router /api/admin/role-permissions [get]
+// @Router /api/admin/role-permissions [post]
+// @Router /api/admin/role-permissions [delete]
+func (pc *PermissionController) RolePermissionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			roleID, err := strconv.Atoi(r.URL.Query().Get("role_id"))
+			if err != nil {
+				http.Error(w, "Invalid role ID", http.StatusBadRequest)
+				return
+			}
+
+			permissions, err := pc.permissionService.GetRolePermissions(roleID)
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(permissions)
+		case http.MethodPost:
+			var req models.RolePermissionRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if err := pc.permissionService.GrantPermission(req.RoleID, req.Permission, adminUserID); err != nil {
+				writePermissionError(w, err)
+				return
+			}
+
+			pc.publishAdminAction(adminUserID, "permission_granted", fmt.Sprintf("Granted %s to role %d", req.Permission, req.RoleID))
+			pc.publishRoleUpdated(adminUserID, req.RoleID)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": "Permission granted successfully"})
+		case http.MethodDelete:
+			roleID, err := strconv.Atoi(r.URL.Query().Get("role_id"))
+			if err != nil {
+				http.Error(w, "Invalid role ID", http.StatusBadRequest)
+				return
+			}
+			permission := r.URL.Query().Get("permission")
+
+			if err := pc.permissionService.RevokePermission(roleID, permission); err != nil {
+				writePermissionError(w, err)
+				return
+			}
+
+			pc.publishAdminAction(adminUserID, "permission_revoked", fmt.Sprintf("Revoked %s from role %d", permission, roleID))
+			pc.publishRoleUpdated(adminUserID, roleID)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": "Permission revoked successfully"})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// writePermissionError maps an error of a grant change to its response
+func writePermissionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrRoleNotFound), errors.Is(err, services.ErrPermissionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrProtectedPermission):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// publishRoleUpdated announces that the permissions of a role changed, so that replicas reload them
+func (pc *PermissionController) publishRoleUpdated(adminUserID, roleID int) {
+	if pc.eventService == nil {
+		return
+	}
+
+	if err := pc.eventService.PublishRoleEvent(events.EventTypeRoleUpdated, adminUserID, roleID, "", nil); err != nil {
+		fmt.Printf("Warning: Failed to publish role updated event: %v\n", err)
+	}
+}
+
+// publishAdminAction records a change of role permissions in the admin audit stream
+func (pc *PermissionController) publishAdminAction(adminUserID int, action, details string) {
+	if pc.eventService == nil {
+		return
+	}
+
+	if err := pc.eventService.PublishAdminEvent(adminUserID, action, details, nil); err != nil {
+		fmt.Printf("Warning: Failed to publish admin event: %v\n", err)
+	}
+}
@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/frallan97/hackaton-demo-backend/events"
+	"github.com/frallan97/hackaton-demo-backend/middleware"
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/services"
+)
+
+// PolicyController handles admin management of the access policies and their decision log
+type PolicyController struct {
+	policyService *services.PolicyService
+	eventService  *events.EventService
+}
+
+// NewPolicyController creates a new policy controller
+func NewPolicyController(policyService *services.PolicyService, eventService *events.EventService) *PolicyController {
+	return &PolicyController{
+		policyService: policyService,
+		eventService:  eventService,
+	}
+}
+
+// PoliciesHandler lists the versions of the policy document or publishes a new one
+// @Summary Manage access policies
+// @Description GET lists the published versions of the policy document, newest first; the newest is in force. POST validates and publishes a new version, which every replica evaluates at once (Admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.PolicyVersionRequest false "New version (POST only)"
+// @Success 200 {array} models.PolicyVersion
+// @Success 201 {object} models.PolicyVersion
+// @Failure 400 {object} map[string]string
+// @Router /api/admin/policies [get]
+// @Router /api/admin/policies [post]
+func (pc *PolicyController) PoliciesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			versions, err := pc.policyService.ListVersions()
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(versions)
+		case http.MethodPost:
+			var req models.PolicyVersionRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if validationErrors := services.ValidatePolicyDocument(&req.Document); len(validationErrors) > 0 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(validationErrors)
+				return
+			}
+
+			version, err := pc.policyService.PublishVersion(&req.Document, req.Comment, adminUserID)
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			pc.publishPolicyUpdated(adminUserID, version.Version)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(version)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// EvaluatePoliciesHandler evaluates the policies for a user without acting on the decision
+// @Summary Dry-run the access policies
+// @Description Evaluates the policies in force, or a draft document given in the request, for a user, an action and the attributes of a resource. Set admin_scope to evaluate the user as signed in with the admin scope, which the admin role and what it grants need. The decision is logged as a dry run (Admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.PolicyEvaluationRequest true "Evaluation"
+// @Success 200 {object} models.PolicyEvaluationResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {string} string "User not found"
+// @Router /api/admin/policies/evaluate [post]
+func (pc *PolicyController) EvaluatePoliciesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req models.PolicyEvaluationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		validationErrors := make(map[string]string)
+		if req.UserID <= 0 {
+			validationErrors["user_id"] = "User ID is required"
+		}
+		if req.Action == "" {
+			validationErrors["action"] = "Action is required"
+		}
+		if req.Document != nil {
+			for field, message := range services.ValidatePolicyDocument(req.Document) {
+				validationErrors["document."+field] = message
+			}
+		}
+		if len(validationErrors) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(validationErrors)
+			return
+		}
+
+		result, err := pc.policyService.DryRun(&req, adminUserID)
+		if err != nil {
+			if errors.Is(err, services.ErrPolicySubjectNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// PolicyDecisionsHandler lists the policy decision log
+// @Summary Policy decision log
+// @Description Lists the decisions of the access policies, including dry runs, newest first (Admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query int false "Only decisions for this user"
+// @Param action query string false "Only decisions on this action"
+// @Param limit query int false "Maximum number of entries (default 50, at most 500)"
+// @Param offset query int false "Number of entries to skip"
+// @Success 200 {array} models.PolicyDecisionLog
+// @Router /api/admin/policies/decisions [get]
+func (pc *PolicyController) PolicyDecisionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := services.PolicyDecisionFilter{Action: query.Get("action")}
+		for param, target := range map[string]*int{"user_id": &filter.UserID, "limit": &filter.Limit, "offset": &filter.Offset} {
+			if value := query.Get(param); value != "" {
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					http.Error(w, "Invalid "+param, http.StatusBadRequest)
+					return
+				}
+				*target = n
+			}
+		}
+
+		decisions, err := pc.policyService.ListDecisions(filter)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(decisions)
+	}
+}
+
+// publishPolicyUpdated announces a new version of the policies, so that every replica reloads them
+func (pc *PolicyController) publishPolicyUpdated(adminUserID, version int) {
+	if pc.eventService == nil {
+		return
+	}
+
+	if err := pc.eventService.PublishPolicyUpdated(version, adminUserID); err != nil {
+		fmt.Printf("Warning: Failed to publish policy updated event: %v\n", err)
+	}
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/services"
+	"github.com/frallan97/hackaton-demo-backend/utils"
+)
+
+// ProfileHandler shows or edits the profile of the current user
+// @Summary     Manage profile
+// @Description GET returns the profile of the current user. PATCH changes the display name, avatar, locale, timezone, notification preferences or user-editable custom attributes; fields left out are kept. Once edited, the name and avatar are no longer synced from the login provider; an empty picture removes the avatar override. A null custom attribute removes it.
+// @Tags        users
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       request  body  models.UserProfileUpdate  false  "Profile changes (PATCH only)"
+// @Success     200   {object}  utils.APIResponse{data=models.UserProfile}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     404   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/users/me [get]
+// @Router      /api/users/me [patch]
+func (ac *AuthController) ProfileHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPatch {
+			utils.WriteMethodNotAllowed(w, "GET, PATCH")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			profile, err := ac.userProfileService.GetProfile(claims.UserID)
+			if err != nil {
+				utils.WriteInternalServerError(w, "Failed to retrieve profile", err)
+				return
+			}
+			if profile == nil {
+				utils.WriteNotFound(w, "User not found")
+				return
+			}
+
+			utils.WriteOK(w, profile, "Profile retrieved successfully")
+			return
+		}
+
+		var update models.UserProfileUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			utils.WriteBadRequest(w, "Invalid request body", err)
+			return
+		}
+
+		definitions, err := ac.userProfileService.ListAttributeDefinitions()
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to retrieve user attributes", err)
+			return
+		}
+
+		if validationErrors := services.ValidateProfileUpdate(&update, definitions, false); len(validationErrors) > 0 {
+			utils.WriteValidationError(w, validationErrors)
+			return
+		}
+
+		profile, err := ac.userProfileService.UpdateProfile(claims.UserID, &update)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to update profile", err)
+			return
+		}
+		if profile == nil {
+			utils.WriteNotFound(w, "User not found")
+			return
+		}
+
+		ac.publishProfileUpdated(profile.UserID, profile.Email, profileUpdateFields(&update), claims.UserID)
+		utils.WriteOK(w, profile, "Profile updated successfully")
+	}
+}
+
+// publishProfileUpdated publishes a change of a user's profile
+func (ac *AuthController) publishProfileUpdated(userID int, email string, fields []string, performedBy int) {
+	if ac.eventService == nil || len(fields) == 0 {
+		return
+	}
+
+	if err := ac.eventService.PublishProfileUpdated(userID, email, fields, performedBy); err != nil {
+		fmt.Printf("Warning: Failed to publish profile updated event: %v\n", err)
+	}
+}
+
+// profileUpdateFields names the fields a profile update changes, custom attributes as custom_attributes.<name>
+func profileUpdateFields(update *models.UserProfileUpdate) []string {
+	var fields []string
+	for field, set := range map[string]bool{
+		"name":     update.Name != nil,
+		"picture":  update.Picture != nil,
+		"locale":   update.Locale != nil,
+		"timezone": update.Timezone != nil,
+	} {
+		if set {
+			fields = append(fields, field)
+		}
+	}
+	for notification := range update.NotificationPreferences {
+		fields = append(fields, "notification_preferences."+notification)
+	}
+	for name := range update.CustomAttributes {
+		fields = append(fields, "custom_attributes."+name)
+	}
+
+	slices.Sort(fields)
+	return fields
+}
@@ -2,30 +2,36 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/frallan97/hackaton-demo-backend/database"
+	"github.com/frallan97/hackaton-demo-backend/events"
+	"github.com/frallan97/hackaton-demo-backend/middleware"
 	"github.com/frallan97/hackaton-demo-backend/models"
 	"github.com/frallan97/hackaton-demo-backend/services"
 )
 
 // RoleController handles role-related HTTP requests
 type RoleController struct {
-	roleService *services.RoleService
+	roleService  *services.RoleService
+	eventService *events.EventService
 }
 
 // NewRoleController creates a new role controller
-func NewRoleController(dbManager *database.DBManager) *RoleController {
+func NewRoleController(dbManager *database.DBManager, eventService *events.EventService) *RoleController {
 	return &RoleController{
-		roleService: services.NewRoleService(dbManager.DB),
+		roleService:  services.NewRoleService(dbManager.DB),
+		eventService: eventService,
 	}
 }
 
 // RolesHandler handles role CRUD operations
 // @Summary Role operations
-// @Description Handle role CRUD operations
+// @Description Handle role CRUD operations. Roles can name parent roles, whose permissions and role checks they inherit; an update that would make a role inherit itself is refused.
 // @Tags roles
 // @Accept json
 // @Produce json
@@ -98,7 +104,9 @@ func (rc *RoleController) handleCreateRole(w http.ResponseWriter, r *http.Reques
 
 	role, err := rc.roleService.CreateRole(roleCreate)
 	if err != nil {
-		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
+		if errors.Is(err, services.ErrParentRoleNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
 			http.Error(w, "Role name already exists", http.StatusConflict)
 		} else {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -137,7 +145,9 @@ func (rc *RoleController) handleUpdateRole(w http.ResponseWriter, r *http.Reques
 
 	role, err := rc.roleService.UpdateRole(roleID, roleUpdate)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, services.ErrParentRoleNotFound) || errors.Is(err, services.ErrRoleCycle) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Role not found", http.StatusNotFound)
 		} else if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
 			http.Error(w, "Role name already exists", http.StatusConflict)
@@ -147,6 +157,8 @@ func (rc *RoleController) handleUpdateRole(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	rc.publishRoleChanged(r, events.EventTypeRoleUpdated, role.ID, role.Name)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(role)
 }
@@ -174,5 +186,19 @@ func (rc *RoleController) handleDeleteRole(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	rc.publishRoleChanged(r, events.EventTypeRoleDeleted, roleID, "")
+
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// publishRoleChanged announces a change to a role, which every user with it or inheriting it is affected by
+func (rc *RoleController) publishRoleChanged(r *http.Request, eventType string, roleID int, roleName string) {
+	if rc.eventService == nil {
+		return
+	}
+
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	if err := rc.eventService.PublishRoleEvent(eventType, userID, roleID, roleName, nil); err != nil {
+		fmt.Printf("Warning: Failed to publish role event: %v\n", err)
+	}
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/events"
+	"github.com/frallan97/hackaton-demo-backend/middleware"
+	"github.com/frallan97/hackaton-demo-backend/services"
+)
+
+// anomalyListLimit caps how many login anomalies are returned at once
+const anomalyListLimit = 100
+
+// SecurityController handles admin review of login lockouts, anomalies and login history
+type SecurityController struct {
+	securityService     *services.SecurityService
+	loginHistoryService *services.LoginHistoryService
+	eventService        *events.EventService
+}
+
+// NewSecurityController creates a new security controller
+func NewSecurityController(securityService *services.SecurityService, loginHistoryService *services.LoginHistoryService, eventService *events.EventService) *SecurityController {
+	return &SecurityController{
+		securityService:     securityService,
+		loginHistoryService: loginHistoryService,
+		eventService:        eventService,
+	}
+}
+
+// LockoutsHandler lists and lifts login lockouts
+// @Summary Manage login lockouts
+// @Description GET lists the accounts and IP addresses that are locked out after repeated failed logins or have recent failures, optionally filtered by the subject query parameter. DELETE unlocks the lockout given by the id query parameter and forgets its failures (Admin only).
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param subject query string false "Email or IP address to search for (GET only)"
+// @Param id query int false "Lockout ID (DELETE only)"
+// @Success 200 {array} models.Lockout
+// @Router /api/admin/lockouts [get]
+// @Router /api/admin/lockouts [delete]
+func (sc *SecurityController) LockoutsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			lockouts, err := sc.securityService.ListLockouts(r.URL.Query().Get("subject"))
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(lockouts)
+		case http.MethodDelete:
+			lockoutID, err := strconv.Atoi(r.URL.Query().Get("id"))
+			if err != nil {
+				http.Error(w, "Invalid lockout ID", http.StatusBadRequest)
+				return
+			}
+
+			lockout, err := sc.securityService.Unlock(lockoutID)
+			if err != nil {
+				if errors.Is(err, services.ErrLockoutNotFound) {
+					http.Error(w, err.Error(), http.StatusNotFound)
+				} else {
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			sc.publishAdminAction(adminUserID, "lockout_lifted", fmt.Sprintf("Unlocked %s %s", lockout.Scope, lockout.Subject))
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": "Lockout lifted successfully"})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// AnomaliesHandler lists logins that did not fit a user's history
+// @Summary List login anomalies
+// @Description Lists the most recent logins from a new country or device, or from too far away from the previous login to have been travelled, optionally of the user given by the user_id query parameter (Admin only). Country and location are only known behind a proxy that reports them.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query int false "User ID"
+// @Success 200 {array} models.SecurityAnomaly
+// @Router /api/admin/security-anomalies [get]
+func (sc *SecurityController) AnomaliesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID := 0
+		if value := r.URL.Query().Get("user_id"); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, "Invalid user ID", http.StatusBadRequest)
+				return
+			}
+			userID = id
+		}
+
+		anomalies, err := sc.securityService.ListAnomalies(userID, anomalyListLimit)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(anomalies)
+	}
+}
+
+// LoginHistoryHandler searches the login history of all users
+// @Summary Search login history
+// @Description Lists logins, failed logins, token refreshes and logouts, newest first, optionally filtered by user, client IP address and time range (Admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query int false "User ID"
+// @Param ip query string false "Client IP address"
+// @Param from query string false "Start of the time range (RFC 3339)"
+// @Param to query string false "End of the time range (RFC 3339)"
+// @Param limit query int false "Maximum number of entries (default 50, at most 500)"
+// @Param offset query int false "Number of entries to skip"
+// @Success 200 {array} models.LoginEvent
+// @Router /api/admin/login-history [get]
+func (sc *SecurityController) LoginHistoryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		filter, err := loginHistoryFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if value := r.URL.Query().Get("user_id"); value != "" {
+			if filter.UserID, err = strconv.Atoi(value); err != nil {
+				http.Error(w, "Invalid user ID", http.StatusBadRequest)
+				return
+			}
+		}
+		filter.IPAddress = r.URL.Query().Get("ip")
+
+		history, err := sc.loginHistoryService.List(filter)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(history)
+	}
+}
+
+// loginHistoryFilter reads the time range and paging of a login history request
+func loginHistoryFilter(r *http.Request) (services.LoginHistoryFilter, error) {
+	var filter services.LoginHistoryFilter
+	query := r.URL.Query()
+
+	for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid %s time, expected RFC 3339", name)
+			}
+			*target = t
+		}
+	}
+
+	for name, target := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		if value := query.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return filter, fmt.Errorf("Invalid %s", name)
+			}
+			*target = n
+		}
+	}
+
+	return filter, nil
+}
+
+// publishAdminAction records an unlock in the admin audit stream
+func (sc *SecurityController) publishAdminAction(adminUserID int, action, details string) {
+	if sc.eventService == nil {
+		return
+	}
+
+	if err := sc.eventService.PublishAdminEvent(adminUserID, action, details, nil); err != nil {
+		fmt.Printf("Warning: Failed to publish admin event: %v\n", err)
+	}
+}
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/frallan97/hackaton-demo-backend/events"
+	"github.com/frallan97/hackaton-demo-backend/middleware"
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/services"
+)
+
+// ServiceAccountController handles admin management of service accounts and their tokens
+type ServiceAccountController struct {
+	serviceAccountService *services.ServiceAccountService
+	accessTokenService    *services.AccessTokenService
+	eventService          *events.EventService
+}
+
+// NewServiceAccountController creates a new service account controller
+func NewServiceAccountController(serviceAccountService *services.ServiceAccountService, accessTokenService *services.AccessTokenService, eventService *events.EventService) *ServiceAccountController {
+	return &ServiceAccountController{
+		serviceAccountService: serviceAccountService,
+		accessTokenService:    accessTokenService,
+		eventService:          eventService,
+	}
+}
+
+// ServiceAccountsHandler lists, creates and deactivates service accounts
+// @Summary Manage service accounts
+// @Description GET lists service accounts, POST creates one, DELETE deactivates the service account given by the id query parameter and revokes its tokens (Admin only). Roles are assigned with /api/admin/assign-role like for any user.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.ServiceAccountCreateInput false "Service account (POST only)"
+// @Param id query int false "Service account ID (DELETE only)"
+// @Success 200 {array} models.ServiceAccount
+// @Router /api/admin/service-accounts [get]
+// @Router /api/admin/service-accounts [post]
+// @Router /api/admin/service-accounts [delete]
+func (sc *ServiceAccountController) ServiceAccountsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			accounts, err := sc.serviceAccountService.List()
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(accounts)
+		case http.MethodPost:
+			var req models.ServiceAccountCreateInput
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			account, err := sc.serviceAccountService.Create(&req, adminUserID)
+			if err != nil {
+				switch {
+				case errors.Is(err, services.ErrInvalidServiceAccountName):
+					http.Error(w, err.Error(), http.StatusBadRequest)
+				case errors.Is(err, services.ErrServiceAccountExists):
+					http.Error(w, err.Error(), http.StatusConflict)
+				default:
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			sc.publishAdminAction(adminUserID, "service_account_created", fmt.Sprintf("Created service account %s", account.Name))
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(account)
+		case http.MethodDelete:
+			accountID, err := strconv.Atoi(r.URL.Query().Get("id"))
+			if err != nil {
+				http.Error(w, "Invalid service account ID", http.StatusBadRequest)
+				return
+			}
+
+			account, err := sc.serviceAccountService.Deactivate(accountID)
+			if err != nil {
+				if errors.Is(err, services.ErrServiceAccountNotFound) {
+					http.Error(w, err.Error(), http.StatusNotFound)
+				} else {
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			sc.publishAdminAction(adminUserID, "service_account_deactivated", fmt.Sprintf("Deactivated service account %s", account.Name))
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": "Service account deactivated successfully"})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// ServiceAccountTokensHandler lists, creates and revokes access tokens of a service account
+// @Summary Manage service account tokens
+// @Description GET lists the active tokens and POST creates a token for the service account given by the service_account_id query parameter; the token is only shown in the POST response. DELETE revokes the token given by the id query parameter (Admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param service_account_id query int true "Service account ID"
+// @Param request body models.AccessTokenCreateInput false "Token name, scopes (read, write, admin) and lifetime in days (POST only)"
+// @Param id query int false "Token ID (DELETE only)"
+// @Success 200 {array} models.AccessToken
+// @Router /api/admin/service-accounts/tokens [get]
+// @Router /api/admin/service-accounts/tokens [post]
+// @Router /api/admin/service-accounts/tokens [delete]
+func (sc *ServiceAccountController) ServiceAccountTokensHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		accountID, err := strconv.Atoi(r.URL.Query().Get("service_account_id"))
+		if err != nil {
+			http.Error(w, "Invalid service account ID", http.StatusBadRequest)
+			return
+		}
+
+		account, err := sc.serviceAccountService.Get(accountID)
+		if err != nil {
+			if errors.Is(err, services.ErrServiceAccountNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			tokens, err := sc.accessTokenService.ListTokens(account.ID)
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(tokens)
+		case http.MethodPost:
+			if !account.IsActive {
+				http.Error(w, "Service account is deactivated", http.StatusConflict)
+				return
+			}
+
+			var req models.AccessTokenCreateInput
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if validationErrors := services.ValidateAccessTokenInput(&req); len(validationErrors) > 0 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(validationErrors)
+				return
+			}
+
+			// Service accounts can not answer a second factor. Their tokens are issued by an
+			// admin session that passed the MFA check, so they count as MFA sessions.
+			token, err := sc.accessTokenService.CreateToken(account.ID, &req, adminUserID, true)
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			sc.publishAdminAction(adminUserID, "service_account_token_created", fmt.Sprintf("Created token %s for service account %s", token.Name, account.Name))
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(token)
+		case http.MethodDelete:
+			tokenID, err := strconv.Atoi(r.URL.Query().Get("id"))
+			if err != nil {
+				http.Error(w, "Invalid token ID", http.StatusBadRequest)
+				return
+			}
+
+			if err := sc.accessTokenService.RevokeToken(account.ID, tokenID); err != nil {
+				if errors.Is(err, services.ErrAccessTokenNotFound) {
+					http.Error(w, err.Error(), http.StatusNotFound)
+				} else {
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			sc.publishAdminAction(adminUserID, "service_account_token_revoked", fmt.Sprintf("Revoked token %d of service account %s", tokenID, account.Name))
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": "Token revoked successfully"})
+		}
+	}
+}
+
+// publishAdminAction records a service account change in the admin audit stream
+func (sc *ServiceAccountController) publishAdminAction(adminUserID int, action, details string) {
+	if sc.eventService == nil {
+		return
+	}
+
+	if err := sc.eventService.PublishAdminEvent(adminUserID, action, details, nil); err != nil {
+		fmt.Printf("Warning: Failed to publish admin event: %v\n", err)
+	}
+}
@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/frallan97/hackaton-demo-backend/middleware"
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/services"
+	"github.com/frallan97/hackaton-demo-backend/utils"
+)
+
+// SessionsHandler lists the login sessions of the current user or signs some of them out
+// @Summary     Manage sessions
+// @Description GET lists the active login sessions of the current user with their device, IP address and last activity; the session making the request is marked current. DELETE with the id query parameter signs out that session, DELETE with others=true signs out every session except the current one. Access tokens of a revoked session stop working immediately.
+// @Tags        auth
+// @Produce     json
+// @Security    BearerAuth
+// @Param       id      query  string  false  "Session ID (DELETE only)"
+// @Param       others  query  bool    false  "Sign out all other sessions (DELETE only)"
+// @Success     200   {object}  utils.APIResponse{data=[]models.Session}
+// @Success     200   {object}  utils.APIResponse{data=models.SessionsRevoked}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     404   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/sessions [get]
+// @Router      /api/auth/sessions [delete]
+func (ac *AuthController) SessionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			utils.WriteMethodNotAllowed(w, "GET, DELETE")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			sessions, err := ac.refreshTokenService.ListSessions(claims.UserID)
+			if err != nil {
+				utils.WriteInternalServerError(w, "Failed to retrieve sessions", err)
+				return
+			}
+			for _, session := range sessions {
+				session.Current = session.ID == claims.SessionID
+			}
+			utils.WriteOK(w, sessions, "Sessions retrieved successfully")
+
+		case http.MethodDelete:
+			if r.URL.Query().Get("others") == "true" {
+				if claims.SessionID == "" {
+					utils.WriteBadRequest(w, "The current token does not belong to a session", nil)
+					return
+				}
+
+				sessionIDs, err := ac.revocationService.RevokeOtherSessions(claims.UserID, claims.SessionID, "logout_others")
+				if err != nil {
+					utils.WriteInternalServerError(w, "Failed to revoke sessions", err)
+					return
+				}
+
+				ac.publishSessionsRevoked(claims.UserID, claims.Email, "logout_others", sessionIDs)
+				utils.WriteOK(w, &models.SessionsRevoked{Revoked: len(sessionIDs)}, "Signed out of all other sessions")
+				return
+			}
+
+			sessionID := r.URL.Query().Get("id")
+			if sessionID == "" {
+				utils.WriteBadRequest(w, "Missing session ID", nil)
+				return
+			}
+
+			if err := ac.revocationService.RevokeUserSession(claims.UserID, sessionID, "session_revoked"); err != nil {
+				if errors.Is(err, services.ErrSessionNotFound) {
+					utils.WriteNotFound(w, "Session not found")
+					return
+				}
+				utils.WriteInternalServerError(w, "Failed to revoke session", err)
+				return
+			}
+
+			ac.publishSessionsRevoked(claims.UserID, claims.Email, "session_revoked", []string{sessionID})
+			utils.WriteOK(w, &models.SessionsRevoked{Revoked: 1}, "Session signed out")
+		}
+	}
+}
+
+// LoginHistoryHandler lists the login history of the current user
+// @Summary     Login history
+// @Description List the logins, failed logins, token refreshes and logouts of the current user with their client IP address and device, newest first. Failed logins are included when they named the user's email.
+// @Tags        auth
+// @Produce     json
+// @Security    BearerAuth
+// @Param       from    query  string  false  "Start of the time range (RFC 3339)"
+// @Param       to      query  string  false  "End of the time range (RFC 3339)"
+// @Param       limit   query  int     false  "Maximum number of entries (default 50, at most 500)"
+// @Param       offset  query  int     false  "Number of entries to skip"
+// @Success     200   {object}  utils.APIResponse{data=[]models.LoginEvent}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/login-history [get]
+func (ac *AuthController) LoginHistoryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			utils.WriteMethodNotAllowed(w, "GET")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		filter, err := loginHistoryFilter(r)
+		if err != nil {
+			utils.WriteBadRequest(w, err.Error(), nil)
+			return
+		}
+		filter.UserID = claims.UserID
+
+		history, err := ac.loginHistoryService.List(filter)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to retrieve login history", err)
+			return
+		}
+
+		utils.WriteOK(w, history, "Login history retrieved successfully")
+	}
+}
+
+// AdminUserSessionsHandler lists or signs out the login sessions of any user
+// @Summary     Manage a user's sessions
+// @Description GET lists the active login sessions of the user given by the user_id query parameter. DELETE signs out the session given by the id query parameter (Admin only).
+// @Tags        admin
+// @Produce     json
+// @Security    BearerAuth
+// @Param       user_id  query  int     true   "User ID"
+// @Param       id       query  string  false  "Session ID (DELETE only)"
+// @Success     200   {object}  utils.APIResponse{data=[]models.Session}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     404   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/admin/user-sessions [get]
+// @Router      /api/admin/user-sessions [delete]
+func (ac *AuthController) AdminUserSessionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			utils.WriteMethodNotAllowed(w, "GET, DELETE")
+			return
+		}
+
+		adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			utils.WriteUnauthorized(w, "Unauthorized")
+			return
+		}
+
+		userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+		if err != nil {
+			utils.WriteBadRequest(w, "Invalid user ID", err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			sessions, err := ac.refreshTokenService.ListSessions(userID)
+			if err != nil {
+				utils.WriteInternalServerError(w, "Failed to retrieve sessions", err)
+				return
+			}
+			utils.WriteOK(w, sessions, "Sessions retrieved successfully")
+
+		case http.MethodDelete:
+			sessionID := r.URL.Query().Get("id")
+			if sessionID == "" {
+				utils.WriteBadRequest(w, "Missing session ID", nil)
+				return
+			}
+
+			if err := ac.revocationService.RevokeUserSession(userID, sessionID, "admin_session_revoked"); err != nil {
+				if errors.Is(err, services.ErrSessionNotFound) {
+					utils.WriteNotFound(w, "Session not found")
+					return
+				}
+				utils.WriteInternalServerError(w, "Failed to revoke session", err)
+				return
+			}
+
+			ac.publishSessionsRevoked(userID, "", "admin_session_revoked", []string{sessionID})
+			ac.publishAdminAction(adminUserID, "session_revoked", fmt.Sprintf("Signed out session %s of user %d", sessionID, userID))
+			utils.WriteOK(w, &models.SessionsRevoked{Revoked: 1}, "Session signed out")
+		}
+	}
+}
+
+// ForceLogoutHandler signs a user out of every session and revokes all their tokens
+// @Summary     Force logout
+// @Description Revoke every access and refresh token of a user, signing them out on all devices (Admin only). Personal access tokens are not affected.
+// @Tags        admin
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       request  body  models.ForceLogoutRequest  true  "User to sign out"
+// @Success     200   {object}  utils.APIResponse{data=LogoutResponse}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     404   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/admin/force-logout [post]
+func (ac *AuthController) ForceLogoutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			utils.WriteUnauthorized(w, "Unauthorized")
+			return
+		}
+
+		var req models.ForceLogoutRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteBadRequest(w, "Invalid request body", err)
+			return
+		}
+
+		user, err := ac.userService.GetUserByID(req.UserID)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+			return
+		}
+		if user == nil {
+			utils.WriteNotFound(w, "User not found")
+			return
+		}
+
+		if err := ac.revokeCredentials(user.ID, "admin_force_logout"); err != nil {
+			utils.WriteInternalServerError(w, "Failed to revoke sessions", err)
+			return
+		}
+
+		ac.publishAdminAction(adminUserID, "force_logout", fmt.Sprintf("Signed out %s (%d) from all devices", user.Email, user.ID))
+
+		response := &LogoutResponse{
+			Message: fmt.Sprintf("Signed out %s from all devices", user.Email),
+		}
+
+		utils.WriteOK(w, response, "Logout successful")
+	}
+}
+
+// revokeCredentials signs a user out of every session and revokes their personal access tokens,
+// for when a credential may have leaked. A token minted from a stolen session must not outlive it.
+func (ac *AuthController) revokeCredentials(userID int, reason string) error {
+	if err := ac.revocationService.RevokeAllForUser(userID, reason); err != nil {
+		return err
+	}
+	return ac.accessTokenService.RevokeAllTokens(userID)
+}
+
+// sessionDevice describes the client a request comes from, for the session list
+func sessionDevice(r *http.Request) services.SessionDevice {
+	return services.SessionDevice{
+		IPAddress: middleware.ClientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// publishSessionsRevoked publishes the remote sign-out of login sessions
+func (ac *AuthController) publishSessionsRevoked(userID int, email, reason string, sessionIDs []string) {
+	if ac.eventService == nil || len(sessionIDs) == 0 {
+		return
+	}
+
+	if err := ac.eventService.PublishSessionsRevoked(userID, email, reason, sessionIDs); err != nil {
+		fmt.Printf("Warning: Failed to publish sessions revoked event: %v\n", err)
+	}
+}
+
+// publishAdminAction records an action an admin took on another user in the admin audit stream
+func (ac *AuthController) publishAdminAction(adminUserID int, action, details string) {
+	if ac.eventService == nil {
+		return
+	}
+
+	if err := ac.eventService.PublishAdminEvent(adminUserID, action, details, nil); err != nil {
+		fmt.Printf("Warning: Failed to publish admin event: %v\n", err)
+	}
+}
@@ -2,150 +2,128 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
-	"github.com/frallan97/hackaton-demo-backend/config"
-	"github.com/frallan97/hackaton-demo-backend/database"
+	"github.com/frallan97/hackaton-demo-backend/events"
+	"github.com/frallan97/hackaton-demo-backend/middleware"
+	"github.com/frallan97/hackaton-demo-backend/models"
 	"github.com/frallan97/hackaton-demo-backend/services"
 )
 
 // SetupController handles initial setup operations
 type SetupController struct {
-	adminService *services.AdminService
-	userService  *services.UserService
-	roleService  *services.RoleService
-	jwtService   *services.JWTService
-	config       *config.Config
+	setupService *services.SetupService
+	eventService *events.EventService
 }
 
 // NewSetupController creates a new setup controller
-func NewSetupController(dbManager *database.DBManager, jwtService *services.JWTService, config *config.Config) *SetupController {
+func NewSetupController(setupService *services.SetupService, eventService *events.EventService) *SetupController {
 	return &SetupController{
-		adminService: services.NewAdminService(dbManager.DB),
-		userService:  services.NewUserService(dbManager.DB),
-		roleService:  services.NewRoleService(dbManager.DB),
-		jwtService:   jwtService,
-		config:       config,
+		setupService: setupService,
+		eventService: eventService,
 	}
 }
 
-// MakeFirstUserAdminHandler assigns admin role to the first user in the system
-// This is a convenience endpoint for initial setup
-// @Summary Make first user admin
-// @Description Assigns admin role to the first user if no admin exists yet
+// SetupStatusHandler reports whether the first admin still has to be set up
+// @Summary Setup status
+// @Description Reports whether no admin exists yet, so the first admin can be promoted with the setup token
 // @Tags setup
 // @Produce json
-// @Success 200 {string} string "Admin role assigned successfully"
-// @Router /api/setup/first-admin [post]
-func (sc *SetupController) MakeFirstUserAdminHandler() http.HandlerFunc {
+// @Success 200 {object} models.SetupStatus
+// @Router /api/setup/status [get]
+func (sc *SetupController) SetupStatusHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
+		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		// Check if there are any admins already
-		users, err := sc.adminService.GetAllUsersWithRolesAndOrganizations()
+		required, err := sc.setupService.Required()
 		if err != nil {
-			http.Error(w, "Failed to check existing users", http.StatusInternalServerError)
-			return
-		}
-
-		// Check if any user already has admin role
-		hasAdmin := false
-		for _, user := range users {
-			for _, role := range user.Roles {
-				if role.Name == "admin" {
-					hasAdmin = true
-					break
-				}
-			}
-			if hasAdmin {
-				break
-			}
-		}
-
-		if hasAdmin {
-			http.Error(w, "Admin user already exists", http.StatusConflict)
-			return
-		}
-
-		if len(users) == 0 {
-			http.Error(w, "No users found in system", http.StatusNotFound)
-			return
-		}
-
-		// Get the first user
-		firstUser := users[0]
-
-		// Get admin role
-		adminRole, err := sc.roleService.GetRoleByName("admin")
-		if err != nil {
-			http.Error(w, "Admin role not found", http.StatusInternalServerError)
-			return
-		}
-
-		// Assign admin role to first user (self-assigned)
-		err = sc.adminService.AssignRoleToUser(firstUser.ID, adminRole.ID, firstUser.ID)
-		if err != nil {
-			http.Error(w, "Failed to assign admin role", http.StatusInternalServerError)
+			http.Error(w, "Failed to check setup status", http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"message":   "Admin role assigned successfully to first user",
-			"user_id":   firstUser.ID,
-			"user_name": firstUser.Name,
-		})
+		json.NewEncoder(w).Encode(&models.SetupStatus{SetupRequired: required})
 	}
 }
 
-// GenerateDevTokenHandler creates a long-lived development token for Cursor AI
-// This should only be used in development environments
-func (sc *SetupController) GenerateDevTokenHandler() http.HandlerFunc {
+// MakeFirstUserAdminHandler assigns the admin role to the user with the given email
+// @Summary Make first admin
+// @Description Assigns the admin role to the active user with the given email. Needs the one-time setup token from SETUP_TOKEN, SETUP_TOKEN_FILE or the startup log, and stops working once an admin exists.
+// @Tags setup
+// @Accept json
+// @Produce json
+// @Param request body models.SetupRequest true "Email of the user to promote and the setup token"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {string} string "Invalid request"
+// @Failure 403 {string} string "Invalid setup token"
+// @Failure 404 {string} string "Setup already completed or user not found"
+// @Router /api/setup/first-admin [post]
+func (sc *SetupController) MakeFirstUserAdminHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		// Check if we're in development mode
-		if sc.config.Environment != "development" {
-			http.Error(w, "Development token endpoint is only available in development mode", http.StatusForbidden)
+		var req models.SetupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
 			return
 		}
 
-		// Get the first user (or create a dev user)
-		users, err := sc.adminService.GetAllUsersWithRolesAndOrganizations()
-		if err != nil {
-			http.Error(w, "Failed to get users", http.StatusInternalServerError)
+		if req.Email == "" || req.SetupToken == "" {
+			http.Error(w, "Email and setup token are required", http.StatusBadRequest)
 			return
 		}
 
-		if len(users) == 0 {
-			http.Error(w, "No users found. Please create a user first by logging in.", http.StatusNotFound)
+		user, adminRoleID, err := sc.setupService.Bootstrap(req.SetupToken, req.Email)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrSetupComplete):
+				// Once an admin exists the endpoint behaves as if it did not exist
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, services.ErrInvalidSetupToken):
+				sc.publishSetupFailure(r)
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, services.ErrSetupUserNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			default:
+				http.Error(w, "Failed to assign admin role", http.StatusInternalServerError)
+			}
 			return
 		}
 
-		// Use the first user
-		user := users[0]
-
-		// Generate the token using JWT service (which has the correct secret key)
-		tokenString, _, err := sc.jwtService.GenerateTokens(&user.User)
-		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-			return
+		if sc.eventService != nil {
+			if err := sc.eventService.PublishAdminBootstrapped(user.ID, user.Email, middleware.ClientIP(r)); err != nil {
+				fmt.Printf("Warning: Failed to publish admin bootstrap event: %v\n", err)
+			}
+			// Drops the authorization snapshots of the new admin, which still lack the role
+			if err := sc.eventService.PublishRoleAssigned(user.ID, adminRoleID, "admin"); err != nil {
+				fmt.Printf("Warning: Failed to publish role assigned event: %v\n", err)
+			}
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"message":      "Development token generated successfully",
-			"token":        tokenString,
-			"user_id":      user.ID,
-			"user_email":   user.Email,
-			"expires_days": 30,
-			"usage":        "Add this as 'Authorization: Bearer <token>' header in your requests",
+			"message":   "Admin role assigned successfully",
+			"user_id":   user.ID,
+			"user_name": user.Name,
 		})
 	}
 }
+
+// publishSetupFailure records an attempt to bootstrap the first admin with a wrong token
+func (sc *SetupController) publishSetupFailure(r *http.Request) {
+	if sc.eventService == nil {
+		return
+	}
+
+	if err := sc.eventService.PublishAuthFailure(0, "", "setup_first_admin", "invalid setup token", middleware.RequestClientInfo(r)); err != nil {
+		fmt.Printf("Warning: Failed to publish auth failure event: %v\n", err)
+	}
+}
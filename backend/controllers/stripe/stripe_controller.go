@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/frallan97/hackaton-demo-backend/middleware"
 	"github.com/frallan97/hackaton-demo-backend/models"
 	stripeService "github.com/frallan97/hackaton-demo-backend/services/stripe"
 	"github.com/frallan97/hackaton-demo-backend/utils"
@@ -43,7 +44,7 @@ func (sc *StripeController) CreateCheckoutSessionHandler() http.HandlerFunc {
 		}
 
 		// Get user ID from context (set by auth middleware)
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := middleware.GetUserIDFromContext(r.Context())
 		if !ok {
 			utils.WriteUnauthorized(w, "User not authenticated")
 			return
@@ -86,7 +87,7 @@ func (sc *StripeController) GetPaymentHistoryHandler() http.HandlerFunc {
 		}
 
 		// Get user ID from context (set by auth middleware)
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := middleware.GetUserIDFromContext(r.Context())
 		if !ok {
 			utils.WriteUnauthorized(w, "User not authenticated")
 			return
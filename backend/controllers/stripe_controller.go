@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/frallan97/hackaton-demo-backend/config"
+	"github.com/frallan97/hackaton-demo-backend/middleware"
 	"github.com/frallan97/hackaton-demo-backend/models"
 	"github.com/frallan97/hackaton-demo-backend/services"
 	"github.com/frallan97/hackaton-demo-backend/utils"
@@ -40,7 +41,7 @@ func (c *StripeController) CreateCheckoutSessionHandler() http.HandlerFunc {
 		}
 
 		// Get user ID from context (set by auth middleware)
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := middleware.GetUserIDFromContext(r.Context())
 		if !ok {
 			utils.WriteUnauthorized(w, "User not authenticated")
 			return
@@ -123,7 +124,7 @@ func (c *StripeController) GetUserSubscriptionHandler() http.HandlerFunc {
 		}
 
 		// Get user ID from context
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := middleware.GetUserIDFromContext(r.Context())
 		if !ok {
 			utils.WriteUnauthorized(w, "User not authenticated")
 			return
@@ -156,7 +157,7 @@ func (c *StripeController) GetUserSubscriptionHistoryHandler() http.HandlerFunc
 		}
 
 		// Get user ID from context
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := middleware.GetUserIDFromContext(r.Context())
 		if !ok {
 			utils.WriteUnauthorized(w, "User not authenticated")
 			return
@@ -181,7 +182,7 @@ func (c *StripeController) GetUserPaymentHistoryHandler() http.HandlerFunc {
 		}
 
 		// Get user ID from context
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := middleware.GetUserIDFromContext(r.Context())
 		if !ok {
 			utils.WriteUnauthorized(w, "User not authenticated")
 			return
@@ -206,7 +207,7 @@ func (c *StripeController) CancelSubscriptionHandler() http.HandlerFunc {
 		}
 
 		// Get user ID from context
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := middleware.GetUserIDFromContext(r.Context())
 		if !ok {
 			utils.WriteUnauthorized(w, "User not authenticated")
 			return
@@ -230,7 +231,7 @@ func (c *StripeController) ReactivateSubscriptionHandler() http.HandlerFunc {
 		}
 
 		// Get user ID from context
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := middleware.GetUserIDFromContext(r.Context())
 		if !ok {
 			utils.WriteUnauthorized(w, "User not authenticated")
 			return
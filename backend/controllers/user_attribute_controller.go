@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/frallan97/hackaton-demo-backend/events"
+	"github.com/frallan97/hackaton-demo-backend/middleware"
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/services"
+)
+
+// UserAttributeController handles admin management of custom user attributes
+type UserAttributeController struct {
+	userProfileService *services.UserProfileService
+	eventService       *events.EventService
+}
+
+// NewUserAttributeController creates a new user attribute controller
+func NewUserAttributeController(userProfileService *services.UserProfileService, eventService *events.EventService) *UserAttributeController {
+	return &UserAttributeController{
+		userProfileService: userProfileService,
+		eventService:       eventService,
+	}
+}
+
+// UserAttributesHandler lists, defines and removes custom user attributes
+// @Summary Manage custom user attributes
+// @Description GET lists the custom attributes users can have, POST defines one with a type (string, number or boolean), optional allowed values and whether users can set it themselves. DELETE removes the attribute given by the id query parameter together with its value on every user (Admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.UserAttributeDefinitionCreate false "Attribute (POST only)"
+// @Param id query int false "Attribute ID (DELETE only)"
+// @Success 200 {array} models.UserAttributeDefinition
+// @Router /api/admin/user-attributes [get]
+// @Router /api/admin/user-attributes [post]
+// @Router /api/admin/user-attributes [delete]
+func (uc *UserAttributeController) UserAttributesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			definitions, err := uc.userProfileService.ListAttributeDefinitions()
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(definitions)
+		case http.MethodPost:
+			var req models.UserAttributeDefinitionCreate
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if validationErrors := services.ValidateAttributeDefinitionInput(&req); len(validationErrors) > 0 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(validationErrors)
+				return
+			}
+
+			definition, err := uc.userProfileService.CreateAttributeDefinition(&req)
+			if err != nil {
+				if errors.Is(err, services.ErrUserAttributeExists) {
+					http.Error(w, err.Error(), http.StatusConflict)
+				} else {
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			uc.publishAdminAction(adminUserID, "user_attribute_created", fmt.Sprintf("Defined user attribute %s (%s)", definition.Name, definition.Type))
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(definition)
+		case http.MethodDelete:
+			definitionID, err := strconv.Atoi(r.URL.Query().Get("id"))
+			if err != nil {
+				http.Error(w, "Invalid attribute ID", http.StatusBadRequest)
+				return
+			}
+
+			definition, err := uc.userProfileService.DeleteAttributeDefinition(definitionID)
+			if err != nil {
+				if errors.Is(err, services.ErrUserAttributeNotFound) {
+					http.Error(w, err.Error(), http.StatusNotFound)
+				} else {
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			uc.publishAdminAction(adminUserID, "user_attribute_deleted", fmt.Sprintf("Removed user attribute %s", definition.Name))
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": "User attribute removed successfully"})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// UserAttributeValuesHandler shows or sets the custom attributes of a user
+// @Summary Manage the custom attributes of a user
+// @Description GET returns the custom attributes of the user given by the user_id query parameter. PATCH merges the given values into them, including attributes users can not set themselves; a null value removes an attribute (Admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query int true "User ID"
+// @Param request body object false "Attribute values by name (PATCH only)"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/admin/user-attributes/values [get]
+// @Router /api/admin/user-attributes/values [patch]
+func (uc *UserAttributeController) UserAttributeValuesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminUserID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodPatch {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var profile *models.UserProfile
+		if r.Method == http.MethodGet {
+			profile, err = uc.userProfileService.GetProfile(userID)
+		} else {
+			var values map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			definitions, err := uc.userProfileService.ListAttributeDefinitions()
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			update := &models.UserProfileUpdate{CustomAttributes: values}
+			if validationErrors := services.ValidateProfileUpdate(update, definitions, true); len(validationErrors) > 0 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(validationErrors)
+				return
+			}
+
+			profile, err = uc.userProfileService.UpdateProfile(userID, update)
+			if err == nil && profile != nil {
+				uc.publishProfileUpdated(profile, profileUpdateFields(update), adminUserID)
+			}
+		}
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if profile == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile.CustomAttributes)
+	}
+}
+
+// publishProfileUpdated records a change of a user's custom attributes by an admin
+func (uc *UserAttributeController) publishProfileUpdated(profile *models.UserProfile, fields []string, adminUserID int) {
+	if uc.eventService == nil || len(fields) == 0 {
+		return
+	}
+
+	if err := uc.eventService.PublishProfileUpdated(profile.UserID, profile.Email, fields, adminUserID); err != nil {
+		fmt.Printf("Warning: Failed to publish profile updated event: %v\n", err)
+	}
+}
+
+// publishAdminAction records a change of the attribute definitions in the admin audit stream
+func (uc *UserAttributeController) publishAdminAction(adminUserID int, action, details string) {
+	if uc.eventService == nil {
+		return
+	}
+
+	if err := uc.eventService.PublishAdminEvent(adminUserID, action, details, nil); err != nil {
+		fmt.Printf("Warning: Failed to publish admin event: %v\n", err)
+	}
+}
@@ -0,0 +1,397 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/frallan97/hackaton-demo-backend/services"
+	"github.com/frallan97/hackaton-demo-backend/utils"
+)
+
+const passkeyLoginAction = "passkey_login"
+
+// PasskeysHandler lists or removes the passkeys of the current user
+// @Summary     List or remove passkeys
+// @Description GET lists the passkeys of the current user. DELETE removes the passkey given by the id query parameter and needs a step-up token if the user has passkeys.
+// @Tags        webauthn
+// @Produce     json
+// @Security    BearerAuth
+// @Param       id               query   int     false  "Passkey ID (DELETE only)"
+// @Param       X-Step-Up-Token  header  string  false  "Step-up token (DELETE only)"
+// @Success     200   {object}  utils.APIResponse{data=[]models.WebAuthnCredential}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     403   {object}  utils.APIResponse
+// @Failure     404   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/webauthn/credentials [get]
+// @Router      /api/auth/webauthn/credentials [delete]
+func (ac *AuthController) PasskeysHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			utils.WriteMethodNotAllowed(w, "GET, DELETE")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			credentials, err := ac.webAuthnService.ListCredentials(claims.UserID)
+			if err != nil {
+				utils.WriteInternalServerError(w, "Failed to retrieve passkeys", err)
+				return
+			}
+			utils.WriteOK(w, credentials, "Passkeys retrieved successfully")
+
+		case http.MethodDelete:
+			credentialID, err := strconv.Atoi(r.URL.Query().Get("id"))
+			if err != nil {
+				utils.WriteBadRequest(w, "Invalid passkey ID", err)
+				return
+			}
+
+			if err := ac.webAuthnService.DeleteCredential(claims.UserID, credentialID); err != nil {
+				if errors.Is(err, services.ErrWebAuthnCredentialNotFound) {
+					utils.WriteNotFound(w, "Passkey not found")
+					return
+				}
+				utils.WriteInternalServerError(w, "Failed to remove passkey", err)
+				return
+			}
+
+			ac.publishPasskeyChanged(claims.UserID, claims.Email, false)
+			utils.WriteOK(w, nil, "Passkey removed")
+		}
+	}
+}
+
+// PasskeyRegisterBeginHandler starts adding a passkey to the current user
+// @Summary     Start passkey registration
+// @Description Returns options for navigator.credentials.create(). Users who already have a passkey need a step-up token to add another.
+// @Tags        webauthn
+// @Produce     json
+// @Security    BearerAuth
+// @Param       X-Step-Up-Token  header  string  false  "Step-up token, if the user already has passkeys"
+// @Success     200   {object}  utils.APIResponse{data=models.WebAuthnCreationOptions}
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     403   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/webauthn/register/begin [post]
+func (ac *AuthController) PasskeyRegisterBeginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		user, err := ac.userService.GetUserByID(claims.UserID)
+		if err != nil || user == nil {
+			utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+			return
+		}
+
+		options, err := ac.webAuthnService.BeginRegistration(user)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to start passkey registration", err)
+			return
+		}
+
+		utils.WriteOK(w, options, "Create a passkey with these options")
+	}
+}
+
+// PasskeyRegisterFinishHandler stores a new passkey for the current user
+// @Summary     Finish passkey registration
+// @Description Verify the credential returned by navigator.credentials.create() and store it as a passkey
+// @Tags        webauthn
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       passkey  body   models.WebAuthnRegisterInput  true  "Passkey name and credential"
+// @Success     201   {object}  utils.APIResponse{data=models.WebAuthnCredential}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     409   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/webauthn/register/finish [post]
+func (ac *AuthController) PasskeyRegisterFinishHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		var req models.WebAuthnRegisterInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteBadRequest(w, "Invalid request body", err)
+			return
+		}
+
+		if len(req.Name) > 100 {
+			utils.WriteValidationError(w, map[string]string{
+				"name": "Name must be at most 100 characters",
+			})
+			return
+		}
+
+		credential, err := ac.webAuthnService.FinishRegistration(claims.UserID, req.Name, &req.Credential)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrInvalidWebAuthnResponse), errors.Is(err, services.ErrWebAuthnChallengeNotFound):
+				utils.WriteBadRequest(w, "Passkey could not be verified", err)
+			case errors.Is(err, services.ErrWebAuthnCredentialExists):
+				utils.WriteConflict(w, "Passkey is already registered", nil)
+			default:
+				utils.WriteInternalServerError(w, "Failed to register passkey", err)
+			}
+			return
+		}
+
+		ac.publishPasskeyChanged(claims.UserID, claims.Email, true)
+		utils.WriteCreated(w, credential, "Passkey registered")
+	}
+}
+
+// PasskeyLoginBeginHandler starts a passkey login
+// @Summary     Start passkey login
+// @Description Returns options for navigator.credentials.get(). The email is optional; without it the browser offers every passkey it holds for this site.
+// @Tags        webauthn
+// @Accept      json
+// @Produce     json
+// @Param       login  body   models.WebAuthnLoginBeginInput  false  "Optional email"
+// @Success     200   {object}  utils.APIResponse{data=models.WebAuthnRequestOptions}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/webauthn/login/begin [post]
+func (ac *AuthController) PasskeyLoginBeginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		var req models.WebAuthnLoginBeginInput
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				utils.WriteBadRequest(w, "Invalid request body", err)
+				return
+			}
+		}
+
+		options, err := ac.webAuthnService.BeginLogin(req.Email)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Failed to start passkey login", err)
+			return
+		}
+
+		utils.WriteOK(w, options, "Sign in with a passkey using these options")
+	}
+}
+
+// PasskeyLoginFinishHandler signs a user in with a passkey
+// @Summary     Finish passkey login
+// @Description Verify the assertion returned by navigator.credentials.get(). Passkeys that verified the user (PIN or biometric) count as multi-factor; otherwise users with MFA enabled get an MFA challenge as with other logins.
+// @Tags        webauthn
+// @Accept      json
+// @Produce     json
+// @Param       credential  body   models.WebAuthnAssertionCredential  true  "Assertion"
+// @Success     200   {object}  utils.APIResponse{data=models.AuthResponse}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/webauthn/login/finish [post]
+func (ac *AuthController) PasskeyLoginFinishHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		var req models.WebAuthnAssertionCredential
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteBadRequest(w, "Invalid request body", err)
+			return
+		}
+
+		// Failures count against the account of the passkey, which is refused while locked out
+		email, err := ac.webAuthnService.CredentialEmail(&req)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidWebAuthnResponse) || errors.Is(err, services.ErrWebAuthnCredentialNotFound) {
+				ac.publishAuthFailure(r, "", passkeyLoginAction, err.Error())
+				utils.WriteUnauthorized(w, "Passkey could not be verified")
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to verify passkey", err)
+			return
+		}
+
+		if ac.refuseLockedOut(w, r, email) {
+			return
+		}
+
+		userID, userVerified, err := ac.webAuthnService.FinishLogin(&req)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidWebAuthnResponse) ||
+				errors.Is(err, services.ErrWebAuthnChallengeNotFound) ||
+				errors.Is(err, services.ErrWebAuthnCredentialNotFound) {
+				ac.publishAuthFailure(r, email, passkeyLoginAction, err.Error())
+				utils.WriteUnauthorized(w, "Passkey could not be verified")
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to verify passkey", err)
+			return
+		}
+
+		user, err := ac.userService.GetUserByID(userID)
+		if err != nil {
+			utils.WriteInternalServerError(w, "Database error while retrieving user", err)
+			return
+		}
+
+		if user == nil {
+			ac.publishAuthFailure(r, "", passkeyLoginAction, "account_inactive")
+			utils.WriteUnauthorized(w, "User account is not active")
+			return
+		}
+
+		// Update last login time
+		if err := ac.userService.UpdateUserLastLogin(user.ID); err != nil {
+			// Log error but don't fail the login
+			fmt.Printf("failed to update last login: %v\n", err)
+		}
+
+		// Possession of the passkey plus a PIN or biometric is already two factors
+		if userVerified {
+			ac.completeLogin(w, r, user, true, passkeyLoginAction)
+			return
+		}
+
+		ac.writeLoginSuccess(w, r, user, passkeyLoginAction)
+	}
+}
+
+// StepUpBeginHandler starts re-confirming the current user with a passkey
+// @Summary     Start step-up authentication
+// @Description Returns options for navigator.credentials.get() limited to the current user's passkeys
+// @Tags        webauthn
+// @Produce     json
+// @Security    BearerAuth
+// @Success     200   {object}  utils.APIResponse{data=models.WebAuthnRequestOptions}
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     409   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/webauthn/step-up/begin [post]
+func (ac *AuthController) StepUpBeginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		options, err := ac.webAuthnService.BeginStepUp(claims.UserID)
+		if err != nil {
+			if errors.Is(err, services.ErrNoPasskeys) {
+				utils.WriteConflict(w, "Register a passkey first", nil)
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to start step-up authentication", err)
+			return
+		}
+
+		utils.WriteOK(w, options, "Confirm with a passkey using these options")
+	}
+}
+
+// StepUpFinishHandler verifies a fresh passkey assertion of the current user
+// @Summary     Finish step-up authentication
+// @Description Verify the assertion returned by navigator.credentials.get() and issue a step-up token. Send it in the X-Step-Up-Token header of one sensitive request within five minutes.
+// @Tags        webauthn
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Param       credential  body   models.WebAuthnAssertionCredential  true  "Assertion"
+// @Success     200   {object}  utils.APIResponse{data=models.StepUpToken}
+// @Failure     400   {object}  utils.APIResponse
+// @Failure     401   {object}  utils.APIResponse
+// @Failure     405   {object}  utils.APIResponse
+// @Failure     500   {object}  utils.APIResponse
+// @Router      /api/auth/webauthn/step-up/finish [post]
+func (ac *AuthController) StepUpFinishHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			utils.WriteMethodNotAllowed(w, "POST")
+			return
+		}
+
+		claims, err := ac.claimsFromRequest(r)
+		if err != nil {
+			utils.WriteUnauthorized(w, err.Error())
+			return
+		}
+
+		var req models.WebAuthnAssertionCredential
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteBadRequest(w, "Invalid request body", err)
+			return
+		}
+
+		token, err := ac.webAuthnService.FinishStepUp(claims.UserID, &req)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidWebAuthnResponse) ||
+				errors.Is(err, services.ErrWebAuthnChallengeNotFound) ||
+				errors.Is(err, services.ErrWebAuthnCredentialNotFound) {
+				ac.publishAuthFailure(r, "", "step_up", err.Error())
+				utils.WriteBadRequest(w, "Passkey could not be verified", err)
+				return
+			}
+			utils.WriteInternalServerError(w, "Failed to verify passkey", err)
+			return
+		}
+
+		utils.WriteOK(w, token, "Step-up authentication successful")
+	}
+}
+
+// publishPasskeyChanged publishes a user.passkey_added or user.passkey_removed event
+func (ac *AuthController) publishPasskeyChanged(userID int, email string, added bool) {
+	if ac.eventService == nil {
+		return
+	}
+
+	if err := ac.eventService.PublishPasskeyChanged(userID, email, added); err != nil {
+		fmt.Printf("Warning: Failed to publish passkey event: %v\n", err)
+	}
+}
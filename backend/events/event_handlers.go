@@ -34,6 +34,8 @@ func (em *EventHandlerManager) registerHandlers() {
 	// Auth events
 	em.eventBus.RegisterHandler(EventTypeAuthSuccess, em.handleAuthSuccess)
 	em.eventBus.RegisterHandler(EventTypeAuthFailure, em.handleAuthFailure)
+	em.eventBus.RegisterHandler(EventTypeAuthLockout, em.handleSecurityAlert)
+	em.eventBus.RegisterHandler(EventTypeAuthAnomaly, em.handleSecurityAlert)
 
 	// Role events
 	em.eventBus.RegisterHandler(EventTypeRoleAssigned, em.handleRoleAssigned)
@@ -118,20 +120,21 @@ func (em *EventHandlerManager) handleAuthSuccess(ctx context.Context, event Even
 	return nil
 }
 
-// handleAuthFailure handles failed authentication events
+// handleAuthFailure handles failed authentication events. Failures are counted towards
+// lockouts by the security service, which subscribes to the auth topic itself.
 func (em *EventHandlerManager) handleAuthFailure(ctx context.Context, event Event) error {
-	log.Printf("Handling auth failure event: %s for user %v", event.ID, event.Data[DataKeyUserID])
-
-	// Here you could:
-	// - Update failure metrics
-	// - Check for brute force attempts
-	// - Send security alerts
-	// - Log failed attempt details
-
-	// Simulate some async work
-	time.Sleep(40 * time.Millisecond)
+	log.Printf("Auth failure: %v from %v (%v): %v", event.Data[DataKeyAction], event.Data[DataKeyIPAddress], event.Data[DataKeyEmail], event.Data[DataKeyError])
+	return nil
+}
 
-	log.Printf("Auth failure event processed successfully: %s", event.ID)
+// handleSecurityAlert logs lockouts and login anomalies for operators
+func (em *EventHandlerManager) handleSecurityAlert(ctx context.Context, event Event) error {
+	switch event.Type {
+	case EventTypeAuthLockout:
+		log.Printf("🔒 Locked out %v %v until %v after %v", event.Data[DataKeyLockoutScope], event.Data[DataKeySubject], event.Data[DataKeyLockedUntil], event.Data[DataKeyDetails])
+	case EventTypeAuthAnomaly:
+		log.Printf("⚠️ Login anomaly %v for user %v from %v: %v", event.Data[DataKeyAnomaly], event.Data[DataKeyUserID], event.Data[DataKeyIPAddress], event.Data[DataKeyDetails])
+	}
 	return nil
 }
 
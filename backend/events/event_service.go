@@ -1,5 +1,10 @@
 package events
 
+import (
+	"fmt"
+	"time"
+)
+
 // EventService provides a high-level interface for event operations
 type EventService struct {
 	eventBus EventBus
@@ -116,29 +121,230 @@ func (es *EventService) PublishUserCreated(userID int, email, name string) error
 	return es.PublishUserEvent(EventTypeUserCreated, userID, email, name, nil)
 }
 
+// PublishSignupAllowed publishes a user created event recording why the sign-up policy admitted the user
+func (es *EventService) PublishSignupAllowed(userID int, email, name, reason string, pendingApproval bool) error {
+	data := map[string]interface{}{
+		DataKeyReason:          reason,
+		DataKeyPendingApproval: pendingApproval,
+	}
+	return es.PublishUserEvent(EventTypeUserCreated, userID, email, name, data)
+}
+
+// PublishSignupDenied publishes an auth failure event recording why the sign-up policy refused a login
+func (es *EventService) PublishSignupDenied(email, action, reason string) error {
+	data := map[string]interface{}{
+		DataKeyError:  "sign-up not allowed",
+		DataKeyReason: reason,
+	}
+	return es.PublishAuthEvent(EventTypeAuthFailure, 0, email, action, false, data)
+}
+
+// PublishSignupReviewed publishes an event when an admin approves or rejects a pending sign-up
+func (es *EventService) PublishSignupReviewed(userID int, email string, approved bool, performedBy int) error {
+	eventType := EventTypeUserRejected
+	if approved {
+		eventType = EventTypeUserApproved
+	}
+	data := map[string]interface{}{
+		DataKeyPerformedBy: performedBy,
+	}
+	return es.PublishUserEvent(eventType, userID, email, "", data)
+}
+
 // PublishUserLogin publishes a user login event
-func (es *EventService) PublishUserLogin(userID int, email, name string) error {
-	return es.PublishUserEvent(EventTypeUserLogin, userID, email, name, nil)
+func (es *EventService) PublishUserLogin(userID int, email, name string, client *ClientInfo) error {
+	data := map[string]interface{}{}
+	client.addTo(data)
+	return es.PublishUserEvent(EventTypeUserLogin, userID, email, name, data)
+}
+
+// PublishProfileUpdated publishes an event when a user's profile is changed by the user or, for custom
+// attributes, by an admin. fields names what changed; performedBy is the user making the change.
+func (es *EventService) PublishProfileUpdated(userID int, email string, fields []string, performedBy int) error {
+	data := map[string]interface{}{
+		DataKeyFields:      fields,
+		DataKeyPerformedBy: performedBy,
+	}
+	return es.PublishUserEvent(EventTypeUserUpdated, userID, email, "", data)
+}
+
+// PublishPasswordChanged publishes an event when a user's password is changed or reset
+func (es *EventService) PublishPasswordChanged(userID int, email, action string) error {
+	data := map[string]interface{}{
+		DataKeyAction: action,
+	}
+	return es.PublishUserEvent(EventTypeUserPasswordChanged, userID, email, "", data)
+}
+
+// PublishMFAChanged publishes an event when a user turns multi-factor authentication on or off
+func (es *EventService) PublishMFAChanged(userID int, email string, enabled bool) error {
+	eventType := EventTypeUserMFADisabled
+	if enabled {
+		eventType = EventTypeUserMFAEnabled
+	}
+	return es.PublishUserEvent(eventType, userID, email, "", nil)
+}
+
+// PublishPasskeyChanged publishes an event when a user adds or removes a passkey
+func (es *EventService) PublishPasskeyChanged(userID int, email string, added bool) error {
+	eventType := EventTypeUserPasskeyRemoved
+	if added {
+		eventType = EventTypeUserPasskeyAdded
+	}
+	return es.PublishUserEvent(eventType, userID, email, "", nil)
+}
+
+// PublishAccessTokenChanged publishes an event when a personal access token is created or revoked
+func (es *EventService) PublishAccessTokenChanged(userID int, email string, tokenID int, created bool) error {
+	eventType := EventTypeUserTokenRevoked
+	if created {
+		eventType = EventTypeUserTokenCreated
+	}
+	data := map[string]interface{}{
+		DataKeyTokenID: tokenID,
+	}
+	return es.PublishUserEvent(eventType, userID, email, "", data)
+}
+
+// PublishOAuthConsentChanged publishes an event when a user grants scopes to an OAuth client or revokes its access
+func (es *EventService) PublishOAuthConsentChanged(userID int, email, clientID, scope string, granted bool) error {
+	eventType := EventTypeUserConsentRevoked
+	if granted {
+		eventType = EventTypeUserConsentGranted
+	}
+	data := map[string]interface{}{
+		DataKeyClientID: clientID,
+	}
+	if scope != "" {
+		data[DataKeyScope] = scope
+	}
+	return es.PublishUserEvent(eventType, userID, email, "", data)
+}
+
+// PublishSessionsRevoked publishes an event when login sessions of a user are signed out remotely
+func (es *EventService) PublishSessionsRevoked(userID int, email, reason string, sessionIDs []string) error {
+	data := map[string]interface{}{
+		DataKeySessionIDs: sessionIDs,
+		DataKeyReason:     reason,
+	}
+	return es.PublishUserEvent(EventTypeUserSessionsRevoked, userID, email, "", data)
 }
 
 // PublishUserLogout publishes a user logout event
-func (es *EventService) PublishUserLogout(userID int, email, name string) error {
-	return es.PublishUserEvent(EventTypeUserLogout, userID, email, name, nil)
+func (es *EventService) PublishUserLogout(userID int, email, name string, client *ClientInfo) error {
+	data := map[string]interface{}{}
+	client.addTo(data)
+	return es.PublishUserEvent(EventTypeUserLogout, userID, email, name, data)
 }
 
 // PublishAuthSuccess publishes an authentication success event
-func (es *EventService) PublishAuthSuccess(userID int, email, action string) error {
-	return es.PublishAuthEvent(EventTypeAuthSuccess, userID, email, action, true, nil)
+func (es *EventService) PublishAuthSuccess(userID int, email, action string, client *ClientInfo) error {
+	data := map[string]interface{}{}
+	client.addTo(data)
+	return es.PublishAuthEvent(EventTypeAuthSuccess, userID, email, action, true, data)
 }
 
-// PublishAuthFailure publishes an authentication failure event
-func (es *EventService) PublishAuthFailure(userID int, email, action string, errorDetails string) error {
+// PublishAuthFailure publishes an authentication failure event. Failures that name an email
+// count against that account, and failures with a client IP address against the address.
+func (es *EventService) PublishAuthFailure(userID int, email, action string, errorDetails string, client *ClientInfo) error {
 	data := map[string]interface{}{
 		DataKeyError: errorDetails,
 	}
+	client.addTo(data)
 	return es.PublishAuthEvent(EventTypeAuthFailure, userID, email, action, false, data)
 }
 
+// PublishLockout publishes an event when an account or IP address is locked out after repeated failed logins
+func (es *EventService) PublishLockout(scope, subject string, failures int, lockedUntil time.Time) error {
+	data := map[string]interface{}{
+		DataKeyLockoutScope: scope,
+		DataKeySubject:      subject,
+		DataKeyLockedUntil:  lockedUntil,
+		DataKeyDetails:      fmt.Sprintf("%d failed logins", failures),
+	}
+	return es.PublishAuthEvent(EventTypeAuthLockout, 0, "", "lockout", true, data)
+}
+
+// PublishAnomaly publishes an event when a login does not fit the user's history
+func (es *EventService) PublishAnomaly(userID int, email, anomaly, details string, client *ClientInfo) error {
+	data := map[string]interface{}{
+		DataKeyAnomaly: anomaly,
+		DataKeyDetails: details,
+	}
+	client.addTo(data)
+	return es.PublishAuthEvent(EventTypeAuthAnomaly, userID, email, "login", true, data)
+}
+
+// PublishTokenRefresh publishes a token refresh security event
+func (es *EventService) PublishTokenRefresh(userID int, email, action string, success bool, details string, client *ClientInfo) error {
+	data := map[string]interface{}{}
+	if details != "" {
+		data[DataKeyDetails] = details
+	}
+	client.addTo(data)
+	return es.PublishAuthEvent(EventTypeAuthTokenRefresh, userID, email, action, success, data)
+}
+
+// PublishTokenRevoked publishes a token revocation event so every replica drops the tokens immediately
+func (es *EventService) PublishTokenRevoked(userID int, tokenID, reason string) error {
+	data := map[string]interface{}{
+		DataKeyTokenID: tokenID,
+		DataKeyReason:  reason,
+	}
+	return es.PublishAuthEvent(EventTypeAuthTokenRevoked, userID, "", "revoke", true, data)
+}
+
+// PublishIdentityLinked publishes an event when a login identity is attached to a user
+func (es *EventService) PublishIdentityLinked(userID int, email, provider string) error {
+	data := map[string]interface{}{
+		DataKeyProvider: provider,
+	}
+	return es.PublishUserEvent(EventTypeUserIdentityLinked, userID, email, "", data)
+}
+
+// PublishIdentityUnlinked publishes an event when a login identity is removed from a user
+func (es *EventService) PublishIdentityUnlinked(userID int, email, provider string) error {
+	data := map[string]interface{}{
+		DataKeyProvider: provider,
+	}
+	return es.PublishUserEvent(EventTypeUserIdentityUnlinked, userID, email, "", data)
+}
+
+// PublishUsersMerged publishes an event when an admin merges one user into another
+func (es *EventService) PublishUsersMerged(targetUserID, sourceUserID, performedBy int) error {
+	data := map[string]interface{}{
+		DataKeyMergedUserID: sourceUserID,
+		DataKeyPerformedBy:  performedBy,
+	}
+	return es.PublishUserEvent(EventTypeUserMerged, targetUserID, "", "", data)
+}
+
+// PublishAdminBootstrapped records the promotion of the first admin with the setup token
+func (es *EventService) PublishAdminBootstrapped(userID int, email, ipAddress string) error {
+	data := map[string]interface{}{
+		DataKeyEmail:     email,
+		DataKeyIPAddress: ipAddress,
+	}
+	return es.PublishAdminEvent(userID, "first_admin_bootstrapped", "Promoted "+email+" to the first admin with the setup token", data)
+}
+
+// PublishImpersonatedRequest records a request an admin made while impersonating a user
+func (es *EventService) PublishImpersonatedRequest(adminUserID, userID int, method, path, ipAddress string) error {
+	data := map[string]interface{}{
+		DataKeyImpersonatedID: userID,
+		DataKeyIPAddress:      ipAddress,
+	}
+	return es.PublishAdminEvent(adminUserID, "impersonated_request", method+" "+path, data)
+}
+
+// PublishPolicyUpdated publishes an event when an admin publishes a new version of the access policies,
+// so that every replica evaluates the new version
+func (es *EventService) PublishPolicyUpdated(version, performedBy int) error {
+	data := BuildAdminEventData(performedBy, "policy_published", fmt.Sprintf("Published version %d of the access policies", version))
+	data[DataKeyPolicyVersion] = version
+	return es.eventBus.Publish(TopicAdmin, EventTypePolicyUpdated, data, &performedBy)
+}
+
 // PublishRoleAssigned publishes a role assigned event
 func (es *EventService) PublishRoleAssigned(userID int, roleID int, roleName string) error {
 	return es.PublishRoleEvent(EventTypeRoleAssigned, userID, roleID, roleName, nil)
@@ -3,18 +3,35 @@ package events
 // Event types for authentication
 const (
 	// User events
-	EventTypeUserCreated         = "user.created"
-	EventTypeUserUpdated         = "user.updated"
-	EventTypeUserDeleted         = "user.deleted"
-	EventTypeUserLogin           = "user.login"
-	EventTypeUserLogout          = "user.logout"
-	EventTypeUserPasswordChanged = "user.password_changed"
+	EventTypeUserCreated          = "user.created"
+	EventTypeUserUpdated          = "user.updated"
+	EventTypeUserDeleted          = "user.deleted"
+	EventTypeUserLogin            = "user.login"
+	EventTypeUserLogout           = "user.logout"
+	EventTypeUserPasswordChanged  = "user.password_changed"
+	EventTypeUserIdentityLinked   = "user.identity_linked"
+	EventTypeUserIdentityUnlinked = "user.identity_unlinked"
+	EventTypeUserMerged           = "user.merged"
+	EventTypeUserApproved         = "user.approved"
+	EventTypeUserRejected         = "user.rejected"
+	EventTypeUserMFAEnabled       = "user.mfa_enabled"
+	EventTypeUserMFADisabled      = "user.mfa_disabled"
+	EventTypeUserPasskeyAdded     = "user.passkey_added"
+	EventTypeUserPasskeyRemoved   = "user.passkey_removed"
+	EventTypeUserTokenCreated     = "user.access_token_created"
+	EventTypeUserTokenRevoked     = "user.access_token_revoked"
+	EventTypeUserConsentGranted   = "user.oauth_consent_granted"
+	EventTypeUserConsentRevoked   = "user.oauth_consent_revoked"
+	EventTypeUserSessionsRevoked  = "user.sessions_revoked"
 
 	// Authentication events
 	EventTypeAuthSuccess      = "auth.success"
 	EventTypeAuthFailure      = "auth.failure"
 	EventTypeAuthTokenRefresh = "auth.token_refresh"
 	EventTypeAuthTokenExpired = "auth.token_expired"
+	EventTypeAuthTokenRevoked = "auth.token_revoked"
+	EventTypeAuthLockout      = "auth.lockout"
+	EventTypeAuthAnomaly      = "auth.anomaly"
 
 	// Role events
 	EventTypeRoleAssigned = "role.assigned"
@@ -34,6 +51,8 @@ const (
 	EventTypeAdminAction = "admin.action"
 	EventTypeAdminLogin  = "admin.login"
 	EventTypeAdminLogout = "admin.logout"
+	// A new version of the access policies was published
+	EventTypePolicyUpdated = "admin.policy_updated"
 
 	// System events
 	EventTypeSystemStartup  = "system.startup"
@@ -55,20 +74,39 @@ const (
 
 // Event data keys
 const (
-	DataKeyUserID    = "user_id"
-	DataKeyEmail     = "email"
-	DataKeyName      = "name"
-	DataKeyRoleID    = "role_id"
-	DataKeyRoleName  = "role_name"
-	DataKeyOrgID     = "organization_id"
-	DataKeyOrgName   = "organization_name"
-	DataKeyAction    = "action"
-	DataKeyDetails   = "details"
-	DataKeyIPAddress = "ip_address"
-	DataKeyUserAgent = "user_agent"
-	DataKeyTimestamp = "timestamp"
-	DataKeyError     = "error"
-	DataKeySuccess   = "success"
+	DataKeyUserID          = "user_id"
+	DataKeyEmail           = "email"
+	DataKeyName            = "name"
+	DataKeyRoleID          = "role_id"
+	DataKeyRoleName        = "role_name"
+	DataKeyOrgID           = "organization_id"
+	DataKeyOrgName         = "organization_name"
+	DataKeyAction          = "action"
+	DataKeyDetails         = "details"
+	DataKeyIPAddress       = "ip_address"
+	DataKeyUserAgent       = "user_agent"
+	DataKeyTimestamp       = "timestamp"
+	DataKeyError           = "error"
+	DataKeySuccess         = "success"
+	DataKeyTokenID         = "token_id"
+	DataKeyClientID        = "client_id"
+	DataKeyScope           = "scope"
+	DataKeySessionIDs      = "session_ids"
+	DataKeyImpersonatedID  = "impersonated_user_id"
+	DataKeyReason          = "reason"
+	DataKeyProvider        = "provider"
+	DataKeyMergedUserID    = "merged_user_id"
+	DataKeyPerformedBy     = "performed_by"
+	DataKeyPendingApproval = "pending_approval"
+	DataKeyCountry         = "country"
+	DataKeyLatitude        = "latitude"
+	DataKeyLongitude       = "longitude"
+	DataKeyLockoutScope    = "lockout_scope"
+	DataKeySubject         = "subject"
+	DataKeyLockedUntil     = "locked_until"
+	DataKeyAnomaly         = "anomaly"
+	DataKeyFields          = "fields"
+	DataKeyPolicyVersion   = "policy_version"
 )
 
 // Common event data builders
@@ -103,6 +141,50 @@ func BuildAuthEventData(userID int, email, action string, success bool) map[stri
 	}
 }
 
+// ClientInfo describes the client an authentication attempt came from. Country and coordinates
+// are only known when the edge proxy in front of the API reports them.
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+	Country   string
+	Latitude  *float64
+	Longitude *float64
+}
+
+// addTo stores the known client details in event data
+func (c *ClientInfo) addTo(data map[string]interface{}) {
+	if c == nil {
+		return
+	}
+	if c.IPAddress != "" {
+		data[DataKeyIPAddress] = c.IPAddress
+	}
+	if c.UserAgent != "" {
+		data[DataKeyUserAgent] = c.UserAgent
+	}
+	if c.Country != "" {
+		data[DataKeyCountry] = c.Country
+	}
+	if c.Latitude != nil && c.Longitude != nil {
+		data[DataKeyLatitude] = *c.Latitude
+		data[DataKeyLongitude] = *c.Longitude
+	}
+}
+
+// ClientInfoFromData reads the client details stored in event data by the Publish* helpers
+func ClientInfoFromData(data map[string]interface{}) *ClientInfo {
+	c := &ClientInfo{}
+	c.IPAddress, _ = data[DataKeyIPAddress].(string)
+	c.UserAgent, _ = data[DataKeyUserAgent].(string)
+	c.Country, _ = data[DataKeyCountry].(string)
+	if lat, ok := data[DataKeyLatitude].(float64); ok {
+		if lon, ok := data[DataKeyLongitude].(float64); ok {
+			c.Latitude, c.Longitude = &lat, &lon
+		}
+	}
+	return c
+}
+
 func BuildAdminEventData(userID int, action, details string) map[string]interface{} {
 	return map[string]interface{}{
 		DataKeyUserID:  userID,
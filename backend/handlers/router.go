@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/frallan97/hackaton-demo-backend/config"
@@ -16,43 +17,95 @@ import (
 
 // Router handles all routing for the application
 type Router struct {
-	loginRateLimiter       *middleware.RateLimiter
-	healthController       *controllers.HealthController
-	messageController      *controllers.MessageController
-	authController         *controllers.AuthController
-	roleController         *controllers.RoleController
-	organizationController *controllers.OrganizationController
-	adminController        *controllers.AdminController
-	setupController        *controllers.SetupController
-	stripeController       *controllers.StripeController
-	rbacMiddleware         *middleware.RBACMiddleware
-	eventService           *events.EventService
+	loginRateLimiter         *middleware.RateLimiter
+	authURLRateLimiter       *middleware.RateLimiter
+	healthController         *controllers.HealthController
+	messageController        *controllers.MessageController
+	authController           *controllers.AuthController
+	roleController           *controllers.RoleController
+	organizationController   *controllers.OrganizationController
+	adminController          *controllers.AdminController
+	setupController          *controllers.SetupController
+	serviceAccountController *controllers.ServiceAccountController
+	oauthClientController    *controllers.OAuthClientController
+	securityController       *controllers.SecurityController
+	userAttributeController  *controllers.UserAttributeController
+	permissionController     *controllers.PermissionController
+	policyController         *controllers.PolicyController
+	stripeController         *controllers.StripeController
+	rbacMiddleware           *middleware.RBACMiddleware
+	securityService          *services.SecurityService
+	eventService             *events.EventService
+	corsAllowedOrigins       []string
 }
 
 // NewRouter creates a new router with all controllers
-func NewRouter(dbManager *database.DBManager, userService *services.UserService, jwtService *services.JWTService, googleOAuthService *services.GoogleOAuthService, eventService *events.EventService, config *config.Config) *Router {
+func NewRouter(dbManager *database.DBManager, userService *services.UserService, jwtService *services.JWTService, refreshTokenService *services.RefreshTokenService, revocationService *services.TokenRevocationService, identityProviders *services.IdentityProviderRegistry, eventService *events.EventService, mailer services.Mailer, setupService *services.SetupService, config *config.Config) *Router {
 	// Create rate limiter for login endpoint: 5 requests per minute
 	loginRateLimiter := middleware.NewRateLimiter(5, time.Minute)
+	// Every auth URL request stores a pending login, so cap how many one client can create
+	authURLRateLimiter := middleware.NewRateLimiter(20, time.Minute)
 	adminService := services.NewAdminService(dbManager.DB)
 	roleService := services.NewRoleService(dbManager.DB)
-	rbacMiddleware := middleware.NewRBACMiddleware(jwtService, adminService)
+	oauthStateService := services.NewOAuthStateService(dbManager.DB, config.JWTSecretKey)
+	identityLinkService := services.NewIdentityLinkService(dbManager.DB, userService)
+	signupPolicyService := services.NewSignupPolicyService(dbManager.DB, config.SignupPolicy)
+	localAuthService := services.NewLocalAuthService(dbManager.DB, userService, mailer, config.AppBaseURL)
+	mfaService := services.NewMFAService(dbManager.DB, config.MFARequiredRoles, config.MFAIssuer)
+	webAuthnService := services.NewWebAuthnService(dbManager.DB, services.WebAuthnConfig{
+		RPID:    config.WebAuthnRPID,
+		RPName:  config.WebAuthnRPName,
+		Origins: config.WebAuthnOrigins,
+	}, config.StepUpRequirePasskey)
+	accessTokenService := services.NewAccessTokenService(dbManager.DB)
+	serviceAccountService := services.NewServiceAccountService(dbManager.DB, accessTokenService)
+	deviceAuthService := services.NewDeviceAuthService(dbManager.DB, strings.TrimRight(config.AppBaseURL, "/")+"/device")
+	// Partner apps are sent to the consent screen of the frontend to authorize
+	oauthServerService := services.NewOAuthServerService(dbManager.DB, refreshTokenService, config.OAuthIssuer, strings.TrimRight(config.AppBaseURL, "/")+"/oauth/authorize", config.JWTSigningAlgorithm)
+	// Counts failed logins from the auth events to lock out accounts and IP addresses
+	securityService := services.NewSecurityService(dbManager.DB, eventService)
+	loginHistoryService := services.NewLoginHistoryService(dbManager.DB, config.LoginHistoryRetention)
+	userProfileService := services.NewUserProfileService(dbManager.DB)
+	permissionService := services.NewPermissionService(dbManager.DB)
+	// Caches the roles, permissions and organization memberships of users, dropped on changes announced by any replica
+	authorizationService := services.NewAuthorizationService(dbManager.DB, eventService, config.AuthorizationCacheTTL)
+	rbacMiddleware := middleware.NewRBACMiddleware(jwtService, revocationService, mfaService, webAuthnService, accessTokenService, authorizationService)
+	// Evaluates the access policies for resource-level rules, such as deleting only your own messages
+	policyService := services.NewPolicyService(dbManager.DB, eventService, authorizationService, config.PolicyDecisionRetention)
 
 	// Initialize Stripe services
 	stripeService := services.NewStripeService(dbManager.DB, config)
 	subscriptionService := services.NewSubscriptionService(dbManager.DB, stripeService)
 
 	return &Router{
-		loginRateLimiter:       loginRateLimiter,
-		healthController:       controllers.NewHealthController(dbManager),
-		messageController:      controllers.NewMessageController(dbManager),
-		authController:         controllers.NewAuthController(dbManager, userService, jwtService, googleOAuthService, eventService, roleService, adminService),
-		roleController:         controllers.NewRoleController(dbManager),
-		organizationController: controllers.NewOrganizationController(dbManager),
-		adminController:        controllers.NewAdminController(dbManager),
-		setupController:        controllers.NewSetupController(dbManager, jwtService, config),
-		stripeController:       controllers.NewStripeController(stripeService, subscriptionService, config),
-		rbacMiddleware:         rbacMiddleware,
-		eventService:           eventService,
+		loginRateLimiter:         loginRateLimiter,
+		authURLRateLimiter:       authURLRateLimiter,
+		healthController:         controllers.NewHealthController(dbManager),
+		messageController:        controllers.NewMessageController(dbManager, policyService),
+		authController:           controllers.NewAuthController(dbManager, userService, jwtService, refreshTokenService, identityProviders, eventService, roleService, adminService, revocationService, oauthStateService, identityLinkService, signupPolicyService, localAuthService, mfaService, webAuthnService, accessTokenService, deviceAuthService, oauthServerService, middleware.NewSessionCookies(config.AuthCookies, config.AuthCookieDomain), securityService, loginHistoryService, userProfileService),
+		roleController:           controllers.NewRoleController(dbManager, eventService),
+		organizationController:   controllers.NewOrganizationController(dbManager, eventService),
+		adminController:          controllers.NewAdminController(dbManager, revocationService, signupPolicyService, eventService),
+		setupController:          controllers.NewSetupController(setupService, eventService),
+		serviceAccountController: controllers.NewServiceAccountController(serviceAccountService, accessTokenService, eventService),
+		oauthClientController:    controllers.NewOAuthClientController(oauthServerService, eventService),
+		securityController:       controllers.NewSecurityController(securityService, loginHistoryService, eventService),
+		userAttributeController:  controllers.NewUserAttributeController(userProfileService, eventService),
+		permissionController:     controllers.NewPermissionController(permissionService, eventService),
+		policyController:         controllers.NewPolicyController(policyService, eventService),
+		stripeController:         controllers.NewStripeController(stripeService, subscriptionService, config),
+		rbacMiddleware:           rbacMiddleware,
+		securityService:          securityService,
+		eventService:             eventService,
+		corsAllowedOrigins:       config.CORSAllowedOrigins,
+	}
+}
+
+// requireAdmin wraps an admin handler in a permission check for requests with one of the given methods
+// (all if none given). Admin endpoints also need the mfa claim from users the MFA policy covers.
+func (r *Router) requireAdmin(permission string, methods ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return r.rbacMiddleware.RequirePermission(permission, methods...)(r.rbacMiddleware.RequireMFA()(next))
 	}
 }
 
@@ -64,56 +117,153 @@ func (r *Router) SetupRoutes() http.Handler {
 	mux.HandleFunc("/health", r.healthController.HealthHandler())
 
 	// Event monitoring endpoint (admin only)
-	mux.Handle("/api/events/stats", r.rbacMiddleware.RequireRole("admin")(http.HandlerFunc(r.getEventStats)))
+	mux.Handle("/api/events/stats", r.requireAdmin(services.PermissionEventsRead)(http.HandlerFunc(r.getEventStats)))
 
-	// API endpoints
-	mux.HandleFunc("/api/messages", r.messageController.MessagesHandler())
+	// API endpoints - anyone can read and post messages; deleting one needs a user the access policies allow
+	mux.Handle("/api/messages", r.rbacMiddleware.OptionalAuth()(r.messageController.MessagesHandler()))
+
+	// Login endpoints are rate limited and refuse IP addresses locked out after repeated failed logins
+	lockout := middleware.LockoutMiddleware(r.securityService)
+	limitLogin := func(next http.Handler) http.Handler {
+		return middleware.RateLimitMiddleware(r.loginRateLimiter)(lockout(next))
+	}
 
 	// Authentication endpoints with rate limiting on login
-	loginHandler := middleware.RateLimitMiddleware(r.loginRateLimiter)(http.HandlerFunc(r.authController.GoogleLoginHandler()))
-	mux.Handle("/api/auth/google/login", loginHandler)
-	mux.HandleFunc("/api/auth/google/url", r.authController.GetAuthURLHandler())
+	loginHandler := limitLogin(http.HandlerFunc(r.authController.LoginHandler()))
+	mux.Handle("/api/auth/{provider}/login", loginHandler)
+	authURLHandler := middleware.RateLimitMiddleware(r.authURLRateLimiter)(http.HandlerFunc(r.authController.GetAuthURLHandler()))
+	mux.Handle("/api/auth/{provider}/url", authURLHandler)
+	mux.HandleFunc("/api/auth/providers", r.authController.GetProvidersHandler())
+	linkHandler := middleware.RateLimitMiddleware(r.loginRateLimiter)(http.HandlerFunc(r.authController.LinkIdentityHandler()))
+	// Admins impersonating a user can look around, but not change credentials, billing or roles
+	noImpersonation := r.rbacMiddleware.DenyImpersonation
+	mux.Handle("/api/auth/{provider}/link", noImpersonation()(linkHandler))
+	mux.Handle("/api/auth/link/confirm", noImpersonation()(r.authController.ConfirmIdentityLinkHandler()))
+	mux.Handle("/api/auth/identities", noImpersonation(http.MethodDelete)(r.authController.IdentitiesHandler()))
+
+	// Email/password auth, rate limited like the provider logins
+	mux.Handle("/api/auth/local/register", limitLogin(r.authController.RegisterHandler()))
+	mux.Handle("/api/auth/local/verify-email", limitLogin(r.authController.VerifyEmailHandler()))
+	mux.Handle("/api/auth/local/login", limitLogin(r.authController.LocalLoginHandler()))
+	mux.Handle("/api/auth/local/forgot-password", limitLogin(r.authController.ForgotPasswordHandler()))
+	mux.Handle("/api/auth/local/reset-password", limitLogin(r.authController.ResetPasswordHandler()))
+	mux.Handle("/api/auth/local/change-password", noImpersonation()(limitLogin(r.authController.ChangePasswordHandler())))
+
+	// Multi-factor authentication; codes are short, so every endpoint taking one is rate limited
+	mux.HandleFunc("/api/auth/mfa", r.authController.MFAStatusHandler())
+	mux.Handle("/api/auth/mfa/enroll", noImpersonation()(r.authController.MFAEnrollHandler()))
+	mux.Handle("/api/auth/mfa/confirm", noImpersonation()(limitLogin(r.authController.MFAConfirmHandler())))
+	mux.Handle("/api/auth/mfa/verify", limitLogin(r.authController.MFAVerifyHandler()))
+	mux.Handle("/api/auth/mfa/disable", noImpersonation()(limitLogin(r.authController.MFADisableHandler())))
+	mux.Handle("/api/auth/mfa/recovery-codes", noImpersonation()(limitLogin(r.authController.MFARecoveryCodesHandler())))
+
+	// Passkeys (WebAuthn). Adding a further passkey or removing one needs a step-up from an existing passkey.
+	stepUp := r.rbacMiddleware.RequireStepUp
+	mux.Handle("/api/auth/webauthn/credentials", noImpersonation(http.MethodDelete)(stepUp(http.MethodDelete)(r.authController.PasskeysHandler())))
+	mux.Handle("/api/auth/webauthn/register/begin", noImpersonation()(stepUp()(r.authController.PasskeyRegisterBeginHandler())))
+	mux.Handle("/api/auth/webauthn/register/finish", noImpersonation()(r.authController.PasskeyRegisterFinishHandler()))
+	mux.Handle("/api/auth/webauthn/login/begin", limitLogin(r.authController.PasskeyLoginBeginHandler()))
+	mux.Handle("/api/auth/webauthn/login/finish", limitLogin(r.authController.PasskeyLoginFinishHandler()))
+	mux.Handle("/api/auth/webauthn/step-up/begin", noImpersonation()(r.authController.StepUpBeginHandler()))
+	mux.Handle("/api/auth/webauthn/step-up/finish", noImpersonation()(limitLogin(r.authController.StepUpFinishHandler())))
+
 	mux.HandleFunc("/api/auth/refresh", r.authController.RefreshTokenHandler())
 	mux.HandleFunc("/api/auth/me", r.authController.GetMeHandler())
 	mux.HandleFunc("/api/auth/logout", r.authController.LogoutHandler())
+	mux.Handle("/api/auth/logout-all", noImpersonation()(r.authController.LogoutAllHandler()))
+	mux.Handle("/api/auth/sessions", noImpersonation(http.MethodDelete)(r.authController.SessionsHandler()))
+	mux.HandleFunc("/api/auth/login-history", r.authController.LoginHistoryHandler())
+	mux.Handle("/api/auth/tokens", noImpersonation(http.MethodPost, http.MethodDelete)(stepUp(http.MethodPost)(r.authController.AccessTokensHandler())))
+	mux.HandleFunc("/api/auth/impersonation/stop", r.authController.StopImpersonationHandler())
+
+	// Self-service profile; provider sync keeps what the user edits here
+	mux.Handle("/api/users/me", noImpersonation(http.MethodPatch, http.MethodPut)(r.authController.ProfileHandler()))
+
+	// Device authorization grant (RFC 8628) for CLIs and editor tools. Every device code
+	// request stores a pending login, so it is limited like the auth URLs.
+	mux.Handle("/api/auth/device/code", middleware.RateLimitMiddleware(r.authURLRateLimiter)(r.authController.DeviceCodeHandler()))
+	mux.HandleFunc("/api/auth/device/token", r.authController.DeviceTokenHandler())
+	mux.Handle("/api/auth/device", noImpersonation(http.MethodPost)(limitLogin(r.authController.DeviceLoginHandler())))
+	mux.HandleFunc("/.well-known/jwks.json", r.authController.JWKSHandler())
+
+	// OAuth 2.0 / OpenID Connect server for partner apps. The consent screen is a frontend
+	// page backed by /api/oauth/authorize; clients use the /oauth endpoints.
+	mux.Handle("/api/oauth/authorize", noImpersonation(http.MethodPost)(r.authController.OAuthAuthorizeHandler()))
+	mux.Handle("/api/oauth/consents", noImpersonation(http.MethodDelete)(r.authController.OAuthConsentsHandler()))
+	mux.HandleFunc("/oauth/token", r.authController.OAuthTokenHandler())
+	mux.HandleFunc("/oauth/introspect", r.authController.OAuthIntrospectHandler())
+	mux.HandleFunc("/oauth/revoke", r.authController.OAuthRevokeHandler())
+	mux.HandleFunc("/oauth/userinfo", r.authController.OAuthUserInfoHandler())
+	mux.HandleFunc("/.well-known/openid-configuration", r.authController.OpenIDConfigurationHandler())
+
+	// Setup endpoints - promote the first admin with the one-time setup token
+	mux.HandleFunc("/api/setup/status", r.setupController.SetupStatusHandler())
+	mux.Handle("/api/setup/first-admin", limitLogin(r.setupController.MakeFirstUserAdminHandler()))
 
-	// Setup endpoints - for initial admin setup
-	mux.HandleFunc("/api/setup/first-admin", r.setupController.MakeFirstUserAdminHandler())
-	mux.HandleFunc("/api/setup/dev-token", r.setupController.GenerateDevTokenHandler())
+	// RBAC endpoints - routes require permissions, which roles grant (see /api/admin/role-permissions)
+	// Impersonation tokens never carry the admin scope, so they are also kept out of the admin endpoints
+	can := r.rbacMiddleware.RequirePermission
+	writes := []string{http.MethodPost, http.MethodPut, http.MethodDelete}
+	mux.Handle("/api/roles", noImpersonation(writes...)(can(services.PermissionRolesRead)(can(services.PermissionRolesWrite, writes...)(http.HandlerFunc(r.roleController.RolesHandler())))))
 
-	// RBAC endpoints - require authentication
-	mux.Handle("/api/roles", r.rbacMiddleware.RequireAnyRole([]string{"admin", "manager"})(http.HandlerFunc(r.roleController.RolesHandler())))
-	mux.Handle("/api/organizations", r.rbacMiddleware.RequireAnyRole([]string{"admin", "manager"})(http.HandlerFunc(r.organizationController.OrganizationsHandler())))
+	// Organizations are scoped by the role of the user in the organization given by the id parameter
+	orgRole := r.rbacMiddleware.RequireOrgRole
+	organizationsHandler := orgRole("id", services.OrgRoleViewer, http.MethodGet)(orgRole("id", services.OrgRoleAdmin, http.MethodPut)(orgRole("id", services.OrgRoleOwner, http.MethodDelete)(stepUp(http.MethodDelete)(http.HandlerFunc(r.organizationController.OrganizationsHandler())))))
+	mux.Handle("/api/organizations", noImpersonation(writes...)(can(services.PermissionOrgRead)(can(services.PermissionOrgWrite, writes...)(organizationsHandler))))
 
-	// Admin endpoints - require admin role
-	mux.Handle("/api/admin/users", r.rbacMiddleware.RequireRole("admin")(http.HandlerFunc(r.adminController.GetAllUsersHandler())))
-	mux.Handle("/api/admin/assign-role", r.rbacMiddleware.RequireRole("admin")(http.HandlerFunc(r.adminController.AssignRoleHandler())))
-	mux.Handle("/api/admin/remove-role", r.rbacMiddleware.RequireRole("admin")(http.HandlerFunc(r.adminController.RemoveRoleHandler())))
-	mux.Handle("/api/admin/assign-organization", r.rbacMiddleware.RequireRole("admin")(http.HandlerFunc(r.adminController.AssignOrganizationHandler())))
-	mux.Handle("/api/admin/remove-organization", r.rbacMiddleware.RequireRole("admin")(http.HandlerFunc(r.adminController.RemoveOrganizationHandler())))
-	mux.Handle("/api/admin/user-roles", r.rbacMiddleware.RequireRole("admin")(http.HandlerFunc(r.adminController.GetUserRolesHandler())))
-	mux.Handle("/api/admin/user-organizations", r.rbacMiddleware.RequireRole("admin")(http.HandlerFunc(r.adminController.GetUserOrganizationsHandler())))
+	// Admin endpoints - require admin permissions
+	mux.Handle("/api/admin/users", r.requireAdmin(services.PermissionUsersRead)(http.HandlerFunc(r.adminController.GetAllUsersHandler())))
+	mux.Handle("/api/admin/assign-role", r.requireAdmin(services.PermissionUsersAssignRole)(stepUp()(http.HandlerFunc(r.adminController.AssignRoleHandler()))))
+	mux.Handle("/api/admin/remove-role", r.requireAdmin(services.PermissionUsersAssignRole)(http.HandlerFunc(r.adminController.RemoveRoleHandler())))
+	mux.Handle("/api/admin/assign-organization", r.requireAdmin(services.PermissionUsersManage)(http.HandlerFunc(r.adminController.AssignOrganizationHandler())))
+	mux.Handle("/api/admin/remove-organization", r.requireAdmin(services.PermissionUsersManage)(http.HandlerFunc(r.adminController.RemoveOrganizationHandler())))
+	mux.Handle("/api/admin/deactivate-user", r.requireAdmin(services.PermissionUsersManage)(http.HandlerFunc(r.adminController.DeactivateUserHandler())))
+	mux.Handle("/api/admin/user-sessions", r.requireAdmin(services.PermissionSessionsManage)(http.HandlerFunc(r.authController.AdminUserSessionsHandler())))
+	mux.Handle("/api/admin/force-logout", r.requireAdmin(services.PermissionSessionsManage)(http.HandlerFunc(r.authController.ForceLogoutHandler())))
+	mux.Handle("/api/admin/lockouts", r.requireAdmin(services.PermissionSecurityRead)(r.requireAdmin(services.PermissionSecurityManage, http.MethodDelete)(http.HandlerFunc(r.securityController.LockoutsHandler()))))
+	mux.Handle("/api/admin/login-history", r.requireAdmin(services.PermissionSecurityRead)(http.HandlerFunc(r.securityController.LoginHistoryHandler())))
+	mux.Handle("/api/admin/security-anomalies", r.requireAdmin(services.PermissionSecurityRead)(http.HandlerFunc(r.securityController.AnomaliesHandler())))
+	mux.Handle("/api/admin/impersonate", r.requireAdmin(services.PermissionUsersImpersonate)(stepUp()(http.HandlerFunc(r.authController.ImpersonateHandler()))))
+	mux.Handle("/api/admin/pending-users", r.requireAdmin(services.PermissionUsersRead)(http.HandlerFunc(r.adminController.GetPendingUsersHandler())))
+	mux.Handle("/api/admin/approve-user", r.requireAdmin(services.PermissionUsersManage)(http.HandlerFunc(r.adminController.ApproveUserHandler())))
+	mux.Handle("/api/admin/reject-user", r.requireAdmin(services.PermissionUsersManage)(http.HandlerFunc(r.adminController.RejectUserHandler())))
+	mux.Handle("/api/admin/invitations", r.requireAdmin(services.PermissionUsersManage)(http.HandlerFunc(r.adminController.InvitationsHandler())))
+	mux.Handle("/api/admin/merge-users", r.requireAdmin(services.PermissionUsersManage)(http.HandlerFunc(r.adminController.MergeUsersHandler())))
+	mux.Handle("/api/admin/user-roles", r.requireAdmin(services.PermissionUsersRead)(http.HandlerFunc(r.adminController.GetUserRolesHandler())))
+	mux.Handle("/api/admin/user-organizations", r.requireAdmin(services.PermissionUsersRead)(http.HandlerFunc(r.adminController.GetUserOrganizationsHandler())))
+	mux.Handle("/api/admin/service-accounts", r.requireAdmin(services.PermissionServiceAccountsManage)(http.HandlerFunc(r.serviceAccountController.ServiceAccountsHandler())))
+	mux.Handle("/api/admin/service-accounts/tokens", r.requireAdmin(services.PermissionServiceAccountsManage)(http.HandlerFunc(r.serviceAccountController.ServiceAccountTokensHandler())))
+	mux.Handle("/api/admin/oauth-clients", r.requireAdmin(services.PermissionOAuthClientsManage)(http.HandlerFunc(r.oauthClientController.OAuthClientsHandler())))
+	mux.Handle("/api/admin/user-attributes", r.requireAdmin(services.PermissionUserAttributesManage)(http.HandlerFunc(r.userAttributeController.UserAttributesHandler())))
+	mux.Handle("/api/admin/user-attributes/values", r.requireAdmin(services.PermissionUsersRead)(r.requireAdmin(services.PermissionUsersManage, http.MethodPatch)(http.HandlerFunc(r.userAttributeController.UserAttributeValuesHandler()))))
+	mux.Handle("/api/admin/permissions", r.requireAdmin(services.PermissionPermissionsManage)(http.HandlerFunc(r.permissionController.PermissionsHandler())))
+	mux.Handle("/api/admin/role-permissions", r.requireAdmin(services.PermissionPermissionsManage)(http.HandlerFunc(r.permissionController.RolePermissionsHandler())))
+	mux.Handle("/api/admin/policies", r.requireAdmin(services.PermissionPoliciesManage)(http.HandlerFunc(r.policyController.PoliciesHandler())))
+	mux.Handle("/api/admin/policies/evaluate", r.requireAdmin(services.PermissionPoliciesManage)(http.HandlerFunc(r.policyController.EvaluatePoliciesHandler())))
+	mux.Handle("/api/admin/policies/decisions", r.requireAdmin(services.PermissionPoliciesManage)(http.HandlerFunc(r.policyController.PolicyDecisionsHandler())))
 
 	// Stripe endpoints - public endpoints
 	mux.HandleFunc("/api/stripe/webhook", r.stripeController.WebhookHandler())
 	mux.HandleFunc("/api/stripe/plans", r.stripeController.GetAvailablePlansHandler())
 
-	// Stripe endpoints - require authentication
-	mux.Handle("/api/stripe/checkout", r.rbacMiddleware.RequireAnyRole([]string{"user", "admin", "manager"})(http.HandlerFunc(r.stripeController.CreateCheckoutSessionHandler())))
-	mux.Handle("/api/stripe/subscription", r.rbacMiddleware.RequireAnyRole([]string{"user", "admin", "manager"})(http.HandlerFunc(r.stripeController.GetUserSubscriptionHandler())))
-	mux.Handle("/api/stripe/subscription/history", r.rbacMiddleware.RequireAnyRole([]string{"user", "admin", "manager"})(http.HandlerFunc(r.stripeController.GetUserSubscriptionHistoryHandler())))
-	mux.Handle("/api/stripe/payments", r.rbacMiddleware.RequireAnyRole([]string{"user", "admin", "manager"})(http.HandlerFunc(r.stripeController.GetUserPaymentHistoryHandler())))
-	mux.Handle("/api/stripe/subscription/cancel", r.rbacMiddleware.RequireAnyRole([]string{"user", "admin", "manager"})(http.HandlerFunc(r.stripeController.CancelSubscriptionHandler())))
-	mux.Handle("/api/stripe/subscription/reactivate", r.rbacMiddleware.RequireAnyRole([]string{"user", "admin", "manager"})(http.HandlerFunc(r.stripeController.ReactivateSubscriptionHandler())))
+	// Stripe endpoints - require billing permissions for the user's own subscription
+	mux.Handle("/api/stripe/checkout", noImpersonation()(can(services.PermissionBillingWrite)(http.HandlerFunc(r.stripeController.CreateCheckoutSessionHandler()))))
+	mux.Handle("/api/stripe/subscription", can(services.PermissionBillingRead)(http.HandlerFunc(r.stripeController.GetUserSubscriptionHandler())))
+	mux.Handle("/api/stripe/subscription/history", can(services.PermissionBillingRead)(http.HandlerFunc(r.stripeController.GetUserSubscriptionHistoryHandler())))
+	mux.Handle("/api/stripe/payments", can(services.PermissionBillingRead)(http.HandlerFunc(r.stripeController.GetUserPaymentHistoryHandler())))
+	mux.Handle("/api/stripe/subscription/cancel", noImpersonation()(can(services.PermissionBillingWrite)(stepUp()(http.HandlerFunc(r.stripeController.CancelSubscriptionHandler())))))
+	mux.Handle("/api/stripe/subscription/reactivate", noImpersonation()(can(services.PermissionBillingWrite)(http.HandlerFunc(r.stripeController.ReactivateSubscriptionHandler()))))
 
-	// Stripe admin endpoints - require admin role
-	mux.Handle("/api/stripe/admin/metrics", r.rbacMiddleware.RequireRole("admin")(http.HandlerFunc(r.stripeController.GetSubscriptionMetricsHandler())))
+	// Stripe admin endpoints - require metrics across all customers
+	mux.Handle("/api/stripe/admin/metrics", r.requireAdmin(services.PermissionBillingMetrics)(http.HandlerFunc(r.stripeController.GetSubscriptionMetricsHandler())))
 
 	// Swagger documentation
 	mux.Handle("/docs/", httpSwagger.WrapHandler)
 
 	// Apply middleware - CORS must be first to handle preflight requests
-	handler := middleware.CORSMiddleware(mux)
+	handler := r.rbacMiddleware.AuditImpersonation(r.eventService)(mux)
+	handler = middleware.CSRFMiddleware(handler)
+	handler = middleware.CORSMiddleware(r.corsAllowedOrigins)(handler)
 	handler = middleware.LoggingMiddleware(handler)
 
 	return handler
@@ -18,6 +18,7 @@ import (
 	_ "github.com/frallan97/hackaton-demo-backend/docs"
 	"github.com/frallan97/hackaton-demo-backend/events"
 	"github.com/frallan97/hackaton-demo-backend/handlers"
+	"github.com/frallan97/hackaton-demo-backend/middleware"
 	"github.com/frallan97/hackaton-demo-backend/services"
 )
 
@@ -29,6 +30,11 @@ func main() {
 	cfg := config.LoadConfig()
 	log.Printf("📡 Environment: %s", cfg.Environment)
 
+	// Only proxies in front of the API may tell us the client IP address
+	if err := middleware.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("❌ Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// Initialize database manager with optimized connection
 	log.Println("🗄️  Connecting to database...")
 	dbManager := database.NewDBManager(cfg)
@@ -124,16 +130,45 @@ func main() {
 
 	// Create services (fast, no I/O operations)
 	userService := services.NewUserService(dbManager.DB)
-	jwtService := services.NewJWTService(cfg.JWTSecretKey)
+	refreshTokenService := services.NewRefreshTokenService(dbManager.DB)
+	signingKeyService, err := services.NewSigningKeyService(dbManager.DB, cfg.JWTSigningAlgorithm, cfg.JWTKeyRotationInterval, cfg.JWTKeyOverlap, cfg.JWTKeyEncryptionKey)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize signing keys: %v", err)
+	}
+	jwtService := services.NewJWTService(signingKeyService, refreshTokenService, cfg.JWTSecretKey, cfg.JWTLegacyHS256Until)
+	revocationService := services.NewTokenRevocationService(dbManager.DB, refreshTokenService, eventService, jwtService.GetTokenExpiry(), cfg.JWTLegacyHS256Until)
 	googleOAuthService := services.NewGoogleOAuthService(
 		cfg.GoogleClientID,
 		cfg.GoogleClientSecret,
 		cfg.GoogleRedirectURL,
 	)
+	identityProviders := []services.IdentityProvider{googleOAuthService}
+	for _, providerCfg := range cfg.OIDCProviders {
+		provider, err := services.NewOIDCProvider(providerCfg, nil)
+		if err != nil {
+			log.Printf("⚠️  Skipping identity provider %s: %v", providerCfg.Name, err)
+			continue
+		}
+		identityProviders = append(identityProviders, provider)
+	}
+	identityProviderRegistry := services.NewIdentityProviderRegistry(identityProviders...)
+
+	var mailer services.Mailer
+	if cfg.SMTPHost != "" {
+		mailer = services.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+	} else {
+		log.Println("⚠️  SMTP_HOST not set, emails will be written to the log")
+		mailer = services.NewLogMailer()
+	}
+
+	setupService, err := services.NewSetupService(dbManager.DB, cfg.SetupToken, cfg.SetupTokenFile)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize first admin setup: %v", err)
+	}
 
 	// Initialize router (fast, no I/O operations)
 	log.Println("🌐 Setting up routes...")
-	router := handlers.NewRouter(dbManager, userService, jwtService, googleOAuthService, eventService, cfg)
+	router := handlers.NewRouter(dbManager, userService, jwtService, refreshTokenService, revocationService, identityProviderRegistry, eventService, mailer, setupService, cfg)
 	handler := router.SetupRoutes()
 
 	// Publish system startup event (non-blocking)
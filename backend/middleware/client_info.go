@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/frallan97/hackaton-demo-backend/events"
+)
+
+// Visitor location headers added by Cloudflare. Other edge proxies with a GeoIP
+// database can be set up to send the same headers. They are only read from trusted proxies.
+const (
+	countryHeader   = "CF-IPCountry"
+	latitudeHeader  = "CF-IPLatitude"
+	longitudeHeader = "CF-IPLongitude"
+)
+
+// RequestClientInfo describes the client of a request for auth events: its IP address,
+// user agent and, when the edge proxy reports them, its country and coordinates
+func RequestClientInfo(r *http.Request) *events.ClientInfo {
+	client := &events.ClientInfo{
+		IPAddress: ClientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+
+	// Anyone else could claim to be anywhere
+	if !FromTrustedProxy(r) {
+		return client
+	}
+
+	// XX is sent for addresses without a known country
+	if country := strings.ToUpper(strings.TrimSpace(r.Header.Get(countryHeader))); len(country) == 2 && country != "XX" {
+		client.Country = country
+	}
+
+	lat, latErr := strconv.ParseFloat(r.Header.Get(latitudeHeader), 64)
+	lon, lonErr := strconv.ParseFloat(r.Header.Get(longitudeHeader), 64)
+	if latErr == nil && lonErr == nil && lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180 {
+		client.Latitude, client.Longitude = &lat, &lon
+	}
+
+	return client
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the networks of the proxies in front of the API. Only requests
+// coming from them may name the client in forwarding headers.
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies sets the proxies whose forwarding headers are trusted, given as CIDRs or
+// single addresses. It is called once at startup; until then no proxy is trusted.
+func SetTrustedProxies(proxies []string) error {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		networks = append(networks, network)
+	}
+
+	trustedProxies = networks
+	return nil
+}
+
+// ClientIP returns the IP address of the client of a request. Behind a trusted proxy it is read
+// from X-Forwarded-For, right to left, skipping further trusted proxies: the entries to the left
+// of the first untrusted hop were written by the client and can be forged. Requests from any
+// other peer are attributed to the peer itself.
+func ClientIP(r *http.Request) string {
+	peer := peerIP(r)
+	if !isTrustedProxy(peer) {
+		return peer
+	}
+
+	if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+		hops := strings.Split(strings.Join(forwardedFor, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			if i == 0 || !isTrustedProxy(hop) {
+				return hop
+			}
+		}
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	return peer
+}
+
+// FromTrustedProxy reports whether a request was sent by a trusted proxy, whose headers can be believed
+func FromTrustedProxy(r *http.Request) bool {
+	return isTrustedProxy(peerIP(r))
+}
+
+// peerIP returns the address the request was received from, without the port
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// isTrustedProxy reports whether the address belongs to a trusted proxy
+func isTrustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// setTestTrustedProxies trusts the given proxies for the duration of a test
+func setTestTrustedProxies(t *testing.T, proxies ...string) {
+	t.Helper()
+
+	if err := SetTrustedProxies(proxies); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { trustedProxies = nil })
+}
+
+func TestClientIP(t *testing.T) {
+	setTestTrustedProxies(t, "10.0.0.0/8", "192.168.1.1", "::1")
+
+	cases := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		realIP       string
+		want         string
+	}{
+		{"direct client", "203.0.113.5:1234", nil, "", "203.0.113.5"},
+		{"spoofed forwarded for from untrusted peer", "203.0.113.5:1234", []string{"198.51.100.1"}, "", "203.0.113.5"},
+		{"spoofed real ip from untrusted peer", "203.0.113.5:1234", nil, "198.51.100.1", "203.0.113.5"},
+		{"behind trusted proxy", "10.0.0.2:1234", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"rightmost untrusted hop wins", "10.0.0.2:1234", []string{"1.2.3.4, 198.51.100.1"}, "", "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:1234", []string{"198.51.100.1, 192.168.1.1, 10.0.0.3"}, "", "198.51.100.1"},
+		{"spoofed entry left of client", "10.0.0.2:1234", []string{"10.0.0.9, 198.51.100.1, 10.0.0.3"}, "", "198.51.100.1"},
+		{"repeated headers", "10.0.0.2:1234", []string{"1.2.3.4", "198.51.100.1, 10.0.0.3"}, "", "198.51.100.1"},
+		{"only trusted hops", "10.0.0.2:1234", []string{"10.0.0.4, 10.0.0.3"}, "", "10.0.0.4"},
+		{"garbage hop stops the walk", "10.0.0.2:1234", []string{"198.51.100.1, not-an-ip"}, "", "10.0.0.2"},
+		{"real ip behind trusted proxy", "10.0.0.2:1234", nil, "198.51.100.1", "198.51.100.1"},
+		{"invalid real ip", "10.0.0.2:1234", nil, "not-an-ip", "10.0.0.2"},
+		{"ipv6 trusted proxy", "[::1]:1234", []string{"2001:db8::1"}, "", "2001:db8::1"},
+		{"remote address without port", "203.0.113.5", nil, "", "203.0.113.5"},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = c.remoteAddr
+		for _, value := range c.forwardedFor {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if c.realIP != "" {
+			r.Header.Set("X-Real-IP", c.realIP)
+		}
+
+		if got := ClientIP(r); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSetTrustedProxies(t *testing.T) {
+	setTestTrustedProxies(t)
+
+	if err := SetTrustedProxies([]string{"10.0.0.0/8", "not-a-proxy"}); err == nil {
+		t.Error("Expected an error for an invalid proxy")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if FromTrustedProxy(r) || ClientIP(r) != "127.0.0.1" {
+		t.Error("Expected no proxy to be trusted until configured")
+	}
+}
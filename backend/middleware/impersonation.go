@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/frallan97/hackaton-demo-backend/events"
+	"github.com/frallan97/hackaton-demo-backend/services"
+)
+
+// DenyImpersonation returns a middleware that refuses requests with one of the given methods
+// (all if none given) when they are made with an impersonation token. Actions like billing,
+// role changes and creating credentials are left to the real user.
+func (rbac *RBACMiddleware) DenyImpersonation(methods ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(methods) == 0 || slices.Contains(methods, r.Method) {
+				if claims := rbac.impersonationClaims(r); claims != nil {
+					http.Error(w, "Forbidden: not allowed while impersonating", http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AuditImpersonation returns a middleware that logs every request made with an
+// impersonation token and records it as an action of the impersonating admin
+func (rbac *RBACMiddleware) AuditImpersonation(eventService *events.EventService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if claims := rbac.impersonationClaims(r); claims != nil {
+				log.Printf("🎭 Admin %d (%s) impersonating user %d: %s %s", claims.Actor.UserID, claims.Actor.Subject, claims.UserID, r.Method, r.URL.Path)
+
+				if eventService != nil {
+					if err := eventService.PublishImpersonatedRequest(claims.Actor.UserID, claims.UserID, r.Method, r.URL.Path, ClientIP(r)); err != nil {
+						log.Printf("Warning: Failed to publish impersonation event: %v", err)
+					}
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// impersonationClaims returns the claims of the request if it carries a valid impersonation token
+func (rbac *RBACMiddleware) impersonationClaims(r *http.Request) *services.Claims {
+	token, ok := BearerToken(r)
+	if !ok || strings.HasPrefix(token, services.AccessTokenPrefix) {
+		return nil
+	}
+
+	claims, err := rbac.jwtService.ValidateToken(token)
+	if err != nil || !claims.IsImpersonation() || rbac.revocationService.IsRevoked(claims) {
+		return nil
+	}
+
+	return claims
+}
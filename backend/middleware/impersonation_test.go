@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/services"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testJWTSecret signs the tokens of middleware tests, which the JWT service accepts as legacy HS256 tokens
+const testJWTSecret = "test-secret"
+
+// newTestRBACMiddleware returns an RBAC middleware that validates tokens signed by signTestToken
+// and knows no revocations
+func newTestRBACMiddleware() *RBACMiddleware {
+	jwtService := services.NewJWTService(nil, nil, testJWTSecret, time.Now().Add(time.Hour))
+	return NewRBACMiddleware(jwtService, &services.TokenRevocationService{}, nil, nil, nil, nil)
+}
+
+// signTestToken returns an access token for the given claims
+func signTestToken(t *testing.T, claims services.Claims) string {
+	t.Helper()
+
+	now := time.Now()
+	claims.Issuer = "hackaton-demo"
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(15 * time.Minute))
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// okHandler answers 200 for requests that get through a middleware
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestDenyImpersonation(t *testing.T) {
+	rbac := newTestRBACMiddleware()
+	impersonation := signTestToken(t, services.Claims{
+		UserID: 7,
+		Scope:  services.ImpersonationScope,
+		Actor:  &services.ActorClaims{Subject: "admin@example.com", UserID: 1},
+	})
+	login := signTestToken(t, services.Claims{UserID: 7, SessionID: "session"})
+
+	cases := []struct {
+		name    string
+		methods []string
+		method  string
+		token   string
+		cookie  bool
+		want    int
+	}{
+		{"impersonation on a sensitive route", nil, http.MethodPost, impersonation, false, http.StatusForbidden},
+		{"impersonation reading a sensitive route", nil, http.MethodGet, impersonation, false, http.StatusForbidden},
+		{"impersonation in a session cookie", nil, http.MethodPost, impersonation, true, http.StatusForbidden},
+		{"impersonation on a denied method", []string{http.MethodDelete}, http.MethodDelete, impersonation, false, http.StatusForbidden},
+		{"impersonation on another method", []string{http.MethodDelete}, http.MethodGet, impersonation, false, http.StatusOK},
+		{"the user's own session", nil, http.MethodPost, login, false, http.StatusOK},
+		{"no token", nil, http.MethodPost, "", false, http.StatusOK},
+		{"invalid token", nil, http.MethodPost, "not-a-token", false, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "/api/auth/mfa/disable", nil)
+		switch {
+		case c.token != "" && c.cookie:
+			req.AddCookie(&http.Cookie{Name: AccessTokenCookie, Value: c.token})
+		case c.token != "":
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		rec := httptest.NewRecorder()
+		rbac.DenyImpersonation(c.methods...)(okHandler).ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s: expected %d, got %d", c.name, c.want, rec.Code)
+		}
+	}
+}
+
+func TestAuditImpersonationPassesRequestsOn(t *testing.T) {
+	rbac := newTestRBACMiddleware()
+	token := signTestToken(t, services.Claims{
+		UserID: 7,
+		Scope:  services.ImpersonationScope,
+		Actor:  &services.ActorClaims{Subject: "admin@example.com", UserID: 1},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/messages", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	rbac.AuditImpersonation(nil)(okHandler).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected audited requests to be served, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/services"
+)
+
+// LockoutMiddleware refuses requests from IP addresses that are locked out after repeated failed logins
+func LockoutMiddleware(securityService *services.SecurityService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lockedUntil, locked, err := securityService.LockedUntil("", ClientIP(r))
+			if err != nil {
+				// Brute force protection must not take logins down with it
+				log.Printf("Warning: Failed to check lockout: %v", err)
+			} else if locked {
+				WriteLockedOut(w, lockedUntil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WriteLockedOut answers a login attempt from a locked out account or IP address
+func WriteLockedOut(w http.ResponseWriter, lockedUntil time.Time) {
+	retryAfter := int(math.Ceil(time.Until(lockedUntil).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write([]byte(`{"error":"Too many failed login attempts. Please try again later."}`))
+}
@@ -2,7 +2,10 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/frallan97/hackaton-demo-backend/services"
@@ -10,15 +13,26 @@ import (
 
 // RBACMiddleware provides role-based access control
 type RBACMiddleware struct {
-	jwtService   *services.JWTService
-	adminService *services.AdminService
+	jwtService        *services.JWTService
+	revocationService *services.TokenRevocationService
+	mfaService        *services.MFAService
+	webAuthnService   *services.WebAuthnService
+	accessTokens      *services.AccessTokenService
+	authorization     *services.AuthorizationService
 }
 
+// StepUpTokenHeader carries the single-use token from a fresh passkey assertion
+const StepUpTokenHeader = "X-Step-Up-Token"
+
 // NewRBACMiddleware creates a new RBAC middleware
-func NewRBACMiddleware(jwtService *services.JWTService, adminService *services.AdminService) *RBACMiddleware {
+func NewRBACMiddleware(jwtService *services.JWTService, revocationService *services.TokenRevocationService, mfaService *services.MFAService, webAuthnService *services.WebAuthnService, accessTokens *services.AccessTokenService, authorization *services.AuthorizationService) *RBACMiddleware {
 	return &RBACMiddleware{
-		jwtService:   jwtService,
-		adminService: adminService,
+		jwtService:        jwtService,
+		revocationService: revocationService,
+		mfaService:        mfaService,
+		webAuthnService:   webAuthnService,
+		accessTokens:      accessTokens,
+		authorization:     authorization,
 	}
 }
 
@@ -26,102 +40,267 @@ func NewRBACMiddleware(jwtService *services.JWTService, adminService *services.A
 func (rbac *RBACMiddleware) RequireRole(role string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userID, err := rbac.getUserIDFromRequest(r)
-			if err != nil {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			_, authz, ok := rbac.authorize(w, r)
+			if !ok {
 				return
 			}
 
-			hasRole, err := rbac.adminService.UserHasRole(userID, role)
-			if err != nil {
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			if !authz.HasRole(role) {
+				http.Error(w, "Forbidden: insufficient permissions", http.StatusForbidden)
 				return
 			}
 
-			if !hasRole {
+			next.ServeHTTP(w, r.WithContext(withAuthorization(r.Context(), authz)))
+		})
+	}
+}
+
+// RequireAnyRole returns a middleware that requires any of the specified roles
+func (rbac *RBACMiddleware) RequireAnyRole(roles []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, authz, ok := rbac.authorize(w, r)
+			if !ok {
+				return
+			}
+
+			if !slices.ContainsFunc(roles, authz.HasRole) {
 				http.Error(w, "Forbidden: insufficient permissions", http.StatusForbidden)
 				return
 			}
 
-			// Add user ID to context for use in handlers
-			ctx := context.WithValue(r.Context(), "userID", userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(withAuthorization(r.Context(), authz)))
 		})
 	}
 }
 
-// RequireAnyRole returns a middleware that requires any of the specified roles
-func (rbac *RBACMiddleware) RequireAnyRole(roles []string) func(http.Handler) http.Handler {
+// RequirePermission returns a middleware that requires a permission granted by one of the user's roles
+// for requests with one of the given methods (all if none given). Like the admin role itself, the
+// permissions of the admin role only count for credentials with the admin scope.
+func (rbac *RBACMiddleware) RequirePermission(permission string, methods ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(methods) > 0 && !slices.Contains(methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			_, authz, ok := rbac.authorize(w, r)
+			if !ok {
+				return
+			}
+
+			if !authz.HasPermission(permission) {
+				http.Error(w, "Forbidden: missing permission "+permission, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withAuthorization(r.Context(), authz)))
+		})
+	}
+}
+
+// RequireOrgRole returns a middleware that requires at least the given role in the organization whose ID
+// is in the named query parameter, for requests with one of the given methods (all if none given).
+// Users with the org:manage permission pass for every organization. Requests without the parameter
+// pass on; handlers scope them with the authorization in the context.
+func (rbac *RBACMiddleware) RequireOrgRole(param, minRole string, methods ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userID, err := rbac.getUserIDFromRequest(r)
-			if err != nil {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			if len(methods) > 0 && !slices.Contains(methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			_, authz, ok := rbac.authorize(w, r)
+			if !ok {
 				return
 			}
 
-			hasAnyRole := false
-			for _, role := range roles {
-				hasRole, err := rbac.adminService.UserHasRole(userID, role)
+			orgIDStr := r.URL.Query().Get(param)
+			if orgIDStr != "" && !authz.HasPermission(services.PermissionOrgManage) {
+				orgID, err := strconv.Atoi(orgIDStr)
 				if err != nil {
-					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					http.Error(w, "Invalid organization ID", http.StatusBadRequest)
 					return
 				}
-				if hasRole {
-					hasAnyRole = true
-					break
+
+				if !services.OrgRoleAtLeast(authz.OrgRole(orgID), minRole) {
+					http.Error(w, "Forbidden: requires the "+minRole+" role in this organization", http.StatusForbidden)
+					return
 				}
 			}
 
-			if !hasAnyRole {
-				http.Error(w, "Forbidden: insufficient permissions", http.StatusForbidden)
+			next.ServeHTTP(w, r.WithContext(withAuthorization(r.Context(), authz)))
+		})
+	}
+}
+
+// RequireAuth returns a middleware that requires authentication but no specific role
+func (rbac *RBACMiddleware) RequireAuth() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, authz, ok := rbac.authorize(w, r)
+			if !ok {
 				return
 			}
 
-			// Add user ID to context for use in handlers
-			ctx := context.WithValue(r.Context(), "userID", userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(withAuthorization(r.Context(), authz)))
 		})
 	}
 }
 
-// RequireAuth returns a middleware that requires authentication but no specific role
-func (rbac *RBACMiddleware) RequireAuth() func(http.Handler) http.Handler {
+// OptionalAuth returns a middleware that authenticates requests carrying credentials, for endpoints
+// that also serve anonymous requests. Invalid credentials are refused rather than ignored, so that a
+// request is never handled anonymously by mistake.
+func (rbac *RBACMiddleware) OptionalAuth() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := BearerToken(r); !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			_, authz, ok := rbac.authorize(w, r)
+			if !ok {
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withAuthorization(r.Context(), authz)))
+		})
+	}
+}
+
+// RequireMFA returns a middleware that requires a session started with a second factor
+// from users whose roles make MFA mandatory
+func (rbac *RBACMiddleware) RequireMFA() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userID, err := rbac.getUserIDFromRequest(r)
-			if err != nil {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			claims, authz, ok := rbac.authorize(w, r)
+			if !ok {
+				return
+			}
+
+			if !claims.MFA {
+				required, err := rbac.mfaService.IsRequired(claims.UserID)
+				if err != nil {
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+
+				if required {
+					http.Error(w, "Forbidden: multi-factor authentication required", http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(withAuthorization(r.Context(), authz)))
+		})
+	}
+}
+
+// RequireStepUp returns a middleware that requires a step-up token from a fresh passkey assertion,
+// sent in the X-Step-Up-Token header, for requests with one of the given methods (all if none given).
+// Each token allows a single request.
+func (rbac *RBACMiddleware) RequireStepUp(methods ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(methods) > 0 && !slices.Contains(methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, authz, ok := rbac.authorize(w, r)
+			if !ok {
+				return
+			}
+
+			token := r.Header.Get(StepUpTokenHeader)
+			if token == "" {
+				required, err := rbac.webAuthnService.StepUpRequired(claims.UserID)
+				if err != nil {
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+
+				if required {
+					http.Error(w, "Forbidden: step-up authentication required", http.StatusForbidden)
+					return
+				}
+			} else if err := rbac.webAuthnService.ConsumeStepUpToken(claims.UserID, token); err != nil {
+				if errors.Is(err, services.ErrStepUpRequired) {
+					http.Error(w, "Forbidden: invalid or expired step-up token", http.StatusForbidden)
+					return
+				}
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
 
-			// Add user ID to context for use in handlers
-			ctx := context.WithValue(r.Context(), "userID", userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(withAuthorization(r.Context(), authz)))
 		})
 	}
 }
 
-// getUserIDFromRequest extracts and validates the user ID from the JWT token in the request
-func (rbac *RBACMiddleware) getUserIDFromRequest(r *http.Request) (int, error) {
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		return 0, &AuthError{Message: "authorization header required"}
+// authenticate validates the credentials of the request and checks that their scope
+// allows the request method. On failure it writes the error response and returns false.
+func (rbac *RBACMiddleware) authenticate(w http.ResponseWriter, r *http.Request) (*services.Claims, bool) {
+	claims, err := rbac.getClaimsFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
 	}
 
-	// Extract token from "Bearer <token>"
-	parts := strings.SplitN(authHeader, " ", 2)
-	if len(parts) != 2 || parts[0] != "Bearer" {
-		return 0, &AuthError{Message: "invalid authorization header format"}
+	if !claims.AllowsMethod(r.Method) {
+		http.Error(w, "Forbidden: token scope does not allow this request", http.StatusForbidden)
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// authorize authenticates the request like authenticate and loads the authorization of its user,
+// scoped to the credentials. On failure it writes the error response and returns false.
+func (rbac *RBACMiddleware) authorize(w http.ResponseWriter, r *http.Request) (*services.Claims, *services.Authorization, bool) {
+	claims, ok := rbac.authenticate(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	authz, err := rbac.authorization.Get(claims.UserID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	return claims, authz.WithScope(claims.HasScope(services.ScopeAdmin)), true
+}
+
+// getClaimsFromRequest extracts and validates the claims of the JWT or personal access token in the request,
+// sent as a bearer token or in the access token cookie of a browser session
+func (rbac *RBACMiddleware) getClaimsFromRequest(r *http.Request) (*services.Claims, error) {
+	token, ok := BearerToken(r)
+	if !ok {
+		return nil, &AuthError{Message: "authorization header or session cookie required"}
+	}
+
+	if strings.HasPrefix(token, services.AccessTokenPrefix) {
+		claims, err := rbac.accessTokens.Authenticate(token, ClientIP(r))
+		if err != nil {
+			return nil, &AuthError{Message: "invalid token"}
+		}
+		return claims, nil
 	}
 
-	token := parts[1]
 	claims, err := rbac.jwtService.ValidateToken(token)
 	if err != nil {
-		return 0, &AuthError{Message: "invalid token"}
+		return nil, &AuthError{Message: "invalid token"}
+	}
+
+	if rbac.revocationService.IsRevoked(claims) {
+		return nil, &AuthError{Message: "token has been revoked"}
 	}
 
-	return claims.UserID, nil
+	return claims, nil
 }
 
 // AuthError represents an authentication error
@@ -133,8 +312,25 @@ func (e *AuthError) Error() string {
 	return e.Message
 }
 
+// authorizationKey is the context key of the authorization of the request's user
+type authorizationKey struct{}
+
+// withAuthorization adds the authorization of the request's user to its context for use in handlers
+func withAuthorization(ctx context.Context, authz *services.Authorization) context.Context {
+	return context.WithValue(ctx, authorizationKey{}, authz)
+}
+
+// AuthorizationFromContext retrieves the authorization of the request's user, added by the RBAC middleware
+func AuthorizationFromContext(ctx context.Context) (*services.Authorization, bool) {
+	authz, ok := ctx.Value(authorizationKey{}).(*services.Authorization)
+	return authz, ok
+}
+
 // GetUserIDFromContext retrieves the user ID from the request context
 func GetUserIDFromContext(ctx context.Context) (int, bool) {
-	userID, ok := ctx.Value("userID").(int)
-	return userID, ok
+	authz, ok := AuthorizationFromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+	return authz.UserID, true
 }
\ No newline at end of file
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/frallan97/hackaton-demo-backend/services"
+)
+
+func TestRequirePermissionMethods(t *testing.T) {
+	rbac := newTestRBACMiddleware()
+	handler := rbac.RequirePermission(services.PermissionOrgWrite, http.MethodPost, http.MethodDelete)(okHandler)
+	readOnly := signTestToken(t, services.Claims{UserID: 7, Scope: services.ScopeRead})
+
+	// None of these cases reach the authorization lookup, which needs a database
+	cases := []struct {
+		name   string
+		method string
+		token  string
+		want   int
+	}{
+		{"unlisted method without token", http.MethodGet, "", http.StatusOK},
+		{"unlisted method with invalid token", http.MethodPut, "invalid", http.StatusOK},
+		{"listed method without token", http.MethodPost, "", http.StatusUnauthorized},
+		{"listed method with invalid token", http.MethodDelete, "invalid", http.StatusUnauthorized},
+		{"listed method beyond the token scope", http.MethodPost, readOnly, http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, "/api/organizations", nil)
+		if c.token != "" {
+			r.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != c.want {
+			t.Errorf("%s: got status %d, want %d", c.name, w.Code, c.want)
+		}
+	}
+
+	all := rbac.RequirePermission(services.PermissionOrgRead)(okHandler)
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodOptions} {
+		w := httptest.NewRecorder()
+		all.ServeHTTP(w, httptest.NewRequest(method, "/api/organizations", nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %s to need the permission when no methods are given, got status %d", method, w.Code)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Cookies of browser sessions. The access and refresh tokens are HttpOnly; the CSRF
+// token is readable by the frontend, which echoes it in the X-CSRF-Token header.
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFTokenCookie    = "csrf_token"
+	CSRFTokenHeader    = "X-CSRF-Token"
+)
+
+// refreshTokenCookiePath limits the refresh token cookie to the endpoints that use it
+const refreshTokenCookiePath = "/api/auth"
+
+// SessionCookies writes the cookies of browser sessions when cookie sessions are enabled
+type SessionCookies struct {
+	Enabled bool
+	Domain  string
+}
+
+// NewSessionCookies creates the session cookie settings
+func NewSessionCookies(enabled bool, domain string) *SessionCookies {
+	return &SessionCookies{
+		Enabled: enabled,
+		Domain:  domain,
+	}
+}
+
+// Set stores a token pair in HttpOnly cookies together with a fresh CSRF token, which it returns
+func (sc *SessionCookies) Set(w http.ResponseWriter, r *http.Request, accessToken string, accessTTL time.Duration, refreshToken string, refreshTTL time.Duration) (string, error) {
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, sc.cookie(r, AccessTokenCookie, accessToken, "/", accessTTL, true))
+	http.SetCookie(w, sc.cookie(r, RefreshTokenCookie, refreshToken, refreshTokenCookiePath, refreshTTL, true))
+	http.SetCookie(w, sc.cookie(r, CSRFTokenCookie, csrfToken, "/", refreshTTL, false))
+
+	return csrfToken, nil
+}
+
+// Clear removes the session cookies
+func (sc *SessionCookies) Clear(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, sc.cookie(r, AccessTokenCookie, "", "/", -1, true))
+	http.SetCookie(w, sc.cookie(r, RefreshTokenCookie, "", refreshTokenCookiePath, -1, true))
+	http.SetCookie(w, sc.cookie(r, CSRFTokenCookie, "", "/", -1, false))
+}
+
+func (sc *SessionCookies) cookie(r *http.Request, name, value, path string, ttl time.Duration, httpOnly bool) *http.Cookie {
+	maxAge := int(ttl.Seconds())
+	if ttl < 0 {
+		maxAge = -1
+	}
+
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   sc.Domain,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		// Plain HTTP is only expected in local development
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// BearerToken returns the access token of a request: the bearer token of the Authorization
+// header, which API clients keep using, or else the access token cookie of a browser session
+func BearerToken(r *http.Request) (string, bool) {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		token, ok := strings.CutPrefix(authHeader, "Bearer ")
+		return token, ok && token != ""
+	}
+
+	if cookie, err := r.Cookie(AccessTokenCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, true
+	}
+
+	return "", false
+}
+
+// CSRFMiddleware protects cookie sessions with a double-submit token: a state-changing request that
+// carries session cookies but no Authorization header must send the CSRF cookie in the X-CSRF-Token header.
+// Requests authenticated with a bearer header can not be forged by another site and pass as they are.
+func CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "" || !hasSessionCookie(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(CSRFTokenCookie)
+		header := r.Header.Get(CSRFTokenHeader)
+		if err != nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+			http.Error(w, "Forbidden: missing or invalid CSRF token", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hasSessionCookie reports whether the request carries the access or refresh token cookie
+func hasSessionCookie(r *http.Request) bool {
+	for _, name := range []string{AccessTokenCookie, RefreshTokenCookie} {
+		if cookie, err := r.Cookie(name); err == nil && cookie.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// newCSRFToken returns a random token for the double-submit check
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate CSRF token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
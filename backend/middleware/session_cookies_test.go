@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBearerToken(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		cookie string
+		token  string
+		ok     bool
+	}{
+		{"header", "Bearer header-token", "", "header-token", true},
+		{"cookie", "", "cookie-token", "cookie-token", true},
+		{"header wins over cookie", "Bearer header-token", "cookie-token", "header-token", true},
+		{"header without Bearer prefix", "Basic dXNlcjpwYXNz", "cookie-token", "", false},
+		{"empty bearer token", "Bearer ", "cookie-token", "", false},
+		{"neither", "", "", "", false},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+		if c.header != "" {
+			r.Header.Set("Authorization", c.header)
+		}
+		if c.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: AccessTokenCookie, Value: c.cookie})
+		}
+
+		token, ok := BearerToken(r)
+		if ok != c.ok || (ok && token != c.token) {
+			t.Errorf("%s: got %q, %v, want %q, %v", c.name, token, ok, c.token, c.ok)
+		}
+	}
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	handler := CSRFMiddleware(okHandler)
+
+	cases := []struct {
+		name          string
+		method        string
+		authorization string
+		session       string
+		csrfCookie    string
+		csrfHeader    string
+		want          int
+	}{
+		{"safe method with session", http.MethodGet, "", AccessTokenCookie, "token", "", http.StatusOK},
+		{"head with session", http.MethodHead, "", AccessTokenCookie, "", "", http.StatusOK},
+		{"options with session", http.MethodOptions, "", AccessTokenCookie, "", "", http.StatusOK},
+		{"bearer request", http.MethodPost, "Bearer token", AccessTokenCookie, "", "", http.StatusOK},
+		{"no session cookie", http.MethodPost, "", "", "", "", http.StatusOK},
+		{"matching token", http.MethodPost, "", AccessTokenCookie, "token", "token", http.StatusOK},
+		{"matching token with refresh cookie", http.MethodPost, "", RefreshTokenCookie, "token", "token", http.StatusOK},
+		{"token mismatch", http.MethodPost, "", AccessTokenCookie, "token", "other", http.StatusForbidden},
+		{"missing header", http.MethodDelete, "", AccessTokenCookie, "token", "", http.StatusForbidden},
+		{"missing cookie", http.MethodPut, "", AccessTokenCookie, "", "token", http.StatusForbidden},
+		{"refresh cookie only", http.MethodPost, "", RefreshTokenCookie, "", "", http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, "/api/messages", nil)
+		if c.authorization != "" {
+			r.Header.Set("Authorization", c.authorization)
+		}
+		if c.session != "" {
+			r.AddCookie(&http.Cookie{Name: c.session, Value: "session-token"})
+		}
+		if c.csrfCookie != "" {
+			r.AddCookie(&http.Cookie{Name: CSRFTokenCookie, Value: c.csrfCookie})
+		}
+		if c.csrfHeader != "" {
+			r.Header.Set(CSRFTokenHeader, c.csrfHeader)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != c.want {
+			t.Errorf("%s: got status %d, want %d", c.name, w.Code, c.want)
+		}
+	}
+}
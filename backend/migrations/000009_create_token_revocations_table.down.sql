@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_token_revocations_expires_at;
+DROP INDEX IF EXISTS idx_token_revocations_user_id;
+DROP TABLE IF EXISTS token_revocations;
@@ -0,0 +1,17 @@
+-- Revoked access tokens. A row either denies a single token by its jti, or
+-- denies every token of a user issued before revoke_before. Rows are only
+-- kept until the tokens they cover would have expired anyway.
+CREATE TABLE IF NOT EXISTS token_revocations (
+    id SERIAL PRIMARY KEY,
+    jti VARCHAR(64) UNIQUE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    revoke_before TIMESTAMP WITH TIME ZONE,
+    reason VARCHAR(100),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (jti IS NOT NULL OR revoke_before IS NOT NULL)
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_token_revocations_user_id ON token_revocations(user_id);
+CREATE INDEX IF NOT EXISTS idx_token_revocations_expires_at ON token_revocations(expires_at);
@@ -0,0 +1,4 @@
+ALTER TABLE oauth_states DROP COLUMN IF EXISTS provider;
+ALTER TABLE users ALTER COLUMN google_id SET NOT NULL;
+DROP INDEX IF EXISTS idx_user_identities_user_id;
+DROP TABLE IF EXISTS user_identities;
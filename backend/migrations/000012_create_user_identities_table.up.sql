@@ -0,0 +1,29 @@
+-- External login identities. A user can sign in with several providers;
+-- each (provider, subject) pair belongs to exactly one user.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    email_verified BOOLEAN DEFAULT false,
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, subject)
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+
+-- Existing users signed up with Google
+INSERT INTO user_identities (user_id, provider, subject, email, last_login_at, created_at)
+SELECT id, 'google', google_id, email, last_login_at, created_at
+FROM users
+WHERE google_id IS NOT NULL
+ON CONFLICT (provider, subject) DO NOTHING;
+
+-- Users no longer need a Google account
+ALTER TABLE users ALTER COLUMN google_id DROP NOT NULL;
+
+-- Pending logins are bound to the provider they were started for
+ALTER TABLE oauth_states ADD COLUMN IF NOT EXISTS provider VARCHAR(50) NOT NULL DEFAULT 'google';
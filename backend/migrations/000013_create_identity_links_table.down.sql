@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_identity_links_expires_at;
+DROP INDEX IF EXISTS idx_identity_links_user_id;
+DROP TABLE IF EXISTS identity_links;
@@ -0,0 +1,17 @@
+-- Pending account links. A login whose verified email already belongs to
+-- another account is parked here until that account confirms the link.
+CREATE TABLE IF NOT EXISTS identity_links (
+    id SERIAL PRIMARY KEY,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_identity_links_user_id ON identity_links(user_id);
+CREATE INDEX IF NOT EXISTS idx_identity_links_expires_at ON identity_links(expires_at);
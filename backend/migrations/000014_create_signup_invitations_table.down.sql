@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_pending_approval;
+DROP INDEX IF EXISTS idx_signup_invitations_email;
+DROP TABLE IF EXISTS signup_invitations;
+ALTER TABLE users DROP COLUMN IF EXISTS pending_approval;
@@ -0,0 +1,17 @@
+-- Users waiting for an administrator to approve their sign-up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_approval BOOLEAN NOT NULL DEFAULT false;
+
+-- Invitations to sign up while sign-up is invite-only
+CREATE TABLE IF NOT EXISTS signup_invitations (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    accepted_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_signup_invitations_email ON signup_invitations(LOWER(email));
+CREATE INDEX IF NOT EXISTS idx_users_pending_approval ON users(pending_approval) WHERE pending_approval = true;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_email_tokens_expires_at;
+DROP INDEX IF EXISTS idx_email_tokens_user_id;
+DROP TABLE IF EXISTS email_tokens;
+DROP TABLE IF EXISTS user_passwords;
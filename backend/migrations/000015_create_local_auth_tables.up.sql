@@ -0,0 +1,26 @@
+-- Password credentials for local (email/password) login.
+-- The matching login identity is stored in user_identities with provider 'local'.
+CREATE TABLE IF NOT EXISTS user_passwords (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    password_hash TEXT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Single-use tokens sent by email. Registrations are only turned into a user
+-- once the address is verified, so 'verify_email' tokens carry the sign-up data.
+CREATE TABLE IF NOT EXISTS email_tokens (
+    id SERIAL PRIMARY KEY,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    purpose VARCHAR(30) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255),
+    password_hash TEXT,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_email_tokens_user_id ON email_tokens(user_id);
+CREATE INDEX IF NOT EXISTS idx_email_tokens_expires_at ON email_tokens(expires_at);
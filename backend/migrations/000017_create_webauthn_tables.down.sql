@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_step_up_tokens_expires_at;
+DROP INDEX IF EXISTS idx_step_up_tokens_user_id;
+DROP INDEX IF EXISTS idx_webauthn_challenges_expires_at;
+DROP INDEX IF EXISTS idx_webauthn_credentials_user_id;
+DROP TABLE IF EXISTS step_up_tokens;
+DROP TABLE IF EXISTS webauthn_challenges;
+DROP TABLE IF EXISTS webauthn_credentials;
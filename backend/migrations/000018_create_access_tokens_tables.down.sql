@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_access_tokens_expires_at;
+DROP INDEX IF EXISTS idx_access_tokens_user_id;
+DROP TABLE IF EXISTS access_tokens;
+DROP TABLE IF EXISTS service_accounts;
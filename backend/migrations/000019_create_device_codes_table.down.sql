@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_device_codes_requester_ip;
+DROP INDEX IF EXISTS idx_device_codes_expires_at;
+DROP TABLE IF EXISTS device_codes;
@@ -0,0 +1,22 @@
+-- Pending device logins (OAuth 2.0 device authorization grant, RFC 8628).
+-- The device polls with device_code, which is stored hashed; the user enters
+-- user_code in the browser to approve or deny the login.
+CREATE TABLE IF NOT EXISTS device_codes (
+    id SERIAL PRIMARY KEY,
+    device_code_hash VARCHAR(64) UNIQUE NOT NULL,
+    user_code VARCHAR(16) UNIQUE NOT NULL,
+    client_id VARCHAR(64) NOT NULL,
+    requester_ip TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'denied', 'consumed')),
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    mfa BOOLEAN NOT NULL DEFAULT false,
+    interval_seconds INTEGER NOT NULL,
+    last_polled_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    decided_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_device_codes_expires_at ON device_codes(expires_at);
+CREATE INDEX IF NOT EXISTS idx_device_codes_requester_ip ON device_codes(requester_ip) WHERE status = 'pending';
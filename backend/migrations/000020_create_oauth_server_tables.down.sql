@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_client_id;
+DROP INDEX IF EXISTS idx_oauth_consents_client_id;
+DROP INDEX IF EXISTS idx_oauth_authorization_codes_expires_at;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS scope;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS client_id;
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
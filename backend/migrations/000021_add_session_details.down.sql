@@ -0,0 +1,8 @@
+DELETE FROM token_revocations WHERE jti IS NULL AND revoke_before IS NULL;
+ALTER TABLE token_revocations DROP CONSTRAINT IF EXISTS token_revocations_check;
+ALTER TABLE token_revocations ADD CONSTRAINT token_revocations_check CHECK (jti IS NOT NULL OR revoke_before IS NOT NULL);
+ALTER TABLE token_revocations DROP COLUMN IF EXISTS session_id;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS last_seen_at;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS device_name;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS user_agent;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS ip_address;
@@ -0,0 +1,11 @@
+-- Every refresh token family is a session. Remember where it is used from, so
+-- users can recognise their sessions and sign out the ones they do not.
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS ip_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS device_name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+-- A revocation can also deny every access token of one session
+ALTER TABLE token_revocations ADD COLUMN IF NOT EXISTS session_id VARCHAR(64);
+ALTER TABLE token_revocations DROP CONSTRAINT IF EXISTS token_revocations_check;
+ALTER TABLE token_revocations ADD CONSTRAINT token_revocations_check CHECK (jti IS NOT NULL OR revoke_before IS NOT NULL OR session_id IS NOT NULL);
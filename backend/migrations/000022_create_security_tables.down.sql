@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS security_anomalies;
+DROP TABLE IF EXISTS user_last_logins;
+DROP TABLE IF EXISTS user_login_signals;
+DROP TABLE IF EXISTS auth_lockouts;
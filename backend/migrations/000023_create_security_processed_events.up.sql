@@ -0,0 +1,8 @@
+-- With NATS every replica receives each auth event, some more than once. The security
+-- service claims an event here before counting it, so it is only counted once.
+CREATE TABLE IF NOT EXISTS security_processed_events (
+    event_id VARCHAR(64) PRIMARY KEY,
+    processed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_processed_events_processed_at ON security_processed_events(processed_at);
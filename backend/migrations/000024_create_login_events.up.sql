@@ -0,0 +1,18 @@
+-- History of logins, token refreshes and logouts. users.last_login_at only keeps
+-- the latest login; this keeps every attempt with where it came from.
+CREATE TABLE IF NOT EXISTS login_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    event_type VARCHAR(16) NOT NULL CHECK (event_type IN ('login', 'refresh', 'logout')),
+    success BOOLEAN NOT NULL,
+    provider VARCHAR(100) NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    failure_reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_events_user_id ON login_events(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_events_ip_address ON login_events(ip_address, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_events_created_at ON login_events(created_at);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS user_attribute_definitions;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS custom_attributes,
+    DROP COLUMN IF EXISTS notification_preferences,
+    DROP COLUMN IF EXISTS timezone,
+    DROP COLUMN IF EXISTS locale,
+    DROP COLUMN IF EXISTS picture_edited,
+    DROP COLUMN IF EXISTS name_edited;
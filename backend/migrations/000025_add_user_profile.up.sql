@@ -0,0 +1,21 @@
+-- Self-service profile. Name and picture are mirrored from the login provider until
+-- the user edits them; the *_edited flags keep provider sync from overwriting edits.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS name_edited BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS picture_edited BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS locale VARCHAR(35) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS notification_preferences JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS custom_attributes JSONB NOT NULL DEFAULT '{}';
+
+-- Custom user attributes defined by admins. Values live in users.custom_attributes
+-- and are validated against these definitions.
+CREATE TABLE IF NOT EXISTS user_attribute_definitions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(64) UNIQUE NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    type VARCHAR(16) NOT NULL CHECK (type IN ('string', 'number', 'boolean')),
+    allowed_values TEXT[] NOT NULL DEFAULT '{}',
+    user_editable BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
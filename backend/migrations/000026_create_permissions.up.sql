@@ -0,0 +1,55 @@
+-- Fine-grained permissions underneath roles. Routes require a permission; a user has it
+-- when one of their roles is granted it. Admins can change the grants at runtime.
+CREATE TABLE IF NOT EXISTS permissions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    granted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    granted_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_role_permissions_permission_id ON role_permissions(permission_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('roles:read', 'List roles'),
+    ('roles:write', 'Create, update and delete roles'),
+    ('org:read', 'List organizations'),
+    ('org:write', 'Create, update and delete organizations'),
+    ('billing:read', 'View your own subscription and payments'),
+    ('billing:write', 'Start, cancel and reactivate your own subscription'),
+    ('billing:metrics', 'View subscription metrics of all customers'),
+    ('users:read', 'List users with their roles and organizations'),
+    ('users:manage', 'Approve, reject, invite, deactivate and merge users, and manage their organizations and attributes'),
+    ('users:assign_role', 'Assign roles to users and remove them'),
+    ('users:impersonate', 'Act as another user for support'),
+    ('sessions:manage', 'List and sign out the sessions of any user'),
+    ('security:read', 'Review lockouts, login anomalies and login history'),
+    ('security:manage', 'Lift lockouts'),
+    ('service_accounts:manage', 'Manage service accounts and their access tokens'),
+    ('oauth_clients:manage', 'Register and delete OAuth clients'),
+    ('user_attributes:manage', 'Define custom user attributes'),
+    ('permissions:manage', 'Change which permissions roles grant'),
+    ('events:read', 'View event bus statistics')
+ON CONFLICT (name) DO NOTHING;
+
+-- Grants matching the role checks the routes had before: admins may do everything,
+-- managers manage organizations and roles, and every signed-up user handles their own billing.
+-- Editors and readers, which nothing checked, get write and read access to organizations.
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON
+    r.name = 'admin'
+    OR (r.name = 'manager' AND p.name IN ('roles:read', 'roles:write', 'org:read', 'org:write', 'billing:read', 'billing:write'))
+    OR (r.name = 'editor' AND p.name IN ('roles:read', 'org:read', 'org:write'))
+    OR (r.name = 'reader' AND p.name IN ('roles:read', 'org:read'))
+    OR (r.name = 'user' AND p.name IN ('billing:read', 'billing:write'))
+ON CONFLICT (role_id, permission_id) DO NOTHING;
@@ -0,0 +1,10 @@
+DELETE FROM role_permissions
+WHERE role_id = (SELECT id FROM roles WHERE name = 'user')
+    AND permission_id = (SELECT id FROM permissions WHERE name = 'org:read');
+DELETE FROM permissions WHERE name = 'org:manage';
+
+UPDATE permissions SET description = 'List organizations' WHERE name = 'org:read';
+UPDATE permissions SET description = 'Create, update and delete organizations' WHERE name = 'org:write';
+
+ALTER TABLE user_organizations DROP CONSTRAINT IF EXISTS user_organizations_role_check;
+ALTER TABLE user_organizations ALTER COLUMN role DROP NOT NULL;
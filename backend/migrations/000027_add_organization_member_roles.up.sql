@@ -0,0 +1,22 @@
+-- Organization-scoped roles. What a user may do with an organization depends on their role in
+-- it: viewers and members can read it, admins can also update it and owners can delete it.
+-- Holders of org:manage can do all of that with every organization.
+UPDATE user_organizations SET role = 'member' WHERE role IS NULL OR role NOT IN ('owner', 'admin', 'member', 'viewer');
+ALTER TABLE user_organizations ALTER COLUMN role SET NOT NULL;
+ALTER TABLE user_organizations ADD CONSTRAINT user_organizations_role_check CHECK (role IN ('owner', 'admin', 'member', 'viewer'));
+
+INSERT INTO permissions (name, description) VALUES
+    ('org:manage', 'Read, update and delete every organization, not only those the user is a member of')
+ON CONFLICT (name) DO NOTHING;
+
+UPDATE permissions SET description = 'List the organizations the user is a member of' WHERE name = 'org:read';
+UPDATE permissions SET description = 'Create organizations, and update or delete those the user administers' WHERE name = 'org:write';
+
+-- Admins keep access to every organization; every signed-up user can list their own
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON
+    (r.name = 'admin' AND p.name = 'org:manage')
+    OR (r.name = 'user' AND p.name = 'org:read')
+ON CONFLICT (role_id, permission_id) DO NOTHING;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_role_parents_parent_role_id;
+DROP TABLE IF EXISTS role_parents;
@@ -0,0 +1,22 @@
+-- Role inheritance. A role has the permissions of its parent roles and passes their role
+-- checks, transitively. The hierarchy must not contain cycles; RoleService checks this.
+CREATE TABLE IF NOT EXISTS role_parents (
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    parent_role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, parent_role_id),
+    CHECK (role_id <> parent_role_id)
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_role_parents_parent_role_id ON role_parents(parent_role_id);
+
+-- admin inherits manager, which inherits editor, then reader, then user
+INSERT INTO role_parents (role_id, parent_role_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN roles p ON
+    (r.name = 'admin' AND p.name = 'manager')
+    OR (r.name = 'manager' AND p.name = 'editor')
+    OR (r.name = 'editor' AND p.name = 'reader')
+    OR (r.name = 'reader' AND p.name = 'user')
+ON CONFLICT (role_id, parent_role_id) DO NOTHING;
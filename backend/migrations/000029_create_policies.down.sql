@@ -0,0 +1,8 @@
+DELETE FROM permissions WHERE name = 'policies:manage';
+
+ALTER TABLE messages DROP COLUMN IF EXISTS user_id;
+
+DROP INDEX IF EXISTS idx_policy_decisions_created_at;
+DROP INDEX IF EXISTS idx_policy_decisions_user_id;
+DROP TABLE IF EXISTS policy_decisions;
+DROP TABLE IF EXISTS policy_versions;
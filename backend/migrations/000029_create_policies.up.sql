@@ -0,0 +1,62 @@
+-- Attribute-based access policies for rules roles can not express, such as users deleting only
+-- their own messages. The policy document is versioned; the latest version is in force.
+CREATE TABLE IF NOT EXISTS policy_versions (
+    version SERIAL PRIMARY KEY,
+    document JSONB NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Every policy decision, including dry runs by admins, is kept for audits
+CREATE TABLE IF NOT EXISTS policy_decisions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    action VARCHAR(100) NOT NULL,
+    resource JSONB NOT NULL DEFAULT '{}',
+    allowed BOOLEAN NOT NULL,
+    effect VARCHAR(16) NOT NULL CHECK (effect IN ('allow', 'deny', 'not_applicable')),
+    policy_id VARCHAR(100) NOT NULL DEFAULT '',
+    policy_version INTEGER NOT NULL DEFAULT 0,
+    reason TEXT NOT NULL DEFAULT '',
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    performed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_policy_decisions_user_id ON policy_decisions(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_policy_decisions_created_at ON policy_decisions(created_at);
+
+-- Messages remember who posted them, so that policies can tell their owners apart
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+INSERT INTO policy_versions (document, comment)
+SELECT '{
+    "policies": [
+        {
+            "id": "messages-delete-own",
+            "description": "Users may delete the messages they posted",
+            "effect": "allow",
+            "actions": ["message:delete"],
+            "conditions": [{"attribute": "resource.owner_id", "operator": "equals", "value_from": "subject.user_id"}]
+        },
+        {
+            "id": "messages-delete-admin",
+            "description": "Admins may delete any message",
+            "effect": "allow",
+            "actions": ["message:delete"],
+            "conditions": [{"attribute": "subject.roles", "operator": "contains", "value": "admin"}]
+        }
+    ]
+}'::jsonb, 'Default policies'
+WHERE NOT EXISTS (SELECT 1 FROM policy_versions);
+
+INSERT INTO permissions (name, description) VALUES
+    ('policies:manage', 'Publish access policies, evaluate them for any user and review the decision log')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON r.name = 'admin' AND p.name = 'policies:manage'
+ON CONFLICT (role_id, permission_id) DO NOTHING;
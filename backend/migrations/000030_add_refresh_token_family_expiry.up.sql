@@ -0,0 +1,5 @@
+-- Rotating a refresh token extends its family by the idle expiry. Bound every family by an
+-- absolute lifetime too, so a session, or a stolen token that keeps being refreshed, ends.
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS family_expires_at TIMESTAMP WITH TIME ZONE;
+UPDATE refresh_tokens SET family_expires_at = created_at + INTERVAL '30 days' WHERE family_expires_at IS NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN family_expires_at SET NOT NULL;
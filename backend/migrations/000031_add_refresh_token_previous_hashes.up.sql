@@ -0,0 +1,4 @@
+-- Remember the hashes of the last tokens a family was rotated away from. Only presenting one of
+-- them is a replay that revokes the family; any other wrong secret is just an invalid token, so
+-- knowing a family ID, which access tokens carry as sid, is not enough to end someone's session.
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS previous_token_hashes TEXT[] NOT NULL DEFAULT '{}';
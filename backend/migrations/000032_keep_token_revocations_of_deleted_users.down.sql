@@ -0,0 +1,3 @@
+DELETE FROM token_revocations WHERE user_id IS NOT NULL AND user_id NOT IN (SELECT id FROM users);
+ALTER TABLE token_revocations
+    ADD CONSTRAINT token_revocations_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,3 @@
+-- Keep revocations after their user is deleted: a merged user's tokens are revoked once the
+-- merge has deleted it, and its outstanding access tokens must stay denied until they expire.
+ALTER TABLE token_revocations DROP CONSTRAINT IF EXISTS token_revocations_user_id_fkey;
@@ -1,14 +1,490 @@
 package models
 
-// LoginInput represents the input for login requests.
+import "time"
+
+// LoginInput represents an email/password login request
 type LoginInput struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// RegisterInput represents an email/password sign-up request
+type RegisterInput struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+	Name     string `json:"name"`
+}
+
+// EmailTokenInput carries a token from an emailed verification link
+type EmailTokenInput struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ForgotPasswordInput represents a request for a password reset email
+type ForgotPasswordInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordInput represents a password reset with an emailed token
+type ResetPasswordInput struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// ChangePasswordInput represents a password change by a logged in user
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+// MFAStatus describes the multi-factor authentication state of a user
+type MFAStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// MFAEnrollment holds the TOTP secret of an enrollment that still has to be confirmed with a code
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFAChallenge is returned by a login that needs a second factor instead of tokens
+type MFAChallenge struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// MFAVerifyInput completes a login with a TOTP or recovery code
+type MFAVerifyInput struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// MFACodeInput carries a TOTP or recovery code for MFA management
+type MFACodeInput struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// MFAEnabledResponse is returned when MFA is turned on. The recovery codes are only shown once.
+type MFAEnabledResponse struct {
+	RecoveryCodes []string      `json:"recovery_codes"`
+	Auth          *AuthResponse `json:"auth"`
+}
+
+// WebAuthnRelyingParty identifies this site to the authenticator
+type WebAuthnRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// WebAuthnUserEntity identifies the account a new passkey belongs to. ID is an opaque base64url user handle.
+type WebAuthnUserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// WebAuthnCredentialParameter names a public key algorithm the server accepts
+type WebAuthnCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// WebAuthnCredentialDescriptor refers to an existing credential by its base64url ID
+type WebAuthnCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// WebAuthnAuthenticatorSelection states which authenticators may create a passkey
+type WebAuthnAuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// WebAuthnCreationOptions are the options for navigator.credentials.create(), in the
+// JSON form read by PublicKeyCredential.parseCreationOptionsFromJSON()
+type WebAuthnCreationOptions struct {
+	RP                     WebAuthnRelyingParty           `json:"rp"`
+	User                   WebAuthnUserEntity             `json:"user"`
+	Challenge              string                         `json:"challenge"`
+	PubKeyCredParams       []WebAuthnCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                            `json:"timeout"`
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection WebAuthnAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                         `json:"attestation"`
+}
+
+// WebAuthnRequestOptions are the options for navigator.credentials.get(), in the
+// JSON form read by PublicKeyCredential.parseRequestOptionsFromJSON()
+type WebAuthnRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	Timeout          int                            `json:"timeout"`
+	RPID             string                         `json:"rpId"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+// WebAuthnAttestationResponse is the response part of a new credential, base64url encoded
+type WebAuthnAttestationResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON"`
+	AttestationObject string   `json:"attestationObject"`
+	Transports        []string `json:"transports,omitempty"`
+}
+
+// WebAuthnRegistrationCredential is the JSON form of the credential from navigator.credentials.create()
+type WebAuthnRegistrationCredential struct {
+	ID       string                      `json:"id"`
+	RawID    string                      `json:"rawId"`
+	Type     string                      `json:"type"`
+	Response WebAuthnAttestationResponse `json:"response"`
+}
+
+// WebAuthnAssertionResponse is the response part of an assertion, base64url encoded
+type WebAuthnAssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"userHandle,omitempty"`
+}
+
+// WebAuthnAssertionCredential is the JSON form of the credential from navigator.credentials.get()
+type WebAuthnAssertionCredential struct {
+	ID       string                    `json:"id"`
+	RawID    string                    `json:"rawId"`
+	Type     string                    `json:"type"`
+	Response WebAuthnAssertionResponse `json:"response"`
+}
+
+// WebAuthnRegisterInput finishes a passkey registration
+type WebAuthnRegisterInput struct {
+	Name       string                         `json:"name"`
+	Credential WebAuthnRegistrationCredential `json:"credential" validate:"required"`
+}
+
+// WebAuthnLoginBeginInput starts a passkey login. Without an email the browser offers every passkey it has for the site.
+type WebAuthnLoginBeginInput struct {
+	Email string `json:"email"`
+}
+
+// WebAuthnCredential is a passkey registered to a user
+type WebAuthnCredential struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Transports []string   `json:"transports" db:"transports"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+}
+
+// StepUpToken proves a fresh passkey assertion. It is sent in the X-Step-Up-Token header
+// and can be used for a single sensitive request.
+type StepUpToken struct {
+	StepUpToken string    `json:"step_up_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// AccessToken is a personal access token of a user or service account. The token itself is only shown when it is created.
+type AccessToken struct {
+	ID          int        `json:"id" db:"id"`
+	UserID      int        `json:"user_id" db:"user_id"`
+	Name        string     `json:"name" db:"name"`
+	TokenPrefix string     `json:"token_prefix" db:"token_prefix"`
+	Scopes      []string   `json:"scopes" db:"scopes"`
+	ExpiresAt   time.Time  `json:"expires_at" db:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at" db:"last_used_at"`
+	LastUsedIP  string     `json:"last_used_ip,omitempty" db:"last_used_ip"`
+	CreatedBy   *int       `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// AccessTokenCreateInput represents a request for a new access token
+type AccessTokenCreateInput struct {
+	Name   string   `json:"name" validate:"required"`
+	Scopes []string `json:"scopes" validate:"required"`
+	// ExpiresInDays is the lifetime of the token; 0 or omitted gives the default
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+// AccessTokenCreated is returned once when a token is created and carries the secret token
+type AccessTokenCreated struct {
+	AccessToken
+	Token string `json:"token"`
+}
+
+// ServiceAccount is a non-human account that authenticates with access tokens only
+type ServiceAccount struct {
+	ID          int       `json:"id" db:"user_id"`
+	Name        string    `json:"name" db:"name"`
+	Email       string    `json:"email" db:"email"`
+	Description string    `json:"description" db:"description"`
+	IsActive    bool      `json:"is_active" db:"is_active"`
+	CreatedBy   *int      `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// ServiceAccountCreateInput represents a request for a new service account
+type ServiceAccountCreateInput struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+}
+
+// DeviceAuthorization is the response of the device authorization endpoint (RFC 8628 section 3.2)
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceLogin describes a pending device login to the user asked to approve it
+type DeviceLogin struct {
+	UserCode  string    `json:"user_code"`
+	ClientID  string    `json:"client_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// DeviceApprovalRequest approves or denies a device login by its user code
+type DeviceApprovalRequest struct {
+	UserCode string `json:"user_code" validate:"required"`
+	Approve  bool   `json:"approve"`
+}
+
+// OAuthError is an OAuth 2.0 error response (RFC 6749 section 5.2)
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// OAuthClient is a partner app registered to request delegated access to users' data
+type OAuthClient struct {
+	ID            int       `json:"id" db:"id"`
+	ClientID      string    `json:"client_id" db:"client_id"`
+	Name          string    `json:"name" db:"name"`
+	RedirectURIs  []string  `json:"redirect_uris" db:"redirect_uris"`
+	AllowedScopes []string  `json:"allowed_scopes" db:"allowed_scopes"`
+	Confidential  bool      `json:"confidential"`
+	CreatedBy     *int      `json:"created_by" db:"created_by"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// OAuthClientCreateInput represents a request to register a client. Confidential
+// clients get a secret; public clients (single-page and native apps) rely on PKCE alone.
+type OAuthClientCreateInput struct {
+	Name          string   `json:"name" validate:"required"`
+	RedirectURIs  []string `json:"redirect_uris" validate:"required"`
+	AllowedScopes []string `json:"allowed_scopes" validate:"required"`
+	Confidential  bool     `json:"confidential"`
+}
+
+// OAuthClientCreated is returned once when a client is registered and carries its secret
+type OAuthClientCreated struct {
+	OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// OAuthAuthorizeRequest holds the parameters of an authorization request (RFC 6749 section 4.1.1, RFC 7636)
+type OAuthAuthorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+// OAuthConsentRequest is what the consent screen shows the user before they decide
+type OAuthConsentRequest struct {
+	ClientID   string   `json:"client_id,omitempty"`
+	ClientName string   `json:"client_name,omitempty"`
+	Scopes     []string `json:"scopes,omitempty"`
+	// Consented is set when the user already granted every requested scope to this client
+	Consented bool `json:"consented"`
+	// RedirectTo is set instead when the request is invalid and the browser should take the error back to the client
+	RedirectTo string `json:"redirect_to,omitempty"`
+}
+
+// OAuthAuthorizeDecision approves or denies an authorization request
+type OAuthAuthorizeDecision struct {
+	OAuthAuthorizeRequest
+	Approve bool `json:"approve"`
+}
+
+// OAuthAuthorizeResult tells the consent screen where to send the browser next
+type OAuthAuthorizeResult struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// OAuthConsent is a grant of scopes by a user to a client
+type OAuthConsent struct {
+	ClientID   string    `json:"client_id" db:"client_id"`
+	ClientName string    `json:"client_name" db:"name"`
+	Scopes     []string  `json:"scopes" db:"scopes"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// OAuthTokenResponse is a successful response of the token endpoint (RFC 6749 section 5.1)
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// OAuthIntrospection is the response of the introspection endpoint (RFC 7662 section 2.2)
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+}
+
+// OIDCUserInfo holds the claims returned by the userinfo endpoint, limited to the granted scopes
+type OIDCUserInfo struct {
+	Sub     string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Picture string `json:"picture,omitempty"`
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// RefreshToken represents a server-side refresh token family (one row per login session)
+type RefreshToken struct {
+	ID              int        `json:"id" db:"id"`
+	FamilyID        string     `json:"family_id" db:"family_id"`
+	UserID          int        `json:"user_id" db:"user_id"`
+	Generation      int        `json:"generation" db:"generation"`
+	MFA             bool       `json:"mfa" db:"mfa"`
+	ClientID        string     `json:"client_id,omitempty" db:"client_id"`
+	Scope           string     `json:"scope,omitempty" db:"scope"`
+	ExpiresAt       time.Time  `json:"expires_at" db:"expires_at"`
+	FamilyExpiresAt time.Time  `json:"family_expires_at" db:"family_expires_at"`
+	RotatedAt       *time.Time `json:"rotated_at,omitempty" db:"rotated_at"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	RevokedReason   string     `json:"revoked_reason,omitempty" db:"revoked_reason"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Session is a login session as shown to its user: one active refresh token family
+// together with where it was started and last used from
+type Session struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	MFA        bool      `json:"mfa"`
+	Current    bool      `json:"current"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// SessionsRevoked reports how many sessions were signed out
+type SessionsRevoked struct {
+	Revoked int `json:"revoked"`
+}
+
+// ForceLogoutRequest represents an admin request to sign a user out everywhere
+type ForceLogoutRequest struct {
+	UserID int `json:"user_id"`
+}
+
+// ImpersonationRequest represents an admin request to act as another user
+type ImpersonationRequest struct {
+	UserID int    `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+// ImpersonationResponse carries the short-lived token an admin uses to act as a user.
+// It can not be refreshed; the admin's own tokens stay valid and are used again after stopping.
+type ImpersonationResponse struct {
+	User        *User  `json:"user"`
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// SetupRequest promotes the first admin with the one-time setup token
+type SetupRequest struct {
+	Email      string `json:"email"`
+	SetupToken string `json:"setup_token"`
+}
+
+// SetupStatus reports whether the first admin still has to be set up
+type SetupStatus struct {
+	SetupRequired bool `json:"setup_required"`
+}
+
+// Lockout counts the failed logins of an account (by email) or an IP address
+type Lockout struct {
+	ID            int        `json:"id" db:"id"`
+	Scope         string     `json:"scope" db:"scope"`
+	Subject       string     `json:"subject" db:"subject"`
+	Failures      int        `json:"failures" db:"failures"`
+	Lockouts      int        `json:"lockouts" db:"lockouts"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty" db:"locked_until"`
+	LastFailureAt *time.Time `json:"last_failure_at,omitempty" db:"last_failure_at"`
+	Locked        bool       `json:"locked" db:"-"`
+}
+
+// SecurityAnomaly is a login that did not fit the user's history, such as one from a new
+// country or device, or one too far from the previous login to have been travelled
+type SecurityAnomaly struct {
+	ID        int       `json:"id" db:"id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	Kind      string    `json:"kind" db:"kind"`
+	Details   string    `json:"details" db:"details"`
+	IPAddress string    `json:"ip_address" db:"ip_address"`
+	UserAgent string    `json:"user_agent" db:"user_agent"`
+	Country   string    `json:"country" db:"country"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
-// LoginResponse represents the response for login requests.
-type LoginResponse struct {
-	Username string `json:"username"`
-	Status   string `json:"status"`
-	Message  string `json:"message"`
+// LoginEvent is an entry of the login history: a login attempt, a token refresh or a logout
+type LoginEvent struct {
+	ID            int64     `json:"id" db:"id"`
+	UserID        *int      `json:"user_id,omitempty" db:"user_id"`
+	Email         string    `json:"email,omitempty" db:"email"`
+	EventType     string    `json:"event_type" db:"event_type"`
+	Success       bool      `json:"success" db:"success"`
+	Provider      string    `json:"provider,omitempty" db:"provider"`
+	IPAddress     string    `json:"ip_address" db:"ip_address"`
+	UserAgent     string    `json:"user_agent" db:"user_agent"`
+	DeviceName    string    `json:"device_name" db:"-"`
+	FailureReason string    `json:"failure_reason,omitempty" db:"failure_reason"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
 }
@@ -6,6 +6,7 @@ import "time"
 type Message struct {
 	ID        int       `json:"id"`
 	Content   string    `json:"content"`
+	UserID    *int      `json:"user_id,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
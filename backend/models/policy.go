@@ -0,0 +1,106 @@
+package models
+
+import "time"
+
+// PolicyDocument is a set of access policies evaluated together. Documents are versioned;
+// the latest version is the one in force.
+type PolicyDocument struct {
+	Policies []Policy `json:"policies"`
+}
+
+// Policy allows or denies actions when all of its conditions hold
+type Policy struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+	// Effect is allow or deny
+	Effect string `json:"effect"`
+	// Actions the policy covers, such as message:delete, message:* or *
+	Actions    []string          `json:"actions"`
+	Conditions []PolicyCondition `json:"conditions,omitempty"`
+}
+
+// PolicyCondition compares an attribute of the subject or resource, such as subject.user_id or
+// resource.owner_id, with a literal value or with another attribute given by ValueFrom
+type PolicyCondition struct {
+	Attribute string      `json:"attribute"`
+	Operator  string      `json:"operator"`
+	Value     interface{} `json:"value,omitempty"`
+	ValueFrom string      `json:"value_from,omitempty"`
+}
+
+// PolicySubject holds the attributes of the user a policy is evaluated for
+type PolicySubject struct {
+	UserID int      `json:"user_id"`
+	Roles  []string `json:"roles"`
+	// OrgRoles maps the organizations the user is a member of to their role in each
+	OrgRoles map[int]string `json:"org_roles"`
+	// Plan is the plan of the user's active subscription, empty without one
+	Plan string `json:"plan"`
+}
+
+// PolicyInput is a request to perform an action on a resource, described by its attributes
+type PolicyInput struct {
+	Subject  PolicySubject          `json:"subject"`
+	Action   string                 `json:"action"`
+	Resource map[string]interface{} `json:"resource"`
+}
+
+// PolicyDecision is the outcome of evaluating the policies for an input
+type PolicyDecision struct {
+	Allowed bool `json:"allowed"`
+	// Effect is allow or deny, or not_applicable when no policy matched and the request is denied by default
+	Effect   string `json:"effect"`
+	PolicyID string `json:"policy_id,omitempty"`
+	// PolicyVersion is the version of the document evaluated, 0 for a draft
+	PolicyVersion int    `json:"policy_version"`
+	Reason        string `json:"reason"`
+}
+
+// PolicyVersion is a published version of the policy document
+type PolicyVersion struct {
+	Version   int            `json:"version" db:"version"`
+	Document  PolicyDocument `json:"document" db:"document"`
+	Comment   string         `json:"comment,omitempty" db:"comment"`
+	CreatedBy *int           `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+}
+
+// PolicyVersionRequest represents a request to publish a new version of the policy document
+type PolicyVersionRequest struct {
+	Document PolicyDocument `json:"document" validate:"required"`
+	Comment  string         `json:"comment"`
+}
+
+// PolicyEvaluationRequest represents a dry run of the policies for a user. Without a document
+// the policies in force are evaluated; with one, a draft can be tried before publishing it.
+type PolicyEvaluationRequest struct {
+	UserID   int                    `json:"user_id" validate:"required"`
+	Action   string                 `json:"action" validate:"required"`
+	Resource map[string]interface{} `json:"resource"`
+	Document *PolicyDocument        `json:"document,omitempty"`
+	// AdminScope evaluates the user as signed in with the admin scope
+	AdminScope bool `json:"admin_scope"`
+}
+
+// PolicyEvaluationResponse is the decision of a dry run with the subject it was evaluated for
+type PolicyEvaluationResponse struct {
+	Subject  PolicySubject  `json:"subject"`
+	Decision PolicyDecision `json:"decision"`
+}
+
+// PolicyDecisionLog is an entry of the audit log of policy decisions
+type PolicyDecisionLog struct {
+	ID            int64                  `json:"id" db:"id"`
+	UserID        *int                   `json:"user_id,omitempty" db:"user_id"`
+	Action        string                 `json:"action" db:"action"`
+	Resource      map[string]interface{} `json:"resource" db:"resource"`
+	Allowed       bool                   `json:"allowed" db:"allowed"`
+	Effect        string                 `json:"effect" db:"effect"`
+	PolicyID      string                 `json:"policy_id,omitempty" db:"policy_id"`
+	PolicyVersion int                    `json:"policy_version" db:"policy_version"`
+	Reason        string                 `json:"reason" db:"reason"`
+	// DryRun marks evaluations requested by an admin, who is recorded in PerformedBy
+	DryRun      bool      `json:"dry_run" db:"dry_run"`
+	PerformedBy *int      `json:"performed_by,omitempty" db:"performed_by"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
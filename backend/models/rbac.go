@@ -9,20 +9,30 @@ type Role struct {
 	ID          int       `json:"id" db:"id"`
 	Name        string    `json:"name" db:"name"`
 	Description string    `json:"description" db:"description"`
+	Parents     []string  `json:"parents,omitempty"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// EffectiveRole is a role a user has, either assigned directly or inherited through parent roles
+type EffectiveRole struct {
+	Role
+	Inherited bool `json:"inherited"`
+}
+
 // RoleCreate represents the data needed to create a new role
 type RoleCreate struct {
-	Name        string `json:"name" validate:"required,max=50"`
-	Description string `json:"description"`
+	Name        string   `json:"name" validate:"required,max=50"`
+	Description string   `json:"description"`
+	Parents     []string `json:"parents"`
 }
 
-// RoleUpdate represents the data needed to update a role
+// RoleUpdate represents the data needed to update a role. Parents, the names of the roles
+// it inherits, replace the current ones when given.
 type RoleUpdate struct {
-	Name        string `json:"name" validate:"required,max=50"`
-	Description string `json:"description"`
+	Name        string    `json:"name" validate:"required,max=50"`
+	Description string    `json:"description"`
+	Parents     *[]string `json:"parents"`
 }
 
 // Organization represents an organization in the system
@@ -90,9 +100,46 @@ type RoleAssignmentRequest struct {
 	RoleID int `json:"role_id" validate:"required"`
 }
 
+// UserStatusRequest represents a request to activate or deactivate a user
+type UserStatusRequest struct {
+	UserID int `json:"user_id" validate:"required"`
+}
+
+// SignupInvitationRequest represents a request to invite an email address to sign up
+type SignupInvitationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// MergeUsersRequest represents a request to merge one user into another
+type MergeUsersRequest struct {
+	SourceUserID int `json:"source_user_id" validate:"required"`
+	TargetUserID int `json:"target_user_id" validate:"required"`
+}
+
 // OrganizationMembershipRequest represents a request to add a user to an organization
 type OrganizationMembershipRequest struct {
 	UserID         int    `json:"user_id" validate:"required"`
 	OrganizationID int    `json:"organization_id" validate:"required"`
 	Role           string `json:"role" validate:"required"`
+}
+
+// Permission is a fine-grained right, such as org:write, that roles grant to their users
+type Permission struct {
+	ID          int       `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// RolePermission is a permission granted to a role
+type RolePermission struct {
+	Permission
+	GrantedAt time.Time `json:"granted_at" db:"granted_at"`
+	GrantedBy *int      `json:"granted_by,omitempty" db:"granted_by"`
+}
+
+// RolePermissionRequest represents a request to grant a permission to a role or revoke it
+type RolePermissionRequest struct {
+	RoleID     int    `json:"role_id" validate:"required"`
+	Permission string `json:"permission" validate:"required"`
 }
\ No newline at end of file
@@ -15,6 +15,59 @@ type User struct {
 	LastLoginAt time.Time `json:"last_login_at" db:"last_login_at"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	// ImpersonatedBy is the email of the admin acting as the user, only set in /api/auth/me responses
+	ImpersonatedBy string `json:"impersonated_by,omitempty" db:"-"`
+}
+
+// UserProfile is the part of a user's account they manage themselves. Name and picture start
+// out as reported by the login provider; once edited they are no longer synced from it.
+type UserProfile struct {
+	UserID                  int                    `json:"user_id" db:"user_id"`
+	Email                   string                 `json:"email" db:"email"`
+	Name                    string                 `json:"name" db:"name"`
+	Picture                 string                 `json:"picture" db:"picture"`
+	NameEdited              bool                   `json:"name_edited" db:"name_edited"`
+	PictureEdited           bool                   `json:"picture_edited" db:"picture_edited"`
+	Locale                  string                 `json:"locale" db:"locale"`
+	Timezone                string                 `json:"timezone" db:"timezone"`
+	NotificationPreferences map[string]bool        `json:"notification_preferences" db:"notification_preferences"`
+	CustomAttributes        map[string]interface{} `json:"custom_attributes" db:"custom_attributes"`
+	UpdatedAt               time.Time              `json:"updated_at" db:"updated_at"`
+}
+
+// UserProfileUpdate changes a user's profile. Fields left out are kept. Notification preferences
+// and custom attributes are merged into the stored ones; a null attribute value removes it.
+type UserProfileUpdate struct {
+	Name *string `json:"name,omitempty"`
+	// Picture overrides the provider's avatar; an empty string removes the override
+	Picture                 *string                `json:"picture,omitempty"`
+	Locale                  *string                `json:"locale,omitempty"`
+	Timezone                *string                `json:"timezone,omitempty"`
+	NotificationPreferences map[string]bool        `json:"notification_preferences,omitempty"`
+	CustomAttributes        map[string]interface{} `json:"custom_attributes,omitempty"`
+}
+
+// UserAttributeDefinition describes a custom user attribute defined by an admin
+type UserAttributeDefinition struct {
+	ID          int    `json:"id" db:"id"`
+	Name        string `json:"name" db:"name"`
+	Description string `json:"description" db:"description"`
+	// Type is string, number or boolean
+	Type string `json:"type" db:"type"`
+	// AllowedValues restricts a string attribute to these values if not empty
+	AllowedValues []string `json:"allowed_values" db:"allowed_values"`
+	// UserEditable lets users set the attribute on their own profile; otherwise only admins can
+	UserEditable bool      `json:"user_editable" db:"user_editable"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// UserAttributeDefinitionCreate represents the data needed to define a custom user attribute
+type UserAttributeDefinitionCreate struct {
+	Name          string   `json:"name"`
+	Description   string   `json:"description"`
+	Type          string   `json:"type"`
+	AllowedValues []string `json:"allowed_values"`
+	UserEditable  bool     `json:"user_editable"`
 }
 
 // UserCreate represents the data needed to create a new user
@@ -23,6 +76,47 @@ type UserCreate struct {
 	Name     string `json:"name"`
 	Picture  string `json:"picture"`
 	GoogleID string `json:"google_id"`
+	// PendingApproval creates the user inactive until an admin approves the sign-up
+	PendingApproval bool `json:"pending_approval"`
+}
+
+// UserIdentity links a user to an account at an external login provider
+type UserIdentity struct {
+	ID            int        `json:"id" db:"id"`
+	UserID        int        `json:"user_id" db:"user_id"`
+	Provider      string     `json:"provider" db:"provider"`
+	Subject       string     `json:"subject" db:"subject"`
+	Email         string     `json:"email" db:"email"`
+	EmailVerified bool       `json:"email_verified" db:"email_verified"`
+	LastLoginAt   *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+// SignupInvitation allows an email address to sign up while sign-up is invite-only
+type SignupInvitation struct {
+	ID         int        `json:"id" db:"id"`
+	Email      string     `json:"email" db:"email"`
+	InvitedBy  *int       `json:"invited_by,omitempty" db:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty" db:"accepted_at"`
+	AcceptedBy *int       `json:"accepted_by,omitempty" db:"accepted_by"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// SignupPendingResponse is returned when a sign-up was accepted but awaits admin approval
+type SignupPendingResponse struct {
+	User            *User `json:"user"`
+	PendingApproval bool  `json:"pending_approval"`
+}
+
+// ExternalIdentity represents the verified profile returned by a login provider
+type ExternalIdentity struct {
+	Provider      string `json:"provider"`
+	Subject       string `json:"subject"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
 }
 
 // GoogleUserInfo represents the user info from Google OAuth
@@ -40,15 +134,34 @@ type GoogleUserInfo struct {
 // AuthResponse represents the response after successful authentication
 type AuthResponse struct {
 	User         *User  `json:"user"`
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
 	TokenType    string `json:"token_type"`
 	ExpiresIn    int    `json:"expires_in"`
+	// Set when the user's roles require MFA but they have not enrolled yet
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
+	// CSRFToken replaces the tokens when the session is kept in cookies; send it in the X-CSRF-Token header
+	CSRFToken string `json:"csrf_token,omitempty"`
 }
 
 // LoginRequest represents a login request
 type LoginRequest struct {
-	Code string `json:"code" validate:"required"`
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+// ConfirmIdentityLinkRequest represents a request to confirm a pending identity link
+type ConfirmIdentityLinkRequest struct {
+	LinkToken string `json:"link_token" validate:"required"`
+}
+
+// IdentityLinkRequired is returned when a login's verified email already belongs to an account.
+// The owner of that account must log in and confirm the link with the token.
+type IdentityLinkRequired struct {
+	LinkToken string    `json:"link_token"`
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 // RefreshTokenRequest represents a token refresh request
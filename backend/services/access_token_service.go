@@ -0,0 +1,243 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+// AccessTokenPrefix starts every personal access token, which tells them apart from JWTs
+const AccessTokenPrefix = "hdp_"
+
+// Scopes an access token can be limited to
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// AccessTokenScopes lists the valid access token scopes
+var AccessTokenScopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// Lifetimes of access tokens in days
+const (
+	DefaultAccessTokenDays = 30
+	MaxAccessTokenDays     = 365
+)
+
+var (
+	// ErrInvalidAccessToken is returned for unknown, expired or revoked access tokens
+	ErrInvalidAccessToken = errors.New("invalid or expired access token")
+	// ErrAccessTokenNotFound is returned when a token does not exist or belongs to someone else
+	ErrAccessTokenNotFound = errors.New("access token not found")
+)
+
+// AccessTokenService manages personal access tokens for users and service accounts.
+// Tokens are stored hashed and authenticate requests next to JWTs.
+type AccessTokenService struct {
+	db *sql.DB
+	// lastUsedInterval limits how often last_used_at is written for a busy token
+	lastUsedInterval time.Duration
+}
+
+// NewAccessTokenService creates a new access token service
+func NewAccessTokenService(db *sql.DB) *AccessTokenService {
+	return &AccessTokenService{
+		db:               db,
+		lastUsedInterval: time.Minute,
+	}
+}
+
+// ValidateAccessTokenInput checks a token request and returns the problems by field
+func ValidateAccessTokenInput(input *models.AccessTokenCreateInput) map[string]string {
+	errs := make(map[string]string)
+	if strings.TrimSpace(input.Name) == "" {
+		errs["name"] = "Name is required"
+	}
+	if len(input.Scopes) == 0 {
+		errs["scopes"] = "At least one scope is required"
+	}
+	for _, scope := range input.Scopes {
+		if !slices.Contains(AccessTokenScopes, scope) {
+			errs["scopes"] = fmt.Sprintf("Unknown scope %q, valid scopes are %s", scope, strings.Join(AccessTokenScopes, ", "))
+			break
+		}
+	}
+	if input.ExpiresInDays < 0 || input.ExpiresInDays > MaxAccessTokenDays {
+		errs["expires_in_days"] = fmt.Sprintf("Expiry must be between 1 and %d days, or 0 for the default of %d days", MaxAccessTokenDays, DefaultAccessTokenDays)
+	}
+	return errs
+}
+
+// CreateToken creates an access token for a user. The token is returned only here.
+// mfa marks the token as carrying a second factor, which is only set when the
+// session creating it had one.
+func (ats *AccessTokenService) CreateToken(userID int, input *models.AccessTokenCreateInput, createdBy int, mfa bool) (*models.AccessTokenCreated, error) {
+	days := input.ExpiresInDays
+	if days == 0 {
+		days = DefaultAccessTokenDays
+	}
+
+	secret, err := generateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+	token := AccessTokenPrefix + secret
+
+	scopes := slices.Clone(input.Scopes)
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+
+	query := `
+		INSERT INTO access_tokens (user_id, name, token_prefix, token_hash, scopes, mfa, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, user_id, name, token_prefix, scopes, expires_at, created_by, created_at
+	`
+
+	created := &models.AccessTokenCreated{Token: token}
+	expiresAt := time.Now().AddDate(0, 0, days)
+	err = ats.db.QueryRow(query, userID, strings.TrimSpace(input.Name), token[:len(AccessTokenPrefix)+6],
+		hashToken(token), pq.Array(scopes), mfa, expiresAt, createdBy).Scan(
+		&created.ID,
+		&created.UserID,
+		&created.Name,
+		&created.TokenPrefix,
+		pq.Array(&created.Scopes),
+		&created.ExpiresAt,
+		&created.CreatedBy,
+		&created.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create access token: %w", err)
+	}
+
+	return created, nil
+}
+
+// ListTokens returns the active tokens of a user, newest first
+func (ats *AccessTokenService) ListTokens(userID int) ([]models.AccessToken, error) {
+	query := `
+		SELECT id, user_id, name, token_prefix, scopes, expires_at, last_used_at,
+		       COALESCE(last_used_ip, ''), created_by, created_at
+		FROM access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY created_at DESC
+	`
+
+	rows, err := ats.db.Query(query, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []models.AccessToken{}
+	for rows.Next() {
+		var token models.AccessToken
+		if err := rows.Scan(
+			&token.ID,
+			&token.UserID,
+			&token.Name,
+			&token.TokenPrefix,
+			pq.Array(&token.Scopes),
+			&token.ExpiresAt,
+			&token.LastUsedAt,
+			&token.LastUsedIP,
+			&token.CreatedBy,
+			&token.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan access token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeToken revokes one of a user's tokens
+func (ats *AccessTokenService) RevokeToken(userID, tokenID int) error {
+	result, err := ats.db.Exec(
+		`UPDATE access_tokens SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`,
+		time.Now(), tokenID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	if affected == 0 {
+		return ErrAccessTokenNotFound
+	}
+	return nil
+}
+
+// RevokeAllTokens revokes every token of a user
+func (ats *AccessTokenService) RevokeAllTokens(userID int) error {
+	_, err := ats.db.Exec(
+		`UPDATE access_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`,
+		time.Now(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+	return nil
+}
+
+// Authenticate checks an access token presented from ip and returns claims for it.
+// Tokens of inactive users are rejected.
+func (ats *AccessTokenService) Authenticate(token, ip string) (*Claims, error) {
+	if !strings.HasPrefix(token, AccessTokenPrefix) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	query := `
+		SELECT t.id, t.user_id, u.email, t.scopes, t.mfa, t.expires_at, t.last_used_at
+		FROM access_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1 AND t.revoked_at IS NULL AND t.expires_at > $2 AND u.is_active = true
+	`
+
+	var (
+		tokenID    int
+		claims     Claims
+		scopes     []string
+		expiresAt  time.Time
+		lastUsedAt sql.NullTime
+	)
+	now := time.Now()
+	err := ats.db.QueryRow(query, hashToken(token), now).Scan(
+		&tokenID, &claims.UserID, &claims.Email, pq.Array(&scopes), &claims.MFA, &expiresAt, &lastUsedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidAccessToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up access token: %w", err)
+	}
+
+	if !lastUsedAt.Valid || now.Sub(lastUsedAt.Time) >= ats.lastUsedInterval {
+		if _, err := ats.db.Exec(
+			`UPDATE access_tokens SET last_used_at = $1, last_used_ip = $2 WHERE id = $3`,
+			now, ip, tokenID,
+		); err != nil {
+			log.Printf("Warning: failed to record access token use: %v", err)
+		}
+	}
+
+	claims.Scope = strings.Join(scopes, " ")
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Subject:   claims.Email,
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+	return &claims, nil
+}
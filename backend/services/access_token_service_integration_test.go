@@ -0,0 +1,42 @@
+//go:build integration
+
+package services
+
+import (
+	"testing"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+func TestRevokeAllAccessTokens(t *testing.T) {
+	db := openTestDB(t)
+	ats := NewAccessTokenService(db)
+	userID := createTestUser(t, db)
+	otherID := createTestUser(t, db)
+
+	input := &models.AccessTokenCreateInput{Name: "ci", Scopes: []string{ScopeRead, ScopeAdmin}, ExpiresInDays: 365}
+	token, err := ats.CreateToken(userID, input, userID, true)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	other, err := ats.CreateToken(otherID, input, otherID, false)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+
+	if _, err := ats.Authenticate(token.Token, "192.0.2.1"); err != nil {
+		t.Fatalf("Expected the new token to authenticate, got %v", err)
+	}
+
+	// What the password change, password reset and admin force logout do besides ending the sessions
+	if err := ats.RevokeAllTokens(userID); err != nil {
+		t.Fatalf("RevokeAllTokens failed: %v", err)
+	}
+
+	if _, err := ats.Authenticate(token.Token, "192.0.2.1"); err == nil {
+		t.Error("Expected a revoked token to be refused")
+	}
+	if _, err := ats.Authenticate(other.Token, "192.0.2.1"); err != nil {
+		t.Errorf("Expected the tokens of other users to stay valid, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+func TestClaimsScopeLimitsMethods(t *testing.T) {
+	cases := []struct {
+		scope  string
+		method string
+		want   bool
+	}{
+		{"", http.MethodGet, true},
+		{"", http.MethodDelete, true},
+		{"read", http.MethodGet, true},
+		{"read", http.MethodHead, true},
+		{"read", http.MethodPost, false},
+		{"read", http.MethodDelete, false},
+		{"write", http.MethodGet, true},
+		{"write", http.MethodPut, true},
+		{"admin", http.MethodGet, false},
+		{"admin write", http.MethodPost, true},
+	}
+
+	for _, c := range cases {
+		claims := &Claims{Scope: c.scope}
+		if got := claims.AllowsMethod(c.method); got != c.want {
+			t.Errorf("Scope %q with %s: expected %v, got %v", c.scope, c.method, c.want, got)
+		}
+	}
+}
+
+func TestClaimsAdminScope(t *testing.T) {
+	if !(&Claims{}).HasScope(ScopeAdmin) {
+		t.Error("Expected login sessions without a scope to keep the admin role")
+	}
+	if (&Claims{Scope: "read write"}).HasScope(ScopeAdmin) {
+		t.Error("Expected a token without the admin scope not to have it")
+	}
+	if !(&Claims{Scope: "read admin"}).HasScope(ScopeAdmin) {
+		t.Error("Expected a token with the admin scope to have it")
+	}
+}
+
+func TestValidateAccessTokenInput(t *testing.T) {
+	valid := &models.AccessTokenCreateInput{Name: "CI", Scopes: []string{ScopeRead, ScopeWrite}}
+	if errs := ValidateAccessTokenInput(valid); len(errs) != 0 {
+		t.Errorf("Expected valid input, got %v", errs)
+	}
+
+	invalid := map[string]*models.AccessTokenCreateInput{
+		"name":            {Name: " ", Scopes: []string{ScopeRead}},
+		"scopes":          {Name: "CI", Scopes: []string{"root"}},
+		"expires_in_days": {Name: "CI", Scopes: []string{ScopeRead}, ExpiresInDays: MaxAccessTokenDays + 1},
+	}
+	for field, input := range invalid {
+		if _, ok := ValidateAccessTokenInput(input)[field]; !ok {
+			t.Errorf("Expected an error for %s", field)
+		}
+	}
+
+	if _, ok := ValidateAccessTokenInput(&models.AccessTokenCreateInput{Name: "CI"})["scopes"]; !ok {
+		t.Error("Expected an error for missing scopes")
+	}
+
+	for _, days := range []int{0, 1, MaxAccessTokenDays} {
+		input := &models.AccessTokenCreateInput{Name: "CI", Scopes: []string{ScopeRead}, ExpiresInDays: days}
+		if errs := ValidateAccessTokenInput(input); len(errs) != 0 {
+			t.Errorf("Expected an expiry of %d days to be accepted, got %v", days, errs)
+		}
+	}
+	if _, ok := ValidateAccessTokenInput(&models.AccessTokenCreateInput{Name: "CI", Scopes: []string{ScopeRead}, ExpiresInDays: -1})["expires_in_days"]; !ok {
+		t.Error("Expected an error for a negative expiry")
+	}
+}
@@ -134,27 +134,233 @@ func (as *AdminService) RemoveUserFromOrganization(userID, organizationID int) e
 	return nil
 }
 
-// UserHasRole checks if a user has a specific role
-func (as *AdminService) UserHasRole(userID int, roleName string) (bool, error) {
+// SetUserActive activates or deactivates a user account
+func (as *AdminService) SetUserActive(userID int, active bool) error {
+	query := `UPDATE users SET is_active = $1 WHERE id = $2`
+
+	result, err := as.db.Exec(query, active, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update user status: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+// MergeUsers moves everything owned by the source user to the target user and deletes the source.
+// Login identities, roles, organization memberships, Stripe customers, subscriptions and payments
+// are moved; where both users have the same role or membership, or a Stripe customer, the
+// target's entry is kept.
+func (as *AdminService) MergeUsers(sourceUserID, targetUserID int) error {
+	if sourceUserID == targetUserID {
+		return fmt.Errorf("cannot merge a user into itself")
+	}
+
+	tx, err := as.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock both users in a fixed order so concurrent merges cannot deadlock
+	rows, err := tx.Query(`SELECT id FROM users WHERE id IN ($1, $2) ORDER BY id FOR UPDATE`, sourceUserID, targetUserID)
+	if err != nil {
+		return fmt.Errorf("failed to lock users: %w", err)
+	}
+	found := 0
+	for rows.Next() {
+		found++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to lock users: %w", err)
+	}
+	if found != 2 {
+		return fmt.Errorf("user not found")
+	}
+
+	statements := []struct {
+		query string
+		what  string
+	}{
+		{`UPDATE user_identities SET user_id = $2 WHERE user_id = $1`, "identities"},
+		{`INSERT INTO user_roles (user_id, role_id, assigned_at, assigned_by)
+			SELECT $2, role_id, assigned_at, assigned_by FROM user_roles WHERE user_id = $1
+			ON CONFLICT (user_id, role_id) DO NOTHING`, "roles"},
+		{`DELETE FROM user_roles WHERE user_id = $1`, "roles"},
+		{`UPDATE user_roles SET assigned_by = $2 WHERE assigned_by = $1`, "role assignments"},
+		{`INSERT INTO user_organizations (user_id, organization_id, joined_at, role)
+			SELECT $2, organization_id, joined_at, role FROM user_organizations WHERE user_id = $1
+			ON CONFLICT (user_id, organization_id) DO NOTHING`, "organization memberships"},
+		{`DELETE FROM user_organizations WHERE user_id = $1`, "organization memberships"},
+		// A user has one Stripe customer: where the target already has one, file the source's
+		// subscriptions and payments under it and drop the source's, otherwise move the source's
+		{`UPDATE subscriptions s SET stripe_customer_id = t.id
+			FROM stripe_customers c, (SELECT id FROM stripe_customers WHERE user_id = $2 ORDER BY id LIMIT 1) t
+			WHERE c.id = s.stripe_customer_id AND c.user_id = $1`, "subscriptions"},
+		{`UPDATE payments p SET stripe_customer_id = t.id
+			FROM stripe_customers c, (SELECT id FROM stripe_customers WHERE user_id = $2 ORDER BY id LIMIT 1) t
+			WHERE c.id = p.stripe_customer_id AND c.user_id = $1`, "payments"},
+		{`DELETE FROM stripe_customers
+			WHERE user_id = $1 AND EXISTS (SELECT 1 FROM stripe_customers WHERE user_id = $2)`, "Stripe customers"},
+		{`UPDATE stripe_customers SET user_id = $2, updated_at = CURRENT_TIMESTAMP WHERE user_id = $1`, "Stripe customers"},
+		{`UPDATE subscriptions SET user_id = $2 WHERE user_id = $1`, "subscriptions"},
+		{`UPDATE payments SET user_id = $2 WHERE user_id = $1`, "payments"},
+		// Carry over an active subscription unless the target already has one
+		{`UPDATE users t
+			SET subscription_status = s.subscription_status,
+				subscription_plan = s.subscription_plan,
+				subscription_expires_at = s.subscription_expires_at,
+				updated_at = CURRENT_TIMESTAMP
+			FROM users s
+			WHERE s.id = $1 AND t.id = $2
+				AND s.subscription_status = 'active'
+				AND COALESCE(t.subscription_status, 'none') <> 'active'`, "subscription status"},
+		// Sessions of the source user go with it
+		{`DELETE FROM users WHERE id = $1`, "source user"},
+	}
+
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt.query, sourceUserID, targetUserID); err != nil {
+			return fmt.Errorf("failed to merge %s: %w", stmt.what, err)
+		}
+	}
+
+	// Keep users.google_id in step with the identities the target now owns
 	query := `
-		SELECT COUNT(*) 
-		FROM user_roles ur 
-		JOIN roles r ON ur.role_id = r.id 
-		WHERE ur.user_id = $1 AND r.name = $2
+		UPDATE users
+		SET google_id = (
+			SELECT subject FROM user_identities
+			WHERE user_id = $1 AND provider = 'google'
+			ORDER BY created_at LIMIT 1
+		)
+		WHERE id = $1 AND google_id IS NULL
 	`
-	
-	var count int
-	err := as.db.QueryRow(query, userID, roleName).Scan(&count)
+	if _, err := tx.Exec(query, targetUserID); err != nil {
+		return fmt.Errorf("failed to merge Google ID: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit user merge: %w", err)
+	}
+
+	return nil
+}
+
+// GetPendingUsers returns the users whose sign-up is waiting for approval, oldest first
+func (as *AdminService) GetPendingUsers() ([]models.User, error) {
+	query := `
+		SELECT id, email, name, picture, COALESCE(google_id, ''), is_active, last_login_at, created_at, updated_at
+		FROM users
+		WHERE pending_approval = true
+		ORDER BY created_at
+	`
+
+	rows, err := as.db.Query(query)
 	if err != nil {
+		return nil, fmt.Errorf("failed to query pending users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.Picture, &user.GoogleID, &user.IsActive, &user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// ApproveUser activates a user whose sign-up is waiting for approval and returns their email
+func (as *AdminService) ApproveUser(userID int) (string, error) {
+	query := `
+		UPDATE users
+		SET is_active = true, pending_approval = false, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND pending_approval = true
+		RETURNING email
+	`
+
+	var email string
+	if err := as.db.QueryRow(query, userID).Scan(&email); err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("pending user not found")
+		}
+		return "", fmt.Errorf("failed to approve user: %w", err)
+	}
+
+	return email, nil
+}
+
+// RejectUser deletes a user whose sign-up is waiting for approval and returns their email
+func (as *AdminService) RejectUser(userID int) (string, error) {
+	query := `DELETE FROM users WHERE id = $1 AND pending_approval = true RETURNING email`
+
+	var email string
+	if err := as.db.QueryRow(query, userID).Scan(&email); err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("pending user not found")
+		}
+		return "", fmt.Errorf("failed to reject user: %w", err)
+	}
+
+	return email, nil
+}
+
+// UserHasRole checks if a user has a specific role, directly or inherited through parent roles.
+// Unless withAdmin is set the admin role and what is only inherited through it do not count.
+func (as *AdminService) UserHasRole(userID int, roleName string, withAdmin bool) (bool, error) {
+	query := effectiveRolesCTE + `
+		SELECT EXISTS (
+			SELECT 1 FROM effective_roles er JOIN roles r ON r.id = er.role_id WHERE r.name = $3
+		)
+	`
+
+	var hasRole bool
+	if err := as.db.QueryRow(query, userID, withAdmin, roleName).Scan(&hasRole); err != nil {
 		return false, fmt.Errorf("failed to check user role: %w", err)
 	}
 
-	return count > 0, nil
+	return hasRole, nil
 }
 
-// GetUserRoles returns all roles for a specific user
-func (as *AdminService) GetUserRoles(userID int) ([]models.Role, error) {
-	return as.getUserRoles(userID)
+// GetUserRoles returns the roles of a specific user, both those assigned directly and those inherited through them
+func (as *AdminService) GetUserRoles(userID int) ([]models.EffectiveRole, error) {
+	query := effectiveRolesCTE + `
+		SELECT r.id, r.name, r.description, r.created_at, r.updated_at, ur.role_id IS NULL
+		FROM effective_roles er
+		JOIN roles r ON r.id = er.role_id
+		LEFT JOIN user_roles ur ON ur.role_id = r.id AND ur.user_id = $1
+		ORDER BY r.name
+	`
+
+	rows, err := as.db.Query(query, userID, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []models.EffectiveRole{}
+	for rows.Next() {
+		var role models.EffectiveRole
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, &role.UpdatedAt, &role.Inherited); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
 }
 
 // GetUserOrganizations returns all organizations for a specific user
@@ -165,7 +371,7 @@ func (as *AdminService) GetUserOrganizations(userID int) ([]models.Organization,
 // Helper methods
 
 func (as *AdminService) getAllUsers() ([]models.User, error) {
-	query := `SELECT id, email, name, picture, google_id, is_active, last_login_at, created_at, updated_at FROM users ORDER BY name`
+	query := `SELECT id, email, name, picture, COALESCE(google_id, ''), is_active, last_login_at, created_at, updated_at FROM users ORDER BY name`
 	
 	rows, err := as.db.Query(query)
 	if err != nil {
@@ -0,0 +1,144 @@
+//go:build integration
+
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMergeUsers(t *testing.T) {
+	db := openTestDB(t)
+	as := NewAdminService(db)
+	sourceID := createTestUser(t, db)
+	targetID := createTestUser(t, db)
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	insertID := func(query string, args ...interface{}) int {
+		t.Helper()
+		var id int
+		if err := db.QueryRow(query, args...).Scan(&id); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return id
+	}
+
+	orgID := insertID(`INSERT INTO organizations (name) VALUES ($1) RETURNING id`, "merge-"+suffix)
+	sharedOrgID := insertID(`INSERT INTO organizations (name) VALUES ($1) RETURNING id`, "merge-shared-"+suffix)
+	exec(`INSERT INTO user_organizations (user_id, organization_id, role) VALUES ($1, $2, 'owner'), ($1, $3, 'viewer'), ($4, $3, 'admin')`, sourceID, orgID, sharedOrgID, targetID)
+	exec(`INSERT INTO user_roles (user_id, role_id) SELECT $1, id FROM roles WHERE name IN ('editor', 'user')`, sourceID)
+	exec(`INSERT INTO user_roles (user_id, role_id) SELECT $1, id FROM roles WHERE name = 'user'`, targetID)
+	exec(`INSERT INTO user_identities (user_id, provider, subject, email, email_verified) VALUES ($1, 'github', $2, 'source@example.com', true)`, sourceID, "merge-"+suffix)
+
+	customerID := insertID(`INSERT INTO stripe_customers (user_id, stripe_id, email) VALUES ($1, $2, 'source@example.com') RETURNING id`, sourceID, "cus_"+suffix)
+	now := time.Now()
+	exec(`INSERT INTO subscriptions (user_id, stripe_customer_id, stripe_sub_id, status, plan_id, plan_name, current_period_start, current_period_end)
+		VALUES ($1, $2, $3, 'active', 'price_pro', 'pro', $4, $5)`, sourceID, customerID, "sub_"+suffix, now, now.Add(30*24*time.Hour))
+	exec(`INSERT INTO payments (user_id, stripe_customer_id, stripe_payment_id, amount, status) VALUES ($1, $2, $3, 1000, 'succeeded')`, sourceID, customerID, "pi_"+suffix)
+	exec(`UPDATE users SET subscription_status = 'active', subscription_plan = 'pro' WHERE id = $1`, sourceID)
+
+	if err := as.MergeUsers(sourceID, sourceID); err == nil {
+		t.Error("Expected merging a user into itself to fail")
+	}
+	if err := as.MergeUsers(sourceID, targetID); err != nil {
+		t.Fatalf("MergeUsers failed: %v", err)
+	}
+
+	count := func(query string, args ...interface{}) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return n
+	}
+
+	if n := count(`SELECT COUNT(*) FROM users WHERE id = $1`, sourceID); n != 0 {
+		t.Error("Expected the source user to be deleted")
+	}
+	if n := count(`SELECT COUNT(*) FROM user_roles ur JOIN roles r ON r.id = ur.role_id WHERE ur.user_id = $1 AND r.name IN ('editor', 'user')`, targetID); n != 2 {
+		t.Errorf("Expected the target to hold editor and user once each, got %d roles", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM user_organizations WHERE user_id = $1 AND organization_id = $2 AND role = 'owner'`, targetID, orgID); n != 1 {
+		t.Error("Expected the source's membership to move to the target")
+	}
+	if n := count(`SELECT COUNT(*) FROM user_organizations WHERE user_id = $1 AND organization_id = $2 AND role = 'admin'`, targetID, sharedOrgID); n != 1 {
+		t.Error("Expected the target's own membership to be kept where both were members")
+	}
+	if n := count(`SELECT COUNT(*) FROM user_identities WHERE user_id = $1 AND subject = $2`, targetID, "merge-"+suffix); n != 1 {
+		t.Error("Expected the source's identities to move to the target")
+	}
+	if n := count(`SELECT COUNT(*) FROM stripe_customers WHERE user_id = $1 AND id = $2`, targetID, customerID); n != 1 {
+		t.Error("Expected the source's Stripe customer to move to the target")
+	}
+	for _, table := range []string{"subscriptions", "payments"} {
+		if n := count(`SELECT COUNT(*) FROM `+table+` WHERE user_id = $1 AND stripe_customer_id = $2`, targetID, customerID); n != 1 {
+			t.Errorf("Expected the source's %s to move to the target, got %d", table, n)
+		}
+	}
+	if n := count(`SELECT COUNT(*) FROM users WHERE id = $1 AND subscription_status = 'active' AND subscription_plan = 'pro'`, targetID); n != 1 {
+		t.Error("Expected the active subscription to carry over to the target")
+	}
+}
+
+func TestMergeUsersKeepsTargetStripeCustomer(t *testing.T) {
+	db := openTestDB(t)
+	as := NewAdminService(db)
+	sourceID := createTestUser(t, db)
+	targetID := createTestUser(t, db)
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	insertID := func(query string, args ...interface{}) int {
+		t.Helper()
+		var id int
+		if err := db.QueryRow(query, args...).Scan(&id); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return id
+	}
+
+	sourceCustomerID := insertID(`INSERT INTO stripe_customers (user_id, stripe_id, email) VALUES ($1, $2, 'source@example.com') RETURNING id`, sourceID, "cus_source_"+suffix)
+	targetCustomerID := insertID(`INSERT INTO stripe_customers (user_id, stripe_id, email) VALUES ($1, $2, 'target@example.com') RETURNING id`, targetID, "cus_target_"+suffix)
+	now := time.Now()
+	exec(`INSERT INTO subscriptions (user_id, stripe_customer_id, stripe_sub_id, status, plan_id, plan_name, current_period_start, current_period_end)
+		VALUES ($1, $2, $3, 'active', 'price_pro', 'pro', $4, $5)`, sourceID, sourceCustomerID, "sub_"+suffix, now, now.Add(30*24*time.Hour))
+	exec(`INSERT INTO payments (user_id, stripe_customer_id, stripe_payment_id, amount, status) VALUES ($1, $2, $3, 1000, 'succeeded')`, sourceID, sourceCustomerID, "pi_"+suffix)
+
+	if err := as.MergeUsers(sourceID, targetID); err != nil {
+		t.Fatalf("MergeUsers failed: %v", err)
+	}
+
+	count := func(query string, args ...interface{}) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return n
+	}
+
+	if n := count(`SELECT COUNT(*) FROM stripe_customers WHERE user_id = $1`, targetID); n != 1 {
+		t.Errorf("Expected the target to keep a single Stripe customer, got %d", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM stripe_customers WHERE id = $1 AND user_id = $2`, targetCustomerID, targetID); n != 1 {
+		t.Error("Expected the target's own Stripe customer to be kept")
+	}
+	for _, table := range []string{"subscriptions", "payments"} {
+		if n := count(`SELECT COUNT(*) FROM `+table+` WHERE user_id = $1 AND stripe_customer_id = $2`, targetID, targetCustomerID); n != 1 {
+			t.Errorf("Expected the source's %s to move under the target's Stripe customer, got %d", table, n)
+		}
+	}
+}
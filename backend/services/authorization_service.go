@@ -0,0 +1,247 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/events"
+)
+
+// Authorization is a snapshot of what a user may do: their effective roles, the permissions those grant
+// and their organization memberships. Roles and permissions held only through the admin role count only
+// when AdminScope is set, as the admin role itself only counts for credentials with the admin scope.
+type Authorization struct {
+	UserID     int
+	AdminScope bool
+
+	// roles and permissions map to whether they are held without the admin role
+	roles         map[string]bool
+	permissions   map[string]bool
+	organizations map[int]string
+}
+
+// WithScope returns a copy of the snapshot for credentials with or without the admin scope
+func (a *Authorization) WithScope(adminScope bool) *Authorization {
+	scoped := *a
+	scoped.AdminScope = adminScope
+	return &scoped
+}
+
+// HasRole reports whether the user has a role, directly or inherited
+func (a *Authorization) HasRole(role string) bool {
+	withoutAdmin, ok := a.roles[role]
+	return ok && (withoutAdmin || a.AdminScope)
+}
+
+// HasPermission reports whether one of the user's roles grants a permission
+func (a *Authorization) HasPermission(permission string) bool {
+	withoutAdmin, ok := a.permissions[permission]
+	return ok && (withoutAdmin || a.AdminScope)
+}
+
+// OrgRole returns the role of the user in an organization, or an empty string if they are not a member
+func (a *Authorization) OrgRole(organizationID int) string {
+	return a.organizations[organizationID]
+}
+
+// Roles returns the names of the user's roles, directly held or inherited, that count for the scope
+func (a *Authorization) Roles() []string {
+	roles := make([]string, 0, len(a.roles))
+	for role := range a.roles {
+		if a.HasRole(role) {
+			roles = append(roles, role)
+		}
+	}
+	slices.Sort(roles)
+	return roles
+}
+
+// Organizations returns the organizations the user is a member of with their role in each
+func (a *Authorization) Organizations() map[int]string {
+	return maps.Clone(a.organizations)
+}
+
+// cachedAuthorization is a snapshot with the time it stops being used
+type cachedAuthorization struct {
+	authorization *Authorization
+	expiresAt     time.Time
+}
+
+// AuthorizationService resolves the authorization of users in one query and caches it per replica.
+// Role, permission and membership changes are announced on the event bus, so that every replica
+// drops the affected snapshots; the TTL bounds how long a missed event can leave one stale.
+type AuthorizationService struct {
+	db           *sql.DB
+	eventService *events.EventService
+	ttl          time.Duration
+
+	mu      sync.Mutex
+	entries map[int]cachedAuthorization
+	// generation changes on every invalidation, so that loads racing with one are not cached
+	generation uint64
+}
+
+// NewAuthorizationService creates a new authorization service caching snapshots for ttl
+func NewAuthorizationService(db *sql.DB, eventService *events.EventService, ttl time.Duration) *AuthorizationService {
+	as := &AuthorizationService{
+		db:           db,
+		eventService: eventService,
+		ttl:          ttl,
+		entries:      make(map[int]cachedAuthorization),
+	}
+
+	for _, topic := range []string{events.TopicRoles, events.TopicOrganizations, events.TopicUsers} {
+		go as.listen(topic)
+	}
+	go as.purgePeriodically(time.Minute)
+
+	return as
+}
+
+// Get returns the authorization of a user, from the cache unless it has expired
+func (as *AuthorizationService) Get(userID int) (*Authorization, error) {
+	as.mu.Lock()
+	entry, ok := as.entries[userID]
+	generation := as.generation
+	as.mu.Unlock()
+
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.authorization, nil
+	}
+
+	authorization, err := as.load(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	as.mu.Lock()
+	if as.generation == generation {
+		as.entries[userID] = cachedAuthorization{authorization: authorization, expiresAt: time.Now().Add(as.ttl)}
+	}
+	as.mu.Unlock()
+
+	return authorization, nil
+}
+
+// Invalidate drops the cached authorization of a user
+func (as *AuthorizationService) Invalidate(userID int) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	delete(as.entries, userID)
+	as.generation++
+}
+
+// InvalidateAll drops every cached authorization, for changes to roles that affect all their users
+func (as *AuthorizationService) InvalidateAll() {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	as.entries = make(map[int]cachedAuthorization)
+	as.generation++
+}
+
+// load resolves the effective roles, permissions and organization memberships of a user. Roles are
+// followed through their parents, remembering whether the path went through the admin role.
+func (as *AuthorizationService) load(userID int) (*Authorization, error) {
+	query := `
+		WITH RECURSIVE effective_roles(role_id, via_admin) AS (
+			SELECT ur.role_id, r.name = 'admin'
+			FROM user_roles ur
+			JOIN roles r ON r.id = ur.role_id
+			WHERE ur.user_id = $1
+			UNION
+			SELECT rp.parent_role_id, er.via_admin OR r.name = 'admin'
+			FROM role_parents rp
+			JOIN effective_roles er ON er.role_id = rp.role_id
+			JOIN roles r ON r.id = rp.parent_role_id
+		)
+		SELECT
+			COALESCE((
+				SELECT json_object_agg(name, without_admin) FROM (
+					SELECT r.name, bool_or(NOT er.via_admin) AS without_admin
+					FROM effective_roles er JOIN roles r ON r.id = er.role_id
+					GROUP BY r.name
+				) held
+			), '{}'),
+			COALESCE((
+				SELECT json_object_agg(name, without_admin) FROM (
+					SELECT p.name, bool_or(NOT er.via_admin) AS without_admin
+					FROM effective_roles er
+					JOIN role_permissions rp ON rp.role_id = er.role_id
+					JOIN permissions p ON p.id = rp.permission_id
+					GROUP BY p.name
+				) granted
+			), '{}'),
+			COALESCE((
+				SELECT json_object_agg(organization_id, role) FROM user_organizations WHERE user_id = $1
+			), '{}')
+	`
+
+	var rolesJSON, permissionsJSON, organizationsJSON []byte
+	if err := as.db.QueryRow(query, userID).Scan(&rolesJSON, &permissionsJSON, &organizationsJSON); err != nil {
+		return nil, fmt.Errorf("failed to load authorization: %w", err)
+	}
+
+	authorization := &Authorization{UserID: userID}
+	if err := json.Unmarshal(rolesJSON, &authorization.roles); err != nil {
+		return nil, fmt.Errorf("failed to parse roles: %w", err)
+	}
+	if err := json.Unmarshal(permissionsJSON, &authorization.permissions); err != nil {
+		return nil, fmt.Errorf("failed to parse permissions: %w", err)
+	}
+	if err := json.Unmarshal(organizationsJSON, &authorization.organizations); err != nil {
+		return nil, fmt.Errorf("failed to parse organization memberships: %w", err)
+	}
+
+	return authorization, nil
+}
+
+// listen drops the snapshots that the events of a topic make stale
+func (as *AuthorizationService) listen(topic string) {
+	if as.eventService == nil {
+		return
+	}
+
+	ch, err := as.eventService.SubscribeToTopic(topic)
+	if err != nil {
+		log.Printf("Warning: Failed to subscribe to %s events: %v", topic, err)
+		return
+	}
+
+	for event := range ch {
+		switch event.Type {
+		case events.EventTypeRoleAssigned, events.EventTypeRoleRemoved,
+			events.EventTypeUserAddedToOrg, events.EventTypeUserRemovedFromOrg,
+			events.EventTypeUserMerged, events.EventTypeUserDeleted:
+			if event.UserID != nil {
+				as.Invalidate(*event.UserID)
+			}
+		case events.EventTypeRoleUpdated, events.EventTypeRoleDeleted, events.EventTypeOrgDeleted:
+			as.InvalidateAll()
+		}
+	}
+}
+
+// purgePeriodically removes expired snapshots on an interval
+func (as *AuthorizationService) purgePeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		as.mu.Lock()
+		for userID, entry := range as.entries {
+			if now.After(entry.expiresAt) {
+				delete(as.entries, userID)
+			}
+		}
+		as.mu.Unlock()
+	}
+}
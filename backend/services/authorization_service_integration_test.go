@@ -0,0 +1,67 @@
+//go:build integration
+
+package services
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRolePermissions(t *testing.T) {
+	db := openTestDB(t)
+	as := NewAuthorizationService(db, nil, time.Minute)
+
+	rows, err := db.Query(`SELECT name FROM permissions`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var catalogue []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		catalogue = append(catalogue, name)
+	}
+	rows.Close()
+
+	user := []string{PermissionBillingRead, PermissionBillingWrite, PermissionOrgRead}
+	reader := append(slices.Clone(user), PermissionRolesRead)
+	editor := append(slices.Clone(reader), PermissionOrgWrite)
+	manager := append(slices.Clone(editor), PermissionRolesWrite)
+
+	// Permissions held through the parents of a role are granted as well
+	cases := []struct {
+		role       string
+		adminScope bool
+		want       []string
+	}{
+		{"user", false, user},
+		{"reader", false, reader},
+		{"editor", false, editor},
+		{"manager", false, manager},
+		{"admin", true, catalogue},
+		// Without the admin scope, nothing reached through the admin role counts
+		{"admin", false, nil},
+	}
+
+	for _, c := range cases {
+		userID := createTestUser(t, db)
+		if _, err := db.Exec(`INSERT INTO user_roles (user_id, role_id) SELECT $1, id FROM roles WHERE name = $2`, userID, c.role); err != nil {
+			t.Fatal(err)
+		}
+
+		authz, err := as.Get(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		authz = authz.WithScope(c.adminScope)
+
+		for _, permission := range catalogue {
+			if got, want := authz.HasPermission(permission), slices.Contains(c.want, permission); got != want {
+				t.Errorf("%s (admin scope %v): HasPermission(%s) = %v, want %v", c.role, c.adminScope, permission, got, want)
+			}
+		}
+	}
+}
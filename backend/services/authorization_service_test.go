@@ -0,0 +1,43 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAuthorizationScope(t *testing.T) {
+	authz := &Authorization{
+		UserID:        1,
+		roles:         map[string]bool{"admin": false, "manager": false, "user": true},
+		permissions:   map[string]bool{PermissionUsersManage: false, PermissionBillingRead: true},
+		organizations: map[int]string{7: OrgRoleOwner},
+	}
+
+	if authz.HasRole("admin") || authz.HasRole("manager") || authz.HasPermission(PermissionUsersManage) {
+		t.Error("Expected roles and permissions held through the admin role to need the admin scope")
+	}
+	if !authz.HasRole("user") || !authz.HasPermission(PermissionBillingRead) {
+		t.Error("Expected roles and permissions held without the admin role to count without the admin scope")
+	}
+
+	admin := authz.WithScope(true)
+	if !admin.HasRole("admin") || !admin.HasRole("manager") || !admin.HasPermission(PermissionUsersManage) {
+		t.Error("Expected the admin scope to enable the admin role and what it grants")
+	}
+	if authz.AdminScope {
+		t.Error("Expected WithScope to leave the cached snapshot unscoped")
+	}
+
+	if admin.HasRole("editor") || admin.HasPermission(PermissionOrgManage) {
+		t.Error("Expected roles and permissions the user does not hold to be missing")
+	}
+	if roles := authz.Roles(); !slices.Equal(roles, []string{"user"}) {
+		t.Errorf("Expected only the roles held without the admin role, got %v", roles)
+	}
+	if roles := admin.Roles(); !slices.Equal(roles, []string{"admin", "manager", "user"}) {
+		t.Errorf("Expected every role with the admin scope, got %v", roles)
+	}
+	if authz.OrgRole(7) != OrgRoleOwner || authz.OrgRole(8) != "" {
+		t.Errorf("Unexpected organization roles %q and %q", authz.OrgRole(7), authz.OrgRole(8))
+	}
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+// DeviceCodeGrantType is the grant_type of token requests in the device flow
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Device code states
+const (
+	deviceCodePending  = "pending"
+	deviceCodeApproved = "approved"
+	deviceCodeDenied   = "denied"
+	deviceCodeConsumed = "consumed"
+)
+
+// User codes use consonants only, so they are easy to type and never spell words (RFC 8628 section 6.1)
+const (
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+var deviceClientIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+var (
+	// ErrInvalidDeviceClient is returned when a device authorization has no usable client_id
+	ErrInvalidDeviceClient = errors.New("client_id must be 1-64 letters, digits, dots, dashes or underscores")
+	// ErrTooManyDeviceCodes is returned when a client has too many device logins pending
+	ErrTooManyDeviceCodes = errors.New("too many pending device logins")
+	// ErrUserCodeNotFound is returned for unknown, expired or already decided user codes
+	ErrUserCodeNotFound = errors.New("invalid or expired code")
+	// ErrAuthorizationPending is returned while the user has not decided yet
+	ErrAuthorizationPending = errors.New("authorization_pending")
+	// ErrSlowDown is returned when a device polls faster than its interval
+	ErrSlowDown = errors.New("slow_down")
+	// ErrDeviceAccessDenied is returned when the user denied the login
+	ErrDeviceAccessDenied = errors.New("access_denied")
+	// ErrDeviceCodeExpired is returned once the device code has expired
+	ErrDeviceCodeExpired = errors.New("expired_token")
+	// ErrInvalidDeviceCode is returned for unknown or already used device codes
+	ErrInvalidDeviceCode = errors.New("invalid_grant")
+)
+
+// DeviceGrant is an approved device login, ready to be turned into tokens
+type DeviceGrant struct {
+	UserID   int
+	ClientID string
+	MFA      bool
+}
+
+// DeviceAuthService implements the OAuth 2.0 device authorization grant (RFC 8628)
+// for CLIs and editor tools that cannot receive a browser redirect. The device
+// shows a short user code, which a logged-in user approves in the browser while
+// the device polls for tokens.
+type DeviceAuthService struct {
+	db              *sql.DB
+	verificationURI string
+	ttl             time.Duration
+	interval        time.Duration
+	// maxPendingPerIP caps the unapproved device logins one address can hold
+	maxPendingPerIP int
+}
+
+// NewDeviceAuthService creates a new device authorization service. verificationURI is
+// the page where users enter their code.
+func NewDeviceAuthService(db *sql.DB, verificationURI string) *DeviceAuthService {
+	return &DeviceAuthService{
+		db:              db,
+		verificationURI: verificationURI,
+		ttl:             10 * time.Minute,
+		interval:        5 * time.Second,
+		maxPendingPerIP: 10,
+	}
+}
+
+// NormalizeUserCode uppercases a user code and drops the dash and spaces people type along with it
+func NormalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// FormatUserCode splits a user code into two halves for display, e.g. BCDF-GHJK
+func FormatUserCode(code string) string {
+	if len(code) != userCodeLength {
+		return code
+	}
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// StartAuthorization issues a device code and user code for a client
+func (ds *DeviceAuthService) StartAuthorization(clientID, ip string) (*models.DeviceAuthorization, error) {
+	if !deviceClientIDPattern.MatchString(clientID) {
+		return nil, ErrInvalidDeviceClient
+	}
+
+	now := time.Now()
+
+	// Opportunistically drop finished and abandoned device logins
+	if _, err := ds.db.Exec(`DELETE FROM device_codes WHERE expires_at < $1`, now.Add(-time.Hour)); err != nil {
+		log.Printf("Warning: failed to purge device codes: %v", err)
+	}
+
+	var pending int
+	err := ds.db.QueryRow(
+		`SELECT COUNT(*) FROM device_codes WHERE requester_ip = $1 AND status = $2 AND expires_at > $3`,
+		ip, deviceCodePending, now,
+	).Scan(&pending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count pending device codes: %w", err)
+	}
+	if pending >= ds.maxPendingPerIP {
+		return nil, ErrTooManyDeviceCodes
+	}
+
+	deviceCode, err := generateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO device_codes (device_code_hash, user_code, client_id, requester_ip, interval_seconds, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	if _, err := ds.db.Exec(query, hashToken(deviceCode), userCode, clientID, ip, int(ds.interval.Seconds()), now.Add(ds.ttl)); err != nil {
+		return nil, fmt.Errorf("failed to store device code: %w", err)
+	}
+
+	return &models.DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                FormatUserCode(userCode),
+		VerificationURI:         ds.verificationURI,
+		VerificationURIComplete: ds.verificationURI + "?user_code=" + url.QueryEscape(FormatUserCode(userCode)),
+		ExpiresIn:               int(ds.ttl.Seconds()),
+		Interval:                int(ds.interval.Seconds()),
+	}, nil
+}
+
+// GetPendingLogin returns the pending device login of a user code, so the user can see which client asks
+func (ds *DeviceAuthService) GetPendingLogin(userCode string) (*models.DeviceLogin, error) {
+	code := NormalizeUserCode(userCode)
+
+	login := &models.DeviceLogin{UserCode: FormatUserCode(code)}
+	err := ds.db.QueryRow(
+		`SELECT client_id, expires_at FROM device_codes WHERE user_code = $1 AND status = $2 AND expires_at > $3`,
+		code, deviceCodePending, time.Now(),
+	).Scan(&login.ClientID, &login.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserCodeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device code: %w", err)
+	}
+
+	return login, nil
+}
+
+// Decide approves or denies a pending device login for a user. An approved
+// login inherits the MFA state of the session that approved it.
+func (ds *DeviceAuthService) Decide(userCode string, userID int, mfa, approve bool) error {
+	status := deviceCodeDenied
+	if approve {
+		status = deviceCodeApproved
+	}
+
+	now := time.Now()
+	result, err := ds.db.Exec(`
+		UPDATE device_codes SET status = $1, user_id = $2, mfa = $3, decided_at = $4
+		WHERE user_code = $5 AND status = $6 AND expires_at > $4
+	`, status, userID, mfa && approve, now, NormalizeUserCode(userCode), deviceCodePending)
+	if err != nil {
+		return fmt.Errorf("failed to update device code: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update device code: %w", err)
+	}
+	if affected == 0 {
+		return ErrUserCodeNotFound
+	}
+	return nil
+}
+
+// Poll checks a device code on behalf of the device. It returns the grant once
+// the user approved, and can only succeed once per device code. Polling faster
+// than the interval returns ErrSlowDown and lengthens the interval by five seconds.
+func (ds *DeviceAuthService) Poll(deviceCode, clientID string) (*DeviceGrant, error) {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		id           int
+		storedClient string
+		status       string
+		userID       sql.NullInt64
+		mfa          bool
+		interval     int
+		lastPolledAt sql.NullTime
+		expiresAt    time.Time
+	)
+	err = tx.QueryRow(`
+		SELECT id, client_id, status, user_id, mfa, interval_seconds, last_polled_at, expires_at
+		FROM device_codes
+		WHERE device_code_hash = $1
+		FOR UPDATE
+	`, hashToken(deviceCode)).Scan(&id, &storedClient, &status, &userID, &mfa, &interval, &lastPolledAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidDeviceCode
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device code: %w", err)
+	}
+
+	if storedClient != clientID || status == deviceCodeConsumed {
+		return nil, ErrInvalidDeviceCode
+	}
+
+	now := time.Now()
+	if now.After(expiresAt) {
+		return nil, ErrDeviceCodeExpired
+	}
+
+	var pollErr error
+	switch {
+	case lastPolledAt.Valid && now.Sub(lastPolledAt.Time) < time.Duration(interval)*time.Second:
+		interval += 5
+		pollErr = ErrSlowDown
+	case status == deviceCodePending:
+		pollErr = ErrAuthorizationPending
+	case status == deviceCodeDenied:
+		pollErr = ErrDeviceAccessDenied
+	case status == deviceCodeApproved:
+		status = deviceCodeConsumed
+	}
+
+	_, err = tx.Exec(
+		`UPDATE device_codes SET status = $1, interval_seconds = $2, last_polled_at = $3 WHERE id = $4`,
+		status, interval, now, id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update device code: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit device code: %w", err)
+	}
+
+	if pollErr != nil {
+		return nil, pollErr
+	}
+
+	return &DeviceGrant{
+		UserID:   int(userID.Int64),
+		ClientID: storedClient,
+		MFA:      mfa,
+	}, nil
+}
+
+// generateUserCode returns a random user code from userCodeAlphabet
+func generateUserCode() (string, error) {
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate user code: %w", err)
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
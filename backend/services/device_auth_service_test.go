@@ -0,0 +1,37 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUserCodeRoundTrip(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code, err := generateUserCode()
+		if err != nil {
+			t.Fatalf("generateUserCode failed: %v", err)
+		}
+		if len(code) != userCodeLength {
+			t.Fatalf("Expected %d characters, got %q", userCodeLength, code)
+		}
+		for _, c := range code {
+			if !strings.ContainsRune(userCodeAlphabet, c) {
+				t.Fatalf("Unexpected character %q in %q", c, code)
+			}
+		}
+
+		formatted := FormatUserCode(code)
+		if formatted[4] != '-' {
+			t.Errorf("Expected a dash in the middle of %q", formatted)
+		}
+		if got := NormalizeUserCode(strings.ToLower(formatted)); got != code {
+			t.Errorf("Expected %q to normalize back to %q, got %q", formatted, code, got)
+		}
+	}
+}
+
+func TestNormalizeUserCodeDropsSeparators(t *testing.T) {
+	if got := NormalizeUserCode(" bcdf - ghjk "); got != "BCDFGHJK" {
+		t.Errorf("Expected BCDFGHJK, got %q", got)
+	}
+}
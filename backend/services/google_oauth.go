@@ -34,21 +34,53 @@ func NewGoogleOAuthService(clientID, clientSecret, redirectURL string) *GoogleOA
 	}
 }
 
-// GetAuthURL returns the Google OAuth authorization URL
-func (g *GoogleOAuthService) GetAuthURL(state string) string {
-	return g.config.AuthCodeURL(state)
+// GetAuthURL returns the Google OAuth authorization URL with a PKCE S256 code challenge
+func (g *GoogleOAuthService) GetAuthURL(state, codeVerifier string) string {
+	return g.config.AuthCodeURL(state, oauth2.S256ChallengeOption(codeVerifier))
 }
 
-// ExchangeCodeForToken exchanges an authorization code for an access token
-func (g *GoogleOAuthService) ExchangeCodeForToken(code string) (*oauth2.Token, error) {
+// ExchangeCodeForToken exchanges an authorization code and its PKCE code verifier for an access token
+func (g *GoogleOAuthService) ExchangeCodeForToken(code, codeVerifier string) (*oauth2.Token, error) {
 	ctx := context.Background()
-	token, err := g.config.Exchange(ctx, code)
+	token, err := g.config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange code for token: %w", err)
 	}
 	return token, nil
 }
 
+// Name returns the provider key of Google logins
+func (g *GoogleOAuthService) Name() string {
+	return "google"
+}
+
+// AuthURL implements IdentityProvider
+func (g *GoogleOAuthService) AuthURL(ctx context.Context, state, codeVerifier string) (string, error) {
+	return g.GetAuthURL(state, codeVerifier), nil
+}
+
+// Exchange implements IdentityProvider
+func (g *GoogleOAuthService) Exchange(ctx context.Context, code, codeVerifier string) (*models.ExternalIdentity, error) {
+	token, err := g.ExchangeCodeForToken(code, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	userInfo, err := g.GetUserInfo(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ExternalIdentity{
+		Provider:      g.Name(),
+		Subject:       userInfo.ID,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.VerifiedEmail,
+		Name:          userInfo.Name,
+		Picture:       userInfo.Picture,
+	}, nil
+}
+
 // GetUserInfo retrieves user information from Google using the access token
 func (g *GoogleOAuthService) GetUserInfo(token *oauth2.Token) (*models.GoogleUserInfo, error) {
 	ctx := context.Background()
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+// ErrInvalidIdentityLink is returned for unknown, expired, used or foreign link tokens
+var ErrInvalidIdentityLink = errors.New("invalid identity link token")
+
+// PendingIdentityLink is a login identity waiting for the owner of its email address to confirm it
+type PendingIdentityLink struct {
+	Token     string
+	Provider  string
+	Email     string
+	ExpiresAt time.Time
+}
+
+// IdentityLinkService parks logins whose verified email already belongs to
+// an account. The link token is returned to the browser that proved control
+// of the new identity; the identity is only attached once the existing
+// account signs in and confirms it, so neither side alone can take over
+// the other.
+type IdentityLinkService struct {
+	db          *sql.DB
+	userService *UserService
+	ttl         time.Duration
+}
+
+// NewIdentityLinkService creates a new identity link service
+func NewIdentityLinkService(db *sql.DB, userService *UserService) *IdentityLinkService {
+	return &IdentityLinkService{
+		db:          db,
+		userService: userService,
+		ttl:         15 * time.Minute,
+	}
+}
+
+// CanConfirmLink reports whether a login with a new identity whose email already belongs to an
+// existing account may be linked to it once the account owner confirms. Only a verified email of an
+// active account qualifies, since an unverified email proves nothing about who owns the account.
+func CanConfirmLink(existing *models.User, identity *models.ExternalIdentity) bool {
+	return identity.EmailVerified && existing.IsActive
+}
+
+// Create stores a pending link of an identity to an existing user and returns its one-time token
+func (ls *IdentityLinkService) Create(userID int, identity *models.ExternalIdentity) (*PendingIdentityLink, error) {
+	token, err := generateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(ls.ttl)
+
+	query := `
+		INSERT INTO identity_links (token_hash, user_id, provider, subject, email, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	if _, err := ls.db.Exec(query, hashToken(token), userID, identity.Provider, identity.Subject, identity.Email, expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to store identity link: %w", err)
+	}
+
+	// Opportunistically drop abandoned links
+	if _, err := ls.db.Exec(`DELETE FROM identity_links WHERE expires_at < $1`, time.Now().Add(-time.Hour)); err != nil {
+		return nil, fmt.Errorf("failed to purge identity links: %w", err)
+	}
+
+	return &PendingIdentityLink{
+		Token:     token,
+		Provider:  identity.Provider,
+		Email:     identity.Email,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Confirm attaches the identity of a pending link to the user it was created for.
+// The token can only be used once and only by that user.
+func (ls *IdentityLinkService) Confirm(token string, userID int) (*models.ExternalIdentity, error) {
+	tx, err := ls.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE identity_links
+		SET used_at = $1
+		WHERE token_hash = $2 AND user_id = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING provider, subject, email
+	`
+
+	identity := &models.ExternalIdentity{EmailVerified: true}
+	err = tx.QueryRow(query, time.Now(), hashToken(token), userID).Scan(&identity.Provider, &identity.Subject, &identity.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidIdentityLink
+		}
+		return nil, fmt.Errorf("failed to consume identity link: %w", err)
+	}
+
+	if err := ls.userService.linkIdentity(tx, userID, identity); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit identity link: %w", err)
+	}
+
+	return identity, nil
+}
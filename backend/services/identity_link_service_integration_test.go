@@ -0,0 +1,56 @@
+//go:build integration
+
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+func TestIdentityLinkConfirmation(t *testing.T) {
+	db := openTestDB(t)
+	userService := NewUserService(db)
+	ls := NewIdentityLinkService(db, userService)
+	ownerID := createTestUser(t, db)
+	otherID := createTestUser(t, db)
+
+	identity := &models.ExternalIdentity{Provider: "github", Subject: fmt.Sprintf("link-%d", time.Now().UnixNano()), Email: "owner@example.com", EmailVerified: true}
+	link, err := ls.Create(ownerID, identity)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if _, err := ls.Confirm(link.Token, otherID); err != ErrInvalidIdentityLink {
+		t.Fatalf("Expected another user not to confirm the link, got %v", err)
+	}
+	if _, err := ls.Confirm("not-a-token", ownerID); err != ErrInvalidIdentityLink {
+		t.Errorf("Expected an unknown token to be refused, got %v", err)
+	}
+
+	linked, err := ls.Confirm(link.Token, ownerID)
+	if err != nil {
+		t.Fatalf("Confirm failed: %v", err)
+	}
+	if linked.Subject != identity.Subject {
+		t.Errorf("Expected the pending identity to be linked, got %+v", linked)
+	}
+	if user, err := userService.GetUserByIdentity(identity.Provider, identity.Subject); err != nil || user == nil || user.ID != ownerID {
+		t.Errorf("Expected the identity to log in to the owner, got %v, %v", user, err)
+	}
+
+	if _, err := ls.Confirm(link.Token, ownerID); err != ErrInvalidIdentityLink {
+		t.Errorf("Expected a used token to be refused, got %v", err)
+	}
+
+	// An identity can only belong to one account
+	other, err := ls.Create(otherID, identity)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := ls.Confirm(other.Token, otherID); err != ErrIdentityInUse {
+		t.Errorf("Expected an identity of another account to be refused, got %v", err)
+	}
+}
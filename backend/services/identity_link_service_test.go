@@ -0,0 +1,29 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+func TestCanConfirmLink(t *testing.T) {
+	cases := []struct {
+		name          string
+		active        bool
+		emailVerified bool
+		want          bool
+	}{
+		{"verified email of active account", true, true, true},
+		{"unverified email", true, false, false},
+		{"inactive account", false, true, false},
+		{"unverified email of inactive account", false, false, false},
+	}
+
+	for _, c := range cases {
+		existing := &models.User{ID: 1, Email: "user@example.com", IsActive: c.active}
+		identity := &models.ExternalIdentity{Provider: "github", Subject: "42", Email: "user@example.com", EmailVerified: c.emailVerified}
+		if got := CanConfirmLink(existing, identity); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"sort"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+// IdentityProvider authenticates users against an external login provider
+type IdentityProvider interface {
+	// Name is the provider key used in routes and stored in user_identities
+	Name() string
+	// AuthURL returns the provider's authorization URL for a login with the given state and PKCE code verifier
+	AuthURL(ctx context.Context, state, codeVerifier string) (string, error)
+	// Exchange redeems an authorization code and returns the verified identity of the user
+	Exchange(ctx context.Context, code, codeVerifier string) (*models.ExternalIdentity, error)
+}
+
+// IdentityProviderRegistry holds the configured login providers by name
+type IdentityProviderRegistry struct {
+	providers map[string]IdentityProvider
+}
+
+// NewIdentityProviderRegistry creates a new registry of login providers
+func NewIdentityProviderRegistry(providers ...IdentityProvider) *IdentityProviderRegistry {
+	registry := &IdentityProviderRegistry{providers: make(map[string]IdentityProvider)}
+	for _, provider := range providers {
+		registry.providers[provider.Name()] = provider
+	}
+	return registry
+}
+
+// Get returns the provider with the given name
+func (ipr *IdentityProviderRegistry) Get(name string) (IdentityProvider, bool) {
+	provider, ok := ipr.providers[name]
+	return provider, ok
+}
+
+// Names returns the names of all configured providers in alphabetical order
+func (ipr *IdentityProviderRegistry) Names() []string {
+	names := make([]string, 0, len(ipr.providers))
+	for name := range ipr.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
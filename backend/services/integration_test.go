@@ -0,0 +1,62 @@
+//go:build integration
+
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/lib/pq"
+)
+
+// testUserSeq keeps the emails of test users unique within a run
+var testUserSeq atomic.Int64
+
+// openTestDB connects to the database in TEST_DATABASE_URL and migrates it, skipping the test
+// when the variable is not set
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	driver, err := postgres.WithInstance(db, &postgres.Config{MigrationsTable: "schema_migrations"})
+	if err != nil {
+		t.Fatalf("Failed to create postgres driver: %v", err)
+	}
+	m, err := migrate.NewWithDatabaseInstance("file://../migrations", "postgres", driver)
+	if err != nil {
+		t.Fatalf("Failed to create migration instance: %v", err)
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	return db
+}
+
+// createTestUser inserts a user with a unique email and returns its ID
+func createTestUser(t *testing.T, db *sql.DB) int {
+	t.Helper()
+
+	email := fmt.Sprintf("test-%d-%d@example.com", time.Now().UnixNano(), testUserSeq.Add(1))
+	var id int
+	if err := db.QueryRow(`INSERT INTO users (email, name) VALUES ($1, $2) RETURNING id`, email, "Test User").Scan(&id); err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	return id
+}
@@ -2,6 +2,10 @@ package services
 
 import (
 	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/frallan97/hackaton-demo-backend/models"
@@ -10,63 +14,101 @@ import (
 
 // JWTService handles JWT token operations
 type JWTService struct {
-	secretKey     []byte
+	signingKeys   *SigningKeyService
 	accessExpiry  time.Duration
-	refreshExpiry time.Duration
+	refreshTokens *RefreshTokenService
+
+	// Tokens signed with the legacy shared HMAC secret are accepted until legacyUntil
+	legacySecret []byte
+	legacyUntil  time.Time
 }
 
 // Claims represents the JWT claims
 type Claims struct {
-	UserID int    `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    int    `json:"user_id"`
+	Email     string `json:"email"`
+	SessionID string `json:"sid,omitempty"`
+	// MFA is set when the session was started with a second factor
+	MFA bool `json:"mfa,omitempty"`
+	// Scope limits what the credential may do (space separated, see AccessTokenScopes). Login sessions have none and are not limited.
+	Scope string `json:"scope,omitempty"`
+	// ClientID is the OAuth client a delegated token was issued to; its audience is the same client
+	ClientID string `json:"client_id,omitempty"`
+	// Actor is the admin acting as the user, set on impersonation tokens only (RFC 8693 act claim)
+	Actor *ActorClaims `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// NewJWTService creates a new JWT service
-func NewJWTService(secretKey string) *JWTService {
-	return &JWTService{
-		secretKey:     []byte(secretKey),
-		accessExpiry:  15 * time.Minute,   // 15 minutes
-		refreshExpiry: 7 * 24 * time.Hour, // 7 days
+// ActorClaims identifies the admin behind an impersonation token
+type ActorClaims struct {
+	Subject string `json:"sub"`
+	UserID  int    `json:"user_id"`
+}
+
+// ImpersonationScope is the scope of impersonation tokens. It leaves out admin,
+// so an impersonated admin account can not use the admin role.
+const ImpersonationScope = ScopeRead + " " + ScopeWrite
+
+// IDTokenClaims represents the claims of an OpenID Connect ID token
+type IDTokenClaims struct {
+	Nonce    string           `json:"nonce,omitempty"`
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	Email    string           `json:"email,omitempty"`
+	Name     string           `json:"name,omitempty"`
+	Picture  string           `json:"picture,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// accessTokenIssuer is the iss claim of access tokens. ID tokens carry the OAuth issuer
+// URL instead, so they can not be passed off as access tokens.
+const accessTokenIssuer = "hackaton-demo"
+
+// HasScope reports whether the claims grant a scope. Unscoped claims grant everything.
+func (c *Claims) HasScope(scope string) bool {
+	if c.Scope == "" {
+		return true
 	}
+	return slices.Contains(strings.Fields(c.Scope), scope)
 }
 
-// GenerateTokens generates access and refresh tokens for a user
-func (j *JWTService) GenerateTokens(user *models.User) (string, string, error) {
-	// Generate access token
-	accessClaims := Claims{
-		UserID: user.ID,
-		Email:  user.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.accessExpiry)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "hackaton-demo",
-			Subject:   user.Email,
-		},
+// AllowsMethod reports whether the scope of the claims covers an HTTP method:
+// reading needs the read or write scope, anything else the write scope
+func (c *Claims) AllowsMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return c.HasScope(ScopeRead) || c.HasScope(ScopeWrite)
+	default:
+		return c.HasScope(ScopeWrite)
 	}
+}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessTokenString, err := accessToken.SignedString(j.secretKey)
-	if err != nil {
-		return "", "", err
+// IsImpersonation reports whether the claims belong to an admin acting as the user
+func (c *Claims) IsImpersonation() bool {
+	return c.Actor != nil && c.Actor.UserID != 0
+}
+
+// NewJWTService creates a new JWT service.
+// HS256 tokens signed with legacySecret keep validating until legacyUntil,
+// so sessions survive the switch to asymmetric keys.
+func NewJWTService(signingKeys *SigningKeyService, refreshTokens *RefreshTokenService, legacySecret string, legacyUntil time.Time) *JWTService {
+	return &JWTService{
+		signingKeys:   signingKeys,
+		accessExpiry:  15 * time.Minute, // 15 minutes
+		refreshTokens: refreshTokens,
+		legacySecret:  []byte(legacySecret),
+		legacyUntil:   legacyUntil,
 	}
+}
 
-	// Generate refresh token
-	refreshClaims := Claims{
-		UserID: user.ID,
-		Email:  user.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.refreshExpiry)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "hackaton-demo",
-			Subject:   user.Email,
-		},
+// GenerateTokens generates an access token and starts a new refresh token family for a user.
+// mfa marks the session as started with a second factor; device records where it was started.
+func (j *JWTService) GenerateTokens(user *models.User, mfa bool, device SessionDevice) (string, string, error) {
+	refreshTokenString, family, err := j.refreshTokens.Issue(user.ID, mfa, device)
+	if err != nil {
+		return "", "", err
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString(j.secretKey)
+	accessTokenString, err := j.GenerateAccessToken(user, family.FamilyID, mfa)
 	if err != nil {
 		return "", "", err
 	}
@@ -74,53 +116,157 @@ func (j *JWTService) GenerateTokens(user *models.User) (string, string, error) {
 	return accessTokenString, refreshTokenString, nil
 }
 
-// ValidateToken validates a JWT token and returns the claims
-func (j *JWTService) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return j.secretKey, nil
-	})
+// GenerateAccessToken generates a short-lived access token for a user's login session
+func (j *JWTService) GenerateAccessToken(user *models.User, sessionID string, mfa bool) (string, error) {
+	accessClaims, err := j.newAccessClaims(user, sessionID, mfa)
+	if err != nil {
+		return "", err
+	}
 
+	return j.signingKeys.Sign(accessClaims)
+}
+
+// GenerateImpersonationToken generates a short-lived access token that lets an admin act as
+// another user. The token has no session, so it can not be refreshed, and names the admin in its act claim.
+func (j *JWTService) GenerateImpersonationToken(user, admin *models.User, ttl time.Duration) (string, *Claims, error) {
+	accessClaims, err := j.newAccessClaims(user, "", false)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
+	accessClaims.Scope = ImpersonationScope
+	accessClaims.Actor = &ActorClaims{Subject: admin.Email, UserID: admin.ID}
+	accessClaims.ExpiresAt = jwt.NewNumericDate(accessClaims.IssuedAt.Add(ttl))
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	token, err := j.signingKeys.Sign(accessClaims)
+	if err != nil {
+		return "", nil, err
 	}
 
-	return nil, errors.New("invalid token")
+	return token, accessClaims, nil
 }
 
-// RefreshToken refreshes an access token using a refresh token
-func (j *JWTService) RefreshToken(refreshTokenString string) (string, error) {
-	claims, err := j.ValidateToken(refreshTokenString)
+// GenerateClientAccessToken generates a short-lived access token delegated to an OAuth client.
+// The token is limited to scope, which must not be empty, and its audience is the client.
+func (j *JWTService) GenerateClientAccessToken(user *models.User, sessionID string, mfa bool, clientID, scope string) (string, error) {
+	if clientID == "" || strings.TrimSpace(scope) == "" {
+		return "", errors.New("delegated access tokens need a client and a scope")
+	}
+
+	accessClaims, err := j.newAccessClaims(user, sessionID, mfa)
 	if err != nil {
 		return "", err
 	}
+	accessClaims.ClientID = clientID
+	accessClaims.Scope = scope
+	accessClaims.Audience = jwt.ClaimStrings{clientID}
+
+	return j.signingKeys.Sign(accessClaims)
+}
+
+// GenerateIDToken generates an OpenID Connect ID token for a client. The profile and
+// email claims are only included when scope grants them.
+func (j *JWTService) GenerateIDToken(user *models.User, issuer, clientID, nonce, scope string, authTime time.Time) (string, error) {
+	scopes := strings.Fields(scope)
+	now := time.Now()
+
+	idClaims := IDTokenClaims{
+		Nonce:    nonce,
+		AuthTime: jwt.NewNumericDate(authTime),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(j.accessExpiry)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    issuer,
+			Subject:   strconv.Itoa(user.ID),
+			Audience:  jwt.ClaimStrings{clientID},
+		},
+	}
+	if slices.Contains(scopes, OAuthScopeEmail) {
+		idClaims.Email = user.Email
+	}
+	if slices.Contains(scopes, OAuthScopeProfile) {
+		idClaims.Name = user.Name
+		idClaims.Picture = user.Picture
+	}
 
-	// Generate new access token
-	newAccessClaims := Claims{
-		UserID: claims.UserID,
-		Email:  claims.Email,
+	return j.signingKeys.Sign(idClaims)
+}
+
+// newAccessClaims builds the claims shared by every access token
+func (j *JWTService) newAccessClaims(user *models.User, sessionID string, mfa bool) (*Claims, error) {
+	tokenID, err := generateRandomID(16)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Claims{
+		UserID:    user.ID,
+		Email:     user.Email,
+		SessionID: sessionID,
+		MFA:       mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.accessExpiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "hackaton-demo",
-			Subject:   claims.Email,
+			Issuer:    accessTokenIssuer,
+			Subject:   user.Email,
 		},
-	}
+	}, nil
+}
+
+// ValidateToken validates a JWT token and returns the claims
+func (j *JWTService) ValidateToken(tokenString string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, j.keyFunc, jwt.WithValidMethods([]string{
+		SigningAlgorithmRS256,
+		SigningAlgorithmEdDSA,
+		jwt.SigningMethodHS256.Alg(),
+	}), jwt.WithIssuer(accessTokenIssuer))
 
-	newAccessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, newAccessClaims)
-	newAccessTokenString, err := newAccessToken.SignedString(j.secretKey)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid || claims.UserID == 0 {
+		return nil, errors.New("invalid token")
+	}
+
+	if _, legacy := token.Method.(*jwt.SigningMethodHMAC); legacy && !j.isLegacyAccessToken(claims) {
+		return nil, errors.New("legacy token is not an access token")
+	}
+
+	return claims, nil
+}
+
+// isLegacyAccessToken reports whether the claims of an HS256 token are those of an access token.
+// Legacy refresh tokens carry the same claims and issuer, and only differ in living for days.
+func (j *JWTService) isLegacyAccessToken(claims *Claims) bool {
+	if claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		return false
+	}
+	return claims.ExpiresAt.Sub(claims.IssuedAt.Time) <= j.accessExpiry
+}
+
+// keyFunc selects the verification key for a token by its kid header
+func (j *JWTService) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if len(j.legacySecret) == 0 || !time.Now().Before(j.legacyUntil) {
+			return nil, errors.New("HS256 tokens are no longer accepted")
+		}
+		return j.legacySecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
 	}
 
-	return newAccessTokenString, nil
+	return j.signingKeys.VerificationKey(kid, token.Method.Alg())
+}
+
+// JWKS returns the public keys used to verify access tokens
+func (j *JWTService) JWKS() *JWKS {
+	return j.signingKeys.JWKS()
 }
 
 // GetTokenExpiry returns the access token expiry duration
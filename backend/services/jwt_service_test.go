@@ -0,0 +1,130 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestJWTService returns a JWT service signing with a single in-memory Ed25519 key
+func newTestJWTService(t *testing.T) *JWTService {
+	t.Helper()
+
+	now := time.Now()
+	key := newTestSigningKey(t, "test", SigningAlgorithmEdDSA, now.Add(-time.Hour), now.Add(time.Hour), now.Add(2*time.Hour))
+	return NewJWTService(&SigningKeyService{keys: map[string]*signingKey{key.kid: key}}, nil, "", time.Time{})
+}
+
+func TestGenerateImpersonationToken(t *testing.T) {
+	j := newTestJWTService(t)
+	user := &models.User{ID: 7, Email: "user@example.com"}
+	admin := &models.User{ID: 1, Email: "admin@example.com"}
+
+	token, issued, err := j.GenerateImpersonationToken(user, admin, 15*time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateImpersonationToken failed: %v", err)
+	}
+
+	claims, err := j.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken failed: %v", err)
+	}
+	if claims.UserID != user.ID || claims.Email != user.Email {
+		t.Errorf("Expected the token to act as the user, got %d %s", claims.UserID, claims.Email)
+	}
+	if !claims.IsImpersonation() || claims.Actor.UserID != admin.ID || claims.Actor.Subject != admin.Email {
+		t.Errorf("Expected the admin in the act claim, got %+v", claims.Actor)
+	}
+	if claims.SessionID != "" {
+		t.Error("Expected impersonation tokens to have no session, so they can not be refreshed")
+	}
+	if got := claims.ExpiresAt.Sub(claims.IssuedAt.Time); got != 15*time.Minute {
+		t.Errorf("Expected the token to last 15 minutes, got %v", got)
+	}
+	if issued.ID != claims.ID {
+		t.Error("Expected the returned claims to be those of the token")
+	}
+
+	if claims.Scope != ImpersonationScope || claims.HasScope(ScopeAdmin) {
+		t.Errorf("Expected the impersonation scope without admin, got %q", claims.Scope)
+	}
+	if !claims.AllowsMethod(http.MethodGet) || !claims.AllowsMethod(http.MethodPost) {
+		t.Error("Expected impersonation to read and write as the user")
+	}
+
+	// The admin role and everything granted through it only counts with the admin scope
+	authz := (&Authorization{UserID: user.ID, roles: map[string]bool{"admin": false, "user": true}}).WithScope(claims.HasScope(ScopeAdmin))
+	if authz.HasRole("admin") || !authz.HasRole("user") {
+		t.Error("Expected an impersonated admin account to lose the admin role")
+	}
+}
+
+func TestIsImpersonation(t *testing.T) {
+	j := newTestJWTService(t)
+
+	token, err := j.GenerateAccessToken(&models.User{ID: 7, Email: "user@example.com"}, "session", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := j.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.IsImpersonation() || claims.Actor != nil {
+		t.Error("Expected a login token not to be an impersonation")
+	}
+
+	if (&Claims{Actor: &ActorClaims{Subject: "admin@example.com"}}).IsImpersonation() {
+		t.Error("Expected an act claim without an admin ID not to count as impersonation")
+	}
+}
+
+func TestValidateLegacyTokens(t *testing.T) {
+	const secret = "legacy-secret"
+	j := NewJWTService(nil, nil, secret, time.Now().Add(time.Hour))
+
+	// sign builds a token shaped like those issued before asymmetric keys: no jti, no sid
+	sign := func(issuedAt time.Time, ttl time.Duration) string {
+		claims := Claims{
+			UserID: 7,
+			Email:  "user@example.com",
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(issuedAt.Add(ttl)),
+				IssuedAt:  jwt.NewNumericDate(issuedAt),
+				NotBefore: jwt.NewNumericDate(issuedAt),
+				Issuer:    accessTokenIssuer,
+				Subject:   "user@example.com",
+			},
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	now := time.Now()
+	if _, err := j.ValidateToken(sign(now, 15*time.Minute)); err != nil {
+		t.Errorf("Expected a legacy access token to validate, got %v", err)
+	}
+	if _, err := j.ValidateToken(sign(now.Add(-time.Hour), 7*24*time.Hour)); err == nil {
+		t.Error("Expected a legacy refresh token to be refused as an access token")
+	}
+
+	noIssuedAt := Claims{UserID: 7, RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)), Issuer: accessTokenIssuer}}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, noIssuedAt).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.ValidateToken(token); err == nil {
+		t.Error("Expected a legacy token without iat to be refused")
+	}
+
+	expired := NewJWTService(nil, nil, secret, now.Add(-time.Minute))
+	if _, err := expired.ValidateToken(sign(now, 15*time.Minute)); err == nil {
+		t.Error("Expected legacy tokens to be refused after the migration window")
+	}
+}
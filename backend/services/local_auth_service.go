@@ -0,0 +1,350 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+// LocalProvider is the identity provider name of email/password logins
+const LocalProvider = "local"
+
+// Purposes of tokens sent by email
+const (
+	emailTokenVerify = "verify_email"
+	emailTokenReset  = "reset_password"
+)
+
+var (
+	// ErrInvalidCredentials is returned for any failed password login, without saying which part was wrong
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrInvalidEmailToken is returned for unknown, expired or used verification and reset tokens
+	ErrInvalidEmailToken = errors.New("invalid or expired token")
+	// ErrNoPassword is returned when changing the password of an account that only uses external logins
+	ErrNoPassword = errors.New("account has no password")
+)
+
+// PendingRegistration is a verified email/password sign-up that has not been turned into a user yet
+type PendingRegistration struct {
+	Identity     *models.ExternalIdentity
+	PasswordHash string
+}
+
+// LocalAuthService implements email/password login. Sign-ups are only turned
+// into users once the email address is verified, and every password is
+// hashed with argon2id.
+type LocalAuthService struct {
+	db          *sql.DB
+	userService *UserService
+	mailer      Mailer
+	appBaseURL  string
+	verifyTTL   time.Duration
+	resetTTL    time.Duration
+
+	dummyHashOnce sync.Once
+	dummyHash     string
+}
+
+// NewLocalAuthService creates a new local auth service
+func NewLocalAuthService(db *sql.DB, userService *UserService, mailer Mailer, appBaseURL string) *LocalAuthService {
+	return &LocalAuthService{
+		db:          db,
+		userService: userService,
+		mailer:      mailer,
+		appBaseURL:  strings.TrimSuffix(appBaseURL, "/"),
+		verifyTTL:   24 * time.Hour,
+		resetTTL:    time.Hour,
+	}
+}
+
+// NormalizeEmail trims and lower-cases an email address for use as the local login subject
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// LocalIdentity returns the local login identity of an email address. Local identities are only
+// created from verified addresses, so the email always counts as verified.
+func LocalIdentity(email, name string) *models.ExternalIdentity {
+	email = NormalizeEmail(email)
+	return &models.ExternalIdentity{
+		Provider:      LocalProvider,
+		Subject:       email,
+		Email:         email,
+		EmailVerified: true,
+		Name:          name,
+	}
+}
+
+// Register starts an email/password sign-up by emailing a verification link.
+// If the address already has an account, the owner is told so instead, which
+// keeps the response identical and does not reveal which addresses are registered.
+func (la *LocalAuthService) Register(email, name, password string) error {
+	email = NormalizeEmail(email)
+
+	existing, err := la.userService.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		body := "Someone tried to create an account with this email address, but you already have one.\n\n" +
+			"If this was you, log in or reset your password at " + la.appBaseURL + "/login\n\n" +
+			"If it was not you, you can ignore this email."
+		return la.mailer.Send(email, "You already have an account", body)
+	}
+
+	passwordHash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	token, err := la.createEmailToken(emailTokenVerify, email, nil, name, passwordHash, la.verifyTTL)
+	if err != nil {
+		return err
+	}
+
+	body := "Confirm your email address to finish creating your account:\n\n" +
+		la.link("verify_token", token) + "\n\n" +
+		"The link expires in 24 hours. If you did not sign up, you can ignore this email."
+	return la.mailer.Send(email, "Confirm your email address", body)
+}
+
+// VerifyRegistration consumes a verification token and returns the sign-up it belongs to
+func (la *LocalAuthService) VerifyRegistration(token string) (*PendingRegistration, error) {
+	query := `
+		UPDATE email_tokens
+		SET used_at = $1
+		WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING email, COALESCE(name, ''), COALESCE(password_hash, '')
+	`
+
+	var email, name, passwordHash string
+	err := la.db.QueryRow(query, time.Now(), hashToken(token), emailTokenVerify).Scan(&email, &name, &passwordHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidEmailToken
+		}
+		return nil, fmt.Errorf("failed to consume verification token: %w", err)
+	}
+
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+
+	return &PendingRegistration{
+		Identity:     LocalIdentity(email, name),
+		PasswordHash: passwordHash,
+	}, nil
+}
+
+// SetPassword stores a password hash for a user and makes sure they have a local login identity for email
+func (la *LocalAuthService) SetPassword(userID int, email, passwordHash string) error {
+	tx, err := la.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO user_passwords (user_id, password_hash, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET password_hash = EXCLUDED.password_hash, updated_at = EXCLUDED.updated_at
+	`
+	if _, err := tx.Exec(query, userID, passwordHash, time.Now()); err != nil {
+		return fmt.Errorf("failed to store password: %w", err)
+	}
+
+	if err := la.userService.linkIdentity(tx, userID, LocalIdentity(email, "")); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit password: %w", err)
+	}
+
+	return nil
+}
+
+// Authenticate checks an email and password and returns the user, who may still be inactive
+func (la *LocalAuthService) Authenticate(email, password string) (*models.User, error) {
+	user, err := la.userService.GetUserByIdentity(LocalProvider, NormalizeEmail(email))
+	if err != nil {
+		return nil, err
+	}
+
+	var passwordHash string
+	if user != nil {
+		passwordHash, err = la.passwordHash(user.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if passwordHash == "" {
+		// Spend the same time as a real check so response times do not reveal registered addresses
+		VerifyPassword(password, la.getDummyHash())
+		return nil, ErrInvalidCredentials
+	}
+
+	ok, err := VerifyPassword(password, passwordHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// RequestPasswordReset emails a reset link if the address belongs to an active user.
+// Unknown addresses are silently ignored.
+func (la *LocalAuthService) RequestPasswordReset(email string) error {
+	user, err := la.userService.GetUserByEmail(NormalizeEmail(email))
+	if err != nil {
+		return err
+	}
+
+	if user == nil || !user.IsActive || IsServiceAccountEmail(user.Email) {
+		return nil
+	}
+
+	token, err := la.createEmailToken(emailTokenReset, user.Email, &user.ID, "", "", la.resetTTL)
+	if err != nil {
+		return err
+	}
+
+	body := "Use this link to choose a new password:\n\n" +
+		la.link("reset_token", token) + "\n\n" +
+		"The link expires in 1 hour. If you did not ask to reset your password, you can ignore this email."
+	return la.mailer.Send(user.Email, "Reset your password", body)
+}
+
+// ResetPassword sets a new password using a reset token and returns the user it belongs to.
+// Any other outstanding reset links of the user stop working.
+func (la *LocalAuthService) ResetPassword(token, newPassword string) (int, error) {
+	query := `
+		UPDATE email_tokens
+		SET used_at = $1
+		WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING user_id, email
+	`
+
+	var userID int
+	var email string
+	err := la.db.QueryRow(query, time.Now(), hashToken(token), emailTokenReset).Scan(&userID, &email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrInvalidEmailToken
+		}
+		return 0, fmt.Errorf("failed to consume reset token: %w", err)
+	}
+
+	if _, err := la.db.Exec(`UPDATE email_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL`, time.Now(), userID, emailTokenReset); err != nil {
+		return 0, fmt.Errorf("failed to invalidate reset tokens: %w", err)
+	}
+
+	passwordHash, err := HashPassword(newPassword)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := la.SetPassword(userID, email, passwordHash); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// ChangePassword replaces a user's password after checking the current one
+func (la *LocalAuthService) ChangePassword(userID int, currentPassword, newPassword string) error {
+	passwordHash, err := la.passwordHash(userID)
+	if err != nil {
+		return err
+	}
+
+	if passwordHash == "" {
+		return ErrNoPassword
+	}
+
+	ok, err := VerifyPassword(currentPassword, passwordHash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	newHash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = la.db.Exec(`UPDATE user_passwords SET password_hash = $1, updated_at = $2 WHERE user_id = $3`, newHash, time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	return nil
+}
+
+// passwordHash returns the stored password hash of a user, or an empty string if they have none
+func (la *LocalAuthService) passwordHash(userID int) (string, error) {
+	var passwordHash string
+	err := la.db.QueryRow(`SELECT password_hash FROM user_passwords WHERE user_id = $1`, userID).Scan(&passwordHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get password: %w", err)
+	}
+
+	return passwordHash, nil
+}
+
+// createEmailToken stores a single-use email token and returns it
+func (la *LocalAuthService) createEmailToken(purpose, email string, userID *int, name, passwordHash string, ttl time.Duration) (string, error) {
+	token, err := generateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+		INSERT INTO email_tokens (token_hash, purpose, email, user_id, name, password_hash, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7)
+	`
+	if _, err := la.db.Exec(query, hashToken(token), purpose, email, userID, name, passwordHash, time.Now().Add(ttl)); err != nil {
+		return "", fmt.Errorf("failed to store email token: %w", err)
+	}
+
+	// Opportunistically drop expired tokens
+	if _, err := la.db.Exec(`DELETE FROM email_tokens WHERE expires_at < $1`, time.Now().Add(-24*time.Hour)); err != nil {
+		log.Printf("Warning: Failed to purge email tokens: %v", err)
+	}
+
+	return token, nil
+}
+
+// link builds a frontend URL carrying a token
+func (la *LocalAuthService) link(param, token string) string {
+	return la.appBaseURL + "/login?" + url.Values{param: {token}}.Encode()
+}
+
+// getDummyHash returns a hash to verify against when there is no real one
+func (la *LocalAuthService) getDummyHash() string {
+	la.dummyHashOnce.Do(func() {
+		hash, err := HashPassword("dummy password for timing")
+		if err != nil {
+			log.Printf("Warning: Failed to create dummy password hash: %v", err)
+		}
+		la.dummyHash = hash
+	})
+	return la.dummyHash
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+// Types of login history entries
+const (
+	LoginEventLogin   = "login"
+	LoginEventRefresh = "refresh"
+	LoginEventLogout  = "logout"
+)
+
+const (
+	defaultLoginHistoryLimit = 50
+	maxLoginHistoryLimit     = 500
+)
+
+// LoginHistoryFilter selects entries of the login history. Zero values match everything.
+type LoginHistoryFilter struct {
+	UserID    int
+	IPAddress string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
+
+// LoginHistoryService keeps the history of logins, token refreshes and logouts
+type LoginHistoryService struct {
+	db        *sql.DB
+	retention time.Duration
+}
+
+// NewLoginHistoryService creates a new login history service. Entries older than retention
+// are deleted periodically; a retention of 0 keeps them forever.
+func NewLoginHistoryService(db *sql.DB, retention time.Duration) *LoginHistoryService {
+	ls := &LoginHistoryService{
+		db:        db,
+		retention: retention,
+	}
+
+	if retention > 0 {
+		go ls.purgePeriodically(time.Hour)
+	}
+
+	return ls
+}
+
+// Record adds an entry to the login history. Failed logins that only name an email
+// are attached to the account with that email, so its owner sees them too.
+func (ls *LoginHistoryService) Record(event *models.LoginEvent) error {
+	query := `
+		INSERT INTO login_events (user_id, email, event_type, success, provider, ip_address, user_agent, failure_reason)
+		VALUES (COALESCE($1, (SELECT id FROM users WHERE LOWER(email) = $2 AND $2 <> '' LIMIT 1)), $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+
+	err := ls.db.QueryRow(query,
+		event.UserID,
+		NormalizeEmail(event.Email),
+		event.EventType,
+		event.Success,
+		event.Provider,
+		event.IPAddress,
+		event.UserAgent,
+		event.FailureReason,
+	).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record login event: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the entries of the login history matching the filter, newest first
+func (ls *LoginHistoryService) List(filter LoginHistoryFilter) ([]*models.LoginEvent, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.UserID != 0 {
+		addCondition("user_id = $%d", filter.UserID)
+	}
+	if filter.IPAddress != "" {
+		addCondition("ip_address = $%d", strings.TrimSpace(filter.IPAddress))
+	}
+	if !filter.From.IsZero() {
+		addCondition("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("created_at < $%d", filter.To)
+	}
+
+	query := `
+		SELECT id, user_id, email, event_type, success, provider, ip_address, user_agent, failure_reason, created_at
+		FROM login_events
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultLoginHistoryLimit
+	}
+	args = append(args, min(limit, maxLoginHistoryLimit), max(filter.Offset, 0))
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := ls.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list login history: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*models.LoginEvent{}
+	for rows.Next() {
+		event := &models.LoginEvent{}
+		var userID sql.NullInt64
+		if err := rows.Scan(&event.ID, &userID, &event.Email, &event.EventType, &event.Success, &event.Provider, &event.IPAddress, &event.UserAgent, &event.FailureReason, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan login event: %w", err)
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			event.UserID = &id
+		}
+		event.DeviceName = DeviceName(event.UserAgent)
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// purgePeriodically deletes the entries older than the retention on an interval
+func (ls *LoginHistoryService) purgePeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := ls.purge(time.Now())
+		if err != nil {
+			log.Printf("Warning: Failed to purge login history: %v", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("🧹 Purged %d login history entries older than %s", purged, ls.retention)
+		}
+	}
+}
+
+// purge deletes the entries that are older than the retention at now and returns how many it deleted
+func (ls *LoginHistoryService) purge(now time.Time) (int64, error) {
+	result, err := ls.db.Exec(`DELETE FROM login_events WHERE created_at < $1`, now.Add(-ls.retention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge login history: %w", err)
+	}
+	return result.RowsAffected()
+}
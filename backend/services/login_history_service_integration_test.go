@@ -0,0 +1,44 @@
+//go:build integration
+
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+func TestLoginHistoryPurge(t *testing.T) {
+	db := openTestDB(t)
+	// Built directly so that no purge runs in the background
+	ls := &LoginHistoryService{db: db, retention: 90 * 24 * time.Hour}
+
+	userID := createTestUser(t, db)
+	old := &models.LoginEvent{UserID: &userID, EventType: LoginEventLogin, Success: true, Provider: "local"}
+	recent := &models.LoginEvent{UserID: &userID, EventType: LoginEventLogin, Success: true, Provider: "local"}
+	for _, event := range []*models.LoginEvent{old, recent} {
+		if err := ls.Record(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`UPDATE login_events SET created_at = $1 WHERE id = $2`, time.Now().Add(-91*24*time.Hour), old.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := ls.purge(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged < 1 {
+		t.Errorf("Expected the old entry to be purged, purged %d", purged)
+	}
+
+	events, err := ls.List(LoginHistoryFilter{UserID: userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].ID != recent.ID {
+		t.Errorf("Expected only the recent entry to be kept, got %d entries", len(events))
+	}
+}
@@ -0,0 +1,431 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/lib/pq"
+)
+
+const (
+	recoveryCodeCount    = 10
+	recoveryCodeAlphabet = "abcdefghijklmnopqrstuvwxyz234567" // 32 symbols, so a random byte maps onto it without bias
+	mfaChallengeAttempts = 5
+)
+
+var (
+	// ErrMFAAlreadyEnabled is returned when enrolling a user who already uses MFA
+	ErrMFAAlreadyEnabled = errors.New("multi-factor authentication is already enabled")
+	// ErrMFANotEnabled is returned for MFA operations on a user without (a pending enrollment for) MFA
+	ErrMFANotEnabled = errors.New("multi-factor authentication is not enabled")
+	// ErrMFARequired is returned when a user whose roles require MFA tries to turn it off
+	ErrMFARequired = errors.New("multi-factor authentication is required for your roles")
+	// ErrInvalidMFACode is returned for a wrong, reused or malformed TOTP or recovery code
+	ErrInvalidMFACode = errors.New("invalid authentication code")
+	// ErrInvalidMFAChallenge is returned for unknown, expired, used or exhausted login challenges
+	ErrInvalidMFAChallenge = errors.New("invalid or expired MFA challenge")
+)
+
+// MFAService handles TOTP multi-factor authentication: enrollment, recovery codes,
+// login challenges and the policy of which roles must use it
+type MFAService struct {
+	db            *sql.DB
+	requiredRoles []string
+	issuer        string
+	challengeTTL  time.Duration
+}
+
+// NewMFAService creates a new MFA service
+func NewMFAService(db *sql.DB, requiredRoles []string, issuer string) *MFAService {
+	return &MFAService{
+		db:            db,
+		requiredRoles: requiredRoles,
+		issuer:        issuer,
+		challengeTTL:  5 * time.Minute,
+	}
+}
+
+// GetStatus returns the MFA state of a user
+func (ms *MFAService) GetStatus(userID int) (*models.MFAStatus, error) {
+	status := &models.MFAStatus{}
+
+	enabled, err := ms.IsEnabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	status.Enabled = enabled
+
+	status.Required, err = ms.IsRequired(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	if err := ms.db.QueryRow(query, userID).Scan(&status.RecoveryCodesRemaining); err != nil {
+		return nil, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	return status, nil
+}
+
+// IsEnabled reports whether a user has confirmed an MFA enrollment
+func (ms *MFAService) IsEnabled(userID int) (bool, error) {
+	var enabled bool
+	err := ms.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM user_mfa WHERE user_id = $1 AND enabled_at IS NOT NULL)`, userID).Scan(&enabled)
+	if err != nil {
+		return false, fmt.Errorf("failed to check MFA: %w", err)
+	}
+
+	return enabled, nil
+}
+
+// IsRequired reports whether a user holds, directly or by inheritance, one of the roles that must use MFA
+func (ms *MFAService) IsRequired(userID int) (bool, error) {
+	if len(ms.requiredRoles) == 0 {
+		return false, nil
+	}
+
+	query := effectiveRolesCTE + `
+		SELECT EXISTS (
+			SELECT 1 FROM effective_roles er
+			JOIN roles r ON r.id = er.role_id
+			WHERE r.name = ANY($3)
+		)
+	`
+
+	var required bool
+	if err := ms.db.QueryRow(query, userID, true, pq.Array(ms.requiredRoles)).Scan(&required); err != nil {
+		return false, fmt.Errorf("failed to check MFA policy: %w", err)
+	}
+
+	return required, nil
+}
+
+// BeginEnrollment creates a new TOTP secret for a user. MFA is only turned on once
+// ConfirmEnrollment sees a valid code, so an abandoned enrollment changes nothing.
+func (ms *MFAService) BeginEnrollment(userID int, email string) (*models.MFAEnrollment, error) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO user_mfa (user_id, totp_secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET totp_secret = EXCLUDED.totp_secret, last_used_step = 0, created_at = CURRENT_TIMESTAMP
+		WHERE user_mfa.enabled_at IS NULL
+	`
+
+	result, err := ms.db.Exec(query, userID, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store MFA enrollment: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	return &models.MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: TOTPProvisioningURI(secret, ms.issuer, email),
+	}, nil
+}
+
+// ConfirmEnrollment turns MFA on with a code from the new authenticator and returns fresh recovery codes
+func (ms *MFAService) ConfirmEnrollment(userID int, code string) ([]string, error) {
+	tx, err := ms.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var secret string
+	var enabledAt *time.Time
+	err = tx.QueryRow(`SELECT totp_secret, enabled_at FROM user_mfa WHERE user_id = $1 FOR UPDATE`, userID).Scan(&secret, &enabledAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrMFANotEnabled
+		}
+		return nil, fmt.Errorf("failed to get MFA enrollment: %w", err)
+	}
+
+	if enabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	if _, err := tx.Exec(`UPDATE user_mfa SET enabled_at = $1, last_used_step = $2 WHERE user_id = $3`, time.Now(), step, userID); err != nil {
+		return nil, fmt.Errorf("failed to enable MFA: %w", err)
+	}
+
+	codes, err := ms.replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit MFA enrollment: %w", err)
+	}
+
+	return codes, nil
+}
+
+// Disable turns MFA off after checking a code. Users whose roles require MFA cannot turn it off.
+func (ms *MFAService) Disable(userID int, code string) error {
+	required, err := ms.IsRequired(userID)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFARequired
+	}
+
+	tx, err := ms.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := ms.verifyCode(tx, userID, code); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to disable MFA: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit MFA removal: %w", err)
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of a user after checking a code
+func (ms *MFAService) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	tx, err := ms.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := ms.verifyCode(tx, userID, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := ms.replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit recovery codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+// CreateChallenge starts the second step of a login for a user with MFA enabled
+func (ms *MFAService) CreateChallenge(userID int) (*models.MFAChallenge, error) {
+	token, err := generateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(ms.challengeTTL)
+	query := `INSERT INTO mfa_challenges (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`
+	if _, err := ms.db.Exec(query, hashToken(token), userID, expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to store MFA challenge: %w", err)
+	}
+
+	// Opportunistically drop expired challenges
+	if _, err := ms.db.Exec(`DELETE FROM mfa_challenges WHERE expires_at < $1`, time.Now().Add(-time.Hour)); err != nil {
+		log.Printf("Warning: Failed to purge MFA challenges: %v", err)
+	}
+
+	return &models.MFAChallenge{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// ChallengeEmail returns the email of the user an open login challenge belongs to, so that wrong
+// codes count against the account and a locked out account is refused before the code is checked
+func (ms *MFAService) ChallengeEmail(token string) (string, error) {
+	query := `
+		SELECT u.email
+		FROM mfa_challenges c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.token_hash = $1 AND c.used_at IS NULL AND c.expires_at > $2 AND c.attempts < $3
+	`
+
+	var email string
+	if err := ms.db.QueryRow(query, hashToken(token), time.Now(), mfaChallengeAttempts).Scan(&email); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrInvalidMFAChallenge
+		}
+		return "", fmt.Errorf("failed to get MFA challenge: %w", err)
+	}
+
+	return email, nil
+}
+
+// CompleteChallenge checks a code for a login challenge and returns the user it belongs to.
+// A challenge can only be completed once and is burnt after too many wrong codes.
+func (ms *MFAService) CompleteChallenge(token, code string) (int, error) {
+	tx, err := ms.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, user_id, attempts
+		FROM mfa_challenges
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+		FOR UPDATE
+	`
+
+	var challengeID, userID, attempts int
+	err = tx.QueryRow(query, hashToken(token), time.Now()).Scan(&challengeID, &userID, &attempts)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrInvalidMFAChallenge
+		}
+		return 0, fmt.Errorf("failed to get MFA challenge: %w", err)
+	}
+
+	if attempts >= mfaChallengeAttempts {
+		return 0, ErrInvalidMFAChallenge
+	}
+
+	if err := ms.verifyCode(tx, userID, code); err != nil {
+		if !errors.Is(err, ErrInvalidMFACode) {
+			return 0, err
+		}
+		// Count the failure even though the code was wrong
+		if _, err := tx.Exec(`UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = $1`, challengeID); err != nil {
+			return 0, fmt.Errorf("failed to record MFA attempt: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("failed to commit MFA attempt: %w", err)
+		}
+		return 0, ErrInvalidMFACode
+	}
+
+	if _, err := tx.Exec(`UPDATE mfa_challenges SET used_at = $1 WHERE id = $2`, time.Now(), challengeID); err != nil {
+		return 0, fmt.Errorf("failed to complete MFA challenge: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit MFA challenge: %w", err)
+	}
+
+	return userID, nil
+}
+
+// verifyCode checks a TOTP code, or else a recovery code, for a user with MFA enabled.
+// Accepted TOTP codes cannot be used again and recovery codes are used up.
+func (ms *MFAService) verifyCode(tx *sql.Tx, userID int, code string) error {
+	var secret string
+	var lastUsedStep int64
+	query := `SELECT totp_secret, last_used_step FROM user_mfa WHERE user_id = $1 AND enabled_at IS NOT NULL FOR UPDATE`
+	if err := tx.QueryRow(query, userID).Scan(&secret, &lastUsedStep); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrMFANotEnabled
+		}
+		return fmt.Errorf("failed to get MFA: %w", err)
+	}
+
+	if step, ok := ValidateTOTP(secret, code, time.Now()); ok {
+		if step <= lastUsedStep {
+			return ErrInvalidMFACode
+		}
+		if _, err := tx.Exec(`UPDATE user_mfa SET last_used_step = $1 WHERE user_id = $2`, step, userID); err != nil {
+			return fmt.Errorf("failed to record MFA code use: %w", err)
+		}
+		return nil
+	}
+
+	result, err := tx.Exec(
+		`UPDATE mfa_recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`,
+		time.Now(), userID, hashToken(normalizeRecoveryCode(code)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// replaceRecoveryCodes deletes a user's recovery codes and stores new ones, returning them in plain text
+func (ms *MFAService) replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.Exec(`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hashToken(normalizeRecoveryCode(code))); err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// generateRecoveryCode returns a random code like "k7m2p-x9qra"
+func generateRecoveryCode() (string, error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+
+	code := make([]byte, len(raw))
+	for i, b := range raw {
+		code[i] = recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)]
+	}
+
+	return string(code[:5]) + "-" + string(code[5:]), nil
+}
+
+// normalizeRecoveryCode makes recovery codes match regardless of case, spaces and dashes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
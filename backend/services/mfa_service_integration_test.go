@@ -0,0 +1,39 @@
+//go:build integration
+
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMFAChallengeEmail(t *testing.T) {
+	db := openTestDB(t)
+	ms := NewMFAService(db, nil, "test")
+
+	userID := createTestUser(t, db)
+	var email string
+	if err := db.QueryRow(`SELECT email FROM users WHERE id = $1`, userID).Scan(&email); err != nil {
+		t.Fatal(err)
+	}
+
+	challenge, err := ms.CreateChallenge(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := ms.ChallengeEmail(challenge.MFAToken); err != nil || got != email {
+		t.Errorf("Expected %q, got %q, %v", email, got, err)
+	}
+	if _, err := ms.ChallengeEmail("unknown"); !errors.Is(err, ErrInvalidMFAChallenge) {
+		t.Errorf("Expected ErrInvalidMFAChallenge for an unknown token, got %v", err)
+	}
+
+	// An exhausted challenge names no account, like CompleteChallenge refuses it
+	if _, err := db.Exec(`UPDATE mfa_challenges SET attempts = $1 WHERE token_hash = $2`, mfaChallengeAttempts, hashToken(challenge.MFAToken)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.ChallengeEmail(challenge.MFAToken); !errors.Is(err, ErrInvalidMFAChallenge) {
+		t.Errorf("Expected ErrInvalidMFAChallenge for an exhausted challenge, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// Example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if !VerifyCodeChallenge(verifier, challenge) {
+		t.Error("Expected the RFC 7636 verifier to match its challenge")
+	}
+	if VerifyCodeChallenge(verifier+"x", challenge) {
+		t.Error("Expected a different verifier not to match")
+	}
+	if VerifyCodeChallenge("short", challenge) {
+		t.Error("Expected a verifier shorter than 43 characters to be rejected")
+	}
+}
+
+func TestNarrowScope(t *testing.T) {
+	cases := []struct {
+		granted   string
+		requested string
+		want      string
+		ok        bool
+	}{
+		{"openid read offline_access", "", "openid read offline_access", true},
+		{"openid read offline_access", "read", "read", true},
+		{"openid read offline_access", "read read openid", "read openid", true},
+		{"openid read", "write", "", false},
+		{"openid read", "read admin", "", false},
+	}
+
+	for _, c := range cases {
+		got, ok := NarrowScope(c.granted, c.requested)
+		if got != c.want || ok != c.ok {
+			t.Errorf("NarrowScope(%q, %q): expected %q %v, got %q %v", c.granted, c.requested, c.want, c.ok, got, ok)
+		}
+	}
+}
+
+func TestValidateOAuthClientInput(t *testing.T) {
+	valid := &models.OAuthClientCreateInput{
+		Name:          "Partner",
+		RedirectURIs:  []string{"https://partner.example.com/callback", "http://localhost:5173/callback"},
+		AllowedScopes: []string{OAuthScopeOpenID, ScopeRead},
+	}
+	if errs := ValidateOAuthClientInput(valid); len(errs) != 0 {
+		t.Errorf("Expected valid input, got %v", errs)
+	}
+
+	invalid := map[string]*models.OAuthClientCreateInput{
+		"name":           {Name: " ", RedirectURIs: []string{"https://partner.example.com/cb"}, AllowedScopes: []string{ScopeRead}},
+		"redirect_uris":  {Name: "Partner", RedirectURIs: []string{"http://partner.example.com/cb"}, AllowedScopes: []string{ScopeRead}},
+		"allowed_scopes": {Name: "Partner", RedirectURIs: []string{"https://partner.example.com/cb"}, AllowedScopes: []string{ScopeAdmin}},
+	}
+	for field, input := range invalid {
+		if _, ok := ValidateOAuthClientInput(input)[field]; !ok {
+			t.Errorf("Expected an error for %s", field)
+		}
+	}
+
+	for _, redirectURI := range []string{"https://partner.example.com/cb#fragment", "/callback", "javascript:alert(1)"} {
+		if isValidRedirectURI(redirectURI) {
+			t.Errorf("Expected redirect URI %q to be rejected", redirectURI)
+		}
+	}
+}
+
+func TestClaimsDelegatedScope(t *testing.T) {
+	claims := &Claims{ClientID: "partner", Scope: "openid read"}
+	if !claims.HasScope(OAuthScopeOpenID) || !claims.AllowsMethod("GET") {
+		t.Error("Expected a delegated read token to allow reading")
+	}
+	if claims.AllowsMethod("POST") || claims.HasScope(ScopeAdmin) {
+		t.Error("Expected a delegated read token not to allow writing or admin")
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+var (
+	// ErrInvalidOAuthState is returned for missing, malformed or forged state values
+	ErrInvalidOAuthState = errors.New("invalid oauth state")
+	// ErrOAuthStateExpired is returned when the login took longer than the state lifetime
+	ErrOAuthStateExpired = errors.New("oauth state expired")
+	// ErrOAuthStateReplayed is returned when a state has already been used to log in
+	ErrOAuthStateReplayed = errors.New("oauth state already used")
+)
+
+// OAuthStart holds everything needed to send a user to an OAuth provider
+type OAuthStart struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// OAuthStateService issues and verifies the state parameter of OAuth logins.
+// A state has the form "<state_id>.<expires_unix>.<signature>", where the
+// signature covers a nonce that is handed to the browser in a cookie. This
+// binds the login to the browser that started it and prevents login CSRF.
+type OAuthStateService struct {
+	db     *sql.DB
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewOAuthStateService creates a new OAuth state service
+func NewOAuthStateService(db *sql.DB, secret string) *OAuthStateService {
+	return &OAuthStateService{
+		db:     db,
+		secret: []byte(secret),
+		ttl:    10 * time.Minute,
+	}
+}
+
+// Begin creates a new signed state for a provider together with its nonce and PKCE code verifier
+func (ss *OAuthStateService) Begin(provider string) (*OAuthStart, error) {
+	stateID, err := generateRandomID(16)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := generateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	codeVerifier := oauth2.GenerateVerifier()
+	expiresAt := time.Now().Add(ss.ttl)
+
+	query := `INSERT INTO oauth_states (state_id, provider, code_verifier, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := ss.db.Exec(query, stateID, provider, codeVerifier, expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to store oauth state: %w", err)
+	}
+
+	// Opportunistically drop abandoned logins
+	if _, err := ss.db.Exec(`DELETE FROM oauth_states WHERE expires_at < $1`, time.Now().Add(-time.Hour)); err != nil {
+		return nil, fmt.Errorf("failed to purge oauth states: %w", err)
+	}
+
+	return &OAuthStart{
+		State:        ss.issue(stateID, nonce, expiresAt),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// Consume verifies a state against the browser's nonce and the provider it was
+// issued for, marks it as used and returns the PKCE code verifier that belongs to it
+func (ss *OAuthStateService) Consume(state, nonce, provider string) (string, error) {
+	stateID, err := ss.verify(state, nonce, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+		UPDATE oauth_states SET used_at = $1
+		WHERE state_id = $2 AND provider = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING code_verifier
+	`
+
+	var codeVerifier string
+	if err := ss.db.QueryRow(query, time.Now(), stateID, provider).Scan(&codeVerifier); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrOAuthStateReplayed
+		}
+		return "", fmt.Errorf("failed to consume oauth state: %w", err)
+	}
+
+	return codeVerifier, nil
+}
+
+// GetStateExpiry returns how long a login may take before its state expires
+func (ss *OAuthStateService) GetStateExpiry() time.Duration {
+	return ss.ttl
+}
+
+// issue builds the signed state value for a state ID, bound to the browser's nonce
+func (ss *OAuthStateService) issue(stateID, nonce string, expiresAt time.Time) string {
+	payload := stateID + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return payload + "." + ss.sign(payload, nonce)
+}
+
+// verify checks the signature and expiry of a state value and returns its state ID.
+// Whether the state was already used is only known to the database.
+func (ss *OAuthStateService) verify(state, nonce string, now time.Time) (string, error) {
+	parts := strings.Split(state, ".")
+	if len(parts) != 3 || nonce == "" {
+		return "", ErrInvalidOAuthState
+	}
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(ss.sign(payload, nonce))) {
+		return "", ErrInvalidOAuthState
+	}
+
+	expiresUnix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrInvalidOAuthState
+	}
+	if now.After(time.Unix(expiresUnix, 0)) {
+		return "", ErrOAuthStateExpired
+	}
+
+	return parts[0], nil
+}
+
+// sign returns the base64url HMAC-SHA256 of a state payload bound to a nonce
+func (ss *OAuthStateService) sign(payload, nonce string) string {
+	mac := hmac.New(sha256.New, ss.secret)
+	mac.Write([]byte(payload + "." + nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
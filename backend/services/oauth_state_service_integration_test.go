@@ -0,0 +1,27 @@
+//go:build integration
+
+package services
+
+import "testing"
+
+func TestOAuthStateIsSingleUse(t *testing.T) {
+	ss := NewOAuthStateService(openTestDB(t), "secret")
+
+	start, err := ss.Begin("google")
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+
+	if _, err := ss.Consume(start.State, start.Nonce, "github"); err != ErrOAuthStateReplayed {
+		t.Errorf("Expected a state issued for another provider to be refused, got %v", err)
+	}
+
+	verifier, err := ss.Consume(start.State, start.Nonce, "google")
+	if err != nil || verifier != start.CodeVerifier {
+		t.Fatalf("Expected the state to return its code verifier, got %q, %v", verifier, err)
+	}
+
+	if _, err := ss.Consume(start.State, start.Nonce, "google"); err != ErrOAuthStateReplayed {
+		t.Errorf("Expected a replayed state to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestOAuthStateVerify(t *testing.T) {
+	ss := NewOAuthStateService(nil, "secret")
+	now := time.Now()
+	state := ss.issue("state-id", "nonce", now.Add(10*time.Minute))
+
+	if stateID, err := ss.verify(state, "nonce", now); err != nil || stateID != "state-id" {
+		t.Fatalf("Expected the state to verify, got %q, %v", stateID, err)
+	}
+
+	parts := strings.Split(state, ".")
+	cases := []struct {
+		name  string
+		state string
+		nonce string
+		now   time.Time
+		want  error
+	}{
+		{"expired", state, "nonce", now.Add(11 * time.Minute), ErrOAuthStateExpired},
+		{"wrong nonce cookie", state, "other-nonce", now, ErrInvalidOAuthState},
+		{"missing nonce cookie", state, "", now, ErrInvalidOAuthState},
+		{"tampered state ID", "other-id." + parts[1] + "." + parts[2], "nonce", now, ErrInvalidOAuthState},
+		{"extended expiry", parts[0] + "." + "9999999999" + "." + parts[2], "nonce", now, ErrInvalidOAuthState},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2])), "nonce", now, ErrInvalidOAuthState},
+		{"signed with another secret", NewOAuthStateService(nil, "other").issue("state-id", "nonce", now.Add(time.Minute)), "nonce", now, ErrInvalidOAuthState},
+		{"malformed", "state-id.123", "nonce", now, ErrInvalidOAuthState},
+		{"empty", "", "nonce", now, ErrInvalidOAuthState},
+	}
+
+	for _, c := range cases {
+		if _, err := ss.verify(c.state, c.nonce, c.now); err != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, err)
+		}
+	}
+}
+
+func TestGoogleLoginUsesPKCE(t *testing.T) {
+	verifier := oauth2.GenerateVerifier()
+	if len(verifier) < 43 || !pkceValuePattern.MatchString(verifier) {
+		t.Fatalf("Expected an RFC 7636 code verifier, got %q", verifier)
+	}
+
+	var exchanged url.Values
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		exchanged = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"token","token_type":"Bearer"}`))
+	}))
+	defer tokenServer.Close()
+
+	g := NewGoogleOAuthService("client", "secret", "http://localhost:3000/login")
+	g.config.Endpoint = oauth2.Endpoint{AuthURL: "https://accounts.example.com/auth", TokenURL: tokenServer.URL}
+
+	authURL, err := g.AuthURL(context.Background(), "state", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Errorf("Expected an S256 challenge of the verifier, got %s", parsed.RawQuery)
+	}
+	if query.Get("state") != "state" || strings.Contains(authURL, verifier) {
+		t.Errorf("Expected the state and no verifier in the authorization URL, got %s", authURL)
+	}
+
+	if _, err := g.ExchangeCodeForToken("code", verifier); err != nil {
+		t.Fatalf("ExchangeCodeForToken failed: %v", err)
+	}
+	if exchanged.Get("code_verifier") != verifier || exchanged.Get("code") != "code" {
+		t.Errorf("Expected the verifier to be sent with the code, got %v", exchanged)
+	}
+}
@@ -0,0 +1,350 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/config"
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// oidcDiscovery is the subset of the OpenID Provider Metadata we rely on
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider logs users in with any OpenID Connect issuer (Microsoft Entra,
+// Keycloak, ...). Endpoints are discovered from the issuer, ID tokens are
+// verified against the issuer's JWKS, and the profile is mapped onto a user
+// through configurable claim names. Providers that only speak OAuth2 (GitHub)
+// work too when their endpoints are configured explicitly; their profile is
+// then read from the userinfo endpoint.
+type OIDCProvider struct {
+	cfg        config.OIDCProviderConfig
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	discovered  bool
+	oauthConfig *oauth2.Config
+	userInfoURL string
+	jwksURI     string
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// NewOIDCProvider creates a new OpenID Connect login provider
+func NewOIDCProvider(cfg config.OIDCProviderConfig, httpClient *http.Client) (*OIDCProvider, error) {
+	if cfg.Name == "" || cfg.ClientID == "" {
+		return nil, errors.New("provider name and client id are required")
+	}
+	if cfg.Name == LocalProvider {
+		return nil, fmt.Errorf("provider name %s is reserved for email/password logins", LocalProvider)
+	}
+	if cfg.Issuer == "" && (cfg.AuthURL == "" || cfg.TokenURL == "" || cfg.UserInfoURL == "") {
+		return nil, fmt.Errorf("provider %s needs an issuer or explicit auth, token and userinfo URLs", cfg.Name)
+	}
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &OIDCProvider{
+		cfg:        cfg,
+		httpClient: httpClient,
+		keys:       make(map[string]crypto.PublicKey),
+	}, nil
+}
+
+// Name returns the provider key
+func (p *OIDCProvider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthURL implements IdentityProvider
+func (p *OIDCProvider) AuthURL(ctx context.Context, state, codeVerifier string) (string, error) {
+	oauthConfig, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	opts := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(codeVerifier)}
+	if p.cfg.Issuer != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", oidcNonce(codeVerifier)))
+	}
+
+	return oauthConfig.AuthCodeURL(state, opts...), nil
+}
+
+// Exchange implements IdentityProvider
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier string) (*models.ExternalIdentity, error) {
+	oauthConfig, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.httpClient)
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code for token: %w", err)
+	}
+
+	claims := map[string]interface{}{}
+
+	if p.cfg.Issuer != "" {
+		rawIDToken, _ := token.Extra("id_token").(string)
+		if rawIDToken == "" {
+			return nil, errors.New("token response has no id_token")
+		}
+
+		claims, err = p.verifyIDToken(ctx, rawIDToken, oidcNonce(codeVerifier))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Fill in anything the ID token left out (or everything, for plain OAuth2 providers)
+	if p.userInfoURL != "" && (len(claims) == 0 || claimString(claims, p.cfg.ClaimEmail) == "") {
+		userInfo, err := p.fetchUserInfo(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+
+		if sub, ok := claims["sub"]; ok && p.cfg.Issuer != "" && claimString(userInfo, "sub") != fmt.Sprint(sub) {
+			return nil, errors.New("userinfo subject does not match id token")
+		}
+
+		for key, value := range userInfo {
+			if _, exists := claims[key]; !exists {
+				claims[key] = value
+			}
+		}
+	}
+
+	identity := &models.ExternalIdentity{
+		Provider:      p.cfg.Name,
+		Subject:       claimString(claims, p.cfg.ClaimSubject),
+		Email:         claimString(claims, p.cfg.ClaimEmail),
+		EmailVerified: claimBool(claims, p.cfg.ClaimEmailVerified),
+		Name:          claimString(claims, p.cfg.ClaimName),
+		Picture:       claimString(claims, p.cfg.ClaimPicture),
+	}
+
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("provider %s returned no %q claim", p.cfg.Name, p.cfg.ClaimSubject)
+	}
+	if identity.Name == "" {
+		identity.Name = identity.Email
+	}
+
+	return identity, nil
+}
+
+// discover loads the issuer's metadata once and builds the OAuth2 configuration
+func (p *OIDCProvider) discover(ctx context.Context) (*oauth2.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovered {
+		return p.oauthConfig, nil
+	}
+
+	endpoint := oauth2.Endpoint{AuthURL: p.cfg.AuthURL, TokenURL: p.cfg.TokenURL}
+	userInfoURL := p.cfg.UserInfoURL
+
+	if p.cfg.Issuer != "" {
+		var metadata oidcDiscovery
+		discoveryURL := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := p.getJSON(ctx, discoveryURL, nil, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to discover provider %s: %w", p.cfg.Name, err)
+		}
+
+		if metadata.Issuer != p.cfg.Issuer {
+			return nil, fmt.Errorf("provider %s advertises issuer %q, expected %q", p.cfg.Name, metadata.Issuer, p.cfg.Issuer)
+		}
+		if metadata.JWKSURI == "" {
+			return nil, fmt.Errorf("provider %s has no jwks_uri", p.cfg.Name)
+		}
+
+		if endpoint.AuthURL == "" {
+			endpoint.AuthURL = metadata.AuthorizationEndpoint
+		}
+		if endpoint.TokenURL == "" {
+			endpoint.TokenURL = metadata.TokenEndpoint
+		}
+		if userInfoURL == "" {
+			userInfoURL = metadata.UserInfoEndpoint
+		}
+		p.jwksURI = metadata.JWKSURI
+	}
+
+	p.oauthConfig = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       p.cfg.Scopes,
+		Endpoint:     endpoint,
+	}
+	p.userInfoURL = userInfoURL
+	p.discovered = true
+
+	return p.oauthConfig, nil
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, rawIDToken, nonce string) (map[string]interface{}, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if claimString(claims, "nonce") != nonce {
+		return nil, errors.New("invalid id token: nonce mismatch")
+	}
+
+	return claims, nil
+}
+
+// publicKey returns the issuer key for a kid, refetching the JWKS when the kid is unknown
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	// Rate limit refetches so forged kids cannot hammer the issuer
+	if time.Since(p.keysFetched) < 30*time.Second {
+		return nil, ErrUnknownSigningKey
+	}
+	p.keysFetched = time.Now()
+
+	var jwks JWKS
+	if err := p.getJSON(ctx, p.jwksURI, nil, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(jwk)
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+// lookupKey finds a cached key; tokens without a kid are accepted only if the issuer has a single key.
+// Callers must hold the lock.
+func (p *OIDCProvider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// fetchUserInfo reads the user's profile from the provider's userinfo endpoint
+func (p *OIDCProvider) fetchUserInfo(ctx context.Context, token *oauth2.Token) (map[string]interface{}, error) {
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer "+token.AccessToken)
+
+	userInfo := map[string]interface{}{}
+	if err := p.getJSON(ctx, p.userInfoURL, headers, &userInfo); err != nil {
+		return nil, fmt.Errorf("failed to get user info: %w", err)
+	}
+	return userInfo, nil
+}
+
+// getJSON performs a GET request and decodes the JSON response
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, headers http.Header, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// oidcNonce derives the ID token nonce from the PKCE code verifier, so it never has to be stored
+func oidcNonce(codeVerifier string) string {
+	sum := sha256.Sum256([]byte("nonce:" + codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// claimString reads a claim as a string; numeric IDs (GitHub) are formatted without exponent
+func claimString(claims map[string]interface{}, name string) string {
+	switch value := claims[name].(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case json.Number:
+		return value.String()
+	default:
+		return ""
+	}
+}
+
+// claimBool reads a claim as a boolean; some providers send "true" as a string
+func claimBool(claims map[string]interface{}, name string) bool {
+	switch value := claims[name].(type) {
+	case bool:
+		return value
+	case string:
+		return strings.EqualFold(value, "true")
+	default:
+		return false
+	}
+}
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIssuer is a minimal OpenID Connect provider for tests. It serves
+// discovery, JWKS, token and userinfo endpoints and checks PKCE.
+type fakeIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	mu sync.Mutex
+	// Pending authorization codes: code -> nonce and code challenge
+	codes map[string]fakeAuthorization
+	// idTokenClaims is merged into every ID token, overriding the defaults
+	idTokenClaims jwt.MapClaims
+	userInfo      map[string]interface{}
+	noIDToken     bool
+	// forgeryKey, when set, signs ID tokens instead of the published key
+	forgeryKey *rsa.PrivateKey
+}
+
+type fakeAuthorization struct {
+	nonce         string
+	codeChallenge string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	fi := &fakeIssuer{
+		key:   key,
+		kid:   "test-key",
+		codes: make(map[string]fakeAuthorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 fi.server.URL,
+			"authorization_endpoint": fi.server.URL + "/authorize",
+			"token_endpoint":         fi.server.URL + "/token",
+			"userinfo_endpoint":      fi.server.URL + "/userinfo",
+			"jwks_uri":               fi.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(JWKS{Keys: []JWK{{
+			Kty: "RSA",
+			Kid: fi.kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(fi.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(fi.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", fi.handleToken)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer provider-access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fi.mu.Lock()
+		defer fi.mu.Unlock()
+		json.NewEncoder(w).Encode(fi.userInfo)
+	})
+
+	fi.server = httptest.NewServer(mux)
+	t.Cleanup(fi.server.Close)
+	return fi
+}
+
+// authorize simulates the user approving the login at the provider and returns the authorization code
+func (fi *fakeIssuer) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("Invalid auth URL: %v", err)
+	}
+	if u.Query().Get("code_challenge_method") != "S256" {
+		t.Fatalf("Expected S256 code challenge, got %q", u.Query().Get("code_challenge_method"))
+	}
+
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	code := "code-" + u.Query().Get("state")
+	fi.codes[code] = fakeAuthorization{
+		nonce:         u.Query().Get("nonce"),
+		codeChallenge: u.Query().Get("code_challenge"),
+	}
+	return code
+}
+
+func (fi *fakeIssuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	authorization, ok := fi.codes[r.PostForm.Get("code")]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+	delete(fi.codes, r.PostForm.Get("code"))
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != authorization.codeChallenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	response := map[string]interface{}{
+		"access_token": "provider-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	}
+
+	if !fi.noIDToken {
+		claims := jwt.MapClaims{
+			"iss":            fi.server.URL,
+			"aud":            "test-client",
+			"sub":            "user-123",
+			"email":          "jane@example.com",
+			"email_verified": true,
+			"name":           "Jane Doe",
+			"nonce":          authorization.nonce,
+			"iat":            time.Now().Unix(),
+			"exp":            time.Now().Add(time.Hour).Unix(),
+		}
+		for key, value := range fi.idTokenClaims {
+			claims[key] = value
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = fi.kid
+		signingKey := fi.key
+		if fi.forgeryKey != nil {
+			signingKey = fi.forgeryKey
+		}
+		idToken, err := token.SignedString(signingKey)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		response["id_token"] = idToken
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func newTestOIDCProvider(t *testing.T, fi *fakeIssuer, modify func(*config.OIDCProviderConfig)) *OIDCProvider {
+	t.Helper()
+
+	cfg := config.OIDCProviderConfig{
+		Name:               "keycloak",
+		Issuer:             fi.server.URL,
+		ClientID:           "test-client",
+		ClientSecret:       "test-secret",
+		RedirectURL:        "http://localhost:3000/login",
+		Scopes:             []string{"openid", "email", "profile"},
+		ClaimSubject:       "sub",
+		ClaimEmail:         "email",
+		ClaimEmailVerified: "email_verified",
+		ClaimName:          "name",
+		ClaimPicture:       "picture",
+	}
+	if modify != nil {
+		modify(&cfg)
+	}
+
+	provider, err := NewOIDCProvider(cfg, fi.server.Client())
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	return provider
+}
+
+// login runs the full authorization code flow against the fake issuer
+func login(t *testing.T, fi *fakeIssuer, provider *OIDCProvider, verifier string) (string, error) {
+	t.Helper()
+
+	authURL, err := provider.AuthURL(context.Background(), "state-1", verifier)
+	if err != nil {
+		t.Fatalf("Failed to build auth URL: %v", err)
+	}
+
+	code := fi.authorize(t, authURL)
+	identity, err := provider.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		return "", err
+	}
+	return identity.Subject, nil
+}
+
+func TestOIDCProviderLogin(t *testing.T) {
+	fi := newFakeIssuer(t)
+	provider := newTestOIDCProvider(t, fi, nil)
+
+	authURL, err := provider.AuthURL(context.Background(), "state-1", "verifier-0123456789-0123456789-0123456789")
+	if err != nil {
+		t.Fatalf("Failed to build auth URL: %v", err)
+	}
+
+	if !strings.HasPrefix(authURL, fi.server.URL+"/authorize?") {
+		t.Errorf("Expected discovered authorization endpoint, got %s", authURL)
+	}
+
+	code := fi.authorize(t, authURL)
+	identity, err := provider.Exchange(context.Background(), code, "verifier-0123456789-0123456789-0123456789")
+	if err != nil {
+		t.Fatalf("Expected login to succeed, got %v", err)
+	}
+
+	if identity.Provider != "keycloak" {
+		t.Errorf("Expected provider 'keycloak', got %s", identity.Provider)
+	}
+	if identity.Subject != "user-123" {
+		t.Errorf("Expected subject 'user-123', got %s", identity.Subject)
+	}
+	if identity.Email != "jane@example.com" || !identity.EmailVerified {
+		t.Errorf("Expected verified email 'jane@example.com', got %s (verified: %v)", identity.Email, identity.EmailVerified)
+	}
+	if identity.Name != "Jane Doe" {
+		t.Errorf("Expected name 'Jane Doe', got %s", identity.Name)
+	}
+}
+
+func TestOIDCProviderRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{name: "wrong audience", claims: jwt.MapClaims{"aud": "other-client"}},
+		{name: "wrong issuer", claims: jwt.MapClaims{"iss": "https://evil.example.com"}},
+		{name: "wrong nonce", claims: jwt.MapClaims{"nonce": "replayed-nonce"}},
+		{name: "expired", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fi := newFakeIssuer(t)
+			fi.idTokenClaims = tt.claims
+			provider := newTestOIDCProvider(t, fi, nil)
+
+			if _, err := login(t, fi, provider, "verifier-0123456789-0123456789-0123456789"); err == nil {
+				t.Error("Expected login to fail")
+			}
+		})
+	}
+}
+
+func TestOIDCProviderRejectsForeignSignature(t *testing.T) {
+	fi := newFakeIssuer(t)
+	provider := newTestOIDCProvider(t, fi, nil)
+
+	// Sign with a key the issuer does not publish
+	forgeryKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	fi.forgeryKey = forgeryKey
+
+	if _, err := login(t, fi, provider, "verifier-0123456789-0123456789-0123456789"); err == nil {
+		t.Error("Expected login with a forged signature to fail")
+	}
+}
+
+func TestOIDCProviderRejectsWrongCodeVerifier(t *testing.T) {
+	fi := newFakeIssuer(t)
+	provider := newTestOIDCProvider(t, fi, nil)
+
+	authURL, err := provider.AuthURL(context.Background(), "state-1", "verifier-0123456789-0123456789-0123456789")
+	if err != nil {
+		t.Fatalf("Failed to build auth URL: %v", err)
+	}
+
+	code := fi.authorize(t, authURL)
+	if _, err := provider.Exchange(context.Background(), code, "another-verifier-0123456789-0123456789"); err == nil {
+		t.Error("Expected exchange with the wrong code verifier to fail")
+	}
+}
+
+func TestOIDCProviderClaimMapping(t *testing.T) {
+	fi := newFakeIssuer(t)
+	// Entra style: stable object id and UPN instead of sub/email
+	fi.idTokenClaims = jwt.MapClaims{"oid": "object-42", "upn": "jane@contoso.com", "email": nil}
+	provider := newTestOIDCProvider(t, fi, func(cfg *config.OIDCProviderConfig) {
+		cfg.Name = "microsoft"
+		cfg.ClaimSubject = "oid"
+		cfg.ClaimEmail = "upn"
+	})
+
+	authURL, err := provider.AuthURL(context.Background(), "state-1", "verifier-0123456789-0123456789-0123456789")
+	if err != nil {
+		t.Fatalf("Failed to build auth URL: %v", err)
+	}
+
+	identity, err := provider.Exchange(context.Background(), fi.authorize(t, authURL), "verifier-0123456789-0123456789-0123456789")
+	if err != nil {
+		t.Fatalf("Expected login to succeed, got %v", err)
+	}
+
+	if identity.Subject != "object-42" {
+		t.Errorf("Expected subject 'object-42', got %s", identity.Subject)
+	}
+	if identity.Email != "jane@contoso.com" {
+		t.Errorf("Expected email 'jane@contoso.com', got %s", identity.Email)
+	}
+}
+
+func TestOIDCProviderUserInfoOnly(t *testing.T) {
+	fi := newFakeIssuer(t)
+	// GitHub style: plain OAuth2 with a numeric id from the userinfo endpoint
+	fi.noIDToken = true
+	fi.userInfo = map[string]interface{}{"id": 583231, "login": "octocat", "email": "octocat@github.com", "avatar_url": "https://example.com/a.png"}
+	provider := newTestOIDCProvider(t, fi, func(cfg *config.OIDCProviderConfig) {
+		cfg.Name = "github"
+		cfg.Issuer = ""
+		cfg.AuthURL = fi.server.URL + "/authorize"
+		cfg.TokenURL = fi.server.URL + "/token"
+		cfg.UserInfoURL = fi.server.URL + "/userinfo"
+		cfg.ClaimSubject = "id"
+		cfg.ClaimName = "login"
+		cfg.ClaimPicture = "avatar_url"
+	})
+
+	authURL, err := provider.AuthURL(context.Background(), "state-1", "verifier-0123456789-0123456789-0123456789")
+	if err != nil {
+		t.Fatalf("Failed to build auth URL: %v", err)
+	}
+	if strings.Contains(authURL, "nonce=") {
+		t.Error("Expected no nonce for a plain OAuth2 provider")
+	}
+
+	identity, err := provider.Exchange(context.Background(), fi.authorize(t, authURL), "verifier-0123456789-0123456789-0123456789")
+	if err != nil {
+		t.Fatalf("Expected login to succeed, got %v", err)
+	}
+
+	if identity.Subject != "583231" {
+		t.Errorf("Expected subject '583231', got %s", identity.Subject)
+	}
+	if identity.Name != "octocat" || identity.Picture != "https://example.com/a.png" {
+		t.Errorf("Unexpected profile: %+v", identity)
+	}
+	if identity.EmailVerified {
+		t.Error("Expected email to be unverified without a verification claim")
+	}
+}
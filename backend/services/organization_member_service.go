@@ -0,0 +1,71 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+// Roles a user can have in an organization, stored in user_organizations.role
+const (
+	OrgRoleViewer = "viewer"
+	OrgRoleMember = "member"
+	OrgRoleAdmin  = "admin"
+	OrgRoleOwner  = "owner"
+)
+
+// OrgRoles lists the organization roles from least to most privileged
+var OrgRoles = []string{OrgRoleViewer, OrgRoleMember, OrgRoleAdmin, OrgRoleOwner}
+
+// OrgRoleAtLeast reports whether an organization role ranks at or above the minimum role.
+// Unknown roles, including the empty role of non-members, rank below every role.
+func OrgRoleAtLeast(role, minimum string) bool {
+	rank := slices.Index(OrgRoles, role)
+	return rank >= 0 && rank >= slices.Index(OrgRoles, minimum)
+}
+
+// OrganizationMemberService looks up the memberships that scope access to organizations
+type OrganizationMemberService struct {
+	db *sql.DB
+}
+
+// NewOrganizationMemberService creates a new organization member service
+func NewOrganizationMemberService(db *sql.DB) *OrganizationMemberService {
+	return &OrganizationMemberService{db: db}
+}
+
+// GetMemberOrganizations returns the organizations a user is a member of
+func (ms *OrganizationMemberService) GetMemberOrganizations(userID int) ([]models.Organization, error) {
+	query := `
+		SELECT o.id, o.name, o.description, o.metadata, o.created_at, o.updated_at
+		FROM organizations o
+		JOIN user_organizations uo ON o.id = uo.organization_id
+		WHERE uo.user_id = $1
+		ORDER BY o.name
+	`
+
+	rows, err := ms.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query member organizations: %w", err)
+	}
+	defer rows.Close()
+
+	organizations := []models.Organization{}
+	for rows.Next() {
+		var org models.Organization
+		var metadataJSON []byte
+		if err := rows.Scan(&org.ID, &org.Name, &org.Description, &metadataJSON, &org.CreatedAt, &org.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+
+		if len(metadataJSON) == 0 || json.Unmarshal(metadataJSON, &org.Metadata) != nil {
+			org.Metadata = make(map[string]interface{})
+		}
+		organizations = append(organizations, org)
+	}
+
+	return organizations, rows.Err()
+}
@@ -0,0 +1,24 @@
+package services
+
+import "testing"
+
+func TestOrgRoleAtLeast(t *testing.T) {
+	cases := []struct {
+		role, minimum string
+		want          bool
+	}{
+		{OrgRoleOwner, OrgRoleAdmin, true},
+		{OrgRoleAdmin, OrgRoleAdmin, true},
+		{OrgRoleMember, OrgRoleAdmin, false},
+		{OrgRoleViewer, OrgRoleViewer, true},
+		{OrgRoleViewer, OrgRoleMember, false},
+		{"", OrgRoleViewer, false},
+		{"superuser", OrgRoleViewer, false},
+	}
+
+	for _, c := range cases {
+		if got := OrgRoleAtLeast(c.role, c.minimum); got != c.want {
+			t.Errorf("OrgRoleAtLeast(%q, %q) = %v, want %v", c.role, c.minimum, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashPasswordRoundTrip(t *testing.T) {
+	hash, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("HashPassword failed: %v", err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=4$") {
+		t.Errorf("Unexpected hash format: %s", hash)
+	}
+
+	ok, err := VerifyPassword("correct horse battery staple", hash)
+	if err != nil || !ok {
+		t.Errorf("Expected password to verify, got ok=%v err=%v", ok, err)
+	}
+
+	ok, err = VerifyPassword("Correct horse battery staple", hash)
+	if err != nil || ok {
+		t.Errorf("Expected wrong password to be rejected, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestHashPasswordUsesRandomSalt(t *testing.T) {
+	first, _ := HashPassword("same password")
+	second, _ := HashPassword("same password")
+
+	if first == second {
+		t.Error("Expected two hashes of the same password to differ")
+	}
+}
+
+func TestVerifyPasswordRejectsMalformedHashes(t *testing.T) {
+	hashes := []string{
+		"",
+		"plaintext",
+		"$2a$10$abcdefghijklmnopqrstuv",
+		"$argon2i$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA",
+		"$argon2id$v=18$m=65536,t=3,p=4$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=x,t=3,p=4$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=65536,t=3,p=4$!!!$aGFzaA",
+		"$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$",
+	}
+
+	for _, hash := range hashes {
+		if _, err := VerifyPassword("password", hash); err != ErrInvalidPasswordHash {
+			t.Errorf("Expected ErrInvalidPasswordHash for %q, got %v", hash, err)
+		}
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	if err := ValidatePassword("short"); err == nil {
+		t.Error("Expected short password to be rejected")
+	}
+
+	if err := ValidatePassword(strings.Repeat("a", MaxPasswordLength+1)); err == nil {
+		t.Error("Expected overly long password to be rejected")
+	}
+
+	if err := ValidatePassword("long enough password"); err != nil {
+		t.Errorf("Expected valid password to pass, got %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+// Permissions checked by the routes. The catalogue lives in the permissions table; roles are
+// granted permissions in role_permissions and can be changed at runtime.
+const (
+	PermissionRolesRead             = "roles:read"
+	PermissionRolesWrite            = "roles:write"
+	PermissionOrgRead               = "org:read"
+	PermissionOrgWrite              = "org:write"
+	PermissionOrgManage             = "org:manage"
+	PermissionBillingRead           = "billing:read"
+	PermissionBillingWrite          = "billing:write"
+	PermissionBillingMetrics        = "billing:metrics"
+	PermissionUsersRead             = "users:read"
+	PermissionUsersManage           = "users:manage"
+	PermissionUsersAssignRole       = "users:assign_role"
+	PermissionUsersImpersonate      = "users:impersonate"
+	PermissionSessionsManage        = "sessions:manage"
+	PermissionSecurityRead          = "security:read"
+	PermissionSecurityManage        = "security:manage"
+	PermissionServiceAccountsManage = "service_accounts:manage"
+	PermissionOAuthClientsManage    = "oauth_clients:manage"
+	PermissionUserAttributesManage  = "user_attributes:manage"
+	PermissionPermissionsManage     = "permissions:manage"
+	PermissionPoliciesManage        = "policies:manage"
+	PermissionEventsRead            = "events:read"
+)
+
+var (
+	// ErrPermissionNotFound is returned for a permission name that is not in the catalogue
+	ErrPermissionNotFound = errors.New("permission not found")
+	// ErrRoleNotFound is returned when no role has the given ID
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrProtectedPermission is returned when revoking permissions:manage from the admin role,
+	// which would leave nobody able to grant it back
+	ErrProtectedPermission = errors.New("the admin role can not lose the permissions:manage permission")
+)
+
+// PermissionService manages the permissions roles grant and checks them for users
+type PermissionService struct {
+	db *sql.DB
+}
+
+// NewPermissionService creates a new permission service
+func NewPermissionService(db *sql.DB) *PermissionService {
+	return &PermissionService{db: db}
+}
+
+// UserHasPermission reports whether one of the user's roles, or a role they inherit, grants a permission.
+// The admin role is left out unless withAdmin is set, for credentials without the admin scope.
+func (ps *PermissionService) UserHasPermission(userID int, permission string, withAdmin bool) (bool, error) {
+	query := effectiveRolesCTE + `
+		SELECT EXISTS (
+			SELECT 1
+			FROM effective_roles er
+			JOIN role_permissions rp ON rp.role_id = er.role_id
+			JOIN permissions p ON p.id = rp.permission_id
+			WHERE p.name = $3
+		)
+	`
+
+	var granted bool
+	if err := ps.db.QueryRow(query, userID, withAdmin, permission).Scan(&granted); err != nil {
+		return false, fmt.Errorf("failed to check user permission: %w", err)
+	}
+
+	return granted, nil
+}
+
+// ListPermissions returns the permission catalogue
+func (ps *PermissionService) ListPermissions() ([]models.Permission, error) {
+	rows, err := ps.db.Query(`SELECT id, name, description, created_at FROM permissions ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query permissions: %w", err)
+	}
+	defer rows.Close()
+
+	permissions := []models.Permission{}
+	for rows.Next() {
+		var permission models.Permission
+		if err := rows.Scan(&permission.ID, &permission.Name, &permission.Description, &permission.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan permission: %w", err)
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+// GetRolePermissions returns the permissions granted to a role
+func (ps *PermissionService) GetRolePermissions(roleID int) ([]models.RolePermission, error) {
+	query := `
+		SELECT p.id, p.name, p.description, p.created_at, rp.granted_at, rp.granted_by
+		FROM role_permissions rp
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE rp.role_id = $1
+		ORDER BY p.name
+	`
+
+	rows, err := ps.db.Query(query, roleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query role permissions: %w", err)
+	}
+	defer rows.Close()
+
+	permissions := []models.RolePermission{}
+	for rows.Next() {
+		var permission models.RolePermission
+		err := rows.Scan(&permission.ID, &permission.Name, &permission.Description, &permission.CreatedAt, &permission.GrantedAt, &permission.GrantedBy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan role permission: %w", err)
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+// GrantPermission grants a permission to a role. Granting one the role already has is a no-op.
+func (ps *PermissionService) GrantPermission(roleID int, permission string, grantedBy int) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, permissionID, err := ps.lookup(tx, roleID, permission)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO role_permissions (role_id, permission_id, granted_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (role_id, permission_id) DO NOTHING
+	`
+	if _, err := tx.Exec(query, roleID, permissionID, grantedBy); err != nil {
+		return fmt.Errorf("failed to grant permission: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit permission grant: %w", err)
+	}
+
+	return nil
+}
+
+// RevokePermission takes a permission away from a role. Revoking one the role does not have is a no-op.
+func (ps *PermissionService) RevokePermission(roleID int, permission string) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	roleName, permissionID, err := ps.lookup(tx, roleID, permission)
+	if err != nil {
+		return err
+	}
+
+	if roleName == "admin" && permission == PermissionPermissionsManage {
+		return ErrProtectedPermission
+	}
+
+	if _, err := tx.Exec(`DELETE FROM role_permissions WHERE role_id = $1 AND permission_id = $2`, roleID, permissionID); err != nil {
+		return fmt.Errorf("failed to revoke permission: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit permission revocation: %w", err)
+	}
+
+	return nil
+}
+
+// lookup locks a role against concurrent grant changes and returns its name with the ID of a permission
+func (ps *PermissionService) lookup(tx *sql.Tx, roleID int, permission string) (string, int, error) {
+	var roleName string
+	if err := tx.QueryRow(`SELECT name FROM roles WHERE id = $1 FOR UPDATE`, roleID).Scan(&roleName); err != nil {
+		if err == sql.ErrNoRows {
+			return "", 0, ErrRoleNotFound
+		}
+		return "", 0, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	var permissionID int
+	if err := tx.QueryRow(`SELECT id FROM permissions WHERE name = $1`, permission).Scan(&permissionID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", 0, ErrPermissionNotFound
+		}
+		return "", 0, fmt.Errorf("failed to get permission: %w", err)
+	}
+
+	return roleName, permissionID, nil
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+// Effects of policies and of their decisions
+const (
+	PolicyEffectAllow         = "allow"
+	PolicyEffectDeny          = "deny"
+	PolicyEffectNotApplicable = "not_applicable"
+)
+
+// Operators of policy conditions
+const (
+	// PolicyOperatorEquals and PolicyOperatorNotEquals compare two strings, numbers or booleans
+	PolicyOperatorEquals    = "equals"
+	PolicyOperatorNotEquals = "not_equals"
+	// PolicyOperatorIn holds when the attribute is one of a list of values
+	PolicyOperatorIn = "in"
+	// PolicyOperatorContains holds when the attribute is a list, such as subject.roles, holding the value
+	PolicyOperatorContains = "contains"
+	// PolicyOperatorExists holds when the attribute is set; it takes no value
+	PolicyOperatorExists = "exists"
+	// PolicyOperatorOrgRoleAtLeast holds when the attribute is the ID of an organization in which
+	// the subject has at least the organization role given as the value
+	PolicyOperatorOrgRoleAtLeast = "org_role_at_least"
+)
+
+// PolicyOperators lists the operators conditions can use
+var PolicyOperators = []string{
+	PolicyOperatorEquals,
+	PolicyOperatorNotEquals,
+	PolicyOperatorIn,
+	PolicyOperatorContains,
+	PolicyOperatorExists,
+	PolicyOperatorOrgRoleAtLeast,
+}
+
+// policySubjectAttributes lists the attributes of the subject conditions can refer to, after "subject."
+var policySubjectAttributes = []string{"user_id", "roles", "plan"}
+
+// EvaluatePolicies decides whether the policies of a document allow an input. A policy applies when it
+// covers the action and all its conditions hold. Deny overrides allow, and when no policy applies the
+// request is denied. version is recorded in the decision; it is 0 for drafts.
+func EvaluatePolicies(doc *models.PolicyDocument, version int, input *models.PolicyInput) models.PolicyDecision {
+	var allowedBy *models.Policy
+	for i := range doc.Policies {
+		policy := &doc.Policies[i]
+		if !policyApplies(policy, input) {
+			continue
+		}
+
+		if policy.Effect == PolicyEffectDeny {
+			return models.PolicyDecision{
+				Allowed:       false,
+				Effect:        PolicyEffectDeny,
+				PolicyID:      policy.ID,
+				PolicyVersion: version,
+				Reason:        "denied by policy " + policy.ID,
+			}
+		}
+		if allowedBy == nil {
+			allowedBy = policy
+		}
+	}
+
+	if allowedBy != nil {
+		return models.PolicyDecision{
+			Allowed:       true,
+			Effect:        PolicyEffectAllow,
+			PolicyID:      allowedBy.ID,
+			PolicyVersion: version,
+			Reason:        "allowed by policy " + allowedBy.ID,
+		}
+	}
+
+	return models.PolicyDecision{
+		Allowed:       false,
+		Effect:        PolicyEffectNotApplicable,
+		PolicyVersion: version,
+		Reason:        "no policy allows " + input.Action,
+	}
+}
+
+// ValidatePolicyDocument checks that the policies of a document can be evaluated. Errors are keyed by
+// the path of the invalid field, such as policies[0].conditions[1].
+func ValidatePolicyDocument(doc *models.PolicyDocument) map[string]string {
+	errs := make(map[string]string)
+
+	ids := make(map[string]bool)
+	for i, policy := range doc.Policies {
+		field := fmt.Sprintf("policies[%d]", i)
+
+		switch {
+		case strings.TrimSpace(policy.ID) == "":
+			errs[field+".id"] = "Policy ID is required"
+		case ids[policy.ID]:
+			errs[field+".id"] = "Policy ID " + policy.ID + " is used by another policy"
+		}
+		ids[policy.ID] = true
+
+		if policy.Effect != PolicyEffectAllow && policy.Effect != PolicyEffectDeny {
+			errs[field+".effect"] = "Effect must be allow or deny"
+		}
+
+		if len(policy.Actions) == 0 {
+			errs[field+".actions"] = "At least one action is required"
+		}
+		for j, action := range policy.Actions {
+			if strings.TrimSpace(action) == "" || strings.Contains(strings.TrimSuffix(action, "*"), "*") {
+				errs[fmt.Sprintf("%s.actions[%d]", field, j)] = "Actions are names such as message:delete, or end in * to cover all actions starting with the rest"
+			}
+		}
+
+		for j, condition := range policy.Conditions {
+			if message := validatePolicyCondition(condition); message != "" {
+				errs[fmt.Sprintf("%s.conditions[%d]", field, j)] = message
+			}
+		}
+	}
+
+	return errs
+}
+
+// validatePolicyCondition returns why a condition can not be evaluated, or an empty string if it can
+func validatePolicyCondition(condition models.PolicyCondition) string {
+	if !isPolicyAttribute(condition.Attribute) {
+		return "Attribute must be one of subject." + strings.Join(policySubjectAttributes, ", subject.") + " or resource.<name>"
+	}
+	if !slices.Contains(PolicyOperators, condition.Operator) {
+		return "Operator must be one of " + strings.Join(PolicyOperators, ", ")
+	}
+	if condition.Operator == PolicyOperatorExists {
+		return ""
+	}
+
+	if (condition.Value == nil) == (condition.ValueFrom == "") {
+		return "Exactly one of value and value_from is required"
+	}
+	if condition.ValueFrom != "" && !isPolicyAttribute(condition.ValueFrom) {
+		return "The value_from attribute must be one of subject." + strings.Join(policySubjectAttributes, ", subject.") + " or resource.<name>"
+	}
+
+	switch condition.Operator {
+	case PolicyOperatorIn:
+		if _, ok := policyList(condition.Value); condition.ValueFrom == "" && !ok {
+			return "Value must be a list"
+		}
+	case PolicyOperatorOrgRoleAtLeast:
+		if role, _ := condition.Value.(string); !slices.Contains(OrgRoles, role) {
+			return "Value must be one of the organization roles " + strings.Join(OrgRoles, ", ")
+		}
+	}
+
+	return ""
+}
+
+// isPolicyAttribute reports whether a name refers to an attribute of the subject or the resource
+func isPolicyAttribute(name string) bool {
+	if attribute, ok := strings.CutPrefix(name, "subject."); ok {
+		return slices.Contains(policySubjectAttributes, attribute)
+	}
+	attribute, ok := strings.CutPrefix(name, "resource.")
+	return ok && attribute != ""
+}
+
+// policyApplies reports whether a policy covers the action of an input and all its conditions hold
+func policyApplies(policy *models.Policy, input *models.PolicyInput) bool {
+	covered := slices.ContainsFunc(policy.Actions, func(pattern string) bool {
+		return policyActionMatches(pattern, input.Action)
+	})
+	if !covered {
+		return false
+	}
+
+	for _, condition := range policy.Conditions {
+		if !policyConditionHolds(condition, input) {
+			return false
+		}
+	}
+	return true
+}
+
+// policyActionMatches reports whether an action pattern such as message:* covers an action
+func policyActionMatches(pattern, action string) bool {
+	if pattern == action {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(pattern, "*")
+	return ok && strings.HasPrefix(action, prefix)
+}
+
+// policyConditionHolds evaluates a condition. Conditions on attributes that are not set never hold,
+// whatever the operator, so that a policy can not apply by accident because a resource lacks an attribute.
+func policyConditionHolds(condition models.PolicyCondition, input *models.PolicyInput) bool {
+	actual, ok := policyAttribute(input, condition.Attribute)
+	if !ok {
+		return false
+	}
+	if condition.Operator == PolicyOperatorExists {
+		return true
+	}
+
+	expected := condition.Value
+	if condition.ValueFrom != "" {
+		if expected, ok = policyAttribute(input, condition.ValueFrom); !ok {
+			return false
+		}
+	}
+
+	switch condition.Operator {
+	case PolicyOperatorEquals:
+		return policyValuesEqual(actual, expected)
+	case PolicyOperatorNotEquals:
+		return !policyValuesEqual(actual, expected)
+	case PolicyOperatorIn:
+		values, ok := policyList(expected)
+		return ok && slices.ContainsFunc(values, func(value interface{}) bool {
+			return policyValuesEqual(actual, value)
+		})
+	case PolicyOperatorContains:
+		values, ok := policyList(actual)
+		return ok && slices.ContainsFunc(values, func(value interface{}) bool {
+			return policyValuesEqual(value, expected)
+		})
+	case PolicyOperatorOrgRoleAtLeast:
+		organizationID, ok := policyNumber(actual)
+		minimum, _ := expected.(string)
+		return ok && OrgRoleAtLeast(input.Subject.OrgRoles[int(organizationID)], minimum)
+	}
+
+	return false
+}
+
+// policyAttribute returns the value of a subject or resource attribute and whether it is set
+func policyAttribute(input *models.PolicyInput, name string) (interface{}, bool) {
+	if attribute, ok := strings.CutPrefix(name, "subject."); ok {
+		switch attribute {
+		case "user_id":
+			return input.Subject.UserID, input.Subject.UserID != 0
+		case "roles":
+			return input.Subject.Roles, true
+		case "plan":
+			return input.Subject.Plan, input.Subject.Plan != ""
+		}
+		return nil, false
+	}
+
+	if attribute, ok := strings.CutPrefix(name, "resource."); ok {
+		value, ok := input.Resource[attribute]
+		return value, ok && value != nil
+	}
+
+	return nil, false
+}
+
+// policyValuesEqual compares two attribute values. Numbers are compared by value, so that IDs
+// decoded from JSON equal the same IDs set in code.
+func policyValuesEqual(a, b interface{}) bool {
+	if x, ok := policyNumber(a); ok {
+		y, ok := policyNumber(b)
+		return ok && x == y
+	}
+
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	}
+	return false
+}
+
+// policyNumber returns the value of a numeric attribute
+func policyNumber(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// policyList returns the elements of a list attribute
+func policyList(value interface{}) ([]interface{}, bool) {
+	switch list := value.(type) {
+	case []interface{}:
+		return list, true
+	case []string:
+		values := make([]interface{}, len(list))
+		for i, s := range list {
+			values[i] = s
+		}
+		return values, true
+	}
+	return nil, false
+}
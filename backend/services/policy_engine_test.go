@@ -0,0 +1,126 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+const testPolicyDocument = `{
+	"policies": [
+		{
+			"id": "messages-delete-own",
+			"effect": "allow",
+			"actions": ["message:delete"],
+			"conditions": [{"attribute": "resource.owner_id", "operator": "equals", "value_from": "subject.user_id"}]
+		},
+		{
+			"id": "messages-admin",
+			"effect": "allow",
+			"actions": ["message:*"],
+			"conditions": [{"attribute": "subject.roles", "operator": "contains", "value": "admin"}]
+		},
+		{
+			"id": "billing-org-admins",
+			"effect": "allow",
+			"actions": ["billing:manage"],
+			"conditions": [
+				{"attribute": "resource.organization_id", "operator": "org_role_at_least", "value": "admin"},
+				{"attribute": "subject.plan", "operator": "in", "value": ["pro", "enterprise"]}
+			]
+		},
+		{
+			"id": "locked-messages",
+			"effect": "deny",
+			"actions": ["*"],
+			"conditions": [{"attribute": "resource.locked", "operator": "equals", "value": true}]
+		}
+	]
+}`
+
+func TestEvaluatePolicies(t *testing.T) {
+	var doc models.PolicyDocument
+	if err := json.Unmarshal([]byte(testPolicyDocument), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if errs := ValidatePolicyDocument(&doc); len(errs) != 0 {
+		t.Fatalf("Expected a valid document, got %v", errs)
+	}
+
+	user := models.PolicySubject{UserID: 7, Roles: []string{"user"}, OrgRoles: map[int]string{3: OrgRoleAdmin, 4: OrgRoleMember}, Plan: "pro"}
+	admin := models.PolicySubject{UserID: 1, Roles: []string{"admin", "user"}}
+
+	cases := []struct {
+		name     string
+		subject  models.PolicySubject
+		action   string
+		resource map[string]interface{}
+		effect   string
+		policyID string
+	}{
+		{"own message", user, "message:delete", map[string]interface{}{"owner_id": 7}, PolicyEffectAllow, "messages-delete-own"},
+		{"someone else's message", user, "message:delete", map[string]interface{}{"owner_id": 8}, PolicyEffectNotApplicable, ""},
+		{"message without owner", user, "message:delete", map[string]interface{}{}, PolicyEffectNotApplicable, ""},
+		{"admin deletes any message", admin, "message:delete", map[string]interface{}{"owner_id": 8}, PolicyEffectAllow, "messages-admin"},
+		{"deny overrides allow", user, "message:delete", map[string]interface{}{"owner_id": 7, "locked": true}, PolicyEffectDeny, "locked-messages"},
+		{"billing of administered org", user, "billing:manage", map[string]interface{}{"organization_id": 3.0}, PolicyEffectAllow, "billing-org-admins"},
+		{"billing of org as member", user, "billing:manage", map[string]interface{}{"organization_id": 4}, PolicyEffectNotApplicable, ""},
+		{"billing of other org", admin, "billing:manage", map[string]interface{}{"organization_id": 3}, PolicyEffectNotApplicable, ""},
+		{"unknown action", user, "message:edit", map[string]interface{}{"owner_id": 7}, PolicyEffectNotApplicable, ""},
+	}
+
+	for _, c := range cases {
+		input := &models.PolicyInput{Subject: c.subject, Action: c.action, Resource: c.resource}
+		decision := EvaluatePolicies(&doc, 2, input)
+		if decision.Effect != c.effect || decision.PolicyID != c.policyID {
+			t.Errorf("%s: got %s by %q, want %s by %q", c.name, decision.Effect, decision.PolicyID, c.effect, c.policyID)
+		}
+		if decision.Allowed != (c.effect == PolicyEffectAllow) || decision.PolicyVersion != 2 {
+			t.Errorf("%s: unexpected decision %+v", c.name, decision)
+		}
+	}
+
+	free := user
+	free.Plan = ""
+	input := &models.PolicyInput{Subject: free, Action: "billing:manage", Resource: map[string]interface{}{"organization_id": 3}}
+	if decision := EvaluatePolicies(&doc, 2, input); decision.Allowed {
+		t.Error("Expected conditions on attributes that are not set not to hold")
+	}
+}
+
+func TestValidatePolicyDocument(t *testing.T) {
+	valid := models.Policy{ID: "p", Effect: PolicyEffectAllow, Actions: []string{"message:delete"}}
+
+	invalid := map[string]models.Policy{
+		"policies[1].id":            {ID: "p", Effect: PolicyEffectAllow, Actions: []string{"a"}},
+		"policies[1].effect":        {ID: "q", Effect: "maybe", Actions: []string{"a"}},
+		"policies[1].actions":       {ID: "q", Effect: PolicyEffectDeny},
+		"policies[1].actions[0]":    {ID: "q", Effect: PolicyEffectDeny, Actions: []string{"mess*age"}},
+		"policies[1].conditions[0]": {ID: "q", Effect: PolicyEffectDeny, Actions: []string{"a"}, Conditions: []models.PolicyCondition{{Attribute: "subject.email", Operator: PolicyOperatorEquals, Value: "x"}}},
+	}
+	for field, policy := range invalid {
+		doc := &models.PolicyDocument{Policies: []models.Policy{valid, policy}}
+		if _, ok := ValidatePolicyDocument(doc)[field]; !ok {
+			t.Errorf("Expected an error for %s", field)
+		}
+	}
+
+	conditions := map[string]models.PolicyCondition{
+		"unknown operator":      {Attribute: "resource.owner_id", Operator: "like", Value: "x"},
+		"value and value_from":  {Attribute: "resource.owner_id", Operator: PolicyOperatorEquals, Value: 1.0, ValueFrom: "subject.user_id"},
+		"no value":              {Attribute: "resource.owner_id", Operator: PolicyOperatorEquals},
+		"in without a list":     {Attribute: "subject.plan", Operator: PolicyOperatorIn, Value: "pro"},
+		"unknown org role":      {Attribute: "resource.organization_id", Operator: PolicyOperatorOrgRoleAtLeast, Value: "superuser"},
+		"value_from a constant": {Attribute: "resource.owner_id", Operator: PolicyOperatorEquals, ValueFrom: "7"},
+	}
+	for name, condition := range conditions {
+		if message := validatePolicyCondition(condition); message == "" {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+
+	if message := validatePolicyCondition(models.PolicyCondition{Attribute: "resource.owner_id", Operator: PolicyOperatorExists}); message != "" {
+		t.Errorf("Expected exists to take no value, got %q", message)
+	}
+}
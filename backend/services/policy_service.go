@@ -0,0 +1,378 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/events"
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+// Actions guarded by the access policies
+const (
+	PolicyActionMessageDelete = "message:delete"
+)
+
+const (
+	// policyReloadInterval bounds how long a replica that missed a policy update keeps the previous version
+	policyReloadInterval = time.Minute
+
+	defaultPolicyDecisionLimit = 50
+	maxPolicyDecisionLimit     = 500
+)
+
+// ErrPolicySubjectNotFound is returned when policies are evaluated for a user that does not exist
+var ErrPolicySubjectNotFound = errors.New("user not found")
+
+// PolicyDecisionFilter selects entries of the policy decision log. Zero values match everything.
+type PolicyDecisionFilter struct {
+	UserID int
+	Action string
+	Limit  int
+	Offset int
+}
+
+// PolicyService evaluates the access policies for rules roles can not express, such as users deleting
+// only their own messages, and logs every decision for audits. The latest published version of the
+// policy document is in force; replicas reload it when a new version is announced on the event bus.
+type PolicyService struct {
+	db            *sql.DB
+	eventService  *events.EventService
+	authorization *AuthorizationService
+	retention     time.Duration
+
+	mu       sync.Mutex
+	active   *models.PolicyVersion
+	loadedAt time.Time
+}
+
+// NewPolicyService creates a new policy service. Decisions older than retention are deleted
+// periodically; a retention of 0 keeps them forever.
+func NewPolicyService(db *sql.DB, eventService *events.EventService, authorization *AuthorizationService, retention time.Duration) *PolicyService {
+	ps := &PolicyService{
+		db:            db,
+		eventService:  eventService,
+		authorization: authorization,
+		retention:     retention,
+	}
+
+	go ps.listen()
+	if retention > 0 {
+		go ps.purgePeriodically(time.Hour)
+	}
+
+	return ps
+}
+
+// Authorize decides whether a user may perform an action on a resource described by its attributes,
+// and logs the decision
+func (ps *PolicyService) Authorize(authz *Authorization, action string, resource map[string]interface{}) (models.PolicyDecision, error) {
+	subject, err := ps.subject(authz)
+	if err != nil {
+		return models.PolicyDecision{}, err
+	}
+
+	version, err := ps.Active()
+	if err != nil {
+		return models.PolicyDecision{}, err
+	}
+
+	input := &models.PolicyInput{Subject: *subject, Action: action, Resource: resource}
+	decision := EvaluatePolicies(&version.Document, version.Version, input)
+	ps.logDecision(input, decision, nil)
+
+	return decision, nil
+}
+
+// DryRun evaluates the policies for a user without acting on the decision. A draft document is
+// evaluated instead of the version in force when given. The decision is logged as a dry run by performedBy.
+func (ps *PolicyService) DryRun(req *models.PolicyEvaluationRequest, performedBy int) (*models.PolicyEvaluationResponse, error) {
+	var exists bool
+	if err := ps.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, req.UserID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+	if !exists {
+		return nil, ErrPolicySubjectNotFound
+	}
+
+	authz, err := ps.authorization.Get(req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	subject, err := ps.subject(authz.WithScope(req.AdminScope))
+	if err != nil {
+		return nil, err
+	}
+
+	document, version := req.Document, 0
+	if document == nil {
+		active, err := ps.Active()
+		if err != nil {
+			return nil, err
+		}
+		document, version = &active.Document, active.Version
+	}
+
+	input := &models.PolicyInput{Subject: *subject, Action: req.Action, Resource: req.Resource}
+	decision := EvaluatePolicies(document, version, input)
+	ps.logDecision(input, decision, &performedBy)
+
+	return &models.PolicyEvaluationResponse{Subject: *subject, Decision: decision}, nil
+}
+
+// Active returns the version of the policy document in force. Without any published version
+// the document is empty, which denies every action the policies guard.
+func (ps *PolicyService) Active() (*models.PolicyVersion, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.active != nil && time.Since(ps.loadedAt) < policyReloadInterval {
+		return ps.active, nil
+	}
+
+	query := `
+		SELECT version, document, comment, created_by, created_at
+		FROM policy_versions
+		ORDER BY version DESC
+		LIMIT 1
+	`
+
+	version, err := scanPolicyVersion(ps.db.QueryRow(query))
+	if err == sql.ErrNoRows {
+		version = &models.PolicyVersion{}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load policies: %w", err)
+	}
+
+	ps.active, ps.loadedAt = version, time.Now()
+	return version, nil
+}
+
+// ListVersions returns the published versions of the policy document, newest (the one in force) first
+func (ps *PolicyService) ListVersions() ([]*models.PolicyVersion, error) {
+	query := `
+		SELECT version, document, comment, created_by, created_at
+		FROM policy_versions
+		ORDER BY version DESC
+	`
+
+	rows, err := ps.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policy versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []*models.PolicyVersion{}
+	for rows.Next() {
+		version, err := scanPolicyVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan policy version: %w", err)
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// PublishVersion stores a new version of the policy document, which takes effect at once on this
+// replica. The document must have been validated with ValidatePolicyDocument.
+func (ps *PolicyService) PublishVersion(document *models.PolicyDocument, comment string, createdBy int) (*models.PolicyVersion, error) {
+	documentJSON, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy document: %w", err)
+	}
+
+	query := `
+		INSERT INTO policy_versions (document, comment, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING version, document, comment, created_by, created_at
+	`
+
+	version, err := scanPolicyVersion(ps.db.QueryRow(query, documentJSON, strings.TrimSpace(comment), createdBy))
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish policy version: %w", err)
+	}
+
+	ps.Reload()
+	return version, nil
+}
+
+// Reload makes the next evaluation load the policy document in force again
+func (ps *PolicyService) Reload() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.active = nil
+}
+
+// ListDecisions returns the entries of the policy decision log matching the filter, newest first
+func (ps *PolicyService) ListDecisions(filter PolicyDecisionFilter) ([]*models.PolicyDecisionLog, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.UserID != 0 {
+		addCondition("user_id = $%d", filter.UserID)
+	}
+	if filter.Action != "" {
+		addCondition("action = $%d", filter.Action)
+	}
+
+	query := `
+		SELECT id, user_id, action, resource, allowed, effect, policy_id, policy_version, reason, dry_run, performed_by, created_at
+		FROM policy_decisions
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultPolicyDecisionLimit
+	}
+	args = append(args, min(limit, maxPolicyDecisionLimit), max(filter.Offset, 0))
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := ps.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policy decisions: %w", err)
+	}
+	defer rows.Close()
+
+	decisions := []*models.PolicyDecisionLog{}
+	for rows.Next() {
+		decision := &models.PolicyDecisionLog{}
+		var userID, performedBy sql.NullInt64
+		var resourceJSON []byte
+		if err := rows.Scan(&decision.ID, &userID, &decision.Action, &resourceJSON, &decision.Allowed, &decision.Effect, &decision.PolicyID, &decision.PolicyVersion, &decision.Reason, &decision.DryRun, &performedBy, &decision.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan policy decision: %w", err)
+		}
+
+		if len(resourceJSON) == 0 || json.Unmarshal(resourceJSON, &decision.Resource) != nil {
+			decision.Resource = make(map[string]interface{})
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			decision.UserID = &id
+		}
+		if performedBy.Valid {
+			id := int(performedBy.Int64)
+			decision.PerformedBy = &id
+		}
+		decisions = append(decisions, decision)
+	}
+
+	return decisions, rows.Err()
+}
+
+// subject collects the attributes of the user an authorization belongs to
+func (ps *PolicyService) subject(authz *Authorization) (*models.PolicySubject, error) {
+	query := `SELECT COALESCE(subscription_plan, '') FROM users WHERE id = $1 AND subscription_status = 'active'`
+
+	var plan string
+	if err := ps.db.QueryRow(query, authz.UserID).Scan(&plan); err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to look up subscription plan: %w", err)
+	}
+
+	return &models.PolicySubject{
+		UserID:   authz.UserID,
+		Roles:    authz.Roles(),
+		OrgRoles: authz.Organizations(),
+		Plan:     plan,
+	}, nil
+}
+
+// logDecision adds a decision to the audit log. Dry runs record the admin who requested them.
+// A failure is only logged, as the decision has been made either way.
+func (ps *PolicyService) logDecision(input *models.PolicyInput, decision models.PolicyDecision, performedBy *int) {
+	resource := input.Resource
+	if resource == nil {
+		resource = map[string]interface{}{}
+	}
+	resourceJSON, err := json.Marshal(resource)
+	if err != nil {
+		log.Printf("Warning: Failed to encode resource of policy decision: %v", err)
+		resourceJSON = []byte("{}")
+	}
+
+	query := `
+		INSERT INTO policy_decisions (user_id, action, resource, allowed, effect, policy_id, policy_version, reason, dry_run, performed_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	_, err = ps.db.Exec(query, input.Subject.UserID, input.Action, resourceJSON, decision.Allowed, decision.Effect,
+		decision.PolicyID, decision.PolicyVersion, decision.Reason, performedBy != nil, performedBy)
+	if err != nil {
+		log.Printf("Warning: Failed to log policy decision: %v", err)
+	}
+}
+
+// listen reloads the policy document when any replica publishes a new version
+func (ps *PolicyService) listen() {
+	if ps.eventService == nil {
+		return
+	}
+
+	ch, err := ps.eventService.SubscribeToAdminEvents()
+	if err != nil {
+		log.Printf("Warning: Failed to subscribe to admin events: %v", err)
+		return
+	}
+
+	for event := range ch {
+		if event.Type == events.EventTypePolicyUpdated {
+			ps.Reload()
+		}
+	}
+}
+
+// purgePeriodically deletes the decisions older than the retention on an interval
+func (ps *PolicyService) purgePeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result, err := ps.db.Exec(`DELETE FROM policy_decisions WHERE created_at < $1`, time.Now().Add(-ps.retention))
+		if err != nil {
+			log.Printf("Warning: Failed to purge policy decisions: %v", err)
+			continue
+		}
+		if purged, err := result.RowsAffected(); err == nil && purged > 0 {
+			log.Printf("🧹 Purged %d policy decisions older than %s", purged, ps.retention)
+		}
+	}
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPolicyVersion scans a row of policy_versions
+func scanPolicyVersion(row rowScanner) (*models.PolicyVersion, error) {
+	version := &models.PolicyVersion{}
+	var documentJSON []byte
+	var createdBy sql.NullInt64
+	if err := row.Scan(&version.Version, &documentJSON, &version.Comment, &createdBy, &version.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(documentJSON, &version.Document); err != nil {
+		return nil, fmt.Errorf("failed to parse policy document: %w", err)
+	}
+	if createdBy.Valid {
+		id := int(createdBy.Int64)
+		version.CreatedBy = &id
+	}
+
+	return version, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/lib/pq"
 )
 
 // RoleService handles role-related business logic
@@ -20,7 +21,7 @@ func NewRoleService(db *sql.DB) *RoleService {
 
 // GetAllRoles retrieves all roles from the database
 func (rs *RoleService) GetAllRoles() ([]models.Role, error) {
-	query := `SELECT id, name, description, created_at, updated_at FROM roles ORDER BY name`
+	query := `SELECT id, name, description, ` + roleParentsColumn + `, created_at, updated_at FROM roles ORDER BY name`
 	
 	rows, err := rs.db.Query(query)
 	if err != nil {
@@ -31,7 +32,7 @@ func (rs *RoleService) GetAllRoles() ([]models.Role, error) {
 	var roles []models.Role
 	for rows.Next() {
 		var role models.Role
-		err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, &role.UpdatedAt)
+		err := rows.Scan(&role.ID, &role.Name, &role.Description, pq.Array(&role.Parents), &role.CreatedAt, &role.UpdatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan role: %w", err)
 		}
@@ -43,10 +44,10 @@ func (rs *RoleService) GetAllRoles() ([]models.Role, error) {
 
 // GetRoleByID retrieves a role by its ID
 func (rs *RoleService) GetRoleByID(id int) (*models.Role, error) {
-	query := `SELECT id, name, description, created_at, updated_at FROM roles WHERE id = $1`
+	query := `SELECT id, name, description, ` + roleParentsColumn + `, created_at, updated_at FROM roles WHERE id = $1`
 	
 	var role models.Role
-	err := rs.db.QueryRow(query, id).Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, &role.UpdatedAt)
+	err := rs.db.QueryRow(query, id).Scan(&role.ID, &role.Name, &role.Description, pq.Array(&role.Parents), &role.CreatedAt, &role.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("role not found")
@@ -59,10 +60,10 @@ func (rs *RoleService) GetRoleByID(id int) (*models.Role, error) {
 
 // GetRoleByName retrieves a role by its name
 func (rs *RoleService) GetRoleByName(name string) (*models.Role, error) {
-	query := `SELECT id, name, description, created_at, updated_at FROM roles WHERE name = $1`
+	query := `SELECT id, name, description, ` + roleParentsColumn + `, created_at, updated_at FROM roles WHERE name = $1`
 	
 	var role models.Role
-	err := rs.db.QueryRow(query, name).Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, &role.UpdatedAt)
+	err := rs.db.QueryRow(query, name).Scan(&role.ID, &role.Name, &role.Description, pq.Array(&role.Parents), &role.CreatedAt, &role.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("role not found")
@@ -73,25 +74,53 @@ func (rs *RoleService) GetRoleByName(name string) (*models.Role, error) {
 	return &role, nil
 }
 
-// CreateRole creates a new role
+// CreateRole creates a new role inheriting the given parent roles
 func (rs *RoleService) CreateRole(roleCreate models.RoleCreate) (*models.Role, error) {
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `INSERT INTO roles (name, description) VALUES ($1, $2) RETURNING id, name, description, created_at, updated_at`
-	
+
 	var role models.Role
-	err := rs.db.QueryRow(query, roleCreate.Name, roleCreate.Description).Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, &role.UpdatedAt)
+	err = tx.QueryRow(query, roleCreate.Name, roleCreate.Description).Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, &role.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create role: %w", err)
 	}
 
+	if len(roleCreate.Parents) > 0 {
+		if err := rs.setRoleParents(tx, role.ID, role.Name, roleCreate.Parents); err != nil {
+			return nil, err
+		}
+
+		query = `SELECT ` + roleParentsColumn + ` FROM roles WHERE id = $1`
+		if err := tx.QueryRow(query, role.ID).Scan(pq.Array(&role.Parents)); err != nil {
+			return nil, fmt.Errorf("failed to get parent roles: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit role: %w", err)
+	}
+
 	return &role, nil
 }
 
-// UpdateRole updates an existing role
+// UpdateRole updates an existing role. Given parent roles replace the current ones
+// unless the role would then inherit itself.
 func (rs *RoleService) UpdateRole(id int, roleUpdate models.RoleUpdate) (*models.Role, error) {
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `UPDATE roles SET name = $1, description = $2 WHERE id = $3 RETURNING id, name, description, created_at, updated_at`
-	
+
 	var role models.Role
-	err := rs.db.QueryRow(query, roleUpdate.Name, roleUpdate.Description, id).Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, &role.UpdatedAt)
+	err = tx.QueryRow(query, roleUpdate.Name, roleUpdate.Description, id).Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, &role.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("role not found")
@@ -99,6 +128,21 @@ func (rs *RoleService) UpdateRole(id int, roleUpdate models.RoleUpdate) (*models
 		return nil, fmt.Errorf("failed to update role: %w", err)
 	}
 
+	if roleUpdate.Parents != nil {
+		if err := rs.setRoleParents(tx, role.ID, role.Name, *roleUpdate.Parents); err != nil {
+			return nil, err
+		}
+	}
+
+	query = `SELECT ` + roleParentsColumn + ` FROM roles WHERE id = $1`
+	if err := tx.QueryRow(query, role.ID).Scan(pq.Array(&role.Parents)); err != nil {
+		return nil, fmt.Errorf("failed to get parent roles: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit role update: %w", err)
+	}
+
 	return &role, nil
 }
 
@@ -195,18 +239,27 @@ func (os *OrganizationService) GetOrganizationByID(id int) (*models.Organization
 	return &org, nil
 }
 
-// CreateOrganization creates a new organization
-func (os *OrganizationService) CreateOrganization(orgCreate models.OrganizationCreate) (*models.Organization, error) {
+// CreateOrganization creates a new organization owned by the user creating it
+func (os *OrganizationService) CreateOrganization(orgCreate models.OrganizationCreate, ownerID int) (*models.Organization, error) {
 	metadataJSON, err := json.Marshal(orgCreate.Metadata)
 	if err != nil {
 		metadataJSON = []byte("{}")
 	}
 
-	query := `INSERT INTO organizations (name, description, metadata) VALUES ($1, $2, $3) RETURNING id, name, description, metadata, created_at, updated_at`
+	query := `
+		WITH org AS (
+			INSERT INTO organizations (name, description, metadata) VALUES ($1, $2, $3)
+			RETURNING id, name, description, metadata, created_at, updated_at
+		), owner AS (
+			INSERT INTO user_organizations (user_id, organization_id, role)
+			SELECT $4, id, 'owner' FROM org
+		)
+		SELECT id, name, description, metadata, created_at, updated_at FROM org
+	`
 	
 	var org models.Organization
 	var returnedMetadataJSON []byte
-	err = os.db.QueryRow(query, orgCreate.Name, orgCreate.Description, metadataJSON).Scan(&org.ID, &org.Name, &org.Description, &returnedMetadataJSON, &org.CreatedAt, &org.UpdatedAt)
+	err = os.db.QueryRow(query, orgCreate.Name, orgCreate.Description, metadataJSON, ownerID).Scan(&org.ID, &org.Name, &org.Description, &returnedMetadataJSON, &org.CreatedAt, &org.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create organization: %w", err)
 	}
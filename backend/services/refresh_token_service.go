@@ -0,0 +1,442 @@
+package services
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when a previously rotated refresh token is presented again
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	// ErrSessionNotFound is returned when a session does not exist, belongs to someone else or has already ended
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// errRefreshTokenClientMismatch is returned by checkRefreshFamily when another client presents a token
+var errRefreshTokenClientMismatch = errors.New("refresh token belongs to another client")
+
+const (
+	// refreshTokenHistory is how many rotated tokens of a family are remembered to detect their reuse
+	refreshTokenHistory = 10
+	// refreshReuseGrace is how long after a rotation the token it replaced is refused without revoking
+	// the family, so that concurrent refreshes, such as from two browser tabs, do not end the session
+	refreshReuseGrace = 10 * time.Second
+)
+
+// RefreshTokenService handles server-side refresh token storage and rotation
+type RefreshTokenService struct {
+	db     *sql.DB
+	expiry time.Duration
+	// maxLifetime bounds a family however often it is rotated, so a stolen token that
+	// keeps being refreshed still dies
+	maxLifetime time.Duration
+}
+
+// NewRefreshTokenService creates a new refresh token service
+func NewRefreshTokenService(db *sql.DB) *RefreshTokenService {
+	return &RefreshTokenService{
+		db:          db,
+		expiry:      7 * 24 * time.Hour,  // 7 days without a refresh
+		maxLifetime: 30 * 24 * time.Hour, // 30 days after login
+	}
+}
+
+// Issue starts a new refresh token family (session) for a user and returns its first token.
+// mfa records whether the login that started the session passed a second factor.
+func (rs *RefreshTokenService) Issue(userID int, mfa bool, device SessionDevice) (string, *models.RefreshToken, error) {
+	return rs.IssueForClient(userID, mfa, "", "", device)
+}
+
+// IssueForClient starts a refresh token family on behalf of an OAuth client. Every
+// access token refreshed from it is limited to scope and can only be refreshed by the client.
+func (rs *RefreshTokenService) IssueForClient(userID int, mfa bool, clientID, scope string, device SessionDevice) (string, *models.RefreshToken, error) {
+	familyID, err := generateRandomID(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token, err := newRefreshTokenString(familyID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := `
+		INSERT INTO refresh_tokens (family_id, user_id, token_hash, expires_at, family_expires_at, mfa, client_id, scope, ip_address, user_agent, device_name)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, family_id, user_id, generation, mfa, client_id, scope, expires_at, family_expires_at, rotated_at, revoked_at, revoked_reason, created_at
+	`
+
+	now := time.Now()
+	familyExpiresAt := now.Add(rs.maxLifetime)
+	family, err := scanRefreshToken(rs.db.QueryRow(query, familyID, userID, hashToken(token), refreshTokenExpiry(now, rs.expiry, familyExpiresAt), familyExpiresAt, mfa, sql.NullString{String: clientID, Valid: clientID != ""}, scope, device.IPAddress, device.UserAgent, DeviceName(device.UserAgent)))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return token, family, nil
+}
+
+// Rotate exchanges a refresh token for a new one in the same family.
+// Presenting a token the family was rotated away from revokes the whole family
+// and returns ErrRefreshTokenReused together with the family.
+// clientID is the OAuth client presenting the token, empty for login sessions;
+// a family only rotates for the client it was issued to. device records where
+// the session was last seen. Each rotation extends the family by the idle expiry,
+// but never past its absolute lifetime.
+func (rs *RefreshTokenService) Rotate(token, clientID string, device SessionDevice) (string, *models.RefreshToken, error) {
+	familyID, ok := parseRefreshTokenString(token)
+	if !ok {
+		return "", nil, ErrInvalidRefreshToken
+	}
+
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, family_id, user_id, generation, mfa, client_id, scope, expires_at, family_expires_at, rotated_at, revoked_at, revoked_reason, created_at, token_hash, previous_token_hashes
+		FROM refresh_tokens
+		WHERE family_id = $1
+		FOR UPDATE
+	`
+
+	family := &models.RefreshToken{}
+	var familyClientID, revokedReason sql.NullString
+	var storedHash string
+	var previousHashes []string
+	err = tx.QueryRow(query, familyID).Scan(
+		&family.ID,
+		&family.FamilyID,
+		&family.UserID,
+		&family.Generation,
+		&family.MFA,
+		&familyClientID,
+		&family.Scope,
+		&family.ExpiresAt,
+		&family.FamilyExpiresAt,
+		&family.RotatedAt,
+		&family.RevokedAt,
+		&revokedReason,
+		&family.CreatedAt,
+		&storedHash,
+		pq.Array(&previousHashes),
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil, ErrInvalidRefreshToken
+		}
+		return "", nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	family.ClientID = familyClientID.String
+	family.RevokedReason = revokedReason.String
+
+	now := time.Now()
+	switch err := checkRefreshFamily(family, storedHash, previousHashes, token, clientID, now); err {
+	case nil:
+	case errRefreshTokenClientMismatch:
+		// Not this caller's session: leave it untouched
+		return "", nil, ErrInvalidRefreshToken
+	case ErrRefreshTokenReused:
+		// An older token of this family was replayed: assume it leaked and kill the session
+		if _, err := tx.Exec(
+			`UPDATE refresh_tokens SET revoked_at = $1, revoked_reason = $2 WHERE id = $3`,
+			now, "reuse_detected", family.ID,
+		); err != nil {
+			return "", nil, fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return "", nil, fmt.Errorf("failed to commit refresh token revocation: %w", err)
+		}
+		return "", family, ErrRefreshTokenReused
+	default:
+		return "", family, err
+	}
+
+	newToken, err := newRefreshTokenString(family.FamilyID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = tx.QueryRow(
+		`UPDATE refresh_tokens
+		SET token_hash = $1, generation = generation + 1, rotated_at = $2, expires_at = $3,
+			last_seen_at = $2, ip_address = $5, user_agent = $6, device_name = $7,
+			previous_token_hashes = (ARRAY[token_hash] || previous_token_hashes)[1:$8]
+		WHERE id = $4
+		RETURNING generation, rotated_at, expires_at`,
+		hashToken(newToken), now, refreshTokenExpiry(now, rs.expiry, family.FamilyExpiresAt), family.ID, device.IPAddress, device.UserAgent, DeviceName(device.UserAgent), refreshTokenHistory,
+	).Scan(&family.Generation, &family.RotatedAt, &family.ExpiresAt)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", nil, fmt.Errorf("failed to commit refresh token rotation: %w", err)
+	}
+
+	return newToken, family, nil
+}
+
+// Lookup returns the family of a refresh token if the token is the current one and still valid.
+// Unlike Rotate it leaves the token usable, so it suits introspection.
+func (rs *RefreshTokenService) Lookup(token string) (*models.RefreshToken, error) {
+	familyID, ok := parseRefreshTokenString(token)
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	query := `
+		SELECT id, family_id, user_id, generation, mfa, client_id, scope, expires_at, family_expires_at, rotated_at, revoked_at, revoked_reason, created_at
+		FROM refresh_tokens
+		WHERE family_id = $1 AND token_hash = $2 AND revoked_at IS NULL AND expires_at > $3
+	`
+
+	family, err := scanRefreshToken(rs.db.QueryRow(query, familyID, hashToken(token), time.Now()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return family, nil
+}
+
+// RevokeFamily revokes a single refresh token family
+func (rs *RefreshTokenService) RevokeFamily(familyID, reason string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $1, revoked_reason = $2 WHERE family_id = $3 AND revoked_at IS NULL`
+
+	if _, err := rs.db.Exec(query, time.Now(), reason, familyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAllForUser revokes every active refresh token family belonging to a user
+// and returns the IDs of the families it revoked
+func (rs *RefreshTokenService) RevokeAllForUser(userID int, reason string) ([]string, error) {
+	query := `UPDATE refresh_tokens SET revoked_at = $1, revoked_reason = $2 WHERE user_id = $3 AND revoked_at IS NULL RETURNING family_id`
+
+	rows, err := rs.db.Query(query, time.Now(), reason, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke refresh tokens for user: %w", err)
+	}
+
+	return scanFamilyIDs(rows)
+}
+
+// RevokeClientFamilies revokes the active refresh token families a user granted to an OAuth client
+func (rs *RefreshTokenService) RevokeClientFamilies(userID int, clientID, reason string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $1, revoked_reason = $2 WHERE user_id = $3 AND client_id = $4 AND revoked_at IS NULL`
+
+	if _, err := rs.db.Exec(query, time.Now(), reason, userID, clientID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens for client: %w", err)
+	}
+
+	return nil
+}
+
+// ListSessions returns the active login sessions of a user, most recently used first.
+// Refresh tokens held by OAuth clients are not login sessions and are left out.
+func (rs *RefreshTokenService) ListSessions(userID int) ([]*models.Session, error) {
+	query := `
+		SELECT family_id, device_name, ip_address, user_agent, mfa, created_at, COALESCE(last_seen_at, created_at), expires_at
+		FROM refresh_tokens
+		WHERE user_id = $1 AND client_id IS NULL AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY COALESCE(last_seen_at, created_at) DESC
+	`
+
+	rows, err := rs.db.Query(query, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		session := &models.Session{}
+		if err := rows.Scan(
+			&session.ID,
+			&session.DeviceName,
+			&session.IPAddress,
+			&session.UserAgent,
+			&session.MFA,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.ExpiresAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeUserSession revokes one login session of a user. It returns
+// ErrSessionNotFound if the session does not belong to the user or has already ended.
+func (rs *RefreshTokenService) RevokeUserSession(userID int, familyID, reason string) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = $1, revoked_reason = $2
+		WHERE user_id = $3 AND family_id = $4 AND client_id IS NULL AND revoked_at IS NULL
+	`
+
+	result, err := rs.db.Exec(query, time.Now(), reason, userID, familyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions revokes every login session of a user except keepFamilyID
+// and returns the IDs of the sessions it revoked
+func (rs *RefreshTokenService) RevokeOtherSessions(userID int, keepFamilyID, reason string) ([]string, error) {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = $1, revoked_reason = $2
+		WHERE user_id = $3 AND family_id <> $4 AND client_id IS NULL AND revoked_at IS NULL
+		RETURNING family_id
+	`
+
+	rows, err := rs.db.Query(query, time.Now(), reason, userID, keepFamilyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return scanFamilyIDs(rows)
+}
+
+// scanFamilyIDs reads the family IDs returned by a revocation and closes the rows
+func scanFamilyIDs(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	var familyIDs []string
+	for rows.Next() {
+		var familyID string
+		if err := rows.Scan(&familyID); err != nil {
+			return nil, fmt.Errorf("failed to scan revoked session: %w", err)
+		}
+		familyIDs = append(familyIDs, familyID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read revoked sessions: %w", err)
+	}
+
+	return familyIDs, nil
+}
+
+// GetRefreshTokenExpiry returns the refresh token expiry duration
+func (rs *RefreshTokenService) GetRefreshTokenExpiry() time.Duration {
+	return rs.expiry
+}
+
+// checkRefreshFamily decides whether a token presented by clientID may rotate its family, whose
+// current token has storedHash and whose rotated tokens have previousHashes, newest first. Presenting
+// a rotated token is a replay and returns ErrRefreshTokenReused; the caller then revokes the family.
+// The token replaced by the latest rotation is only refused within refreshReuseGrace, and any other
+// secret is merely invalid, so a family ID alone can not be used to end a session.
+func checkRefreshFamily(family *models.RefreshToken, storedHash string, previousHashes []string, token, clientID string, now time.Time) error {
+	if family.ClientID != clientID {
+		return errRefreshTokenClientMismatch
+	}
+	if family.RevokedAt != nil {
+		return ErrInvalidRefreshToken
+	}
+
+	tokenHash := []byte(hashToken(token))
+	if subtle.ConstantTimeCompare(tokenHash, []byte(storedHash)) != 1 {
+		for i, previousHash := range previousHashes {
+			if subtle.ConstantTimeCompare(tokenHash, []byte(previousHash)) != 1 {
+				continue
+			}
+			if i == 0 && family.RotatedAt != nil && now.Sub(*family.RotatedAt) < refreshReuseGrace {
+				return ErrInvalidRefreshToken
+			}
+			return ErrRefreshTokenReused
+		}
+		return ErrInvalidRefreshToken
+	}
+
+	if now.After(family.ExpiresAt) {
+		return ErrInvalidRefreshToken
+	}
+	return nil
+}
+
+// refreshTokenExpiry returns when a token issued at now expires: after the idle expiry,
+// but no later than the absolute expiry of its family
+func refreshTokenExpiry(now time.Time, idle time.Duration, familyExpiresAt time.Time) time.Time {
+	expiresAt := now.Add(idle)
+	if expiresAt.After(familyExpiresAt) {
+		return familyExpiresAt
+	}
+	return expiresAt
+}
+
+// newRefreshTokenString builds an opaque refresh token of the form "<family_id>.<secret>"
+func newRefreshTokenString(familyID string) (string, error) {
+	secret, err := generateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	return familyID + "." + secret, nil
+}
+
+// parseRefreshTokenString extracts the family ID from an opaque refresh token. JWTs, such as the
+// refresh tokens of before server-side sessions, have more than one dot and are refused.
+func parseRefreshTokenString(token string) (string, bool) {
+	familyID, secret, found := strings.Cut(token, ".")
+	if !found || familyID == "" || secret == "" || strings.Contains(secret, ".") {
+		return "", false
+	}
+	return familyID, true
+}
+
+func scanRefreshToken(row *sql.Row) (*models.RefreshToken, error) {
+	family := &models.RefreshToken{}
+	var clientID, revokedReason sql.NullString
+	err := row.Scan(
+		&family.ID,
+		&family.FamilyID,
+		&family.UserID,
+		&family.Generation,
+		&family.MFA,
+		&clientID,
+		&family.Scope,
+		&family.ExpiresAt,
+		&family.FamilyExpiresAt,
+		&family.RotatedAt,
+		&family.RevokedAt,
+		&revokedReason,
+		&family.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	family.ClientID = clientID.String
+	family.RevokedReason = revokedReason.String
+	return family, nil
+}
@@ -0,0 +1,92 @@
+//go:build integration
+
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	db := openTestDB(t)
+	rs := NewRefreshTokenService(db)
+	userID := createTestUser(t, db)
+	device := SessionDevice{IPAddress: "192.0.2.1", UserAgent: "test"}
+
+	first, family, err := rs.IssueForClient(userID, false, "app", "openid", device)
+	if err != nil {
+		t.Fatalf("IssueForClient failed: %v", err)
+	}
+	if !family.FamilyExpiresAt.After(family.ExpiresAt) {
+		t.Errorf("Expected the family to outlive its first token, got %v and %v", family.FamilyExpiresAt, family.ExpiresAt)
+	}
+
+	if _, rotated, err := rs.Rotate(first, "other", device); err != ErrInvalidRefreshToken || rotated != nil {
+		t.Fatalf("Expected another client to be refused without the family, got %v", err)
+	}
+	if _, err := rs.Lookup(first); err != nil {
+		t.Fatalf("Expected a refusal for another client to leave the token usable, got %v", err)
+	}
+
+	second, rotated, err := rs.Rotate(first, "app", device)
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if rotated.Generation != family.Generation+1 || rotated.FamilyID != family.FamilyID {
+		t.Errorf("Expected the next generation of the family, got %+v", rotated)
+	}
+
+	// Right after a rotation the replaced token is refused without ending the session,
+	// as when two tabs refresh at once
+	if _, _, err := rs.Rotate(first, "app", device); err != ErrInvalidRefreshToken {
+		t.Fatalf("Expected a concurrent refresh to be refused, got %v", err)
+	}
+	if _, err := rs.Lookup(second); err != nil {
+		t.Fatalf("Expected a concurrent refresh to leave the family usable, got %v", err)
+	}
+
+	// A secret that was never issued is invalid, not a replay, whoever knows the family ID
+	forged := family.FamilyID + ".forged"
+	if _, _, err := rs.Rotate(forged, "app", device); err != ErrInvalidRefreshToken {
+		t.Fatalf("Expected a forged secret to be refused, got %v", err)
+	}
+	if _, err := rs.Lookup(second); err != nil {
+		t.Fatalf("Expected a forged secret not to revoke the family, got %v", err)
+	}
+
+	if _, err := db.Exec(`UPDATE refresh_tokens SET rotated_at = $1 WHERE id = $2`, time.Now().Add(-time.Minute), family.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := rs.Rotate(first, "app", device); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Expected replaying a rotated token to be detected, got %v", err)
+	}
+	if _, _, err := rs.Rotate(second, "app", device); err != ErrInvalidRefreshToken {
+		t.Errorf("Expected reuse to revoke the whole family, got %v", err)
+	}
+}
+
+func TestRefreshTokenFamilyLifetime(t *testing.T) {
+	db := openTestDB(t)
+	rs := NewRefreshTokenService(db)
+	userID := createTestUser(t, db)
+
+	token, family, err := rs.Issue(userID, false, SessionDevice{})
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+
+	// Move the family close to its absolute end, as if it had been refreshed for weeks
+	familyExpiresAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	if _, err := db.Exec(`UPDATE refresh_tokens SET family_expires_at = $1 WHERE id = $2`, familyExpiresAt, family.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, rotated, err := rs.Rotate(token, "", SessionDevice{})
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if !rotated.ExpiresAt.Equal(familyExpiresAt) {
+		t.Errorf("Expected rotation not to extend the family past %v, got %v", familyExpiresAt, rotated.ExpiresAt)
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+func TestCheckRefreshFamily(t *testing.T) {
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute)
+	rotatedAt := now.Add(-time.Minute)
+	justRotatedAt := now.Add(-time.Second)
+
+	token, err := newRefreshTokenString("family")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, _ := newRefreshTokenString("family")
+	older, _ := newRefreshTokenString("family")
+	forged, _ := newRefreshTokenString("family")
+	previousHashes := []string{hashToken(previous), hashToken(older)}
+
+	cases := []struct {
+		name     string
+		family   models.RefreshToken
+		token    string
+		clientID string
+		want     error
+	}{
+		{"current token", models.RefreshToken{ExpiresAt: now.Add(time.Hour), RotatedAt: &rotatedAt}, token, "", nil},
+		{"current token of client", models.RefreshToken{ClientID: "app", ExpiresAt: now.Add(time.Hour)}, token, "app", nil},
+		{"login session presented by client", models.RefreshToken{ExpiresAt: now.Add(time.Hour)}, token, "app", errRefreshTokenClientMismatch},
+		{"other client", models.RefreshToken{ClientID: "app", ExpiresAt: now.Add(time.Hour)}, token, "other", errRefreshTokenClientMismatch},
+		{"revoked", models.RefreshToken{ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt}, token, "", ErrInvalidRefreshToken},
+		{"reused", models.RefreshToken{ExpiresAt: now.Add(time.Hour), RotatedAt: &rotatedAt}, previous, "", ErrRefreshTokenReused},
+		{"older token reused", models.RefreshToken{ExpiresAt: now.Add(time.Hour), RotatedAt: &justRotatedAt}, older, "", ErrRefreshTokenReused},
+		{"reused after expiry", models.RefreshToken{ExpiresAt: now.Add(-time.Hour), RotatedAt: &rotatedAt}, previous, "", ErrRefreshTokenReused},
+		{"concurrent refresh within grace", models.RefreshToken{ExpiresAt: now.Add(time.Hour), RotatedAt: &justRotatedAt}, previous, "", ErrInvalidRefreshToken},
+		{"forged secret", models.RefreshToken{ExpiresAt: now.Add(time.Hour), RotatedAt: &rotatedAt}, forged, "", ErrInvalidRefreshToken},
+		{"expired", models.RefreshToken{ExpiresAt: now.Add(-time.Second)}, token, "", ErrInvalidRefreshToken},
+	}
+
+	for _, c := range cases {
+		if err := checkRefreshFamily(&c.family, hashToken(token), previousHashes, c.token, c.clientID, now); err != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, err)
+		}
+	}
+}
+
+func TestRefreshTokenExpiryIsCappedByFamily(t *testing.T) {
+	now := time.Now()
+	idle := 7 * 24 * time.Hour
+
+	if got := refreshTokenExpiry(now, idle, now.Add(30*24*time.Hour)); !got.Equal(now.Add(idle)) {
+		t.Errorf("Expected the idle expiry early in the family, got %v", got)
+	}
+
+	familyExpiresAt := now.Add(2 * 24 * time.Hour)
+	if got := refreshTokenExpiry(now, idle, familyExpiresAt); !got.Equal(familyExpiresAt) {
+		t.Errorf("Expected the family expiry near its end, got %v", got)
+	}
+}
+
+func TestParseRefreshTokenString(t *testing.T) {
+	if familyID, ok := parseRefreshTokenString("family.secret"); !ok || familyID != "family" {
+		t.Errorf("Expected family, got %q, %v", familyID, ok)
+	}
+
+	// Legacy refresh tokens were JWTs, which the refresh endpoint no longer takes
+	for _, token := range []string{"", "family", ".secret", "family.", "header.payload.signature"} {
+		if _, ok := parseRefreshTokenString(token); ok {
+			t.Errorf("Expected %q to be refused", token)
+		}
+	}
+}
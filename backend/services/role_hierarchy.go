@@ -0,0 +1,155 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrRoleCycle is returned when parent roles would make a role inherit itself
+	ErrRoleCycle = errors.New("role hierarchy can not contain a cycle")
+	// ErrParentRoleNotFound is returned for a parent role name no role has
+	ErrParentRoleNotFound = errors.New("parent role not found")
+)
+
+// effectiveRolesCTE defines effective_roles, the IDs of the roles of user $1 including those inherited
+// through parent roles. Unless $2 is true the admin role, and what is only inherited through it, is left out.
+// UNION rather than UNION ALL ends the recursion even if a cycle slipped into role_parents.
+const effectiveRolesCTE = `
+	WITH RECURSIVE effective_roles(role_id) AS (
+		SELECT ur.role_id
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = $1 AND ($2 OR r.name <> 'admin')
+		UNION
+		SELECT rp.parent_role_id
+		FROM role_parents rp
+		JOIN effective_roles er ON er.role_id = rp.role_id
+		JOIN roles r ON r.id = rp.parent_role_id
+		WHERE $2 OR r.name <> 'admin'
+	)
+`
+
+// roleParentsColumn selects the names of the parent roles of the row of roles in a query
+const roleParentsColumn = `
+	ARRAY(
+		SELECT p.name FROM role_parents rp JOIN roles p ON p.id = rp.parent_role_id
+		WHERE rp.role_id = roles.id ORDER BY p.name
+	)
+`
+
+// setRoleParents replaces the parent roles of a role, refusing parents that would make it inherit itself.
+// Changes to the hierarchy are serialized so that concurrent ones can not form a cycle together.
+func (rs *RoleService) setRoleParents(tx *sql.Tx, roleID int, roleName string, parentNames []string) error {
+	if _, err := tx.Exec(`LOCK TABLE role_parents IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return fmt.Errorf("failed to lock role hierarchy: %w", err)
+	}
+
+	rows, err := tx.Query(`SELECT id, name FROM roles WHERE name = ANY($1)`, pq.Array(parentNames))
+	if err != nil {
+		return fmt.Errorf("failed to query parent roles: %w", err)
+	}
+	parentIDs := map[string]int{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan parent role: %w", err)
+		}
+		parentIDs[name] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query parent roles: %w", err)
+	}
+
+	ids := make([]int64, 0, len(parentNames))
+	for _, name := range parentNames {
+		id, ok := parentIDs[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrParentRoleNotFound, name)
+		}
+		ids = append(ids, int64(id))
+	}
+
+	hierarchy, err := rs.loadHierarchy(tx)
+	if err != nil {
+		return err
+	}
+	hierarchy[roleName] = parentNames
+	if cycle := findRoleCycle(hierarchy, roleName); cycle != nil {
+		return fmt.Errorf("%w: %s", ErrRoleCycle, strings.Join(cycle, " -> "))
+	}
+
+	if _, err := tx.Exec(`DELETE FROM role_parents WHERE role_id = $1`, roleID); err != nil {
+		return fmt.Errorf("failed to clear parent roles: %w", err)
+	}
+
+	query := `
+		INSERT INTO role_parents (role_id, parent_role_id)
+		SELECT $1, unnest($2::int[])
+		ON CONFLICT (role_id, parent_role_id) DO NOTHING
+	`
+	if _, err := tx.Exec(query, roleID, pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to set parent roles: %w", err)
+	}
+
+	return nil
+}
+
+// loadHierarchy returns the parent role names of every role that has parents
+func (rs *RoleService) loadHierarchy(tx *sql.Tx) (map[string][]string, error) {
+	query := `
+		SELECT r.name, p.name
+		FROM role_parents rp
+		JOIN roles r ON r.id = rp.role_id
+		JOIN roles p ON p.id = rp.parent_role_id
+	`
+
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query role hierarchy: %w", err)
+	}
+	defer rows.Close()
+
+	hierarchy := map[string][]string{}
+	for rows.Next() {
+		var role, parent string
+		if err := rows.Scan(&role, &parent); err != nil {
+			return nil, fmt.Errorf("failed to scan role hierarchy: %w", err)
+		}
+		hierarchy[role] = append(hierarchy[role], parent)
+	}
+
+	return hierarchy, rows.Err()
+}
+
+// findRoleCycle returns a path of parent links from a role back to itself, such as
+// [admin manager admin], or nil if the role does not inherit itself
+func findRoleCycle(parents map[string][]string, role string) []string {
+	visited := map[string]bool{}
+
+	var walk func(path []string) []string
+	walk = func(path []string) []string {
+		for _, parent := range parents[path[len(path)-1]] {
+			if parent == role {
+				return append(path, parent)
+			}
+			if visited[parent] {
+				continue
+			}
+			visited[parent] = true
+			if cycle := walk(append(path, parent)); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+
+	return walk([]string{role})
+}
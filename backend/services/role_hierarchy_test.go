@@ -0,0 +1,29 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFindRoleCycle(t *testing.T) {
+	hierarchy := map[string][]string{
+		"admin":   {"manager"},
+		"manager": {"editor"},
+		"editor":  {"reader"},
+		"reader":  {"user"},
+	}
+
+	if cycle := findRoleCycle(hierarchy, "admin"); cycle != nil {
+		t.Fatalf("Expected no cycle, got %v", cycle)
+	}
+
+	hierarchy["user"] = []string{"auditor", "manager"}
+	want := []string{"user", "manager", "editor", "reader", "user"}
+	if cycle := findRoleCycle(hierarchy, "user"); !slices.Equal(cycle, want) {
+		t.Errorf("Expected cycle %v, got %v", want, cycle)
+	}
+
+	if cycle := findRoleCycle(map[string][]string{"user": {"user"}}, "user"); !slices.Equal(cycle, []string{"user", "user"}) {
+		t.Errorf("Expected a role naming itself as parent to be a cycle, got %v", cycle)
+	}
+}
@@ -0,0 +1,522 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/events"
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+// Lockout scopes: failed logins are counted per account, keyed by email, and per client IP address
+const (
+	LockoutScopeAccount = "account"
+	LockoutScopeIP      = "ip"
+)
+
+// Kinds of login anomalies
+const (
+	AnomalyNewCountry       = "new_country"
+	AnomalyNewDevice        = "new_device"
+	AnomalyImpossibleTravel = "impossible_travel"
+)
+
+// Login signals remembered per user
+const (
+	signalCountry = "country"
+	signalDevice  = "device"
+)
+
+const (
+	// maxTravelSpeed is faster than any airliner; logins further apart than this allows are flagged
+	maxTravelSpeed = 1000.0 // km/h
+	// minTravelDistance ignores jumps that IP geolocation makes on its own
+	minTravelDistance = 500.0  // km
+	earthRadius       = 6371.0 // km
+)
+
+var (
+	// ErrLockoutNotFound is returned when unlocking a lockout that does not exist
+	ErrLockoutNotFound = errors.New("lockout not found")
+)
+
+// lockoutPolicy decides when failed logins lock a subject out and for how long
+type lockoutPolicy struct {
+	// threshold failures within window lock the subject out
+	threshold int
+	window    time.Duration
+	// baseDelay is the length of the first lockout; every following one doubles it up to maxDelay
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	// resetAfter forgets earlier lockouts once the subject has not failed for this long
+	resetAfter time.Duration
+}
+
+var (
+	accountLockoutPolicy = lockoutPolicy{threshold: 5, window: 15 * time.Minute, baseDelay: time.Minute, maxDelay: time.Hour, resetAfter: 24 * time.Hour}
+	// Many users can share an address behind a NAT, so it takes more failures to lock one out
+	ipLockoutPolicy = lockoutPolicy{threshold: 20, window: 15 * time.Minute, baseDelay: time.Minute, maxDelay: time.Hour, resetAfter: 24 * time.Hour}
+)
+
+// delay returns how long the nth lockout of a subject lasts
+func (p lockoutPolicy) delay(lockouts int) time.Duration {
+	if lockouts < 1 {
+		return 0
+	}
+
+	delay := p.baseDelay
+	for i := 1; i < lockouts && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.maxDelay)
+}
+
+// recordFailure counts a failed login at now and reports whether it locked the subject out
+func (p lockoutPolicy) recordFailure(l *models.Lockout, now time.Time) bool {
+	// Logins are refused while locked out, so stray failures do not make the lockout longer
+	if l.LockedUntil != nil && now.Before(*l.LockedUntil) {
+		return false
+	}
+
+	if l.LastFailureAt != nil {
+		idle := now.Sub(*l.LastFailureAt)
+		if idle > p.window {
+			l.Failures = 0
+		}
+		if idle > p.resetAfter {
+			l.Lockouts = 0
+		}
+	}
+
+	l.Failures++
+	l.LastFailureAt = &now
+	if l.Failures < p.threshold {
+		return false
+	}
+
+	l.Failures = 0
+	l.Lockouts++
+	lockedUntil := now.Add(p.delay(l.Lockouts))
+	l.LockedUntil = &lockedUntil
+	return true
+}
+
+// SecurityService protects logins against brute force and flags logins that do not fit a user's history.
+// It consumes the auth events: failures lock accounts and IP addresses out progressively, and successful
+// logins are compared with the countries, devices and location the user logged in from before.
+type SecurityService struct {
+	db           *sql.DB
+	eventService *events.EventService
+}
+
+// NewSecurityService creates a new security service and starts consuming auth events
+func NewSecurityService(db *sql.DB, eventService *events.EventService) *SecurityService {
+	ss := &SecurityService{
+		db:           db,
+		eventService: eventService,
+	}
+
+	go ss.listen()
+	go ss.purgePeriodically(time.Hour)
+
+	return ss
+}
+
+// LockedUntil returns when the lockout of the account with the given email or of the IP address ends,
+// whichever is later. locked is false if neither is locked out.
+func (ss *SecurityService) LockedUntil(email, ip string) (time.Time, bool, error) {
+	query := `
+		SELECT MAX(locked_until)
+		FROM auth_lockouts
+		WHERE locked_until > NOW()
+		  AND ((scope = 'account' AND subject = $1) OR (scope = 'ip' AND subject = $2))
+	`
+
+	var lockedUntil sql.NullTime
+	if err := ss.db.QueryRow(query, NormalizeEmail(email), ip).Scan(&lockedUntil); err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to check lockout: %w", err)
+	}
+
+	return lockedUntil.Time, lockedUntil.Valid, nil
+}
+
+// ListLockouts returns the accounts and IP addresses that are locked out or have recent failed logins,
+// optionally only those whose subject contains the given text
+func (ss *SecurityService) ListLockouts(subject string) ([]*models.Lockout, error) {
+	query := `
+		SELECT id, scope, subject, failures, lockouts, locked_until, last_failure_at
+		FROM auth_lockouts
+		WHERE (locked_until > NOW() OR failures > 0)
+		  AND ($1 = '' OR subject ILIKE '%' || $1 || '%')
+		ORDER BY locked_until DESC NULLS LAST, last_failure_at DESC
+	`
+
+	rows, err := ss.db.Query(query, strings.ToLower(strings.TrimSpace(subject)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lockouts: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	lockouts := []*models.Lockout{}
+	for rows.Next() {
+		lockout := &models.Lockout{}
+		if err := rows.Scan(&lockout.ID, &lockout.Scope, &lockout.Subject, &lockout.Failures, &lockout.Lockouts, &lockout.LockedUntil, &lockout.LastFailureAt); err != nil {
+			return nil, fmt.Errorf("failed to scan lockout: %w", err)
+		}
+		lockout.Locked = lockout.LockedUntil != nil && lockout.LockedUntil.After(now)
+		lockouts = append(lockouts, lockout)
+	}
+
+	return lockouts, rows.Err()
+}
+
+// Unlock lifts a lockout and forgets the failed logins and earlier lockouts of its subject
+func (ss *SecurityService) Unlock(id int) (*models.Lockout, error) {
+	lockout := &models.Lockout{}
+	err := ss.db.QueryRow(`DELETE FROM auth_lockouts WHERE id = $1 RETURNING id, scope, subject`, id).Scan(&lockout.ID, &lockout.Scope, &lockout.Subject)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrLockoutNotFound
+		}
+		return nil, fmt.Errorf("failed to unlock: %w", err)
+	}
+
+	return lockout, nil
+}
+
+// ListAnomalies returns the most recent login anomalies, of one user if userID is not 0
+func (ss *SecurityService) ListAnomalies(userID, limit int) ([]*models.SecurityAnomaly, error) {
+	query := `
+		SELECT id, user_id, kind, details, ip_address, user_agent, country, created_at
+		FROM security_anomalies
+		WHERE $1 = 0 OR user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+
+	rows, err := ss.db.Query(query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list anomalies: %w", err)
+	}
+	defer rows.Close()
+
+	anomalies := []*models.SecurityAnomaly{}
+	for rows.Next() {
+		anomaly := &models.SecurityAnomaly{}
+		if err := rows.Scan(&anomaly.ID, &anomaly.UserID, &anomaly.Kind, &anomaly.Details, &anomaly.IPAddress, &anomaly.UserAgent, &anomaly.Country, &anomaly.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan anomaly: %w", err)
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+
+	return anomalies, rows.Err()
+}
+
+// listen processes auth events as they are published
+func (ss *SecurityService) listen() {
+	if ss.eventService == nil {
+		return
+	}
+
+	ch, err := ss.eventService.SubscribeToAuthEvents()
+	if err != nil {
+		log.Printf("Warning: Failed to subscribe to auth events: %v", err)
+		return
+	}
+
+	for event := range ch {
+		if event.Type != events.EventTypeAuthFailure && event.Type != events.EventTypeAuthSuccess {
+			continue
+		}
+
+		claimed, err := ss.claimEvent(event.ID)
+		if err != nil {
+			log.Printf("Warning: Failed to claim auth event: %v", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		email, _ := event.Data[events.DataKeyEmail].(string)
+		client := events.ClientInfoFromData(event.Data)
+
+		switch event.Type {
+		case events.EventTypeAuthFailure:
+			ss.handleFailure(email, client)
+		case events.EventTypeAuthSuccess:
+			if event.UserID != nil && *event.UserID != 0 {
+				ss.handleSuccess(*event.UserID, email, client, event.Timestamp)
+			}
+		}
+	}
+}
+
+// claimEvent reports whether this is the first delivery of an event to any replica. With NATS,
+// events reach every replica and can arrive more than once, but must only be counted once.
+func (ss *SecurityService) claimEvent(eventID string) (bool, error) {
+	result, err := ss.db.Exec(`INSERT INTO security_processed_events (event_id) VALUES ($1) ON CONFLICT (event_id) DO NOTHING`, eventID)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim event: %w", err)
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim event: %w", err)
+	}
+
+	return claimed == 1, nil
+}
+
+// handleFailure counts a failed login against the account and the IP address it names
+func (ss *SecurityService) handleFailure(email string, client *events.ClientInfo) {
+	if email := NormalizeEmail(email); email != "" {
+		if err := ss.recordFailure(LockoutScopeAccount, email, accountLockoutPolicy); err != nil {
+			log.Printf("Warning: Failed to record failed login: %v", err)
+		}
+	}
+	if client.IPAddress != "" {
+		if err := ss.recordFailure(LockoutScopeIP, client.IPAddress, ipLockoutPolicy); err != nil {
+			log.Printf("Warning: Failed to record failed login: %v", err)
+		}
+	}
+}
+
+// recordFailure counts a failed login of a subject and locks it out when the policy says so
+func (ss *SecurityService) recordFailure(scope, subject string, policy lockoutPolicy) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO auth_lockouts (scope, subject) VALUES ($1, $2) ON CONFLICT (scope, subject) DO NOTHING`, scope, subject); err != nil {
+		return fmt.Errorf("failed to create lockout counter: %w", err)
+	}
+
+	lockout := &models.Lockout{Scope: scope, Subject: subject}
+	err = tx.QueryRow(`
+		SELECT id, failures, lockouts, locked_until, last_failure_at
+		FROM auth_lockouts
+		WHERE scope = $1 AND subject = $2
+		FOR UPDATE
+	`, scope, subject).Scan(&lockout.ID, &lockout.Failures, &lockout.Lockouts, &lockout.LockedUntil, &lockout.LastFailureAt)
+	if err != nil {
+		return fmt.Errorf("failed to get lockout counter: %w", err)
+	}
+
+	locked := policy.recordFailure(lockout, time.Now())
+
+	_, err = tx.Exec(`
+		UPDATE auth_lockouts
+		SET failures = $1, lockouts = $2, locked_until = $3, last_failure_at = $4, updated_at = NOW()
+		WHERE id = $5
+	`, lockout.Failures, lockout.Lockouts, lockout.LockedUntil, lockout.LastFailureAt, lockout.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update lockout counter: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit lockout counter: %w", err)
+	}
+
+	if locked && ss.eventService != nil {
+		if err := ss.eventService.PublishLockout(scope, subject, policy.threshold, *lockout.LockedUntil); err != nil {
+			log.Printf("Warning: Failed to publish lockout event: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// handleSuccess clears the failed logins of the account and checks the login against the user's history
+func (ss *SecurityService) handleSuccess(userID int, email string, client *events.ClientInfo, at time.Time) {
+	if email := NormalizeEmail(email); email != "" {
+		// A lockout still running is left alone: it was not this login that ended it
+		_, err := ss.db.Exec(`
+			DELETE FROM auth_lockouts
+			WHERE scope = 'account' AND subject = $1 AND (locked_until IS NULL OR locked_until <= NOW())
+		`, email)
+		if err != nil {
+			log.Printf("Warning: Failed to clear failed logins: %v", err)
+		}
+	}
+
+	if err := ss.checkLogin(userID, email, client, at); err != nil {
+		log.Printf("Warning: Failed to check login for anomalies: %v", err)
+	}
+}
+
+// checkLogin flags a login from a country or device the user has not used before, or from too far
+// away from the previous login, and then remembers it. Users without history are only remembered.
+func (ss *SecurityService) checkLogin(userID int, email string, client *events.ClientInfo, at time.Time) error {
+	type anomaly struct{ kind, details string }
+	var anomalies []anomaly
+
+	device := ""
+	if client.UserAgent != "" {
+		device = DeviceName(client.UserAgent)
+	}
+
+	if client.Country != "" {
+		known, err := ss.loginSignals(userID, signalCountry)
+		if err != nil {
+			return err
+		}
+		if len(known) > 0 && !known[client.Country] {
+			anomalies = append(anomalies, anomaly{AnomalyNewCountry, "First login from " + client.Country})
+		}
+	}
+
+	if device != "" {
+		known, err := ss.loginSignals(userID, signalDevice)
+		if err != nil {
+			return err
+		}
+		if len(known) > 0 && !known[device] {
+			anomalies = append(anomalies, anomaly{AnomalyNewDevice, "First login from " + device})
+		}
+	}
+
+	if client.Latitude != nil && client.Longitude != nil {
+		var lat, lon sql.NullFloat64
+		var previousIP string
+		var previousAt time.Time
+		err := ss.db.QueryRow(`
+			SELECT ip_address, latitude, longitude, logged_in_at FROM user_last_logins WHERE user_id = $1
+		`, userID).Scan(&previousIP, &lat, &lon, &previousAt)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to get last login: %w", err)
+		}
+		if err == nil && lat.Valid && lon.Valid {
+			if distance, ok := impossibleTravel(lat.Float64, lon.Float64, *client.Latitude, *client.Longitude, at.Sub(previousAt)); ok {
+				anomalies = append(anomalies, anomaly{AnomalyImpossibleTravel, fmt.Sprintf("%.0f km from the login from %s %s earlier", distance, previousIP, at.Sub(previousAt).Round(time.Minute))})
+			}
+		}
+	}
+
+	if err := ss.rememberLogin(userID, device, client, at); err != nil {
+		return err
+	}
+
+	for _, a := range anomalies {
+		_, err := ss.db.Exec(`
+			INSERT INTO security_anomalies (user_id, kind, details, ip_address, user_agent, country)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, userID, a.kind, a.details, client.IPAddress, client.UserAgent, client.Country)
+		if err != nil {
+			return fmt.Errorf("failed to record anomaly: %w", err)
+		}
+
+		if ss.eventService != nil {
+			if err := ss.eventService.PublishAnomaly(userID, email, a.kind, a.details, client); err != nil {
+				log.Printf("Warning: Failed to publish anomaly event: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// loginSignals returns the values of one kind of signal the user has logged in with
+func (ss *SecurityService) loginSignals(userID int, kind string) (map[string]bool, error) {
+	rows, err := ss.db.Query(`SELECT value FROM user_login_signals WHERE user_id = $1 AND kind = $2`, userID, kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login signals: %w", err)
+	}
+	defer rows.Close()
+
+	values := make(map[string]bool)
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, fmt.Errorf("failed to scan login signal: %w", err)
+		}
+		values[value] = true
+	}
+
+	return values, rows.Err()
+}
+
+// rememberLogin stores the country, device and location of a login for the next comparison
+func (ss *SecurityService) rememberLogin(userID int, device string, client *events.ClientInfo, at time.Time) error {
+	signals := map[string]string{
+		signalCountry: client.Country,
+		signalDevice:  device,
+	}
+	for kind, value := range signals {
+		if value == "" {
+			continue
+		}
+		_, err := ss.db.Exec(`
+			INSERT INTO user_login_signals (user_id, kind, value) VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, kind, value) DO UPDATE SET last_seen_at = NOW()
+		`, userID, kind, value)
+		if err != nil {
+			return fmt.Errorf("failed to store login signal: %w", err)
+		}
+	}
+
+	_, err := ss.db.Exec(`
+		INSERT INTO user_last_logins (user_id, ip_address, country, latitude, longitude, logged_in_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE
+		SET ip_address = EXCLUDED.ip_address, country = EXCLUDED.country,
+		    latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude, logged_in_at = EXCLUDED.logged_in_at
+	`, userID, client.IPAddress, client.Country, client.Latitude, client.Longitude, at)
+	if err != nil {
+		return fmt.Errorf("failed to store last login: %w", err)
+	}
+
+	return nil
+}
+
+// purgePeriodically removes lockout counters that have been idle long enough to be forgotten,
+// and the claims of events too old to be delivered again
+func (ss *SecurityService) purgePeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, err := ss.db.Exec(`
+			DELETE FROM auth_lockouts
+			WHERE (locked_until IS NULL OR locked_until < NOW()) AND last_failure_at < $1
+		`, time.Now().Add(-max(accountLockoutPolicy.resetAfter, ipLockoutPolicy.resetAfter)))
+		if err != nil {
+			log.Printf("Warning: Failed to purge lockout counters: %v", err)
+		}
+
+		if _, err := ss.db.Exec(`DELETE FROM security_processed_events WHERE processed_at < NOW() - INTERVAL '1 day'`); err != nil {
+			log.Printf("Warning: Failed to purge processed events: %v", err)
+		}
+	}
+}
+
+// impossibleTravel returns the distance between two logins and whether covering it in the time
+// between them would take a faster than possible trip
+func impossibleTravel(fromLat, fromLon, toLat, toLon float64, elapsed time.Duration) (float64, bool) {
+	distance := greatCircleDistance(fromLat, fromLon, toLat, toLon)
+	if distance < minTravelDistance {
+		return distance, false
+	}
+	if elapsed <= 0 {
+		return distance, true
+	}
+	return distance, distance/elapsed.Hours() > maxTravelSpeed
+}
+
+// greatCircleDistance returns the distance in kilometres between two coordinates
+func greatCircleDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+func TestLockoutPolicyBacksOff(t *testing.T) {
+	policy := lockoutPolicy{threshold: 3, window: 15 * time.Minute, baseDelay: time.Minute, maxDelay: 5 * time.Minute, resetAfter: 24 * time.Hour}
+	lockout := &models.Lockout{}
+	now := time.Now()
+
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute} {
+		for i := 1; i <= policy.threshold; i++ {
+			locked := policy.recordFailure(lockout, now)
+			if locked != (i == policy.threshold) {
+				t.Fatalf("failure %d: expected locked=%v", i, i == policy.threshold)
+			}
+		}
+		if got := lockout.LockedUntil.Sub(now); got != want {
+			t.Errorf("lockout %d: expected %s, got %s", lockout.Lockouts, want, got)
+		}
+
+		// Failures while locked out are not counted
+		if policy.recordFailure(lockout, now.Add(time.Second)) {
+			t.Error("expected no new lockout while locked out")
+		}
+		now = *lockout.LockedUntil
+	}
+}
+
+func TestLockoutPolicyForgets(t *testing.T) {
+	policy := lockoutPolicy{threshold: 3, window: 15 * time.Minute, baseDelay: time.Minute, maxDelay: time.Hour, resetAfter: 24 * time.Hour}
+	now := time.Now()
+	lastFailure := now.Add(-20 * time.Minute)
+	lockout := &models.Lockout{Failures: 2, Lockouts: 1, LastFailureAt: &lastFailure}
+
+	if policy.recordFailure(lockout, now) {
+		t.Fatal("expected failures outside the window to be forgotten")
+	}
+	if lockout.Failures != 1 || lockout.Lockouts != 1 {
+		t.Errorf("expected 1 failure and 1 earlier lockout, got %d and %d", lockout.Failures, lockout.Lockouts)
+	}
+
+	lastFailure = now.Add(-25 * time.Hour)
+	lockout = &models.Lockout{Failures: 2, Lockouts: 3, LastFailureAt: &lastFailure}
+	policy.recordFailure(lockout, now)
+	if lockout.Lockouts != 0 {
+		t.Errorf("expected earlier lockouts to be forgotten, got %d", lockout.Lockouts)
+	}
+}
+
+func TestImpossibleTravel(t *testing.T) {
+	const (
+		stockholmLat, stockholmLon = 59.33, 18.07
+		uppsalaLat, uppsalaLon     = 59.86, 17.64
+		newYorkLat, newYorkLon     = 40.71, -74.01
+	)
+
+	cases := []struct {
+		name            string
+		toLat, toLon    float64
+		elapsed         time.Duration
+		wantImpossible  bool
+		wantMinDistance float64
+	}{
+		{"nearby city right away", uppsalaLat, uppsalaLon, time.Minute, false, 0},
+		{"other continent within an hour", newYorkLat, newYorkLon, time.Hour, true, 6000},
+		{"other continent after a flight", newYorkLat, newYorkLon, 10 * time.Hour, false, 6000},
+	}
+
+	for _, c := range cases {
+		distance, impossible := impossibleTravel(stockholmLat, stockholmLon, c.toLat, c.toLon, c.elapsed)
+		if impossible != c.wantImpossible {
+			t.Errorf("%s: expected impossible=%v (%.0f km)", c.name, c.wantImpossible, distance)
+		}
+		if distance < c.wantMinDistance {
+			t.Errorf("%s: expected at least %.0f km, got %.0f", c.name, c.wantMinDistance, distance)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+// ServiceAccountEmailDomain is the reserved domain of service account email addresses.
+// .invalid can never receive mail, so nobody can sign up or reset a password with one.
+const ServiceAccountEmailDomain = "service-accounts.invalid"
+
+var serviceAccountNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}[a-z0-9]$`)
+
+var (
+	// ErrServiceAccountNotFound is returned when a service account does not exist
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	// ErrServiceAccountExists is returned when creating a service account with a name already in use
+	ErrServiceAccountExists = errors.New("service account already exists")
+	// ErrInvalidServiceAccountName is returned for names that are not lowercase letters, digits and dashes
+	ErrInvalidServiceAccountName = errors.New("service account name must be 3-64 lowercase letters, digits or dashes")
+)
+
+// ServiceAccountService manages non-human accounts used by CI jobs and tooling.
+// A service account is a user without login identities that authenticates
+// with access tokens only; roles are assigned to it like to any other user.
+type ServiceAccountService struct {
+	db           *sql.DB
+	accessTokens *AccessTokenService
+}
+
+// NewServiceAccountService creates a new service account service
+func NewServiceAccountService(db *sql.DB, accessTokens *AccessTokenService) *ServiceAccountService {
+	return &ServiceAccountService{
+		db:           db,
+		accessTokens: accessTokens,
+	}
+}
+
+// IsServiceAccountEmail reports whether an email address belongs to a service account
+func IsServiceAccountEmail(email string) bool {
+	return strings.HasSuffix(strings.ToLower(email), "@"+ServiceAccountEmailDomain)
+}
+
+// Create creates a service account
+func (sas *ServiceAccountService) Create(input *models.ServiceAccountCreateInput, createdBy int) (*models.ServiceAccount, error) {
+	name := strings.TrimSpace(input.Name)
+	if !serviceAccountNamePattern.MatchString(name) {
+		return nil, ErrInvalidServiceAccountName
+	}
+	email := name + "@" + ServiceAccountEmailDomain
+
+	tx, err := sas.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(email) = $1)`, email).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check service account name: %w", err)
+	}
+	if exists {
+		return nil, ErrServiceAccountExists
+	}
+
+	now := time.Now()
+	account := &models.ServiceAccount{
+		Name:        name,
+		Email:       email,
+		Description: strings.TrimSpace(input.Description),
+		IsActive:    true,
+		CreatedBy:   &createdBy,
+		CreatedAt:   now,
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO users (email, name, picture, is_active, pending_approval, last_login_at, created_at, updated_at)
+		VALUES ($1, $2, '', true, false, $3, $3, $3)
+		RETURNING id
+	`, email, name, now).Scan(&account.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service account user: %w", err)
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO service_accounts (user_id, description, created_by, created_at) VALUES ($1, $2, $3, $4)`,
+		account.ID, account.Description, createdBy, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service account: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit service account: %w", err)
+	}
+
+	return account, nil
+}
+
+// List returns all service accounts, including deactivated ones
+func (sas *ServiceAccountService) List() ([]models.ServiceAccount, error) {
+	rows, err := sas.db.Query(`
+		SELECT sa.user_id, u.name, u.email, sa.description, u.is_active, sa.created_by, sa.created_at
+		FROM service_accounts sa
+		JOIN users u ON u.id = sa.user_id
+		ORDER BY u.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []models.ServiceAccount{}
+	for rows.Next() {
+		var account models.ServiceAccount
+		if err := rows.Scan(
+			&account.ID,
+			&account.Name,
+			&account.Email,
+			&account.Description,
+			&account.IsActive,
+			&account.CreatedBy,
+			&account.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan service account: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, rows.Err()
+}
+
+// Get returns a service account by its user id
+func (sas *ServiceAccountService) Get(id int) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	err := sas.db.QueryRow(`
+		SELECT sa.user_id, u.name, u.email, sa.description, u.is_active, sa.created_by, sa.created_at
+		FROM service_accounts sa
+		JOIN users u ON u.id = sa.user_id
+		WHERE sa.user_id = $1
+	`, id).Scan(
+		&account.ID,
+		&account.Name,
+		&account.Email,
+		&account.Description,
+		&account.IsActive,
+		&account.CreatedBy,
+		&account.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrServiceAccountNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service account: %w", err)
+	}
+
+	return &account, nil
+}
+
+// Deactivate disables a service account and revokes all of its tokens.
+// The account is kept so audit records keep pointing at it.
+func (sas *ServiceAccountService) Deactivate(id int) (*models.ServiceAccount, error) {
+	account, err := sas.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := sas.db.Exec(`UPDATE users SET is_active = false WHERE id = $1`, id); err != nil {
+		return nil, fmt.Errorf("failed to deactivate service account: %w", err)
+	}
+	if err := sas.accessTokens.RevokeAllTokens(id); err != nil {
+		return nil, err
+	}
+
+	account.IsActive = false
+	return account, nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+var (
+	// ErrSetupComplete is returned once an admin exists, which disables the bootstrap for good
+	ErrSetupComplete = errors.New("setup has already been completed")
+	// ErrInvalidSetupToken is returned for a missing or wrong setup token
+	ErrInvalidSetupToken = errors.New("invalid setup token")
+	// ErrSetupUserNotFound is returned when no active user has the email to promote
+	ErrSetupUserNotFound = errors.New("no active user with this email")
+)
+
+// SetupService bootstraps the first admin. Promotion needs a one-time setup token that only
+// the operator can know: configured with SETUP_TOKEN or SETUP_TOKEN_FILE, or else generated
+// and written to the log at startup. A generated token is known to the replica that logged it
+// only, so deployments with more than one replica must configure the token.
+type SetupService struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewSetupService creates a new setup service. token and tokenFile are the configured setup token
+// and a file to read it from; if both are empty and no admin exists yet, a token is generated and logged.
+func NewSetupService(db *sql.DB, token, tokenFile string) (*SetupService, error) {
+	ss := &SetupService{db: db}
+
+	required, err := ss.Required()
+	if err != nil {
+		return nil, err
+	}
+	if !required {
+		return ss, nil
+	}
+
+	var generated bool
+	ss.token, generated, err = resolveSetupToken(token, tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	if generated {
+		log.Printf("🔑 No admin exists yet. Promote the first admin with this one-time setup token: %s", ss.token)
+		log.Printf("⚠️  The generated setup token only works on this replica; set SETUP_TOKEN or SETUP_TOKEN_FILE when running more than one")
+	}
+
+	return ss, nil
+}
+
+// resolveSetupToken returns the configured setup token, read from tokenFile if token is empty, or a
+// generated one if neither is set, and whether it was generated
+func resolveSetupToken(token, tokenFile string) (string, bool, error) {
+	switch {
+	case token != "":
+		return token, false, nil
+	case tokenFile != "":
+		contents, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to read setup token file: %w", err)
+		}
+		token = strings.TrimSpace(string(contents))
+		if token == "" {
+			return "", false, errors.New("setup token is empty")
+		}
+		return token, false, nil
+	default:
+		token, err := generateSecureToken(32)
+		if err != nil {
+			return "", false, err
+		}
+		return token, true, nil
+	}
+}
+
+// Required reports whether the system still needs its first admin
+func (ss *SetupService) Required() (bool, error) {
+	query := `
+		SELECT NOT EXISTS (
+			SELECT 1 FROM user_roles ur JOIN roles r ON ur.role_id = r.id WHERE r.name = 'admin'
+		)
+	`
+
+	var required bool
+	if err := ss.db.QueryRow(query).Scan(&required); err != nil {
+		return false, fmt.Errorf("failed to check for an admin: %w", err)
+	}
+
+	return required, nil
+}
+
+// Bootstrap grants the admin role to the active user with the given email if token is the setup
+// token and no admin exists yet, and returns the user and the ID of the admin role. The token can
+// only be used once.
+func (ss *SetupService) Bootstrap(token, email string) (*models.User, int, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.token == "" {
+		return nil, 0, ErrSetupComplete
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(ss.token)) != 1 {
+		return nil, 0, ErrInvalidSetupToken
+	}
+
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the admin role so concurrent bootstraps, on any replica, can not both succeed
+	var adminRoleID int
+	if err := tx.QueryRow(`SELECT id FROM roles WHERE name = 'admin' FOR UPDATE`).Scan(&adminRoleID); err != nil {
+		return nil, 0, fmt.Errorf("failed to get admin role: %w", err)
+	}
+
+	var hasAdmin bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM user_roles WHERE role_id = $1)`, adminRoleID).Scan(&hasAdmin); err != nil {
+		return nil, 0, fmt.Errorf("failed to check for an admin: %w", err)
+	}
+	if hasAdmin {
+		ss.token = ""
+		return nil, 0, ErrSetupComplete
+	}
+
+	user := &models.User{}
+	err = tx.QueryRow(`
+		SELECT id, email, name, picture, COALESCE(google_id, ''), is_active, last_login_at, created_at, updated_at
+		FROM users
+		WHERE LOWER(email) = LOWER($1) AND is_active = true
+	`, strings.TrimSpace(email)).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Name,
+		&user.Picture,
+		&user.GoogleID,
+		&user.IsActive,
+		&user.LastLoginAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, 0, ErrSetupUserNotFound
+		}
+		return nil, 0, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// The first admin assigns the role to themselves
+	if _, err := tx.Exec(`INSERT INTO user_roles (user_id, role_id, assigned_by) VALUES ($1, $2, $1)`, user.ID, adminRoleID); err != nil {
+		return nil, 0, fmt.Errorf("failed to assign admin role: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, fmt.Errorf("failed to commit admin bootstrap: %w", err)
+	}
+
+	ss.token = ""
+	return user, adminRoleID, nil
+}
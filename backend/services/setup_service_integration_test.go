@@ -0,0 +1,74 @@
+//go:build integration
+
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetupBootstrapIsOneShot(t *testing.T) {
+	db := openTestDB(t)
+
+	// Bootstrapping needs a database without admins
+	if _, err := db.Exec(`DELETE FROM user_roles WHERE role_id = (SELECT id FROM roles WHERE name = 'admin')`); err != nil {
+		t.Fatal(err)
+	}
+
+	ss, err := NewSetupService(db, "setup-token", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if required, err := ss.Required(); err != nil || !required {
+		t.Fatalf("Expected setup to be required, got %v, %v", required, err)
+	}
+
+	userID := createTestUser(t, db)
+	var email string
+	if err := db.QueryRow(`SELECT email FROM users WHERE id = $1`, userID).Scan(&email); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := ss.Bootstrap("setup-token", "nobody@example.com"); !errors.Is(err, ErrSetupUserNotFound) {
+		t.Fatalf("Expected ErrSetupUserNotFound, got %v", err)
+	}
+
+	// An unknown email does not use up the token
+	user, roleID, err := ss.Bootstrap("setup-token", email)
+	if err != nil {
+		t.Fatalf("Expected the bootstrap to succeed, got %v", err)
+	}
+	if user.ID != userID {
+		t.Errorf("Expected user %d to be promoted, got %d", userID, user.ID)
+	}
+
+	var assignedBy int
+	if err := db.QueryRow(`SELECT assigned_by FROM user_roles WHERE user_id = $1 AND role_id = $2`, userID, roleID).Scan(&assignedBy); err != nil {
+		t.Fatalf("Expected the admin role to be assigned: %v", err)
+	}
+	if assignedBy != userID {
+		t.Errorf("Expected the first admin to assign the role to themselves, got %d", assignedBy)
+	}
+
+	if _, _, err := ss.Bootstrap("setup-token", email); !errors.Is(err, ErrSetupComplete) {
+		t.Errorf("Expected the token to work once, got %v", err)
+	}
+	if required, err := ss.Required(); err != nil || required {
+		t.Errorf("Expected setup to be complete, got %v, %v", required, err)
+	}
+
+	// A replica started before the bootstrap still holds its token, but the admin now exists
+	other := &SetupService{db: db, token: "setup-token"}
+	if _, _, err := other.Bootstrap("setup-token", email); !errors.Is(err, ErrSetupComplete) {
+		t.Errorf("Expected ErrSetupComplete on another replica, got %v", err)
+	}
+
+	// Once an admin exists no token is loaded at all
+	later, err := NewSetupService(db, "setup-token", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := later.Bootstrap("setup-token", email); !errors.Is(err, ErrSetupComplete) {
+		t.Errorf("Expected ErrSetupComplete after a restart, got %v", err)
+	}
+}
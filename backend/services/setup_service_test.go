@@ -0,0 +1,57 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSetupToken(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "setup_token")
+	if err := os.WriteFile(tokenFile, []byte("  file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if token, generated, err := resolveSetupToken("env-token", tokenFile); err != nil || token != "env-token" || generated {
+		t.Errorf("Expected SETUP_TOKEN to win over the file, got %q, %v, %v", token, generated, err)
+	}
+	if token, generated, err := resolveSetupToken("", tokenFile); err != nil || token != "file-token" || generated {
+		t.Errorf("Expected the trimmed token of the file, got %q, %v, %v", token, generated, err)
+	}
+	if _, _, err := resolveSetupToken("", emptyFile); err == nil {
+		t.Error("Expected an error for an empty token file")
+	}
+	if _, _, err := resolveSetupToken("", filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing token file")
+	}
+
+	first, generated, err := resolveSetupToken("", "")
+	if err != nil || first == "" || !generated {
+		t.Fatalf("Expected a generated token, got %q, %v, %v", first, generated, err)
+	}
+	if second, _, _ := resolveSetupToken("", ""); second == first {
+		t.Error("Expected generated tokens to differ")
+	}
+}
+
+func TestBootstrapChecksTokenFirst(t *testing.T) {
+	// Without a database, these only pass if the token is checked before any query
+	ss := &SetupService{token: "setup-token"}
+	if _, _, err := ss.Bootstrap("wrong-token", "admin@example.com"); !errors.Is(err, ErrInvalidSetupToken) {
+		t.Errorf("Expected ErrInvalidSetupToken, got %v", err)
+	}
+	if _, _, err := ss.Bootstrap("", "admin@example.com"); !errors.Is(err, ErrInvalidSetupToken) {
+		t.Errorf("Expected ErrInvalidSetupToken for an empty token, got %v", err)
+	}
+
+	used := &SetupService{}
+	if _, _, err := used.Bootstrap("", "admin@example.com"); !errors.Is(err, ErrSetupComplete) {
+		t.Errorf("Expected ErrSetupComplete once the token is used, got %v", err)
+	}
+}
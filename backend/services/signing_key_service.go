@@ -0,0 +1,552 @@
+package services
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported asymmetric signing algorithms
+const (
+	SigningAlgorithmRS256 = "RS256"
+	SigningAlgorithmEdDSA = "EdDSA"
+)
+
+// signingKeysLockID is the Postgres advisory lock that serializes key rotation across replicas
+const signingKeysLockID = 727_001
+
+// encryptedSigningKeyPrefix marks private keys stored encrypted; keys stored before encryption hold plain PEM
+const encryptedSigningKeyPrefix = "enc:v1:"
+
+// ErrUnknownSigningKey is returned when a token references a kid that is not (or no longer) published
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// signingKey is a single asymmetric key pair identified by its kid
+type signingKey struct {
+	kid         string
+	algorithm   string
+	privateKey  crypto.Signer
+	publicKey   crypto.PublicKey
+	activatesAt time.Time
+	retiresAt   time.Time
+	expiresAt   time.Time
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// SigningKeyService manages the asymmetric keys used to sign access tokens.
+// Keys live in Postgres so every replica signs with the same key, and are
+// rotated on a schedule: the next key is published one overlap window before
+// it starts signing, and a retired key stays published for one overlap window
+// after it stops signing. Private keys are stored encrypted, so reading the
+// database is not enough to forge tokens.
+type SigningKeyService struct {
+	db               *sql.DB
+	algorithm        string
+	rotationInterval time.Duration
+	overlap          time.Duration
+	cipher           cipher.AEAD
+
+	mu   sync.RWMutex
+	keys map[string]*signingKey
+}
+
+// NewSigningKeyService creates a new signing key service and makes sure a signing key exists.
+// overlap must be at least as long as the access token lifetime. The private keys are
+// encrypted with a key derived from encryptionSecret.
+func NewSigningKeyService(db *sql.DB, algorithm string, rotationInterval, overlap time.Duration, encryptionSecret string) (*SigningKeyService, error) {
+	if algorithm != SigningAlgorithmRS256 && algorithm != SigningAlgorithmEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+
+	keyCipher, err := newSigningKeyCipher(encryptionSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &SigningKeyService{
+		db:               db,
+		algorithm:        algorithm,
+		rotationInterval: rotationInterval,
+		overlap:          overlap,
+		cipher:           keyCipher,
+		keys:             make(map[string]*signingKey),
+	}
+
+	if err := ks.rotate(); err != nil {
+		return nil, err
+	}
+
+	go ks.rotatePeriodically(time.Minute)
+
+	return ks, nil
+}
+
+// currentKey returns the key that currently signs new tokens
+func (ks *SigningKeyService) currentKey() (*signingKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	now := time.Now()
+	var current *signingKey
+	for _, key := range ks.keys {
+		if key.activatesAt.After(now) || !key.retiresAt.After(now) {
+			continue
+		}
+		if current == nil || key.activatesAt.After(current.activatesAt) {
+			current = key
+		}
+	}
+
+	if current == nil {
+		return nil, errors.New("no active signing key")
+	}
+
+	return current, nil
+}
+
+// Sign signs the given claims with the current key and sets the kid header
+func (ks *SigningKeyService) Sign(claims jwt.Claims) (string, error) {
+	key, err := ks.currentKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.algorithm), claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.privateKey)
+}
+
+// VerificationKey returns the public key for a kid, checking that it matches the token's algorithm
+func (ks *SigningKeyService) VerificationKey(kid, algorithm string) (crypto.PublicKey, error) {
+	ks.mu.RLock()
+	key, ok := ks.keys[kid]
+	ks.mu.RUnlock()
+
+	if !ok || !key.expiresAt.After(time.Now()) {
+		return nil, ErrUnknownSigningKey
+	}
+
+	if key.algorithm != algorithm {
+		return nil, fmt.Errorf("signing key %s does not use %s", kid, algorithm)
+	}
+
+	return key.publicKey, nil
+}
+
+// JWKS returns the public keys that tokens may currently be signed or verified with
+func (ks *SigningKeyService) JWKS() *JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]*signingKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		if key.expiresAt.After(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].activatesAt.Before(keys[j].activatesAt) })
+
+	jwks := &JWKS{Keys: make([]JWK, 0, len(keys))}
+	for _, key := range keys {
+		if jwk, ok := publicKeyJWK(key.kid, key.algorithm, key.publicKey); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+
+	return jwks
+}
+
+// rotatePeriodically checks on an interval whether a new key is due and reloads keys created by other replicas
+func (ks *SigningKeyService) rotatePeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := ks.rotate(); err != nil {
+			log.Printf("Warning: Failed to rotate signing keys: %v", err)
+		}
+	}
+}
+
+// rotate creates the next signing key once the newest one is within the
+// overlap window of retiring, then reloads all published keys
+func (ks *SigningKeyService) rotate() error {
+	tx, err := ks.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, signingKeysLockID); err != nil {
+		return fmt.Errorf("failed to lock signing keys: %w", err)
+	}
+
+	if err := ks.encryptStoredKeys(tx); err != nil {
+		return err
+	}
+
+	var latestRetiresAt sql.NullTime
+	if err := tx.QueryRow(`SELECT MAX(retires_at) FROM signing_keys`).Scan(&latestRetiresAt); err != nil {
+		return fmt.Errorf("failed to query signing keys: %w", err)
+	}
+
+	now := time.Now()
+	switch {
+	case !latestRetiresAt.Valid || !latestRetiresAt.Time.After(now):
+		// No usable key at all, start signing immediately
+		if err := ks.createKey(tx, now); err != nil {
+			return err
+		}
+	case latestRetiresAt.Time.Sub(now) <= ks.overlap:
+		// Publish the successor ahead of time so verifiers can fetch it before it is used
+		if err := ks.createKey(tx, latestRetiresAt.Time); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM signing_keys WHERE expires_at < $1`, now); err != nil {
+		return fmt.Errorf("failed to delete expired signing keys: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit signing key rotation: %w", err)
+	}
+
+	return ks.load()
+}
+
+// createKey generates a new key pair that starts signing at activatesAt
+func (ks *SigningKeyService) createKey(tx *sql.Tx, activatesAt time.Time) error {
+	kid, err := generateRandomID(8)
+	if err != nil {
+		return err
+	}
+
+	privateKey, err := generateSigningKeyPair(ks.algorithm)
+	if err != nil {
+		return err
+	}
+
+	privatePEM, publicPEM, err := encodeSigningKeyPair(privateKey)
+	if err != nil {
+		return err
+	}
+
+	sealedPrivateKey, err := sealSigningKey(ks.cipher, kid, privatePEM)
+	if err != nil {
+		return err
+	}
+
+	retiresAt := activatesAt.Add(ks.rotationInterval)
+	expiresAt := retiresAt.Add(ks.overlap)
+
+	query := `
+		INSERT INTO signing_keys (kid, algorithm, private_key, public_key, activates_at, retires_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	if _, err := tx.Exec(query, kid, ks.algorithm, sealedPrivateKey, publicPEM, activatesAt, retiresAt, expiresAt); err != nil {
+		return fmt.Errorf("failed to store signing key: %w", err)
+	}
+
+	log.Printf("🔑 Created %s signing key %s (active from %s)", ks.algorithm, kid, activatesAt.Format(time.RFC3339))
+	return nil
+}
+
+// encryptStoredKeys encrypts private keys stored in plain PEM before keys were encrypted
+func (ks *SigningKeyService) encryptStoredKeys(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT kid, private_key FROM signing_keys WHERE private_key NOT LIKE $1`, encryptedSigningKeyPrefix+"%")
+	if err != nil {
+		return fmt.Errorf("failed to query unencrypted signing keys: %w", err)
+	}
+
+	plainKeys := make(map[string]string)
+	for rows.Next() {
+		var kid, privatePEM string
+		if err := rows.Scan(&kid, &privatePEM); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan signing key: %w", err)
+		}
+		plainKeys[kid] = privatePEM
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read unencrypted signing keys: %w", err)
+	}
+
+	for kid, privatePEM := range plainKeys {
+		sealed, err := sealSigningKey(ks.cipher, kid, privatePEM)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE signing_keys SET private_key = $1 WHERE kid = $2`, sealed, kid); err != nil {
+			return fmt.Errorf("failed to encrypt signing key %s: %w", kid, err)
+		}
+		log.Printf("🔑 Encrypted stored signing key %s", kid)
+	}
+
+	return nil
+}
+
+// load replaces the in-memory key set with all unexpired keys from the database
+func (ks *SigningKeyService) load() error {
+	query := `
+		SELECT kid, algorithm, private_key, activates_at, retires_at, expires_at
+		FROM signing_keys
+		WHERE expires_at > $1
+	`
+
+	rows, err := ks.db.Query(query, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to query signing keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make(map[string]*signingKey)
+	for rows.Next() {
+		key := &signingKey{}
+		var sealedPrivateKey string
+		if err := rows.Scan(&key.kid, &key.algorithm, &sealedPrivateKey, &key.activatesAt, &key.retiresAt, &key.expiresAt); err != nil {
+			return fmt.Errorf("failed to scan signing key: %w", err)
+		}
+
+		privatePEM, err := openSigningKey(ks.cipher, key.kid, sealedPrivateKey)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt signing key %s: %w", key.kid, err)
+		}
+
+		key.privateKey, err = decodeSigningKey(privatePEM)
+		if err != nil {
+			return fmt.Errorf("failed to decode signing key %s: %w", key.kid, err)
+		}
+		key.publicKey = key.privateKey.Public()
+
+		keys[key.kid] = key
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read signing keys: %w", err)
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+
+	return nil
+}
+
+// generateSigningKeyPair creates a private key for the given algorithm
+func generateSigningKeyPair(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case SigningAlgorithmRS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate RSA key: %w", err)
+		}
+		return key, nil
+	case SigningAlgorithmEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate Ed25519 key: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+}
+
+// encodeSigningKeyPair PEM encodes a private key (PKCS#8) and its public key (PKIX)
+func encodeSigningKeyPair(privateKey crypto.Signer) (string, string, error) {
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	return string(privatePEM), string(publicPEM), nil
+}
+
+// decodeSigningKey parses a PEM encoded PKCS#8 private key
+func decodeSigningKey(privatePEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(privatePEM))
+	if block == nil {
+		return nil, errors.New("invalid PEM data")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("key cannot be used for signing")
+	}
+
+	return signer, nil
+}
+
+// newSigningKeyCipher derives the AES-256-GCM cipher private signing keys are encrypted with from a secret
+func newSigningKeyCipher(secret string) (cipher.AEAD, error) {
+	if secret == "" {
+		return nil, errors.New("a secret to encrypt signing keys with is required")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("signing-keys"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signing key cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealSigningKey encrypts a PEM encoded private key for storage. The kid is authenticated
+// with it, so an encrypted key can not be moved to another row.
+func sealSigningKey(aead cipher.AEAD, kid, privatePEM string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(privatePEM), []byte(kid))
+	return encryptedSigningKeyPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// openSigningKey decrypts a private key stored by sealSigningKey
+func openSigningKey(aead cipher.AEAD, kid, stored string) (string, error) {
+	encoded, ok := strings.CutPrefix(stored, encryptedSigningKeyPrefix)
+	if !ok {
+		return "", errors.New("private key is not encrypted")
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("invalid encrypted private key")
+	}
+
+	privatePEM, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(kid))
+	if err != nil {
+		return "", errors.New("cannot decrypt private key, the encryption secret may have changed")
+	}
+
+	return string(privatePEM), nil
+}
+
+// publicKeyJWK encodes a public key as a JSON Web Key. It returns false for key types JWKs do not cover.
+func publicKeyJWK(kid, algorithm string, publicKey crypto.PublicKey) (JWK, bool) {
+	jwk := JWK{Kid: kid, Use: "sig", Alg: algorithm}
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		// Coordinates are padded to the size of the curve (RFC 7518 section 6.2.1.2)
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// parseJWK converts a JSON Web Key into a public key
+func parseJWK(jwk JWK) (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+	}
+}
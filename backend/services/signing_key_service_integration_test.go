@@ -0,0 +1,51 @@
+//go:build integration
+
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigningKeysAreEncryptedAtRest(t *testing.T) {
+	db := openTestDB(t)
+
+	// A key stored before keys were encrypted
+	key, _ := generateSigningKeyPair(SigningAlgorithmEdDSA)
+	privatePEM, publicPEM, err := encodeSigningKeyPair(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := generateRandomID(8)
+	now := time.Now()
+	if _, err := db.Exec(
+		`INSERT INTO signing_keys (kid, algorithm, private_key, public_key, activates_at, retires_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		kid, SigningAlgorithmEdDSA, privatePEM, publicPEM, now.Add(-time.Hour), now.Add(-time.Minute), now.Add(time.Hour),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := NewSigningKeyService(db, SigningAlgorithmEdDSA, 30*24*time.Hour, time.Hour, "test-secret")
+	if err != nil {
+		t.Fatalf("NewSigningKeyService failed: %v", err)
+	}
+	if _, err := ks.VerificationKey(kid, SigningAlgorithmEdDSA); err != nil {
+		t.Errorf("Expected the plain key to stay usable, got %v", err)
+	}
+
+	rows, err := db.Query(`SELECT kid, private_key FROM signing_keys`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var storedKid, stored string
+		if err := rows.Scan(&storedKid, &stored); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(stored, encryptedSigningKeyPrefix) {
+			t.Errorf("Expected signing key %s to be stored encrypted", storedKid)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestSigningKey returns a key pair signing between activatesAt and retiresAt and published until expiresAt
+func newTestSigningKey(t *testing.T, kid, algorithm string, activatesAt, retiresAt, expiresAt time.Time) *signingKey {
+	t.Helper()
+
+	privateKey, err := generateSigningKeyPair(algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &signingKey{
+		kid:         kid,
+		algorithm:   algorithm,
+		privateKey:  privateKey,
+		publicKey:   privateKey.Public(),
+		activatesAt: activatesAt,
+		retiresAt:   retiresAt,
+		expiresAt:   expiresAt,
+	}
+}
+
+func TestPublicKeyJWKRoundTrip(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]crypto.Signer{"EC": ecKey}
+	for _, algorithm := range []string{SigningAlgorithmRS256, SigningAlgorithmEdDSA} {
+		key, err := generateSigningKeyPair(algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[algorithm] = key
+	}
+
+	for name, key := range keys {
+		jwk, ok := publicKeyJWK("kid-1", name, key.Public())
+		if !ok {
+			t.Fatalf("%s: expected the key to be encoded", name)
+		}
+		if jwk.Kid != "kid-1" || jwk.Use != "sig" || jwk.Alg != name {
+			t.Errorf("%s: unexpected JWK metadata %+v", name, jwk)
+		}
+
+		parsed, err := parseJWK(jwk)
+		if err != nil {
+			t.Fatalf("%s: failed to parse encoded JWK: %v", name, err)
+		}
+		if !key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(parsed) {
+			t.Errorf("%s: expected the parsed key to equal the encoded one", name)
+		}
+	}
+
+	rsaJWK, _ := publicKeyJWK("kid", SigningAlgorithmRS256, keys[SigningAlgorithmRS256].Public())
+	if rsaJWK.Kty != "RSA" || rsaJWK.E != "AQAB" || rsaJWK.Crv != "" {
+		t.Errorf("Unexpected RSA JWK %+v", rsaJWK)
+	}
+	edJWK, _ := publicKeyJWK("kid", SigningAlgorithmEdDSA, keys[SigningAlgorithmEdDSA].Public())
+	if edJWK.Kty != "OKP" || edJWK.Crv != "Ed25519" || edJWK.N != "" || edJWK.Y != "" {
+		t.Errorf("Unexpected Ed25519 JWK %+v", edJWK)
+	}
+	ecJWK, _ := publicKeyJWK("kid", "ES256", ecKey.Public())
+	if ecJWK.Kty != "EC" || ecJWK.Crv != "P-256" || len(ecJWK.X) != 43 || len(ecJWK.Y) != 43 {
+		t.Errorf("Expected padded P-256 coordinates, got %+v", ecJWK)
+	}
+
+	if _, ok := publicKeyJWK("kid", "HS256", []byte("secret")); ok {
+		t.Error("Expected a symmetric key not to be encoded")
+	}
+}
+
+func TestSigningKeyWindows(t *testing.T) {
+	now := time.Now()
+	hour := time.Hour
+	ks := &SigningKeyService{keys: map[string]*signingKey{
+		"expired": newTestSigningKey(t, "expired", SigningAlgorithmEdDSA, now.Add(-3*hour), now.Add(-2*hour), now.Add(-hour)),
+		"retired": newTestSigningKey(t, "retired", SigningAlgorithmEdDSA, now.Add(-2*hour), now.Add(-hour), now.Add(hour)),
+		"current": newTestSigningKey(t, "current", SigningAlgorithmEdDSA, now.Add(-hour), now.Add(hour), now.Add(2*hour)),
+		"next":    newTestSigningKey(t, "next", SigningAlgorithmEdDSA, now.Add(hour), now.Add(2*hour), now.Add(3*hour)),
+	}}
+
+	current, err := ks.currentKey()
+	if err != nil || current.kid != "current" {
+		t.Fatalf("Expected the active key to sign, got %v, %v", current, err)
+	}
+
+	token, err := ks.Sign(jwt.RegisteredClaims{Subject: "1"})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return ks.VerificationKey(token.Header["kid"].(string), token.Method.Alg())
+	})
+	if err != nil || parsed.Header["kid"] != "current" {
+		t.Errorf("Expected the token to verify with the current kid, got %v", err)
+	}
+
+	for _, kid := range []string{"retired", "current", "next"} {
+		if _, err := ks.VerificationKey(kid, SigningAlgorithmEdDSA); err != nil {
+			t.Errorf("Expected %s to verify tokens, got %v", kid, err)
+		}
+	}
+	if _, err := ks.VerificationKey("expired", SigningAlgorithmEdDSA); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("Expected an expired key to be unknown, got %v", err)
+	}
+	if _, err := ks.VerificationKey("missing", SigningAlgorithmEdDSA); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("Expected a missing key to be unknown, got %v", err)
+	}
+	if _, err := ks.VerificationKey("current", SigningAlgorithmRS256); err == nil {
+		t.Error("Expected a key to refuse another algorithm")
+	}
+
+	var kids []string
+	for _, jwk := range ks.JWKS().Keys {
+		kids = append(kids, jwk.Kid)
+	}
+	if strings.Join(kids, ",") != "retired,current,next" {
+		t.Errorf("Expected the unexpired keys in activation order, got %v", kids)
+	}
+
+	// Once the current key retires, its successor takes over
+	ks.keys["current"].retiresAt = now.Add(-time.Minute)
+	ks.keys["next"].activatesAt = now.Add(-time.Minute)
+	if current, err := ks.currentKey(); err != nil || current.kid != "next" {
+		t.Errorf("Expected the successor to sign, got %v, %v", current, err)
+	}
+
+	delete(ks.keys, "next")
+	if _, err := ks.currentKey(); err == nil {
+		t.Error("Expected an error without an active key")
+	}
+}
+
+func TestSigningKeyEncryption(t *testing.T) {
+	aead, err := newSigningKeyCipher("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := generateSigningKeyPair(SigningAlgorithmEdDSA)
+	privatePEM, _, err := encodeSigningKeyPair(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := sealSigningKey(aead, "kid-1", privatePEM)
+	if err != nil {
+		t.Fatalf("sealSigningKey failed: %v", err)
+	}
+	if !strings.HasPrefix(sealed, encryptedSigningKeyPrefix) || strings.Contains(sealed, "PRIVATE KEY") {
+		t.Fatalf("Expected an encrypted key, got %q", sealed)
+	}
+	if again, _ := sealSigningKey(aead, "kid-1", privatePEM); again == sealed {
+		t.Error("Expected every encryption to use a fresh nonce")
+	}
+
+	opened, err := openSigningKey(aead, "kid-1", sealed)
+	if err != nil || opened != privatePEM {
+		t.Fatalf("Expected the key to decrypt, got %v", err)
+	}
+
+	if _, err := openSigningKey(aead, "kid-2", sealed); err == nil {
+		t.Error("Expected a key moved to another kid not to decrypt")
+	}
+	other, _ := newSigningKeyCipher("other secret")
+	if _, err := openSigningKey(other, "kid-1", sealed); err == nil {
+		t.Error("Expected a key not to decrypt with another secret")
+	}
+	if _, err := openSigningKey(aead, "kid-1", privatePEM); err == nil {
+		t.Error("Expected a plain PEM key to be refused")
+	}
+	if _, err := openSigningKey(aead, "kid-1", sealed[:len(sealed)-4]); err == nil {
+		t.Error("Expected a truncated key not to decrypt")
+	}
+	if _, err := newSigningKeyCipher(""); err == nil {
+		t.Error("Expected an empty secret to be refused")
+	}
+}
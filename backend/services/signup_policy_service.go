@@ -0,0 +1,258 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/config"
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+// Reasons reported for sign-up decisions
+const (
+	SignupReasonOpen             = "open_signup"
+	SignupReasonInvited          = "invited"
+	SignupReasonPendingApproval  = "pending_approval"
+	SignupReasonFirstUser        = "no_admin_yet"
+	SignupReasonEmailMissing     = "email_missing"
+	SignupReasonEmailNotVerified = "email_not_verified"
+	SignupReasonDomainNotAllowed = "domain_not_allowed"
+	SignupReasonInviteRequired   = "invitation_required"
+)
+
+// ErrInvitationNotFound is returned when an invitation does not exist or was already used
+var ErrInvitationNotFound = errors.New("invitation not found")
+
+// SignupDecision is the outcome of evaluating the sign-up policy for a first-time login
+type SignupDecision struct {
+	Allowed         bool
+	PendingApproval bool
+	Reason          string
+	Invitation      *models.SignupInvitation
+}
+
+// SignupPolicyService decides whether a login with an unknown identity may create an account
+type SignupPolicyService struct {
+	db     *sql.DB
+	policy config.SignupPolicyConfig
+}
+
+// NewSignupPolicyService creates a new sign-up policy service
+func NewSignupPolicyService(db *sql.DB, policy config.SignupPolicyConfig) *SignupPolicyService {
+	for i, domain := range policy.AllowedDomains {
+		policy.AllowedDomains[i] = strings.ToLower(strings.TrimPrefix(domain, "@"))
+	}
+
+	return &SignupPolicyService{
+		db:     db,
+		policy: policy,
+	}
+}
+
+// Evaluate applies the sign-up policy to an identity that does not belong to any user yet.
+// Rules are checked in order: verified email, invitation, allowed domains, invite-only, admin approval.
+func (sp *SignupPolicyService) Evaluate(identity *models.ExternalIdentity) (*SignupDecision, error) {
+	return evaluateSignupPolicy(sp.policy, identity, sp.openInvitation, sp.hasAdmin)
+}
+
+// evaluateSignupPolicy applies a sign-up policy with normalized allowed domains to an identity.
+// The invitation and admin lookups are only made when a rule depends on them.
+func evaluateSignupPolicy(policy config.SignupPolicyConfig, identity *models.ExternalIdentity, openInvitation func(email string) (*models.SignupInvitation, error), hasAdmin func() (bool, error)) (*SignupDecision, error) {
+	emailRules := policy.RequireVerifiedEmail || len(policy.AllowedDomains) > 0 || policy.InviteOnly
+	if emailRules && identity.Email == "" {
+		return &SignupDecision{Reason: SignupReasonEmailMissing}, nil
+	}
+
+	// Domain and invitation checks are only meaningful for an address the provider vouches for
+	if policy.RequireVerifiedEmail && !identity.EmailVerified {
+		return &SignupDecision{Reason: SignupReasonEmailNotVerified}, nil
+	}
+
+	var invitation *models.SignupInvitation
+	if identity.EmailVerified {
+		var err error
+		invitation, err = openInvitation(identity.Email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// An invitation is an explicit decision by an admin and overrides the other rules
+	if invitation != nil {
+		return &SignupDecision{Allowed: true, Reason: SignupReasonInvited, Invitation: invitation}, nil
+	}
+
+	if len(policy.AllowedDomains) > 0 && !emailDomainAllowed(identity.Email, policy.AllowedDomains) {
+		return &SignupDecision{Reason: SignupReasonDomainNotAllowed}, nil
+	}
+
+	if policy.InviteOnly {
+		return &SignupDecision{Reason: SignupReasonInviteRequired}, nil
+	}
+
+	if policy.RequireApproval {
+		// Without an admin nobody could approve anyone, so the first users are let in
+		adminExists, err := hasAdmin()
+		if err != nil {
+			return nil, err
+		}
+		if !adminExists {
+			return &SignupDecision{Allowed: true, Reason: SignupReasonFirstUser}, nil
+		}
+
+		return &SignupDecision{Allowed: true, PendingApproval: true, Reason: SignupReasonPendingApproval}, nil
+	}
+
+	return &SignupDecision{Allowed: true, Reason: SignupReasonOpen}, nil
+}
+
+// AcceptInvitation marks an invitation as used by the user it created
+func (sp *SignupPolicyService) AcceptInvitation(invitationID, userID int) error {
+	query := `UPDATE signup_invitations SET accepted_at = $1, accepted_by = $2 WHERE id = $3 AND accepted_at IS NULL`
+
+	if _, err := sp.db.Exec(query, time.Now(), userID, invitationID); err != nil {
+		return fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	return nil
+}
+
+// CreateInvitation invites an email address to sign up
+func (sp *SignupPolicyService) CreateInvitation(email string, invitedBy int) (*models.SignupInvitation, error) {
+	query := `
+		INSERT INTO signup_invitations (email, invited_by, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, email, invited_by, expires_at, accepted_at, accepted_by, created_at
+	`
+
+	invitation := &models.SignupInvitation{}
+	err := sp.db.QueryRow(query, strings.TrimSpace(email), invitedBy, time.Now().Add(sp.policy.InvitationTTL)).Scan(
+		&invitation.ID,
+		&invitation.Email,
+		&invitation.InvitedBy,
+		&invitation.ExpiresAt,
+		&invitation.AcceptedAt,
+		&invitation.AcceptedBy,
+		&invitation.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// GetInvitations lists all invitations, newest first
+func (sp *SignupPolicyService) GetInvitations() ([]models.SignupInvitation, error) {
+	query := `
+		SELECT id, email, invited_by, expires_at, accepted_at, accepted_by, created_at
+		FROM signup_invitations
+		ORDER BY created_at DESC
+	`
+
+	rows, err := sp.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations []models.SignupInvitation
+	for rows.Next() {
+		var invitation models.SignupInvitation
+		err := rows.Scan(&invitation.ID, &invitation.Email, &invitation.InvitedBy, &invitation.ExpiresAt, &invitation.AcceptedAt, &invitation.AcceptedBy, &invitation.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	return invitations, rows.Err()
+}
+
+// RevokeInvitation deletes an invitation that has not been used yet
+func (sp *SignupPolicyService) RevokeInvitation(invitationID int) error {
+	result, err := sp.db.Exec(`DELETE FROM signup_invitations WHERE id = $1 AND accepted_at IS NULL`, invitationID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+
+	return nil
+}
+
+// emailDomainAllowed reports whether an email address belongs to one of the allowed (lowercase) domains
+func emailDomainAllowed(email string, allowedDomains []string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range allowedDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// openInvitation returns the newest unused, unexpired invitation for an email address
+func (sp *SignupPolicyService) openInvitation(email string) (*models.SignupInvitation, error) {
+	query := `
+		SELECT id, email, invited_by, expires_at, accepted_at, accepted_by, created_at
+		FROM signup_invitations
+		WHERE LOWER(email) = LOWER($1) AND accepted_at IS NULL AND expires_at > $2
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	invitation := &models.SignupInvitation{}
+	err := sp.db.QueryRow(query, email, time.Now()).Scan(
+		&invitation.ID,
+		&invitation.Email,
+		&invitation.InvitedBy,
+		&invitation.ExpiresAt,
+		&invitation.AcceptedAt,
+		&invitation.AcceptedBy,
+		&invitation.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to look up invitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// hasAdmin reports whether any active user holds the admin role
+func (sp *SignupPolicyService) hasAdmin() (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM user_roles ur
+			JOIN roles r ON r.id = ur.role_id
+			JOIN users u ON u.id = ur.user_id
+			WHERE r.name = 'admin' AND u.is_active = true
+		)
+	`
+
+	var exists bool
+	if err := sp.db.QueryRow(query).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check for admins: %w", err)
+	}
+
+	return exists, nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/frallan97/hackaton-demo-backend/config"
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+func TestEvaluateSignupPolicy(t *testing.T) {
+	invited := &models.SignupInvitation{ID: 3, Email: "guest@partner.com"}
+	openInvitation := func(email string) (*models.SignupInvitation, error) {
+		if email == invited.Email {
+			return invited, nil
+		}
+		return nil, nil
+	}
+
+	verified := &models.ExternalIdentity{Email: "alice@Example.com", EmailVerified: true}
+	unverified := &models.ExternalIdentity{Email: "alice@example.com"}
+	noEmail := &models.ExternalIdentity{}
+	guest := &models.ExternalIdentity{Email: "guest@partner.com", EmailVerified: true}
+	unverifiedGuest := &models.ExternalIdentity{Email: "guest@partner.com"}
+	outsider := &models.ExternalIdentity{Email: "mallory@evil.com", EmailVerified: true}
+
+	open := config.SignupPolicyConfig{}
+	verifiedOnly := config.SignupPolicyConfig{RequireVerifiedEmail: true}
+	domains := config.SignupPolicyConfig{RequireVerifiedEmail: true, AllowedDomains: []string{"example.com"}}
+	inviteOnly := config.SignupPolicyConfig{InviteOnly: true}
+	approval := config.SignupPolicyConfig{RequireApproval: true}
+
+	cases := []struct {
+		name     string
+		policy   config.SignupPolicyConfig
+		identity *models.ExternalIdentity
+		hasAdmin bool
+		allowed  bool
+		pending  bool
+		reason   string
+	}{
+		{"open sign-up", open, unverified, true, true, false, SignupReasonOpen},
+		{"open sign-up without email", open, noEmail, true, true, false, SignupReasonOpen},
+		{"verified email required", verifiedOnly, unverified, true, false, false, SignupReasonEmailNotVerified},
+		{"verified email", verifiedOnly, verified, true, true, false, SignupReasonOpen},
+		{"email required by rules", verifiedOnly, noEmail, true, false, false, SignupReasonEmailMissing},
+		{"allowed domain, any case", domains, verified, true, true, false, SignupReasonOpen},
+		{"other domain", domains, outsider, true, false, false, SignupReasonDomainNotAllowed},
+		{"invitation overrides domains", domains, guest, true, true, false, SignupReasonInvited},
+		{"invitation needs a verified email", inviteOnly, unverifiedGuest, true, false, false, SignupReasonInviteRequired},
+		{"invite only", inviteOnly, verified, true, false, false, SignupReasonInviteRequired},
+		{"invited", inviteOnly, guest, true, true, false, SignupReasonInvited},
+		{"approval required", approval, verified, true, true, true, SignupReasonPendingApproval},
+		{"first users without an admin", approval, verified, false, true, false, SignupReasonFirstUser},
+		{"invitation skips approval", approval, guest, true, true, false, SignupReasonInvited},
+	}
+
+	for _, c := range cases {
+		hasAdmin := func() (bool, error) { return c.hasAdmin, nil }
+		decision, err := evaluateSignupPolicy(c.policy, c.identity, openInvitation, hasAdmin)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", c.name, err)
+		}
+		if decision.Allowed != c.allowed || decision.PendingApproval != c.pending || decision.Reason != c.reason {
+			t.Errorf("%s: expected allowed=%v pending=%v reason=%s, got %+v", c.name, c.allowed, c.pending, c.reason, decision)
+		}
+		if (decision.Reason == SignupReasonInvited) != (decision.Invitation != nil) {
+			t.Errorf("%s: expected the invitation only on invited decisions, got %+v", c.name, decision)
+		}
+	}
+}
+
+func TestEvaluateSignupPolicyLookups(t *testing.T) {
+	failing := errors.New("database down")
+	noInvitation := func(string) (*models.SignupInvitation, error) { return nil, nil }
+	identity := &models.ExternalIdentity{Email: "alice@example.com", EmailVerified: true}
+
+	_, err := evaluateSignupPolicy(config.SignupPolicyConfig{}, identity, func(string) (*models.SignupInvitation, error) { return nil, failing }, nil)
+	if err != failing {
+		t.Errorf("Expected invitation lookup errors to be returned, got %v", err)
+	}
+
+	_, err = evaluateSignupPolicy(config.SignupPolicyConfig{RequireApproval: true}, identity, noInvitation, func() (bool, error) { return false, failing })
+	if err != failing {
+		t.Errorf("Expected admin lookup errors to be returned, got %v", err)
+	}
+
+	// Admins are only looked up when approval is required
+	if _, err := evaluateSignupPolicy(config.SignupPolicyConfig{}, identity, noInvitation, nil); err != nil {
+		t.Errorf("Expected no admin lookup without approval, got %v", err)
+	}
+	// Invitations are only looked up for verified addresses
+	unverified := &models.ExternalIdentity{Email: "alice@example.com"}
+	if _, err := evaluateSignupPolicy(config.SignupPolicyConfig{}, unverified, nil, nil); err != nil {
+		t.Errorf("Expected no invitation lookup for an unverified email, got %v", err)
+	}
+}
+
+func TestNewSignupPolicyServiceNormalizesDomains(t *testing.T) {
+	sp := NewSignupPolicyService(nil, config.SignupPolicyConfig{AllowedDomains: []string{"@Example.COM", "partner.com"}})
+
+	cases := map[string]bool{
+		"alice@example.com":       true,
+		"ALICE@EXAMPLE.COM":       true,
+		"bob@partner.com":         true,
+		"eve@sub.example.com":     false,
+		"eve@example.com.evil.io": false,
+		"not-an-email":            false,
+	}
+	for email, want := range cases {
+		if got := emailDomainAllowed(email, sp.policy.AllowedDomains); got != want {
+			t.Errorf("Expected %s allowed=%v, got %v", email, want, got)
+		}
+	}
+}
@@ -79,12 +79,15 @@ func (s *StripeService) CreateCustomer(userID int, email, name string) (*models.
 	return &dbCustomer, nil
 }
 
-// GetCustomerByUserID retrieves a Stripe customer by user ID
+// GetCustomerByUserID retrieves a Stripe customer by user ID.
+// A merged user can own several customers; the oldest one is used.
 func (s *StripeService) GetCustomerByUserID(userID int) (*models.StripeCustomer, error) {
 	query := `
 		SELECT id, user_id, stripe_id, email, default_source, created_at, updated_at
 		FROM stripe_customers
 		WHERE user_id = $1
+		ORDER BY created_at
+		LIMIT 1
 	`
 
 	var customer models.StripeCustomer
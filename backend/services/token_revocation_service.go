@@ -0,0 +1,365 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/events"
+	"github.com/lib/pq"
+)
+
+// TokenRevocationService keeps a denylist of revoked access tokens.
+// Revocations are stored in Postgres and mirrored in an in-memory cache that
+// every replica keeps in sync, so checking a token never hits the database.
+type TokenRevocationService struct {
+	db            *sql.DB
+	refreshTokens *RefreshTokenService
+	eventService  *events.EventService
+	tokenTTL      time.Duration
+	// legacyUntil is when legacy HS256 tokens stop being accepted; user-wide cutoffs are kept until then
+	legacyUntil time.Time
+
+	mu              sync.RWMutex
+	revokedTokens   map[string]time.Time // jti -> token expiry
+	revokedSessions map[string]time.Time // session ID -> expiry of its last access token
+	userCutoffs     map[int]revocationCutoff
+}
+
+// revocationCutoff denies every token of a user issued before a point in time. Token timestamps
+// only have second precision, so the cutoff is kept in whole seconds. Tokens issued in the same
+// second as the revocation are only covered when they have no session: a handler that revokes
+// everything and then signs the user in again at once starts a new session, which survives, while
+// session-less tokens such as impersonation tokens issued in that second are denied.
+type revocationCutoff struct {
+	revokeBefore time.Time
+	expiresAt    time.Time
+}
+
+// NewTokenRevocationService creates a new token revocation service.
+// tokenTTL is the lifetime of access tokens, which bounds how long user-wide
+// revocations need to be remembered; while legacy HS256 tokens are accepted,
+// until legacyUntil, they are remembered until then.
+func NewTokenRevocationService(db *sql.DB, refreshTokens *RefreshTokenService, eventService *events.EventService, tokenTTL time.Duration, legacyUntil time.Time) *TokenRevocationService {
+	rs := &TokenRevocationService{
+		db:              db,
+		refreshTokens:   refreshTokens,
+		eventService:    eventService,
+		tokenTTL:        tokenTTL,
+		legacyUntil:     legacyUntil,
+		revokedTokens:   make(map[string]time.Time),
+		revokedSessions: make(map[string]time.Time),
+		userCutoffs:     make(map[int]revocationCutoff),
+	}
+
+	if err := rs.sync(); err != nil {
+		log.Printf("⚠️  Failed to load token revocations: %v", err)
+	}
+
+	// Pick up revocations made by other replicas as soon as they are announced
+	go rs.listen()
+	// Fall back to polling in case an event was missed
+	go rs.syncPeriodically(30 * time.Second)
+
+	return rs
+}
+
+// IsRevoked reports whether the given access token has been revoked
+func (rs *TokenRevocationService) IsRevoked(claims *Claims) bool {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	if claims.ID != "" {
+		if _, revoked := rs.revokedTokens[claims.ID]; revoked {
+			return true
+		}
+	}
+
+	if claims.SessionID != "" {
+		if _, revoked := rs.revokedSessions[claims.SessionID]; revoked {
+			return true
+		}
+	}
+
+	if cutoff, ok := rs.userCutoffs[claims.UserID]; ok && cutoff.covers(claims) {
+		return true
+	}
+
+	return false
+}
+
+// covers reports whether a token is denied by the cutoff
+func (c revocationCutoff) covers(claims *Claims) bool {
+	if claims.IssuedAt == nil {
+		return false
+	}
+	issuedAt := claims.IssuedAt.Time
+	return issuedAt.Before(c.revokeBefore) || (issuedAt.Equal(c.revokeBefore) && claims.SessionID == "")
+}
+
+// RevokeToken revokes a single access token until it expires. Tokens without a jti, such as
+// legacy HS256 tokens, can not be named and are revoked with a user-wide cutoff at the second they
+// were issued, which also denies the user's older access tokens.
+func (rs *TokenRevocationService) RevokeToken(claims *Claims, reason string) error {
+	if claims.ID == "" {
+		if claims.IssuedAt == nil {
+			return fmt.Errorf("token has neither jti nor iat")
+		}
+		if err := rs.revokeIssuedBefore(claims.UserID, claims.IssuedAt.Time.Truncate(time.Second), reason); err != nil {
+			return err
+		}
+		rs.announce(claims.UserID, "", reason)
+		return nil
+	}
+
+	expiresAt := time.Now().Add(rs.tokenTTL)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	query := `
+		INSERT INTO token_revocations (jti, user_id, reason, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	if _, err := rs.db.Exec(query, claims.ID, claims.UserID, reason, expiresAt); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	rs.mu.Lock()
+	rs.revokedTokens[claims.ID] = expiresAt
+	rs.mu.Unlock()
+
+	rs.announce(claims.UserID, claims.ID, reason)
+	return nil
+}
+
+// RevokeSession revokes an access token together with the refresh token family it belongs to
+// and every other access token issued from that family
+func (rs *TokenRevocationService) RevokeSession(claims *Claims, reason string) error {
+	if claims.SessionID == "" {
+		return rs.RevokeToken(claims, reason)
+	}
+
+	if err := rs.refreshTokens.RevokeFamily(claims.SessionID, reason); err != nil {
+		return err
+	}
+
+	return rs.denySessions(claims.UserID, []string{claims.SessionID}, reason)
+}
+
+// RevokeUserSession signs a user out of one login session, given by its ID.
+// It returns ErrSessionNotFound if the user has no such active session.
+func (rs *TokenRevocationService) RevokeUserSession(userID int, sessionID, reason string) error {
+	if err := rs.refreshTokens.RevokeUserSession(userID, sessionID, reason); err != nil {
+		return err
+	}
+
+	return rs.denySessions(userID, []string{sessionID}, reason)
+}
+
+// RevokeOtherSessions signs a user out of every login session except keepSessionID
+// and returns the IDs of the sessions it revoked
+func (rs *TokenRevocationService) RevokeOtherSessions(userID int, keepSessionID, reason string) ([]string, error) {
+	sessionIDs, err := rs.refreshTokens.RevokeOtherSessions(userID, keepSessionID, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sessionIDs) == 0 {
+		return sessionIDs, nil
+	}
+
+	return sessionIDs, rs.denySessions(userID, sessionIDs, reason)
+}
+
+// RevokeAllForUser revokes every access and refresh token a user currently holds.
+// Tokens issued before the current second, or within it without a session, are denied by
+// a user-wide cutoff; those of the revoked sessions issued within it by their session ID.
+func (rs *TokenRevocationService) RevokeAllForUser(userID int, reason string) error {
+	sessionIDs, err := rs.refreshTokens.RevokeAllForUser(userID, reason)
+	if err != nil {
+		return err
+	}
+
+	if err := rs.revokeIssuedBefore(userID, time.Now().Truncate(time.Second), reason); err != nil {
+		return err
+	}
+
+	if len(sessionIDs) > 0 {
+		// Announces the revocation too
+		return rs.denySessions(userID, sessionIDs, reason)
+	}
+
+	rs.announce(userID, "", reason)
+	return nil
+}
+
+// revokeIssuedBefore stores a user-wide cutoff denying the user's tokens issued before revokeBefore,
+// and those without a session issued in that second. It does not announce the revocation.
+func (rs *TokenRevocationService) revokeIssuedBefore(userID int, revokeBefore time.Time, reason string) error {
+	expiresAt := rs.cutoffExpiry(time.Now())
+
+	query := `
+		INSERT INTO token_revocations (user_id, revoke_before, reason, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	if _, err := rs.db.Exec(query, userID, revokeBefore, reason, expiresAt); err != nil {
+		return fmt.Errorf("failed to revoke tokens for user: %w", err)
+	}
+
+	rs.mu.Lock()
+	rs.applyCutoff(userID, revokeBefore, expiresAt)
+	rs.mu.Unlock()
+
+	return nil
+}
+
+// cutoffExpiry returns until when a user-wide cutoff made at now must be kept: until every token it
+// covers has expired, which for legacy HS256 tokens is only certain once they are no longer accepted
+func (rs *TokenRevocationService) cutoffExpiry(now time.Time) time.Time {
+	expiresAt := now.Add(rs.tokenTTL)
+	if rs.legacyUntil.After(expiresAt) {
+		return rs.legacyUntil
+	}
+	return expiresAt
+}
+
+// denySessions denies the access tokens already issued from revoked sessions until they expire
+func (rs *TokenRevocationService) denySessions(userID int, sessionIDs []string, reason string) error {
+	expiresAt := time.Now().Add(rs.tokenTTL)
+
+	query := `
+		INSERT INTO token_revocations (user_id, session_id, reason, expires_at)
+		SELECT $1, unnest($2::text[]), $3, $4
+	`
+
+	if _, err := rs.db.Exec(query, userID, pq.Array(sessionIDs), reason, expiresAt); err != nil {
+		return fmt.Errorf("failed to revoke session tokens: %w", err)
+	}
+
+	rs.mu.Lock()
+	for _, sessionID := range sessionIDs {
+		rs.revokedSessions[sessionID] = expiresAt
+	}
+	rs.mu.Unlock()
+
+	rs.announce(userID, "", reason)
+	return nil
+}
+
+// announce tells other replicas to reload the denylist
+func (rs *TokenRevocationService) announce(userID int, tokenID, reason string) {
+	if rs.eventService == nil {
+		return
+	}
+
+	if err := rs.eventService.PublishTokenRevoked(userID, tokenID, reason); err != nil {
+		log.Printf("Warning: Failed to publish token revoked event: %v", err)
+	}
+}
+
+// listen reloads the denylist whenever a revocation event is received
+func (rs *TokenRevocationService) listen() {
+	if rs.eventService == nil {
+		return
+	}
+
+	ch, err := rs.eventService.SubscribeToAuthEvents()
+	if err != nil {
+		log.Printf("Warning: Failed to subscribe to auth events: %v", err)
+		return
+	}
+
+	for event := range ch {
+		if event.Type != events.EventTypeAuthTokenRevoked {
+			continue
+		}
+		if err := rs.sync(); err != nil {
+			log.Printf("Warning: Failed to sync token revocations: %v", err)
+		}
+	}
+}
+
+// syncPeriodically reloads the denylist and purges expired rows on an interval
+func (rs *TokenRevocationService) syncPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := rs.sync(); err != nil {
+			log.Printf("Warning: Failed to sync token revocations: %v", err)
+		}
+		rs.purgeExpired()
+	}
+}
+
+// sync reloads all unexpired revocations into the cache. Entries only live
+// as long as the access tokens they cover, so the table stays small.
+func (rs *TokenRevocationService) sync() error {
+	query := `
+		SELECT jti, user_id, revoke_before, session_id, expires_at
+		FROM token_revocations
+		WHERE expires_at > $1
+	`
+
+	rows, err := rs.db.Query(query, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to query token revocations: %w", err)
+	}
+	defer rows.Close()
+
+	revokedTokens := make(map[string]time.Time)
+	revokedSessions := make(map[string]time.Time)
+	userCutoffs := make(map[int]revocationCutoff)
+	for rows.Next() {
+		var jti, sessionID sql.NullString
+		var userID sql.NullInt64
+		var revokeBefore sql.NullTime
+		var expiresAt time.Time
+		if err := rows.Scan(&jti, &userID, &revokeBefore, &sessionID, &expiresAt); err != nil {
+			return fmt.Errorf("failed to scan token revocation: %w", err)
+		}
+
+		if jti.Valid {
+			revokedTokens[jti.String] = expiresAt
+		} else if sessionID.Valid {
+			revokedSessions[sessionID.String] = expiresAt
+		} else if revokeBefore.Valid && userID.Valid {
+			cutoff := revocationCutoff{revokeBefore: revokeBefore.Time, expiresAt: expiresAt}
+			if existing, ok := userCutoffs[int(userID.Int64)]; !ok || cutoff.revokeBefore.After(existing.revokeBefore) {
+				userCutoffs[int(userID.Int64)] = cutoff
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read token revocations: %w", err)
+	}
+
+	rs.mu.Lock()
+	rs.revokedTokens = revokedTokens
+	rs.revokedSessions = revokedSessions
+	rs.userCutoffs = userCutoffs
+	rs.mu.Unlock()
+
+	return nil
+}
+
+// applyCutoff records a user-wide cutoff, keeping the latest one. Callers must hold the lock.
+func (rs *TokenRevocationService) applyCutoff(userID int, revokeBefore, expiresAt time.Time) {
+	if existing, ok := rs.userCutoffs[userID]; ok && existing.revokeBefore.After(revokeBefore) {
+		return
+	}
+	rs.userCutoffs[userID] = revocationCutoff{revokeBefore: revokeBefore, expiresAt: expiresAt}
+}
+
+// purgeExpired deletes revocations for tokens that have expired on their own
+func (rs *TokenRevocationService) purgeExpired() {
+	if _, err := rs.db.Exec(`DELETE FROM token_revocations WHERE expires_at < $1`, time.Now()); err != nil {
+		log.Printf("Warning: Failed to purge expired token revocations: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+//go:build integration
+
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRevokeAllForUserAllowsImmediateNewSession(t *testing.T) {
+	db := openTestDB(t)
+	refreshTokens := NewRefreshTokenService(db)
+	rs := NewTokenRevocationService(db, refreshTokens, nil, 15*time.Minute, time.Time{})
+	userID := createTestUser(t, db)
+
+	_, family, err := refreshTokens.Issue(userID, false, SessionDevice{})
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	old := &Claims{UserID: userID, SessionID: family.FamilyID, RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(time.Now())}}
+
+	if err := rs.RevokeAllForUser(userID, "password_changed"); err != nil {
+		t.Fatalf("RevokeAllForUser failed: %v", err)
+	}
+
+	_, fresh, err := refreshTokens.Issue(userID, false, SessionDevice{})
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	renewed := &Claims{UserID: userID, SessionID: fresh.FamilyID, RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(time.Now())}}
+
+	// Another replica only knows what it loads from the database
+	replica := NewTokenRevocationService(db, refreshTokens, nil, 15*time.Minute, time.Time{})
+	for name, service := range map[string]*TokenRevocationService{"revoking replica": rs, "other replica": replica} {
+		if !service.IsRevoked(old) {
+			t.Errorf("%s: expected a token of a revoked session issued in the same second to be revoked", name)
+		}
+		if service.IsRevoked(renewed) {
+			t.Errorf("%s: expected the session started right after the revocation to stay valid", name)
+		}
+	}
+}
+
+func TestRevokeSessionWithoutJTI(t *testing.T) {
+	db := openTestDB(t)
+	refreshTokens := NewRefreshTokenService(db)
+	legacyUntil := time.Now().Add(24 * time.Hour)
+	rs := NewTokenRevocationService(db, refreshTokens, nil, 15*time.Minute, legacyUntil)
+	userID := createTestUser(t, db)
+
+	// Shaped like a legacy HS256 access token: no jti and no session
+	issuedAt := time.Now().Add(-time.Minute)
+	legacy := &Claims{UserID: userID, RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(issuedAt)}}
+	newer := &Claims{UserID: userID, RegisteredClaims: jwt.RegisteredClaims{ID: "newer", IssuedAt: jwt.NewNumericDate(issuedAt.Add(time.Second))}}
+
+	if err := rs.RevokeSession(legacy, "logout"); err != nil {
+		t.Fatalf("Expected a token without jti to be revoked, got %v", err)
+	}
+
+	replica := NewTokenRevocationService(db, refreshTokens, nil, 15*time.Minute, legacyUntil)
+	for name, service := range map[string]*TokenRevocationService{"revoking replica": rs, "other replica": replica} {
+		if !service.IsRevoked(legacy) {
+			t.Errorf("%s: expected the token to be revoked", name)
+		}
+		if service.IsRevoked(newer) {
+			t.Errorf("%s: expected tokens issued later to stay valid", name)
+		}
+	}
+
+	var expiresAt time.Time
+	if err := db.QueryRow(`SELECT MAX(expires_at) FROM token_revocations WHERE user_id = $1`, userID).Scan(&expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	if expiresAt.Before(legacyUntil.Add(-time.Second)) {
+		t.Errorf("Expected the cutoff to be kept while legacy tokens are accepted, expires at %v", expiresAt)
+	}
+}
+
+func TestRevokeAllForDeletedUser(t *testing.T) {
+	db := openTestDB(t)
+	refreshTokens := NewRefreshTokenService(db)
+	rs := NewTokenRevocationService(db, refreshTokens, nil, 15*time.Minute, time.Time{})
+	userID := createTestUser(t, db)
+	old := &Claims{UserID: userID, RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))}}
+
+	// A merge deletes the source user before its tokens are revoked
+	if _, err := db.Exec(`DELETE FROM users WHERE id = $1`, userID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if err := rs.RevokeAllForUser(userID, "user_merged"); err != nil {
+		t.Fatalf("RevokeAllForUser failed: %v", err)
+	}
+
+	replica := NewTokenRevocationService(db, refreshTokens, nil, 15*time.Minute, time.Time{})
+	for name, service := range map[string]*TokenRevocationService{"revoking replica": rs, "other replica": replica} {
+		if !service.IsRevoked(old) {
+			t.Errorf("%s: expected the deleted user's tokens to be revoked", name)
+		}
+	}
+}
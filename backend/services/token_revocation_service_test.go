@@ -0,0 +1,104 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestRevocationService returns a revocation service with an empty in-memory denylist
+func newTestRevocationService() *TokenRevocationService {
+	return &TokenRevocationService{
+		tokenTTL:        15 * time.Minute,
+		revokedTokens:   make(map[string]time.Time),
+		revokedSessions: make(map[string]time.Time),
+		userCutoffs:     make(map[int]revocationCutoff),
+	}
+}
+
+func TestIsRevokedByTokenAndSession(t *testing.T) {
+	rs := newTestRevocationService()
+	expiresAt := time.Now().Add(time.Hour)
+	rs.revokedTokens["revoked-jti"] = expiresAt
+	rs.revokedSessions["revoked-sid"] = expiresAt
+
+	cases := []struct {
+		name    string
+		claims  Claims
+		revoked bool
+	}{
+		{"revoked jti", Claims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{ID: "revoked-jti"}}, true},
+		{"other jti", Claims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{ID: "other-jti"}}, false},
+		{"revoked session", Claims{UserID: 1, SessionID: "revoked-sid", RegisteredClaims: jwt.RegisteredClaims{ID: "other-jti"}}, true},
+		{"other session", Claims{UserID: 1, SessionID: "other-sid"}, false},
+		{"no jti or session", Claims{UserID: 1}, false},
+	}
+
+	for _, c := range cases {
+		if got := rs.IsRevoked(&c.claims); got != c.revoked {
+			t.Errorf("%s: expected revoked=%v, got %v", c.name, c.revoked, got)
+		}
+	}
+}
+
+func TestIsRevokedByUserCutoff(t *testing.T) {
+	rs := newTestRevocationService()
+	revokeBefore := time.Unix(1700000000, 0)
+	rs.applyCutoff(1, revokeBefore, revokeBefore.Add(time.Hour))
+
+	issued := func(userID int, at time.Time) *Claims {
+		return &Claims{UserID: userID, SessionID: "session", RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(at)}}
+	}
+
+	if !rs.IsRevoked(issued(1, revokeBefore.Add(-time.Second))) {
+		t.Error("Expected a token issued before the cutoff to be revoked")
+	}
+	if rs.IsRevoked(issued(1, revokeBefore)) {
+		t.Error("Expected a session token issued in the second of the cutoff, such as right after a password change, to stay valid")
+	}
+	sessionless := issued(1, revokeBefore)
+	sessionless.SessionID = ""
+	if !rs.IsRevoked(sessionless) {
+		t.Error("Expected a token without a session issued in the second of the cutoff, such as an impersonation token, to be revoked")
+	}
+	if rs.IsRevoked(issued(1, revokeBefore.Add(time.Second))) {
+		t.Error("Expected a token issued after the cutoff to stay valid")
+	}
+	if rs.IsRevoked(issued(2, revokeBefore.Add(-time.Second))) {
+		t.Error("Expected the cutoff to only cover its user")
+	}
+	if rs.IsRevoked(&Claims{UserID: 1}) {
+		t.Error("Expected a token without iat not to be covered by the cutoff")
+	}
+
+	// An older cutoff synced late must not move the cutoff back
+	rs.applyCutoff(1, revokeBefore.Add(-time.Hour), revokeBefore)
+	if !rs.IsRevoked(issued(1, revokeBefore.Add(-time.Second))) {
+		t.Error("Expected the latest cutoff to be kept")
+	}
+
+	rs.applyCutoff(1, revokeBefore.Add(time.Minute), revokeBefore.Add(time.Hour))
+	if !rs.IsRevoked(issued(1, revokeBefore.Add(30*time.Second))) {
+		t.Error("Expected a later cutoff to replace the earlier one")
+	}
+}
+
+func TestCutoffExpiry(t *testing.T) {
+	rs := newTestRevocationService()
+	now := time.Unix(1700000000, 0)
+
+	if got := rs.cutoffExpiry(now); !got.Equal(now.Add(rs.tokenTTL)) {
+		t.Errorf("Expected cutoffs to last as long as access tokens, got %v", got)
+	}
+
+	rs.legacyUntil = now.Add(24 * time.Hour)
+	if got := rs.cutoffExpiry(now); !got.Equal(rs.legacyUntil) {
+		t.Errorf("Expected cutoffs to last while legacy tokens are accepted, got %v", got)
+	}
+
+	rs.legacyUntil = now.Add(time.Minute)
+	if got := rs.cutoffExpiry(now); !got.Equal(now.Add(rs.tokenTTL)) {
+		t.Errorf("Expected an ending legacy window not to shorten cutoffs, got %v", got)
+	}
+}
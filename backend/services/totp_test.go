@@ -0,0 +1,69 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Base32 of the RFC 6238 SHA1 test key "12345678901234567890"
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFC6238Vectors(t *testing.T) {
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, want := range vectors {
+		got, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("At %d expected %s, got %s", unix, want, got)
+		}
+	}
+}
+
+func TestValidateTOTPAllowsOneStepOfSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := TOTPStep(now)
+
+	for _, offset := range []int64{-1, 0, 1} {
+		code, _ := TOTPCode(rfc6238Secret, step+offset)
+		matched, ok := ValidateTOTP(rfc6238Secret, code, now)
+		if !ok || matched != step+offset {
+			t.Errorf("Expected code at offset %d to validate at step %d, got step=%d ok=%v", offset, step+offset, matched, ok)
+		}
+	}
+
+	code, _ := TOTPCode(rfc6238Secret, step+2)
+	if _, ok := ValidateTOTP(rfc6238Secret, code, now); ok {
+		t.Error("Expected code two steps ahead to be rejected")
+	}
+
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, now); ok {
+			t.Errorf("Expected %q to be rejected", code)
+		}
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret failed: %v", err)
+	}
+
+	uri := TOTPProvisioningURI(secret, "Hackaton Demo", "jane@example.com")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Hackaton%20Demo:jane@example.com?") {
+		t.Errorf("Unexpected URI label: %s", uri)
+	}
+	if !strings.Contains(uri, "secret="+secret) || !strings.Contains(uri, "issuer=Hackaton+Demo") {
+		t.Errorf("URI is missing the secret or issuer: %s", uri)
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import "strings"
+
+// Browsers and systems recognised in user agents, most specific first:
+// Edge and Opera also claim to be Chrome, and Chrome claims to be Safari.
+var (
+	userAgentBrowsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"CriOS/", "Chrome"},
+		{"Safari/", "Safari"},
+	}
+	userAgentSystems = []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"CrOS", "ChromeOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// SessionDevice describes where a session is used from
+type SessionDevice struct {
+	IPAddress string
+	UserAgent string
+}
+
+// DeviceName returns an approximate, human readable name for the device behind a user agent,
+// such as "Firefox on Windows". Non-browser clients are named after their product, e.g. "curl".
+func DeviceName(userAgent string) string {
+	userAgent = strings.TrimSpace(userAgent)
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	var browser, system string
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range userAgentSystems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+
+	// Tools like curl or Go-http-client/1.1 put their name first
+	product, _, _ := strings.Cut(strings.Fields(userAgent)[0], "/")
+	if len(product) > 64 {
+		product = product[:64]
+	}
+	return product
+}
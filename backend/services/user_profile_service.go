@@ -0,0 +1,432 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	// Time zones are validated against the embedded database, the runtime image has none
+	_ "time/tzdata"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/lib/pq"
+)
+
+// Types of custom user attributes
+const (
+	AttributeTypeString  = "string"
+	AttributeTypeNumber  = "number"
+	AttributeTypeBoolean = "boolean"
+)
+
+// AttributeTypes are the types a custom user attribute can have
+var AttributeTypes = []string{AttributeTypeString, AttributeTypeNumber, AttributeTypeBoolean}
+
+// notificationDefaults are the notifications users can turn on or off, and whether they get them until they do
+var notificationDefaults = map[string]bool{
+	"security_alerts": true,
+	"billing":         true,
+	"product_updates": false,
+}
+
+const (
+	maxProfileNameLength       = 100
+	maxPictureURLLength        = 2048
+	maxAttributeStringLength   = 1000
+	maxAttributeAllowedValues  = 100
+	maxAttributeDescriptionLen = 500
+)
+
+var (
+	localePattern        = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+	attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+)
+
+var (
+	// ErrUserAttributeNotFound is returned when no custom attribute has the given ID
+	ErrUserAttributeNotFound = errors.New("user attribute not found")
+	// ErrUserAttributeExists is returned when defining an attribute whose name is taken
+	ErrUserAttributeExists = errors.New("a user attribute with this name already exists")
+)
+
+// UserProfileService manages the self-service profile of users and the custom attributes admins define for them
+type UserProfileService struct {
+	db *sql.DB
+}
+
+// NewUserProfileService creates a new user profile service
+func NewUserProfileService(db *sql.DB) *UserProfileService {
+	return &UserProfileService{db: db}
+}
+
+// GetProfile returns the profile of an active user, or nil if there is none
+func (ps *UserProfileService) GetProfile(userID int) (*models.UserProfile, error) {
+	query := `
+		SELECT id, email, name, picture, name_edited, picture_edited, locale, timezone, notification_preferences, custom_attributes, updated_at
+		FROM users
+		WHERE id = $1 AND is_active = true
+	`
+
+	profile, err := scanProfile(ps.db.QueryRow(query, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user profile: %w", err)
+	}
+
+	return profile, nil
+}
+
+// ValidateProfileUpdate checks a profile update against the defined custom attributes and returns
+// the problems by field. Users can only set attributes marked user editable; admins can set all.
+// Name and locale are normalized in place.
+func ValidateProfileUpdate(update *models.UserProfileUpdate, definitions []models.UserAttributeDefinition, asAdmin bool) map[string]string {
+	errs := make(map[string]string)
+
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		update.Name = &name
+		if name == "" || utf8.RuneCountInString(name) > maxProfileNameLength {
+			errs["name"] = fmt.Sprintf("Name is required and must be at most %d characters", maxProfileNameLength)
+		}
+	}
+
+	if update.Picture != nil && *update.Picture != "" && !isValidPictureURL(*update.Picture) {
+		errs["picture"] = "Picture must be an absolute https URL"
+	}
+
+	if update.Locale != nil && *update.Locale != "" {
+		if !localePattern.MatchString(*update.Locale) || len(*update.Locale) > 35 {
+			errs["locale"] = "Locale must be a language tag such as en or sv-SE"
+		} else {
+			locale := canonicalLocale(*update.Locale)
+			update.Locale = &locale
+		}
+	}
+
+	if update.Timezone != nil && *update.Timezone != "" {
+		if _, err := time.LoadLocation(*update.Timezone); err != nil || *update.Timezone == "Local" {
+			errs["timezone"] = "Timezone must be an IANA time zone such as Europe/Stockholm"
+		}
+	}
+
+	for notification := range update.NotificationPreferences {
+		if _, ok := notificationDefaults[notification]; !ok {
+			errs["notification_preferences"] = fmt.Sprintf("Unknown notification %q", notification)
+			break
+		}
+	}
+
+	for name, value := range update.CustomAttributes {
+		field := "custom_attributes." + name
+
+		i := slices.IndexFunc(definitions, func(d models.UserAttributeDefinition) bool { return d.Name == name })
+		if i < 0 {
+			errs[field] = "Unknown attribute"
+			continue
+		}
+		definition := definitions[i]
+
+		if !asAdmin && !definition.UserEditable {
+			errs[field] = "Only admins can change this attribute"
+			continue
+		}
+		if value == nil {
+			continue
+		}
+		if err := validateAttributeValue(&definition, value); err != nil {
+			errs[field] = err.Error()
+		}
+	}
+
+	return errs
+}
+
+// UpdateProfile applies a validated profile update. Editing the name or picture stops them from
+// being synced from the login provider; removing the picture override syncs it again on the next login.
+func (ps *UserProfileService) UpdateProfile(userID int, update *models.UserProfileUpdate) (*models.UserProfile, error) {
+	notifications, err := json.Marshal(nonNilMap(update.NotificationPreferences))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode notification preferences: %w", err)
+	}
+
+	setAttributes := map[string]interface{}{}
+	removeAttributes := []string{}
+	for name, value := range update.CustomAttributes {
+		if value == nil {
+			removeAttributes = append(removeAttributes, name)
+		} else {
+			setAttributes[name] = value
+		}
+	}
+	attributes, err := json.Marshal(setAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode custom attributes: %w", err)
+	}
+
+	query := `
+		UPDATE users
+		SET name = COALESCE($2::text, name),
+			name_edited = name_edited OR $2::text IS NOT NULL,
+			picture = COALESCE($3::text, picture),
+			picture_edited = CASE WHEN $3::text IS NULL THEN picture_edited ELSE $3::text <> '' END,
+			locale = COALESCE($4::text, locale),
+			timezone = COALESCE($5::text, timezone),
+			notification_preferences = notification_preferences || $6::jsonb,
+			custom_attributes = (custom_attributes || $7::jsonb) - $8::text[]
+		WHERE id = $1 AND is_active = true
+		RETURNING id, email, name, picture, name_edited, picture_edited, locale, timezone, notification_preferences, custom_attributes, updated_at
+	`
+
+	row := ps.db.QueryRow(query, userID, update.Name, update.Picture, update.Locale, update.Timezone, notifications, attributes, pq.Array(removeAttributes))
+	profile, err := scanProfile(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to update user profile: %w", err)
+	}
+
+	return profile, nil
+}
+
+// ValidateAttributeDefinitionInput checks a custom attribute definition and returns errors by field
+func ValidateAttributeDefinitionInput(input *models.UserAttributeDefinitionCreate) map[string]string {
+	errs := make(map[string]string)
+
+	input.Name = strings.TrimSpace(input.Name)
+	if !attributeNamePattern.MatchString(input.Name) {
+		errs["name"] = "Name must start with a lowercase letter and contain only lowercase letters, digits and underscores (at most 64)"
+	}
+	if len(input.Description) > maxAttributeDescriptionLen {
+		errs["description"] = fmt.Sprintf("Description must be at most %d characters", maxAttributeDescriptionLen)
+	}
+	if !slices.Contains(AttributeTypes, input.Type) {
+		errs["type"] = "Type must be one of " + strings.Join(AttributeTypes, ", ")
+	}
+
+	if len(input.AllowedValues) > 0 {
+		switch {
+		case input.Type != AttributeTypeString:
+			errs["allowed_values"] = "Allowed values can only be given for string attributes"
+		case len(input.AllowedValues) > maxAttributeAllowedValues:
+			errs["allowed_values"] = fmt.Sprintf("At most %d allowed values can be given", maxAttributeAllowedValues)
+		case slices.Contains(input.AllowedValues, ""):
+			errs["allowed_values"] = "Allowed values can not be empty"
+		}
+	}
+
+	return errs
+}
+
+// ListAttributeDefinitions returns the custom user attributes defined by admins
+func (ps *UserProfileService) ListAttributeDefinitions() ([]models.UserAttributeDefinition, error) {
+	query := `
+		SELECT id, name, description, type, allowed_values, user_editable, created_at
+		FROM user_attribute_definitions
+		ORDER BY name
+	`
+
+	rows, err := ps.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user attributes: %w", err)
+	}
+	defer rows.Close()
+
+	definitions := []models.UserAttributeDefinition{}
+	for rows.Next() {
+		var definition models.UserAttributeDefinition
+		err := rows.Scan(&definition.ID, &definition.Name, &definition.Description, &definition.Type, pq.Array(&definition.AllowedValues), &definition.UserEditable, &definition.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user attribute: %w", err)
+		}
+		definitions = append(definitions, definition)
+	}
+
+	return definitions, rows.Err()
+}
+
+// CreateAttributeDefinition defines a custom user attribute from a validated input
+func (ps *UserProfileService) CreateAttributeDefinition(input *models.UserAttributeDefinitionCreate) (*models.UserAttributeDefinition, error) {
+	allowedValues := input.AllowedValues
+	if allowedValues == nil {
+		allowedValues = []string{}
+	}
+
+	query := `
+		INSERT INTO user_attribute_definitions (name, description, type, allowed_values, user_editable)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO NOTHING
+		RETURNING id, name, description, type, allowed_values, user_editable, created_at
+	`
+
+	definition := &models.UserAttributeDefinition{}
+	err := ps.db.QueryRow(query, input.Name, input.Description, input.Type, pq.Array(allowedValues), input.UserEditable).Scan(
+		&definition.ID,
+		&definition.Name,
+		&definition.Description,
+		&definition.Type,
+		pq.Array(&definition.AllowedValues),
+		&definition.UserEditable,
+		&definition.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserAttributeExists
+		}
+		return nil, fmt.Errorf("failed to create user attribute: %w", err)
+	}
+
+	return definition, nil
+}
+
+// DeleteAttributeDefinition removes a custom user attribute together with its values on every user
+func (ps *UserProfileService) DeleteAttributeDefinition(id int) (*models.UserAttributeDefinition, error) {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM user_attribute_definitions
+		WHERE id = $1
+		RETURNING id, name, description, type, allowed_values, user_editable, created_at
+	`
+
+	definition := &models.UserAttributeDefinition{}
+	err = tx.QueryRow(query, id).Scan(
+		&definition.ID,
+		&definition.Name,
+		&definition.Description,
+		&definition.Type,
+		pq.Array(&definition.AllowedValues),
+		&definition.UserEditable,
+		&definition.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserAttributeNotFound
+		}
+		return nil, fmt.Errorf("failed to delete user attribute: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET custom_attributes = custom_attributes - $1::text WHERE custom_attributes ? $1::text`, definition.Name); err != nil {
+		return nil, fmt.Errorf("failed to remove user attribute values: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit user attribute deletion: %w", err)
+	}
+
+	return definition, nil
+}
+
+// scanProfile reads a profile row, filling in notification preferences the user never set
+func scanProfile(row *sql.Row) (*models.UserProfile, error) {
+	profile := &models.UserProfile{}
+	var notifications, attributes []byte
+
+	err := row.Scan(
+		&profile.UserID,
+		&profile.Email,
+		&profile.Name,
+		&profile.Picture,
+		&profile.NameEdited,
+		&profile.PictureEdited,
+		&profile.Locale,
+		&profile.Timezone,
+		&notifications,
+		&attributes,
+		&profile.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	profile.NotificationPreferences = make(map[string]bool, len(notificationDefaults))
+	for notification, enabled := range notificationDefaults {
+		profile.NotificationPreferences[notification] = enabled
+	}
+	if err := json.Unmarshal(notifications, &profile.NotificationPreferences); err != nil {
+		return nil, fmt.Errorf("failed to parse notification preferences: %w", err)
+	}
+
+	profile.CustomAttributes = map[string]interface{}{}
+	if err := json.Unmarshal(attributes, &profile.CustomAttributes); err != nil {
+		return nil, fmt.Errorf("failed to parse custom attributes: %w", err)
+	}
+
+	return profile, nil
+}
+
+// validateAttributeValue checks that a JSON value fits the type of a custom attribute
+func validateAttributeValue(definition *models.UserAttributeDefinition, value interface{}) error {
+	switch definition.Type {
+	case AttributeTypeString:
+		s, ok := value.(string)
+		if !ok {
+			return errors.New("must be a string")
+		}
+		if len(definition.AllowedValues) > 0 && !slices.Contains(definition.AllowedValues, s) {
+			return fmt.Errorf("must be one of %s", strings.Join(definition.AllowedValues, ", "))
+		}
+		if utf8.RuneCountInString(s) > maxAttributeStringLength {
+			return fmt.Errorf("must be at most %d characters", maxAttributeStringLength)
+		}
+	case AttributeTypeNumber:
+		if _, ok := value.(float64); !ok {
+			return errors.New("must be a number")
+		}
+	case AttributeTypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return errors.New("must be true or false")
+		}
+	default:
+		return fmt.Errorf("unknown attribute type %q", definition.Type)
+	}
+	return nil
+}
+
+// isValidPictureURL reports whether a picture override is an absolute https URL
+func isValidPictureURL(picture string) bool {
+	if len(picture) > maxPictureURLLength {
+		return false
+	}
+	u, err := url.Parse(picture)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// canonicalLocale writes a language tag with a lowercase language and an uppercase region, as in sv-SE
+func canonicalLocale(locale string) string {
+	parts := strings.Split(locale, "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch len(parts[i]) {
+		case 2:
+			parts[i] = strings.ToUpper(parts[i])
+		case 4:
+			// Script, as in zh-Hant
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		default:
+			parts[i] = strings.ToLower(parts[i])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// nonNilMap returns an empty map for nil, so it encodes as a JSON object
+func nonNilMap(m map[string]bool) map[string]bool {
+	if m == nil {
+		return map[string]bool{}
+	}
+	return m
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+func TestValidateProfileUpdate(t *testing.T) {
+	definitions := []models.UserAttributeDefinition{
+		{Name: "team", Type: AttributeTypeString, AllowedValues: []string{"red", "blue"}, UserEditable: true},
+		{Name: "employee_number", Type: AttributeTypeNumber},
+	}
+	name, locale, timezone := "  Ada  ", "SV-se", "Europe/Stockholm"
+
+	valid := &models.UserProfileUpdate{
+		Name:                    &name,
+		Locale:                  &locale,
+		Timezone:                &timezone,
+		NotificationPreferences: map[string]bool{"product_updates": true},
+		CustomAttributes:        map[string]interface{}{"team": "red"},
+	}
+	if errs := ValidateProfileUpdate(valid, definitions, false); len(errs) != 0 {
+		t.Fatalf("Expected a valid update, got %v", errs)
+	}
+	if *valid.Name != "Ada" || *valid.Locale != "sv-SE" {
+		t.Errorf("Expected name and locale to be normalized, got %q and %q", *valid.Name, *valid.Locale)
+	}
+
+	empty, badURL, badLocale, badZone := " ", "http://example.com/a.png", "english", "Mars/Olympus"
+	invalid := map[string]*models.UserProfileUpdate{
+		"name":                              {Name: &empty},
+		"picture":                           {Picture: &badURL},
+		"locale":                            {Locale: &badLocale},
+		"timezone":                          {Timezone: &badZone},
+		"notification_preferences":          {NotificationPreferences: map[string]bool{"spam": true}},
+		"custom_attributes.team":            {CustomAttributes: map[string]interface{}{"team": "green"}},
+		"custom_attributes.unknown":         {CustomAttributes: map[string]interface{}{"unknown": "x"}},
+		"custom_attributes.employee_number": {CustomAttributes: map[string]interface{}{"employee_number": 7.0}},
+	}
+	for field, update := range invalid {
+		if _, ok := ValidateProfileUpdate(update, definitions, false)[field]; !ok {
+			t.Errorf("Expected an error for %s", field)
+		}
+	}
+
+	adminUpdate := &models.UserProfileUpdate{CustomAttributes: map[string]interface{}{"employee_number": 7.0, "team": nil}}
+	if errs := ValidateProfileUpdate(adminUpdate, definitions, true); len(errs) != 0 {
+		t.Errorf("Expected admins to set any attribute, got %v", errs)
+	}
+	wrongType := &models.UserProfileUpdate{CustomAttributes: map[string]interface{}{"employee_number": "7"}}
+	if _, ok := ValidateProfileUpdate(wrongType, definitions, true)["custom_attributes.employee_number"]; !ok {
+		t.Error("Expected an error for a value of the wrong type")
+	}
+}
+
+func TestValidateAttributeDefinitionInput(t *testing.T) {
+	valid := &models.UserAttributeDefinitionCreate{Name: "team", Type: AttributeTypeString, AllowedValues: []string{"red", "blue"}}
+	if errs := ValidateAttributeDefinitionInput(valid); len(errs) != 0 {
+		t.Errorf("Expected a valid definition, got %v", errs)
+	}
+
+	invalid := map[string]*models.UserAttributeDefinitionCreate{
+		"name":           {Name: "Team Name", Type: AttributeTypeString},
+		"type":           {Name: "team", Type: "date"},
+		"allowed_values": {Name: "level", Type: AttributeTypeNumber, AllowedValues: []string{"1"}},
+	}
+	for field, input := range invalid {
+		if _, ok := ValidateAttributeDefinitionInput(input)[field]; !ok {
+			t.Errorf("Expected an error for %s", field)
+		}
+	}
+}
+
+func TestCanonicalLocale(t *testing.T) {
+	for locale, want := range map[string]string{"en": "en", "EN-gb": "en-GB", "zh-hant-tw": "zh-Hant-TW"} {
+		if got := canonicalLocale(locale); got != want {
+			t.Errorf("canonicalLocale(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
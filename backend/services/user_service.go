@@ -2,12 +2,22 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/frallan97/hackaton-demo-backend/models"
 )
 
+var (
+	// ErrIdentityInUse is returned when a login identity already belongs to another user
+	ErrIdentityInUse = errors.New("identity is linked to another user")
+	// ErrIdentityNotFound is returned when a user has no identity with the given ID
+	ErrIdentityNotFound = errors.New("identity not found")
+	// ErrLastIdentity is returned when removing an identity would leave a user unable to log in
+	ErrLastIdentity = errors.New("cannot remove the only login identity")
+)
+
 // UserService handles user-related database operations
 type UserService struct {
 	db *sql.DB
@@ -21,9 +31,9 @@ func NewUserService(db *sql.DB) *UserService {
 // CreateUser creates a new user in the database
 func (u *UserService) CreateUser(userData *models.UserCreate) (*models.User, error) {
 	query := `
-		INSERT INTO users (email, name, picture, google_id, is_active, last_login_at, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id, email, name, picture, google_id, is_active, last_login_at, created_at, updated_at
+		INSERT INTO users (email, name, picture, google_id, is_active, pending_approval, last_login_at, created_at, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9)
+		RETURNING id, email, name, picture, COALESCE(google_id, ''), is_active, last_login_at, created_at, updated_at
 	`
 
 	now := time.Now()
@@ -35,10 +45,11 @@ func (u *UserService) CreateUser(userData *models.UserCreate) (*models.User, err
 		userData.Name,
 		userData.Picture,
 		userData.GoogleID,
-		true, // is_active
-		now,  // last_login_at
-		now,  // created_at
-		now,  // updated_at
+		!userData.PendingApproval, // is_active
+		userData.PendingApproval,  // pending_approval
+		now,                       // last_login_at
+		now,                       // created_at
+		now,                       // updated_at
 	).Scan(
 		&user.ID,
 		&user.Email,
@@ -58,10 +69,258 @@ func (u *UserService) CreateUser(userData *models.UserCreate) (*models.User, err
 	return user, nil
 }
 
+// CreateUserWithIdentity creates a new user together with the login identity they signed up with
+func (u *UserService) CreateUserWithIdentity(userData *models.UserCreate, identity *models.ExternalIdentity) (*models.User, error) {
+	tx, err := u.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO users (email, name, picture, google_id, is_active, pending_approval, last_login_at, created_at, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9)
+		RETURNING id, email, name, picture, COALESCE(google_id, ''), is_active, last_login_at, created_at, updated_at
+	`
+
+	now := time.Now()
+	user := &models.User{}
+
+	err = tx.QueryRow(
+		query,
+		userData.Email,
+		userData.Name,
+		userData.Picture,
+		userData.GoogleID,
+		!userData.PendingApproval, // is_active
+		userData.PendingApproval,  // pending_approval
+		now,                       // last_login_at
+		now,                       // created_at
+		now,                       // updated_at
+	).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Name,
+		&user.Picture,
+		&user.GoogleID,
+		&user.IsActive,
+		&user.LastLoginAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if err := u.insertIdentity(tx, user.ID, identity, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit user creation: %w", err)
+	}
+
+	return user, nil
+}
+
+// GetUserByIdentity retrieves a user by one of their login identities, whether or not the account is active
+func (u *UserService) GetUserByIdentity(provider, subject string) (*models.User, error) {
+	query := `
+		SELECT u.id, u.email, u.name, u.picture, COALESCE(u.google_id, ''), u.is_active, u.last_login_at, u.created_at, u.updated_at
+		FROM users u
+		JOIN user_identities ui ON ui.user_id = u.id
+		WHERE ui.provider = $1 AND ui.subject = $2
+	`
+
+	user := &models.User{}
+	err := u.db.QueryRow(query, provider, subject).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Name,
+		&user.Picture,
+		&user.GoogleID,
+		&user.IsActive,
+		&user.LastLoginAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // User not found
+		}
+		return nil, fmt.Errorf("failed to get user by identity: %w", err)
+	}
+
+	return user, nil
+}
+
+// UpdateIdentityLogin records a login through an identity and refreshes the email the provider reported
+func (u *UserService) UpdateIdentityLogin(identity *models.ExternalIdentity) error {
+	query := `
+		UPDATE user_identities
+		SET email = $1, email_verified = $2, last_login_at = $3
+		WHERE provider = $4 AND subject = $5
+	`
+
+	_, err := u.db.Exec(query, identity.Email, identity.EmailVerified, time.Now(), identity.Provider, identity.Subject)
+	if err != nil {
+		return fmt.Errorf("failed to update identity login: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserIdentities returns all login identities of a user
+func (u *UserService) GetUserIdentities(userID int) ([]models.UserIdentity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, COALESCE(email, ''), email_verified, last_login_at, created_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := u.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user identities: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []models.UserIdentity
+	for rows.Next() {
+		var identity models.UserIdentity
+		err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.EmailVerified, &identity.LastLoginAt, &identity.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user identity: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
+
+// LinkIdentity attaches another login identity to an existing user.
+// Linking an identity the user already owns is a no-op.
+func (u *UserService) LinkIdentity(userID int, identity *models.ExternalIdentity) error {
+	tx, err := u.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := u.linkIdentity(tx, userID, identity); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit identity link: %w", err)
+	}
+
+	return nil
+}
+
+// UnlinkIdentity removes a login identity from a user, keeping at least one identity so the user can still log in
+func (u *UserService) UnlinkIdentity(userID, identityID int) (*models.UserIdentity, error) {
+	tx, err := u.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the user so two concurrent unlinks cannot remove the last two identities
+	if _, err := tx.Exec(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return nil, fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM user_identities WHERE user_id = $1`, userID).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to count user identities: %w", err)
+	}
+
+	query := `
+		DELETE FROM user_identities
+		WHERE id = $1 AND user_id = $2
+		RETURNING id, user_id, provider, subject, COALESCE(email, ''), email_verified, last_login_at, created_at
+	`
+
+	identity := &models.UserIdentity{}
+	err = tx.QueryRow(query, identityID, userID).Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.EmailVerified, &identity.LastLoginAt, &identity.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrIdentityNotFound
+		}
+		return nil, fmt.Errorf("failed to unlink identity: %w", err)
+	}
+
+	if count <= 1 {
+		return nil, ErrLastIdentity
+	}
+
+	switch identity.Provider {
+	case "google":
+		if _, err := tx.Exec(`UPDATE users SET google_id = NULL WHERE id = $1 AND google_id = $2`, userID, identity.Subject); err != nil {
+			return nil, fmt.Errorf("failed to clear Google ID: %w", err)
+		}
+	case LocalProvider:
+		// Without the local identity the password can no longer be used
+		if _, err := tx.Exec(`DELETE FROM user_passwords WHERE user_id = $1`, userID); err != nil {
+			return nil, fmt.Errorf("failed to remove password: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit identity unlink: %w", err)
+	}
+
+	return identity, nil
+}
+
+// linkIdentity attaches an identity to a user inside a transaction, refusing identities owned by someone else
+func (u *UserService) linkIdentity(tx *sql.Tx, userID int, identity *models.ExternalIdentity) error {
+	var ownerID int
+	err := tx.QueryRow(`SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2`, identity.Provider, identity.Subject).Scan(&ownerID)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return fmt.Errorf("failed to look up identity: %w", err)
+	case ownerID == userID:
+		return nil
+	default:
+		return ErrIdentityInUse
+	}
+
+	if err := u.insertIdentity(tx, userID, identity, time.Now()); err != nil {
+		return err
+	}
+
+	if identity.Provider == "google" {
+		if _, err := tx.Exec(`UPDATE users SET google_id = $1 WHERE id = $2 AND google_id IS NULL`, identity.Subject, userID); err != nil {
+			return fmt.Errorf("failed to set Google ID: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// insertIdentity links a login identity to a user
+func (u *UserService) insertIdentity(tx *sql.Tx, userID int, identity *models.ExternalIdentity, now time.Time) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email, email_verified, last_login_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := tx.Exec(query, userID, identity.Provider, identity.Subject, identity.Email, identity.EmailVerified, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	return nil
+}
+
 // GetUserByGoogleID retrieves a user by their Google ID
 func (u *UserService) GetUserByGoogleID(googleID string) (*models.User, error) {
 	query := `
-		SELECT id, email, name, picture, google_id, is_active, last_login_at, created_at, updated_at
+		SELECT id, email, name, picture, COALESCE(google_id, ''), is_active, last_login_at, created_at, updated_at
 		FROM users
 		WHERE google_id = $1 AND is_active = true
 	`
@@ -89,10 +348,55 @@ func (u *UserService) GetUserByGoogleID(googleID string) (*models.User, error) {
 	return user, nil
 }
 
+// GetUserByEmail retrieves a user by email address, whether or not the account is active
+func (u *UserService) GetUserByEmail(email string) (*models.User, error) {
+	query := `
+		SELECT id, email, name, picture, COALESCE(google_id, ''), is_active, last_login_at, created_at, updated_at
+		FROM users
+		WHERE LOWER(email) = LOWER($1)
+	`
+
+	user := &models.User{}
+	err := u.db.QueryRow(query, email).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Name,
+		&user.Picture,
+		&user.GoogleID,
+		&user.IsActive,
+		&user.LastLoginAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // User not found
+		}
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
+	}
+
+	return user, nil
+}
+
+// IsPendingApproval reports whether a user's sign-up is still waiting for admin approval
+func (u *UserService) IsPendingApproval(userID int) (bool, error) {
+	var pending bool
+	err := u.db.QueryRow(`SELECT pending_approval FROM users WHERE id = $1`, userID).Scan(&pending)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get user approval status: %w", err)
+	}
+
+	return pending, nil
+}
+
 // GetUserByID retrieves a user by their ID
 func (u *UserService) GetUserByID(userID int) (*models.User, error) {
 	query := `
-		SELECT id, email, name, picture, google_id, is_active, last_login_at, created_at, updated_at
+		SELECT id, email, name, picture, COALESCE(google_id, ''), is_active, last_login_at, created_at, updated_at
 		FROM users
 		WHERE id = $1 AND is_active = true
 	`
@@ -137,19 +441,21 @@ func (u *UserService) UpdateUserLastLogin(userID int) error {
 	return nil
 }
 
-// UpdateUserProfile updates a user's profile information
-func (u *UserService) UpdateUserProfile(userID int, name, picture string) (*models.User, error) {
+// SyncProviderProfile mirrors the name and picture reported by the login provider. Fields the
+// user edited on their profile are kept.
+func (u *UserService) SyncProviderProfile(userID int, name, picture string) (*models.User, error) {
 	query := `
 		UPDATE users
-		SET name = $1, picture = $2, updated_at = $3
-		WHERE id = $4
-		RETURNING id, email, name, picture, google_id, is_active, last_login_at, created_at, updated_at
+		SET name = CASE WHEN name_edited THEN name ELSE $1 END,
+			picture = CASE WHEN picture_edited THEN picture ELSE $2 END
+		WHERE id = $3
+			AND ((NOT name_edited AND name <> $1) OR (NOT picture_edited AND picture <> $2))
+		RETURNING id, email, name, picture, COALESCE(google_id, ''), is_active, last_login_at, created_at, updated_at
 	`
 
-	now := time.Now()
 	user := &models.User{}
 
-	err := u.db.QueryRow(query, name, picture, now, userID).Scan(
+	err := u.db.QueryRow(query, name, picture, userID).Scan(
 		&user.ID,
 		&user.Email,
 		&user.Name,
@@ -162,7 +468,11 @@ func (u *UserService) UpdateUserProfile(userID int, name, picture string) (*mode
 	)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to update user profile: %w", err)
+		if err == sql.ErrNoRows {
+			// Nothing the user has not edited differs from the provider
+			return u.GetUserByID(userID)
+		}
+		return nil, fmt.Errorf("failed to sync user profile: %w", err)
 	}
 
 	return user, nil
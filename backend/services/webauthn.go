@@ -0,0 +1,347 @@
+package services
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// COSE algorithm identifiers of the public key types we accept, in order of preference
+const (
+	COSEAlgES256 = -7
+	COSEAlgEdDSA = -8
+	COSEAlgRS256 = -257
+)
+
+// Authenticator data flags (WebAuthn section 6.1)
+const (
+	authDataFlagUserPresent      = 0x01
+	authDataFlagUserVerified     = 0x04
+	authDataFlagAttestedCredData = 0x40
+)
+
+const maxCredentialIDLength = 1023
+
+// ErrInvalidWebAuthnResponse is returned when a credential or assertion from the browser fails verification
+var ErrInvalidWebAuthnResponse = errors.New("invalid WebAuthn response")
+
+// WebAuthnConfig describes the relying party (this site) that passkeys are bound to
+type WebAuthnConfig struct {
+	// RPID is the domain passkeys are scoped to, e.g. "example.com"
+	RPID string
+	// RPName is shown by the browser when creating a passkey
+	RPName string
+	// Origins are the exact browser origins allowed to use the passkeys, e.g. "https://app.example.com"
+	Origins []string
+}
+
+// CollectedClientData is the JSON the browser signs over together with the authenticator data
+type CollectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin,omitempty"`
+}
+
+// AuthenticatorData is the parsed binary authenticator data of a registration or assertion
+type AuthenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	// PublicKey is the COSE encoded credential public key, present on registration only
+	PublicKey []byte
+}
+
+// UserPresent reports whether the user touched or otherwise interacted with the authenticator
+func (ad *AuthenticatorData) UserPresent() bool {
+	return ad.Flags&authDataFlagUserPresent != 0
+}
+
+// UserVerified reports whether the authenticator verified the user with a PIN or biometric
+func (ad *AuthenticatorData) UserVerified() bool {
+	return ad.Flags&authDataFlagUserVerified != 0
+}
+
+// VerifiedCredential is a new credential that passed registration checks
+type VerifiedCredential struct {
+	ID           []byte
+	PublicKey    []byte
+	SignCount    uint32
+	UserVerified bool
+}
+
+// VerifiedAssertion is the result of an assertion that passed verification
+type VerifiedAssertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// VerifyRegistration checks the response of navigator.credentials.create() (WebAuthn section 7.1)
+// and returns the new credential. Attestation statements are not verified: we request "none"
+// and do not restrict which authenticator models may be used.
+func (c WebAuthnConfig) VerifyRegistration(clientDataJSON, attestationObject, challenge []byte) (*VerifiedCredential, error) {
+	if err := c.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed attestation object: %v", ErrInvalidWebAuthnResponse, err)
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrInvalidWebAuthnResponse)
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object has no authenticator data", ErrInvalidWebAuthnResponse)
+	}
+
+	authData, err := ParseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.CredentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrInvalidWebAuthnResponse)
+	}
+
+	// Reject keys we could never verify an assertion with
+	if _, err := parseCOSEPublicKey(authData.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return &VerifiedCredential{
+		ID:           authData.CredentialID,
+		PublicKey:    authData.PublicKey,
+		SignCount:    authData.SignCount,
+		UserVerified: authData.UserVerified(),
+	}, nil
+}
+
+// VerifyAssertion checks the response of navigator.credentials.get() against a stored credential
+// (WebAuthn section 7.2). A signature counter that did not increase points to a cloned
+// authenticator and fails verification.
+func (c WebAuthnConfig) VerifyAssertion(publicKey []byte, storedSignCount uint32, clientDataJSON, rawAuthData, signature, challenge []byte) (*VerifiedAssertion, error) {
+	if err := c.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	authData, err := ParseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+
+	key, err := parseCOSEPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	if err := verifyCOSESignature(key, signed, signature); err != nil {
+		return nil, err
+	}
+
+	// Authenticators that do not keep a counter always report 0
+	if (authData.SignCount != 0 || storedSignCount != 0) && authData.SignCount <= storedSignCount {
+		return nil, fmt.Errorf("%w: signature counter did not increase", ErrInvalidWebAuthnResponse)
+	}
+
+	return &VerifiedAssertion{
+		SignCount:    authData.SignCount,
+		UserVerified: authData.UserVerified(),
+	}, nil
+}
+
+// ParseClientData decodes the client data JSON of a registration or assertion
+func ParseClientData(clientDataJSON []byte) (*CollectedClientData, error) {
+	var clientData CollectedClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return nil, fmt.Errorf("%w: malformed client data", ErrInvalidWebAuthnResponse)
+	}
+	return &clientData, nil
+}
+
+// ParseAuthenticatorData decodes binary authenticator data (WebAuthn section 6.1)
+func ParseAuthenticatorData(data []byte) (*AuthenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidWebAuthnResponse)
+	}
+
+	authData := &AuthenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	if authData.Flags&authDataFlagAttestedCredData == 0 {
+		return authData, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidWebAuthnResponse)
+	}
+	authData.AAGUID = rest[:16]
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength > maxCredentialIDLength || idLength > len(rest) {
+		return nil, fmt.Errorf("%w: invalid credential ID length", ErrInvalidWebAuthnResponse)
+	}
+	authData.CredentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	// The public key is the only item whose length is not given up front
+	_, keyLength, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed credential public key: %v", ErrInvalidWebAuthnResponse, err)
+	}
+	authData.PublicKey = rest[:keyLength]
+
+	return authData, nil
+}
+
+// DecodeWebAuthnBase64 decodes the base64url values browsers use for binary WebAuthn fields
+func DecodeWebAuthnBase64(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+// EncodeWebAuthnBase64 encodes binary WebAuthn fields for the browser
+func EncodeWebAuthnBase64(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+func (c WebAuthnConfig) verifyClientData(clientDataJSON []byte, expectedType string, challenge []byte) error {
+	clientData, err := ParseClientData(clientDataJSON)
+	if err != nil {
+		return err
+	}
+
+	if clientData.Type != expectedType {
+		return fmt.Errorf("%w: unexpected client data type %q", ErrInvalidWebAuthnResponse, clientData.Type)
+	}
+
+	received, err := DecodeWebAuthnBase64(clientData.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidWebAuthnResponse)
+	}
+
+	if clientData.CrossOrigin {
+		return fmt.Errorf("%w: cross-origin requests are not allowed", ErrInvalidWebAuthnResponse)
+	}
+
+	for _, origin := range c.Origins {
+		if clientData.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: origin %q is not allowed", ErrInvalidWebAuthnResponse, clientData.Origin)
+}
+
+func (c WebAuthnConfig) verifyAuthenticatorData(authData *AuthenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(c.RPID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return fmt.Errorf("%w: relying party ID mismatch", ErrInvalidWebAuthnResponse)
+	}
+
+	if !authData.UserPresent() {
+		return fmt.Errorf("%w: user was not present", ErrInvalidWebAuthnResponse)
+	}
+
+	return nil
+}
+
+// parseCOSEPublicKey decodes a COSE_Key (RFC 9053) of one of the supported algorithms
+func parseCOSEPublicKey(data []byte) (crypto.PublicKey, error) {
+	decoded, n, err := decodeCBOR(data)
+	if err != nil || n != len(data) {
+		return nil, fmt.Errorf("%w: malformed public key", ErrInvalidWebAuthnResponse)
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed public key", ErrInvalidWebAuthnResponse)
+	}
+
+	kty, _ := key[int64(1)].(int64)
+	alg, _ := key[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == COSEAlgES256:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: invalid P-256 public key", ErrInvalidWebAuthnResponse)
+		}
+		// Let crypto/ecdh check that the point is on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("%w: invalid P-256 public key", ErrInvalidWebAuthnResponse)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	case kty == 1 && alg == COSEAlgEdDSA:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid Ed25519 public key", ErrInvalidWebAuthnResponse)
+		}
+		return ed25519.PublicKey(x), nil
+
+	case kty == 3 && alg == COSEAlgRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: invalid RSA public key", ErrInvalidWebAuthnResponse)
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+
+	default:
+		return nil, fmt.Errorf("%w: unsupported public key algorithm %d", ErrInvalidWebAuthnResponse, alg)
+	}
+}
+
+// verifyCOSESignature checks a WebAuthn assertion signature with a parsed credential public key
+func verifyCOSESignature(key crypto.PublicKey, message, signature []byte) error {
+	digest := sha256.Sum256(message)
+
+	valid := false
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(k, digest[:], signature)
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, message, signature)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	}
+
+	if !valid {
+		return fmt.Errorf("%w: invalid signature", ErrInvalidWebAuthnResponse)
+	}
+	return nil
+}
@@ -0,0 +1,539 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+	"github.com/lib/pq"
+)
+
+// Purposes a WebAuthn challenge can be issued for
+const (
+	webAuthnPurposeRegister = "register"
+	webAuthnPurposeLogin    = "login"
+	webAuthnPurposeStepUp   = "step_up"
+)
+
+const defaultPasskeyName = "Passkey"
+
+var (
+	// ErrWebAuthnChallengeNotFound is returned for unknown, expired, used or foreign challenges
+	ErrWebAuthnChallengeNotFound = errors.New("invalid or expired WebAuthn challenge")
+	// ErrWebAuthnCredentialNotFound is returned when a passkey does not exist or belongs to someone else
+	ErrWebAuthnCredentialNotFound = errors.New("passkey not found")
+	// ErrWebAuthnCredentialExists is returned when registering a passkey that is already registered
+	ErrWebAuthnCredentialExists = errors.New("passkey is already registered")
+	// ErrNoPasskeys is returned when starting a step-up for a user without passkeys
+	ErrNoPasskeys = errors.New("no passkey registered")
+	// ErrStepUpRequired is returned when a sensitive request lacks a valid step-up token
+	ErrStepUpRequired = errors.New("step-up authentication required")
+)
+
+// WebAuthnService handles passkeys: registration, passwordless login and step-up
+// authentication for sensitive operations
+type WebAuthnService struct {
+	db                    *sql.DB
+	config                WebAuthnConfig
+	stepUpRequiresPasskey bool
+	challengeTTL          time.Duration
+	stepUpTTL             time.Duration
+}
+
+// NewWebAuthnService creates a new WebAuthn service. If stepUpRequiresPasskey is false,
+// users without a passkey pass step-up checks on their session alone.
+func NewWebAuthnService(db *sql.DB, config WebAuthnConfig, stepUpRequiresPasskey bool) *WebAuthnService {
+	return &WebAuthnService{
+		db:                    db,
+		config:                config,
+		stepUpRequiresPasskey: stepUpRequiresPasskey,
+		challengeTTL:          5 * time.Minute,
+		stepUpTTL:             5 * time.Minute,
+	}
+}
+
+// BeginRegistration creates the options for adding a passkey to a user's account
+func (ws *WebAuthnService) BeginRegistration(user *models.User) (*models.WebAuthnCreationOptions, error) {
+	challenge, err := ws.createChallenge(user.ID, webAuthnPurposeRegister)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := ws.credentialDescriptors(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := user.Name
+	if displayName == "" {
+		displayName = user.Email
+	}
+
+	return &models.WebAuthnCreationOptions{
+		RP: models.WebAuthnRelyingParty{
+			ID:   ws.config.RPID,
+			Name: ws.config.RPName,
+		},
+		User: models.WebAuthnUserEntity{
+			ID:          EncodeWebAuthnBase64(webAuthnUserHandle(user.ID)),
+			Name:        user.Email,
+			DisplayName: displayName,
+		},
+		Challenge: challenge,
+		PubKeyCredParams: []models.WebAuthnCredentialParameter{
+			{Type: "public-key", Alg: COSEAlgES256},
+			{Type: "public-key", Alg: COSEAlgEdDSA},
+			{Type: "public-key", Alg: COSEAlgRS256},
+		},
+		Timeout:            int(ws.challengeTTL.Milliseconds()),
+		ExcludeCredentials: existing,
+		AuthenticatorSelection: models.WebAuthnAuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}, nil
+}
+
+// FinishRegistration verifies a new credential from the browser and stores it as a passkey of the user
+func (ws *WebAuthnService) FinishRegistration(userID int, name string, credential *models.WebAuthnRegistrationCredential) (*models.WebAuthnCredential, error) {
+	clientDataJSON, err := DecodeWebAuthnBase64(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed client data", ErrInvalidWebAuthnResponse)
+	}
+	attestationObject, err := DecodeWebAuthnBase64(credential.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrInvalidWebAuthnResponse)
+	}
+
+	challenge, err := ws.consumeChallenge(clientDataJSON, webAuthnPurposeRegister, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	verified, err := ws.config.VerifyRegistration(clientDataJSON, attestationObject, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = defaultPasskeyName
+	}
+	transports := credential.Response.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+
+	query := `
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, name, transports)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (credential_id) DO NOTHING
+		RETURNING id, user_id, name, transports, created_at, last_used_at
+	`
+
+	stored := &models.WebAuthnCredential{}
+	err = ws.db.QueryRow(query, userID, verified.ID, verified.PublicKey, int64(verified.SignCount), name, pq.Array(transports)).Scan(
+		&stored.ID,
+		&stored.UserID,
+		&stored.Name,
+		pq.Array(&stored.Transports),
+		&stored.CreatedAt,
+		&stored.LastUsedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWebAuthnCredentialExists
+		}
+		return nil, fmt.Errorf("failed to store passkey: %w", err)
+	}
+
+	return stored, nil
+}
+
+// BeginLogin creates the options for a passkey login. With an email only that account's passkeys
+// are offered; without one the browser lets the user pick any passkey it holds for the site.
+func (ws *WebAuthnService) BeginLogin(email string) (*models.WebAuthnRequestOptions, error) {
+	challenge, err := ws.createChallenge(0, webAuthnPurposeLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := []models.WebAuthnCredentialDescriptor{}
+	if email = strings.TrimSpace(email); email != "" {
+		// An unknown email gets the same answer as a discoverable login, so accounts cannot be probed
+		var userID int
+		err := ws.db.QueryRow(`SELECT id FROM users WHERE LOWER(email) = LOWER($1)`, email).Scan(&userID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to get user by email: %w", err)
+		}
+		if err == nil {
+			if allowed, err = ws.credentialDescriptors(userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return ws.requestOptions(challenge, allowed), nil
+}
+
+// FinishLogin verifies a passkey assertion and returns the user it signs in, and whether
+// the authenticator verified the user (which makes the login multi-factor)
+func (ws *WebAuthnService) FinishLogin(credential *models.WebAuthnAssertionCredential) (int, bool, error) {
+	clientDataJSON, err := DecodeWebAuthnBase64(credential.Response.ClientDataJSON)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: malformed client data", ErrInvalidWebAuthnResponse)
+	}
+
+	challenge, err := ws.consumeChallenge(clientDataJSON, webAuthnPurposeLogin, 0)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return ws.verifyAssertion(credential, clientDataJSON, challenge, 0)
+}
+
+// CredentialEmail returns the email of the user a passkey assertion claims to be from, so that failed
+// passkey logins count against the account and a locked out account is refused before verifying
+func (ws *WebAuthnService) CredentialEmail(credential *models.WebAuthnAssertionCredential) (string, error) {
+	credentialID, err := DecodeWebAuthnBase64(credential.RawID)
+	if err != nil {
+		return "", fmt.Errorf("%w: malformed credential ID", ErrInvalidWebAuthnResponse)
+	}
+
+	query := `
+		SELECT u.email
+		FROM webauthn_credentials c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.credential_id = $1
+	`
+
+	var email string
+	if err := ws.db.QueryRow(query, credentialID).Scan(&email); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrWebAuthnCredentialNotFound
+		}
+		return "", fmt.Errorf("failed to get passkey: %w", err)
+	}
+
+	return email, nil
+}
+
+// BeginStepUp creates the options for re-confirming a user with one of their passkeys
+func (ws *WebAuthnService) BeginStepUp(userID int) (*models.WebAuthnRequestOptions, error) {
+	allowed, err := ws.credentialDescriptors(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(allowed) == 0 {
+		return nil, ErrNoPasskeys
+	}
+
+	challenge, err := ws.createChallenge(userID, webAuthnPurposeStepUp)
+	if err != nil {
+		return nil, err
+	}
+
+	return ws.requestOptions(challenge, allowed), nil
+}
+
+// FinishStepUp verifies a fresh passkey assertion of the user and returns a single-use step-up token
+func (ws *WebAuthnService) FinishStepUp(userID int, credential *models.WebAuthnAssertionCredential) (*models.StepUpToken, error) {
+	clientDataJSON, err := DecodeWebAuthnBase64(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed client data", ErrInvalidWebAuthnResponse)
+	}
+
+	challenge, err := ws.consumeChallenge(clientDataJSON, webAuthnPurposeStepUp, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := ws.verifyAssertion(credential, clientDataJSON, challenge, userID); err != nil {
+		return nil, err
+	}
+
+	token, err := generateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(ws.stepUpTTL)
+	query := `INSERT INTO step_up_tokens (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`
+	if _, err := ws.db.Exec(query, hashToken(token), userID, expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to store step-up token: %w", err)
+	}
+
+	// Opportunistically drop expired step-up tokens
+	if _, err := ws.db.Exec(`DELETE FROM step_up_tokens WHERE expires_at < $1`, time.Now().Add(-time.Hour)); err != nil {
+		log.Printf("Warning: Failed to purge step-up tokens: %v", err)
+	}
+
+	return &models.StepUpToken{
+		StepUpToken: token,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// StepUpRequired reports whether sensitive requests of a user need a step-up token
+func (ws *WebAuthnService) StepUpRequired(userID int) (bool, error) {
+	if ws.stepUpRequiresPasskey {
+		return true, nil
+	}
+	return ws.HasCredentials(userID)
+}
+
+// ConsumeStepUpToken uses up a step-up token of the user, returning ErrStepUpRequired if it is not valid
+func (ws *WebAuthnService) ConsumeStepUpToken(userID int, token string) error {
+	query := `
+		UPDATE step_up_tokens
+		SET used_at = $1
+		WHERE token_hash = $2 AND user_id = $3 AND used_at IS NULL AND expires_at > $1
+	`
+
+	result, err := ws.db.Exec(query, time.Now(), hashToken(token), userID)
+	if err != nil {
+		return fmt.Errorf("failed to use step-up token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrStepUpRequired
+	}
+
+	return nil
+}
+
+// HasCredentials reports whether a user has registered at least one passkey
+func (ws *WebAuthnService) HasCredentials(userID int) (bool, error) {
+	var exists bool
+	err := ws.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM webauthn_credentials WHERE user_id = $1)`, userID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check passkeys: %w", err)
+	}
+
+	return exists, nil
+}
+
+// ListCredentials returns the passkeys of a user
+func (ws *WebAuthnService) ListCredentials(userID int) ([]models.WebAuthnCredential, error) {
+	query := `
+		SELECT id, user_id, name, transports, created_at, last_used_at
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := ws.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get passkeys: %w", err)
+	}
+	defer rows.Close()
+
+	credentials := []models.WebAuthnCredential{}
+	for rows.Next() {
+		var credential models.WebAuthnCredential
+		if err := rows.Scan(
+			&credential.ID,
+			&credential.UserID,
+			&credential.Name,
+			pq.Array(&credential.Transports),
+			&credential.CreatedAt,
+			&credential.LastUsedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan passkey: %w", err)
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+// DeleteCredential removes a passkey of a user
+func (ws *WebAuthnService) DeleteCredential(userID, credentialID int) error {
+	result, err := ws.db.Exec(`DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`, credentialID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+
+	return nil
+}
+
+// verifyAssertion checks an assertion against the stored passkey it names and records the new
+// signature counter. If userID is set the passkey must belong to that user.
+func (ws *WebAuthnService) verifyAssertion(credential *models.WebAuthnAssertionCredential, clientDataJSON, challenge []byte, userID int) (int, bool, error) {
+	credentialID, err := DecodeWebAuthnBase64(credential.RawID)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: malformed credential ID", ErrInvalidWebAuthnResponse)
+	}
+	authData, err := DecodeWebAuthnBase64(credential.Response.AuthenticatorData)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: malformed authenticator data", ErrInvalidWebAuthnResponse)
+	}
+	signature, err := DecodeWebAuthnBase64(credential.Response.Signature)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: malformed signature", ErrInvalidWebAuthnResponse)
+	}
+	userHandle, err := DecodeWebAuthnBase64(credential.Response.UserHandle)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: malformed user handle", ErrInvalidWebAuthnResponse)
+	}
+
+	tx, err := ws.db.Begin()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id, ownerID int
+	var publicKey []byte
+	var signCount int64
+	query := `SELECT id, user_id, public_key, sign_count FROM webauthn_credentials WHERE credential_id = $1 FOR UPDATE`
+	if err := tx.QueryRow(query, credentialID).Scan(&id, &ownerID, &publicKey, &signCount); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, ErrWebAuthnCredentialNotFound
+		}
+		return 0, false, fmt.Errorf("failed to get passkey: %w", err)
+	}
+
+	if userID != 0 && ownerID != userID {
+		return 0, false, ErrWebAuthnCredentialNotFound
+	}
+
+	// Discoverable credentials name their account; it has to be the one the passkey was registered to
+	if len(userHandle) > 0 && string(userHandle) != string(webAuthnUserHandle(ownerID)) {
+		return 0, false, fmt.Errorf("%w: user handle mismatch", ErrInvalidWebAuthnResponse)
+	}
+
+	verified, err := ws.config.VerifyAssertion(publicKey, uint32(signCount), clientDataJSON, authData, signature, challenge)
+	if err != nil {
+		return 0, false, err
+	}
+
+	_, err = tx.Exec(`UPDATE webauthn_credentials SET sign_count = $1, last_used_at = $2 WHERE id = $3`, int64(verified.SignCount), time.Now(), id)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to update passkey: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("failed to commit passkey use: %w", err)
+	}
+
+	return ownerID, verified.UserVerified, nil
+}
+
+// createChallenge stores a new single-use challenge and returns it base64url encoded
+func (ws *WebAuthnService) createChallenge(userID int, purpose string) (string, error) {
+	challenge, err := generateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	owner := sql.NullInt64{Int64: int64(userID), Valid: userID != 0}
+	query := `INSERT INTO webauthn_challenges (challenge_hash, user_id, purpose, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := ws.db.Exec(query, hashToken(challenge), owner, purpose, time.Now().Add(ws.challengeTTL)); err != nil {
+		return "", fmt.Errorf("failed to store WebAuthn challenge: %w", err)
+	}
+
+	// Opportunistically drop expired challenges
+	if _, err := ws.db.Exec(`DELETE FROM webauthn_challenges WHERE expires_at < $1`, time.Now().Add(-time.Hour)); err != nil {
+		log.Printf("Warning: Failed to purge WebAuthn challenges: %v", err)
+	}
+
+	return challenge, nil
+}
+
+// consumeChallenge uses up the challenge the browser signed and returns its raw bytes.
+// The challenge is burnt even if the response later fails verification.
+func (ws *WebAuthnService) consumeChallenge(clientDataJSON []byte, purpose string, userID int) ([]byte, error) {
+	clientData, err := ParseClientData(clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := DecodeWebAuthnBase64(clientData.Challenge)
+	if err != nil || len(challenge) == 0 {
+		return nil, ErrWebAuthnChallengeNotFound
+	}
+
+	query := `
+		UPDATE webauthn_challenges
+		SET used_at = $1
+		WHERE challenge_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING COALESCE(user_id, 0)
+	`
+
+	var owner int
+	err = ws.db.QueryRow(query, time.Now(), hashToken(EncodeWebAuthnBase64(challenge)), purpose).Scan(&owner)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWebAuthnChallengeNotFound
+		}
+		return nil, fmt.Errorf("failed to use WebAuthn challenge: %w", err)
+	}
+
+	if owner != userID {
+		return nil, ErrWebAuthnChallengeNotFound
+	}
+
+	return challenge, nil
+}
+
+// credentialDescriptors lists a user's passkeys in the form the browser expects
+func (ws *WebAuthnService) credentialDescriptors(userID int) ([]models.WebAuthnCredentialDescriptor, error) {
+	rows, err := ws.db.Query(`SELECT credential_id, transports FROM webauthn_credentials WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get passkeys: %w", err)
+	}
+	defer rows.Close()
+
+	descriptors := []models.WebAuthnCredentialDescriptor{}
+	for rows.Next() {
+		var credentialID []byte
+		var transports []string
+		if err := rows.Scan(&credentialID, pq.Array(&transports)); err != nil {
+			return nil, fmt.Errorf("failed to scan passkey: %w", err)
+		}
+		descriptors = append(descriptors, models.WebAuthnCredentialDescriptor{
+			Type:       "public-key",
+			ID:         EncodeWebAuthnBase64(credentialID),
+			Transports: transports,
+		})
+	}
+
+	return descriptors, rows.Err()
+}
+
+func (ws *WebAuthnService) requestOptions(challenge string, allowed []models.WebAuthnCredentialDescriptor) *models.WebAuthnRequestOptions {
+	return &models.WebAuthnRequestOptions{
+		Challenge:        challenge,
+		Timeout:          int(ws.challengeTTL.Milliseconds()),
+		RPID:             ws.config.RPID,
+		AllowCredentials: allowed,
+		UserVerification: "preferred",
+	}
+}
+
+// webAuthnUserHandle returns the opaque user handle stored with a user's passkeys
+func webAuthnUserHandle(userID int) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
@@ -0,0 +1,440 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/frallan97/hackaton-demo-backend/models"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://app.example.com"
+)
+
+var testWebAuthnConfig = WebAuthnConfig{
+	RPID:    testRPID,
+	RPName:  "Example",
+	Origins: []string{testOrigin},
+}
+
+// softAuthenticator is a software passkey that answers navigator.credentials calls like a browser would
+type softAuthenticator struct {
+	rpID         string
+	origin       string
+	signer       crypto.Signer
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	counterless  bool // like many platform authenticators, always report a counter of 0
+	userVerified bool
+}
+
+func newSoftAuthenticator(t *testing.T, alg int) *softAuthenticator {
+	t.Helper()
+
+	var signer crypto.Signer
+	var err error
+	switch alg {
+	case COSEAlgES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case COSEAlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("unsupported algorithm %d", alg)
+	}
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	credentialID := make([]byte, 32)
+	rand.Read(credentialID)
+
+	return &softAuthenticator{
+		rpID:         testRPID,
+		origin:       testOrigin,
+		signer:       signer,
+		credentialID: credentialID,
+		userHandle:   webAuthnUserHandle(42),
+		userVerified: true,
+	}
+}
+
+// create returns what navigator.credentials.create() would return for the options
+func (a *softAuthenticator) create(t *testing.T, options *models.WebAuthnCreationOptions) *models.WebAuthnRegistrationCredential {
+	t.Helper()
+
+	clientDataJSON := a.clientData(t, "webauthn.create", options.Challenge)
+
+	attestedData := make([]byte, 16+2) // zero AAGUID, as with "none" attestation
+	binary.BigEndian.PutUint16(attestedData[16:], uint16(len(a.credentialID)))
+	attestedData = append(attestedData, a.credentialID...)
+	attestedData = append(attestedData, a.coseKey(t)...)
+
+	authData := append(a.authData(authDataFlagAttestedCredData), attestedData...)
+	attestationObject := cborEncode(t, map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": authData,
+	})
+
+	return &models.WebAuthnRegistrationCredential{
+		ID:    EncodeWebAuthnBase64(a.credentialID),
+		RawID: EncodeWebAuthnBase64(a.credentialID),
+		Type:  "public-key",
+		Response: models.WebAuthnAttestationResponse{
+			ClientDataJSON:    EncodeWebAuthnBase64(clientDataJSON),
+			AttestationObject: EncodeWebAuthnBase64(attestationObject),
+			Transports:        []string{"internal"},
+		},
+	}
+}
+
+// get returns what navigator.credentials.get() would return for the options
+func (a *softAuthenticator) get(t *testing.T, options *models.WebAuthnRequestOptions) *models.WebAuthnAssertionCredential {
+	t.Helper()
+
+	if !a.counterless {
+		a.signCount++
+	}
+	clientDataJSON := a.clientData(t, "webauthn.get", options.Challenge)
+	authData := a.authData(0)
+	signature := a.sign(t, authData, clientDataJSON)
+
+	return &models.WebAuthnAssertionCredential{
+		ID:    EncodeWebAuthnBase64(a.credentialID),
+		RawID: EncodeWebAuthnBase64(a.credentialID),
+		Type:  "public-key",
+		Response: models.WebAuthnAssertionResponse{
+			ClientDataJSON:    EncodeWebAuthnBase64(clientDataJSON),
+			AuthenticatorData: EncodeWebAuthnBase64(authData),
+			Signature:         EncodeWebAuthnBase64(signature),
+			UserHandle:        EncodeWebAuthnBase64(a.userHandle),
+		},
+	}
+}
+
+// sign signs authenticator data and client data as an assertion
+func (a *softAuthenticator) sign(t *testing.T, authData, clientDataJSON []byte) []byte {
+	t.Helper()
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	message := append(append([]byte(nil), authData...), clientDataHash[:]...)
+
+	var signature []byte
+	var err error
+	if _, ok := a.signer.(ed25519.PrivateKey); ok {
+		signature, err = a.signer.Sign(rand.Reader, message, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(message)
+		signature, err = a.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatalf("failed to sign assertion: %v", err)
+	}
+	return signature
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, typ, challenge string) []byte {
+	t.Helper()
+
+	clientDataJSON, err := json.Marshal(CollectedClientData{Type: typ, Challenge: challenge, Origin: a.origin})
+	if err != nil {
+		t.Fatalf("failed to marshal client data: %v", err)
+	}
+	return clientDataJSON
+}
+
+func (a *softAuthenticator) authData(flags byte) []byte {
+	flags |= authDataFlagUserPresent
+	if a.userVerified {
+		flags |= authDataFlagUserVerified
+	}
+
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpIDHash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.signCount)
+	return data
+}
+
+func (a *softAuthenticator) coseKey(t *testing.T) []byte {
+	t.Helper()
+
+	switch pub := a.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		return cborEncode(t, map[interface{}]interface{}{
+			int64(1): int64(2), int64(3): int64(COSEAlgES256), int64(-1): int64(1), int64(-2): x, int64(-3): y,
+		})
+	case ed25519.PublicKey:
+		return cborEncode(t, map[interface{}]interface{}{
+			int64(1): int64(1), int64(3): int64(COSEAlgEdDSA), int64(-1): int64(6), int64(-2): []byte(pub),
+		})
+	}
+	t.Fatal("unsupported key type")
+	return nil
+}
+
+// decodeRegistration and decodeAssertion unpack browser JSON the way WebAuthnService does
+func decodeRegistration(t *testing.T, credential *models.WebAuthnRegistrationCredential) ([]byte, []byte) {
+	t.Helper()
+	clientDataJSON, err1 := DecodeWebAuthnBase64(credential.Response.ClientDataJSON)
+	attestationObject, err2 := DecodeWebAuthnBase64(credential.Response.AttestationObject)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("failed to decode registration: %v %v", err1, err2)
+	}
+	return clientDataJSON, attestationObject
+}
+
+func decodeAssertion(t *testing.T, credential *models.WebAuthnAssertionCredential) ([]byte, []byte, []byte) {
+	t.Helper()
+	clientDataJSON, err1 := DecodeWebAuthnBase64(credential.Response.ClientDataJSON)
+	authData, err2 := DecodeWebAuthnBase64(credential.Response.AuthenticatorData)
+	signature, err3 := DecodeWebAuthnBase64(credential.Response.Signature)
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatalf("failed to decode assertion: %v %v %v", err1, err2, err3)
+	}
+	return clientDataJSON, authData, signature
+}
+
+func newTestChallenge(t *testing.T) (string, []byte) {
+	t.Helper()
+	challenge, err := generateSecureToken(32)
+	if err != nil {
+		t.Fatalf("failed to generate challenge: %v", err)
+	}
+	raw, _ := DecodeWebAuthnBase64(challenge)
+	return challenge, raw
+}
+
+// register runs a full registration with the authenticator and returns the stored credential
+func register(t *testing.T, authenticator *softAuthenticator) *VerifiedCredential {
+	t.Helper()
+
+	challenge, raw := newTestChallenge(t)
+	credential := authenticator.create(t, &models.WebAuthnCreationOptions{Challenge: challenge})
+	clientDataJSON, attestationObject := decodeRegistration(t, credential)
+
+	verified, err := testWebAuthnConfig.VerifyRegistration(clientDataJSON, attestationObject, raw)
+	if err != nil {
+		t.Fatalf("VerifyRegistration failed: %v", err)
+	}
+	return verified
+}
+
+func TestWebAuthnRegistrationAndLogin(t *testing.T) {
+	for _, alg := range []int{COSEAlgES256, COSEAlgEdDSA} {
+		authenticator := newSoftAuthenticator(t, alg)
+		stored := register(t, authenticator)
+
+		if string(stored.ID) != string(authenticator.credentialID) {
+			t.Errorf("alg %d: expected the authenticator's credential ID", alg)
+		}
+		if !stored.UserVerified {
+			t.Errorf("alg %d: expected the registration to be user verified", alg)
+		}
+
+		signCount := stored.SignCount
+		for i := 0; i < 2; i++ {
+			challenge, raw := newTestChallenge(t)
+			assertion := authenticator.get(t, &models.WebAuthnRequestOptions{Challenge: challenge})
+			clientDataJSON, authData, signature := decodeAssertion(t, assertion)
+
+			result, err := testWebAuthnConfig.VerifyAssertion(stored.PublicKey, signCount, clientDataJSON, authData, signature, raw)
+			if err != nil {
+				t.Fatalf("alg %d: VerifyAssertion failed: %v", alg, err)
+			}
+			if result.SignCount != signCount+1 || !result.UserVerified {
+				t.Errorf("alg %d: unexpected assertion result %+v", alg, result)
+			}
+			signCount = result.SignCount
+		}
+	}
+}
+
+func TestWebAuthnRegistrationRejectsMismatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(a *softAuthenticator)
+	}{
+		{"origin", func(a *softAuthenticator) { a.origin = "https://evil.example.net" }},
+		{"relying party", func(a *softAuthenticator) { a.rpID = "evil.example.net" }},
+	}
+
+	for _, tt := range tests {
+		authenticator := newSoftAuthenticator(t, COSEAlgES256)
+		tt.modify(authenticator)
+
+		challenge, raw := newTestChallenge(t)
+		credential := authenticator.create(t, &models.WebAuthnCreationOptions{Challenge: challenge})
+		clientDataJSON, attestationObject := decodeRegistration(t, credential)
+
+		_, err := testWebAuthnConfig.VerifyRegistration(clientDataJSON, attestationObject, raw)
+		if !errors.Is(err, ErrInvalidWebAuthnResponse) {
+			t.Errorf("%s: expected ErrInvalidWebAuthnResponse, got %v", tt.name, err)
+		}
+	}
+
+	// A response to a different challenge
+	authenticator := newSoftAuthenticator(t, COSEAlgES256)
+	challenge, _ := newTestChallenge(t)
+	_, otherChallenge := newTestChallenge(t)
+	credential := authenticator.create(t, &models.WebAuthnCreationOptions{Challenge: challenge})
+	clientDataJSON, attestationObject := decodeRegistration(t, credential)
+	if _, err := testWebAuthnConfig.VerifyRegistration(clientDataJSON, attestationObject, otherChallenge); !errors.Is(err, ErrInvalidWebAuthnResponse) {
+		t.Errorf("challenge: expected ErrInvalidWebAuthnResponse, got %v", err)
+	}
+}
+
+func TestWebAuthnAssertionRejectsForgeries(t *testing.T) {
+	authenticator := newSoftAuthenticator(t, COSEAlgES256)
+	stored := register(t, authenticator)
+
+	// An assertion made for registration cannot be replayed as a login
+	challenge, raw := newTestChallenge(t)
+	credential := authenticator.create(t, &models.WebAuthnCreationOptions{Challenge: challenge})
+	clientDataJSON, _ := decodeRegistration(t, credential)
+	assertion := authenticator.get(t, &models.WebAuthnRequestOptions{Challenge: challenge})
+	_, authData, signature := decodeAssertion(t, assertion)
+	if _, err := testWebAuthnConfig.VerifyAssertion(stored.PublicKey, 0, clientDataJSON, authData, signature, raw); !errors.Is(err, ErrInvalidWebAuthnResponse) {
+		t.Errorf("type: expected ErrInvalidWebAuthnResponse, got %v", err)
+	}
+
+	// A tampered signature
+	challenge, raw = newTestChallenge(t)
+	assertion = authenticator.get(t, &models.WebAuthnRequestOptions{Challenge: challenge})
+	clientDataJSON, authData, signature = decodeAssertion(t, assertion)
+	signature[len(signature)-1] ^= 0xff
+	if _, err := testWebAuthnConfig.VerifyAssertion(stored.PublicKey, 0, clientDataJSON, authData, signature, raw); !errors.Is(err, ErrInvalidWebAuthnResponse) {
+		t.Errorf("signature: expected ErrInvalidWebAuthnResponse, got %v", err)
+	}
+
+	// A signature from another authenticator
+	other := newSoftAuthenticator(t, COSEAlgES256)
+	other.credentialID = authenticator.credentialID
+	assertion = other.get(t, &models.WebAuthnRequestOptions{Challenge: challenge})
+	clientDataJSON, authData, signature = decodeAssertion(t, assertion)
+	if _, err := testWebAuthnConfig.VerifyAssertion(stored.PublicKey, 0, clientDataJSON, authData, signature, raw); !errors.Is(err, ErrInvalidWebAuthnResponse) {
+		t.Errorf("key: expected ErrInvalidWebAuthnResponse, got %v", err)
+	}
+
+	// A validly signed assertion without user presence
+	challenge, raw = newTestChallenge(t)
+	assertion = authenticator.get(t, &models.WebAuthnRequestOptions{Challenge: challenge})
+	clientDataJSON, authData, _ = decodeAssertion(t, assertion)
+	authData[32] &^= authDataFlagUserPresent
+	signature = authenticator.sign(t, authData, clientDataJSON)
+	if _, err := testWebAuthnConfig.VerifyAssertion(stored.PublicKey, 0, clientDataJSON, authData, signature, raw); !errors.Is(err, ErrInvalidWebAuthnResponse) {
+		t.Errorf("presence: expected ErrInvalidWebAuthnResponse, got %v", err)
+	}
+}
+
+func TestWebAuthnAssertionDetectsClonedAuthenticator(t *testing.T) {
+	authenticator := newSoftAuthenticator(t, COSEAlgES256)
+	stored := register(t, authenticator)
+
+	// The clone's counter lags behind what the server has seen
+	authenticator.signCount = 4
+	challenge, raw := newTestChallenge(t)
+	assertion := authenticator.get(t, &models.WebAuthnRequestOptions{Challenge: challenge})
+	clientDataJSON, authData, signature := decodeAssertion(t, assertion)
+	if _, err := testWebAuthnConfig.VerifyAssertion(stored.PublicKey, 7, clientDataJSON, authData, signature, raw); !errors.Is(err, ErrInvalidWebAuthnResponse) {
+		t.Errorf("Expected a lagging counter to be rejected, got %v", err)
+	}
+
+	// Authenticators without a counter always send 0, which is fine
+	counterless := newSoftAuthenticator(t, COSEAlgES256)
+	counterless.counterless = true
+	stored = register(t, counterless)
+	for i := 0; i < 2; i++ {
+		challenge, raw := newTestChallenge(t)
+		assertion := counterless.get(t, &models.WebAuthnRequestOptions{Challenge: challenge})
+		clientDataJSON, authData, signature := decodeAssertion(t, assertion)
+		if _, err := testWebAuthnConfig.VerifyAssertion(stored.PublicKey, 0, clientDataJSON, authData, signature, raw); err != nil {
+			t.Errorf("Expected a zero counter to be accepted, got %v", err)
+		}
+	}
+}
+
+func TestDecodeCBORRejectsMalformedInput(t *testing.T) {
+	deep := make([]byte, 0, 64)
+	for i := 0; i < 40; i++ {
+		deep = append(deep, 0x81) // array of one item
+	}
+	deep = append(deep, 0x00)
+
+	inputs := map[string][]byte{
+		"empty":             {},
+		"truncated string":  {0x45, 1, 2},
+		"indefinite array":  {0x9f, 0x01, 0xff},
+		"huge length":       {0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"duplicate map key": {0xa2, 0x01, 0x01, 0x01, 0x02},
+		"deep nesting":      deep,
+	}
+
+	for name, input := range inputs {
+		if _, _, err := decodeCBOR(input); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// cborEncode encodes the value types decodeCBOR produces, so tests can build authenticator output
+func cborEncode(t *testing.T, value interface{}) []byte {
+	t.Helper()
+
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case map[interface{}]interface{}:
+		// Sort keys so the output is deterministic
+		keys := make([][]byte, 0, len(v))
+		encoded := map[string][]byte{}
+		for key, item := range v {
+			k := cborEncode(t, key)
+			keys = append(keys, k)
+			encoded[string(k)] = cborEncode(t, item)
+		}
+		sort.Slice(keys, func(i, j int) bool { return string(keys[i]) < string(keys[j]) })
+
+		out := head(5, uint64(len(v)))
+		for _, k := range keys {
+			out = append(append(out, k...), encoded[string(k)]...)
+		}
+		return out
+	}
+
+	t.Fatalf("cborEncode: unsupported type %T", value)
+	return nil
+}
@@ -151,6 +151,10 @@ func WriteNotFound(w http.ResponseWriter, message string) {
 	WriteError(w, http.StatusNotFound, message, nil)
 }
 
+func WriteConflict(w http.ResponseWriter, message string, err error) {
+	WriteError(w, http.StatusConflict, message, err)
+}
+
 func WriteInternalServerError(w http.ResponseWriter, message string, err error) {
 	WriteError(w, http.StatusInternalServerError, message, err)
 }
@@ -39,8 +39,32 @@ interface AuthContextType {
   authenticatedFetch: (url: string, options?: RequestInit) => Promise<Response>;
   hasRole: (roleName: string) => boolean;
   setError: (error: string) => void;
+  mfaToken: string | null;
+  completeLogin: (authData: any) => Promise<void>;
+  verifyMfa: (code: string) => Promise<boolean>;
+  cancelMfa: () => void;
 }
 
+// With cookie sessions (AUTH_COOKIES on the backend) the tokens stay in HttpOnly cookies and
+// requests carry the CSRF token from the login response instead of an Authorization header
+const getCsrfToken = (): string | null =>
+  localStorage.getItem('csrf_token') || document.cookie.match(/(?:^|; )csrf_token=([^;]*)/)?.[1] || null;
+
+const authHeaders = (): Record<string, string> => {
+  const token = localStorage.getItem('access_token');
+  if (token) {
+    return { 'Authorization': `Bearer ${token}` };
+  }
+  const csrfToken = getCsrfToken();
+  return csrfToken ? { 'X-CSRF-Token': csrfToken } : {};
+};
+
+const clearStoredTokens = (): void => {
+  localStorage.removeItem('access_token');
+  localStorage.removeItem('refresh_token');
+  localStorage.removeItem('csrf_token');
+};
+
 // Create Auth Context
 const AuthContext = createContext<AuthContextType | undefined>(undefined);
 
@@ -61,6 +85,8 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
   const [user, setUser] = useState<User | null>(null);
   const [loading, setLoading] = useState<boolean>(true);
   const [error, setError] = useState<string>('');
+  // Set while a login waits for a second factor
+  const [mfaToken, setMfaToken] = useState<string | null>(null);
 
   // Check if user is already logged in on component mount
   useEffect(() => {
@@ -71,24 +97,23 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
   useEffect(() => {
     const urlParams = new URLSearchParams(window.location.search);
     const code = urlParams.get('code');
+    const state = urlParams.get('state') || '';
     
     if (code) {
-      handleOAuthCallback(code);
+      handleOAuthCallback(code, state);
     }
   }, []);
 
   const checkAuthStatus = async (): Promise<void> => {
-    const token = localStorage.getItem('access_token');
-    if (!token) {
+    if (!localStorage.getItem('access_token') && !getCsrfToken()) {
       setLoading(false);
       return;
     }
 
     try {
       const response = await fetch(`${config.apiBaseUrl}/api/auth/me`, {
-        headers: {
-          'Authorization': `Bearer ${token}`
-        }
+        headers: authHeaders(),
+        credentials: 'include'
       });
 
       if (response.ok) {
@@ -99,10 +124,12 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
         try {
           const [rolesRes, orgsRes] = await Promise.all([
             fetch(`${config.apiBaseUrl}/api/admin/user-roles?id=${userData.id}`, {
-              headers: { 'Authorization': `Bearer ${token}` }
+              headers: authHeaders(),
+              credentials: 'include'
             }),
             fetch(`${config.apiBaseUrl}/api/admin/user-organizations?id=${userData.id}`, {
-              headers: { 'Authorization': `Bearer ${token}` }
+              headers: authHeaders(),
+              credentials: 'include'
             })
           ]);
 
@@ -130,15 +157,13 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
         setIsLoggedIn(true);
       } else {
         // Token is invalid, clear it
-        localStorage.removeItem('access_token');
-        localStorage.removeItem('refresh_token');
+        clearStoredTokens();
         setIsLoggedIn(false);
         setUser(null);
       }
     } catch (error) {
       console.error('Auth check failed:', error);
-      localStorage.removeItem('access_token');
-      localStorage.removeItem('refresh_token');
+      clearStoredTokens();
       setIsLoggedIn(false);
       setUser(null);
     } finally {
@@ -152,44 +177,156 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
 
     try {
       // Get the OAuth URL from our backend
-      const response = await fetch(`${config.apiBaseUrl}/api/auth/google/url`);
-      const data = await response.json();
+      // The backend sets a nonce cookie that must come back with the login request
+      const response = await fetch(`${config.apiBaseUrl}/api/auth/google/url`, {
+        credentials: 'include',
+      });
+      const responseData = await response.json();
       
       // Redirect to Google OAuth
-      window.location.href = data.auth_url;
+      sessionStorage.setItem('oauth_provider', 'google');
+      window.location.href = responseData.data.auth_url;
     } catch (error) {
       setError('Failed to start login process. Please try again.');
       setLoading(false);
     }
   };
 
-  const handleOAuthCallback = async (code: string): Promise<void> => {
+  // Stores the tokens of a finished login, or keeps the challenge of a login that needs a second factor
+  const completeLogin = async (authData: any): Promise<void> => {
+    if (authData?.mfa_required) {
+      setMfaToken(authData.mfa_token);
+      return;
+    }
+
+    setMfaToken(null);
+
+    // Store tokens, or only the CSRF token when the session lives in cookies
+    if (authData.csrf_token) {
+      localStorage.setItem('csrf_token', authData.csrf_token);
+    } else {
+      localStorage.setItem('access_token', authData.access_token);
+      localStorage.setItem('refresh_token', authData.refresh_token);
+    }
+
+    // Set user data
+    setUser(authData.user);
+    setIsLoggedIn(true);
+
+    // Finish a link that was waiting for the owner of this account to log in
+    const linkToken = sessionStorage.getItem('pending_link_token');
+    if (linkToken) {
+      sessionStorage.removeItem('pending_link_token');
+      await fetch(`${config.apiBaseUrl}/api/auth/link/confirm`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+          ...authHeaders()
+        },
+        credentials: 'include',
+        body: JSON.stringify({ link_token: linkToken })
+      });
+    }
+  };
+
+  // Answers the MFA challenge of a login with a TOTP or recovery code
+  const verifyMfa = async (code: string): Promise<boolean> => {
+    setError('');
+
+    try {
+      const response = await fetch(`${config.apiBaseUrl}/api/auth/mfa/verify`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ mfa_token: mfaToken, code })
+      });
+
+      const responseData = await response.json();
+      if (!response.ok) {
+        setError(responseData.error || responseData.message);
+        return false;
+      }
+
+      await completeLogin(responseData.data);
+      return true;
+    } catch (error) {
+      setError('Verification failed. Please try again.');
+      return false;
+    }
+  };
+
+  const cancelMfa = (): void => {
+    setMfaToken(null);
+  };
+
+  const handleOAuthCallback = async (code: string, state: string): Promise<void> => {
     setLoading(true);
     setError('');
 
     try {
-      const response = await fetch(`${config.apiBaseUrl}/api/auth/google/login`, {
+      // The provider the login was started with is remembered across the redirect
+      const provider = sessionStorage.getItem('oauth_provider') || 'google';
+      sessionStorage.removeItem('oauth_provider');
+
+      // Attaching another login to the signed-in account uses the same redirect
+      const intent = sessionStorage.getItem('oauth_intent');
+      sessionStorage.removeItem('oauth_intent');
+      const signedIn = localStorage.getItem('access_token') || getCsrfToken();
+
+      if (intent === 'link' && signedIn) {
+        const response = await fetch(`${config.apiBaseUrl}/api/auth/${provider}/link`, {
+          method: 'POST',
+          headers: {
+            'Content-Type': 'application/json',
+            ...authHeaders()
+          },
+          credentials: 'include',
+          body: JSON.stringify({ code, state })
+        });
+
+        if (!response.ok) {
+          const errorData = await response.json().catch(() => null);
+          setError(`Linking failed: ${errorData?.error || response.statusText}`);
+        }
+        window.history.replaceState({}, document.title, window.location.pathname);
+        await checkAuthStatus();
+        return;
+      }
+
+      const response = await fetch(`${config.apiBaseUrl}/api/auth/${provider}/login`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
-        body: JSON.stringify({ code })
+        credentials: 'include',
+        body: JSON.stringify({ code, state })
       });
 
-      if (response.ok) {
+      if (response.status === 202) {
+        // The account was created but an administrator has to approve it first
         const responseData = await response.json();
-        const authData = responseData.data; // Extract auth data from the response
-        
-        // Store tokens
-        localStorage.setItem('access_token', authData.access_token);
-        localStorage.setItem('refresh_token', authData.refresh_token);
-        
-        // Set user data
-        setUser(authData.user);
-        setIsLoggedIn(true);
-        
+        setError(responseData.message);
+        window.history.replaceState({}, document.title, window.location.pathname);
+      } else if (response.ok) {
+        const responseData = await response.json();
+        await completeLogin(responseData.data);
+
         // Clear the URL parameters
         window.history.replaceState({}, document.title, window.location.pathname);
+      } else if (response.status === 409) {
+        // The email belongs to an existing account; logging in to it confirms the link
+        const responseData = await response.json();
+        if (responseData.data?.link_token) {
+          sessionStorage.setItem('pending_link_token', responseData.data.link_token);
+        }
+        setError(responseData.error);
+        window.history.replaceState({}, document.title, window.location.pathname);
+      } else if (response.status === 403) {
+        // Refused by the sign-up policy or the account is not active yet
+        const responseData = await response.json();
+        setError(responseData.error);
+        window.history.replaceState({}, document.title, window.location.pathname);
       } else {
         const errorData = await response.text();
         setError(`Login failed: ${errorData}`);
@@ -206,17 +343,15 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
       // Call logout endpoint
       await fetch(`${config.apiBaseUrl}/api/auth/logout`, {
         method: 'POST',
-        headers: {
-          'Authorization': `Bearer ${localStorage.getItem('access_token')}`
-        }
+        headers: authHeaders(),
+        credentials: 'include'
       });
     } catch (error) {
       console.error('Logout request failed:', error);
     }
 
     // Clear local storage and state
-    localStorage.removeItem('access_token');
-    localStorage.removeItem('refresh_token');
+    clearStoredTokens();
     setIsLoggedIn(false);
     setUser(null);
     setError('');
@@ -224,21 +359,30 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
 
   const refreshToken = async (): Promise<boolean> => {
     const refreshToken = localStorage.getItem('refresh_token');
-    if (!refreshToken) return false;
+    const csrfToken = getCsrfToken();
+    if (!refreshToken && !csrfToken) return false;
 
     try {
+      // Cookie sessions send no body; the refresh token cookie is rotated by the response
       const response = await fetch(`${config.apiBaseUrl}/api/auth/refresh`, {
         method: 'POST',
-        headers: {
-          'Content-Type': 'application/json',
-        },
-        body: JSON.stringify({ refresh_token: refreshToken })
+        headers: refreshToken
+          ? { 'Content-Type': 'application/json' }
+          : { 'X-CSRF-Token': csrfToken as string },
+        credentials: 'include',
+        body: refreshToken ? JSON.stringify({ refresh_token: refreshToken }) : undefined
       });
 
       if (response.ok) {
         const responseData = await response.json();
         const data = responseData.data; // Extract refresh data from the response
+        if (data.csrf_token) {
+          localStorage.setItem('csrf_token', data.csrf_token);
+          return true;
+        }
         localStorage.setItem('access_token', data.access_token);
+        // Refresh tokens are single-use, so always keep the rotated one
+        localStorage.setItem('refresh_token', data.refresh_token);
         return true;
       }
     } catch (error) {
@@ -250,21 +394,17 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
 
   // Helper function to make authenticated API calls
   const authenticatedFetch = async (url: string, options: RequestInit = {}): Promise<Response> => {
-    const token = localStorage.getItem('access_token');
-    
-    const headers: HeadersInit = {
+    const headers: Record<string, string> = {
       'Content-Type': 'application/json',
-      ...options.headers,
+      ...(options.headers as Record<string, string>),
+      ...authHeaders(),
     };
 
-    if (token) {
-      headers.Authorization = `Bearer ${token}`;
-    }
-
     try {
       const response = await fetch(url, {
         ...options,
         headers,
+        credentials: 'include',
       });
 
       // If token expired, try to refresh
@@ -272,11 +412,10 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
         const refreshed = await refreshToken();
         if (refreshed) {
           // Retry the request with new token
-          const newToken = localStorage.getItem('access_token');
-          headers.Authorization = `Bearer ${newToken}`;
           return await fetch(url, {
             ...options,
-            headers,
+            headers: { ...headers, ...authHeaders() },
+            credentials: 'include',
           });
         } else {
           // Refresh failed, logout user
@@ -306,7 +445,11 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
     refreshToken,
     authenticatedFetch,
     hasRole,
-    setError
+    setError,
+    mfaToken,
+    completeLogin,
+    verifyMfa,
+    cancelMfa
   };
 
   return (
@@ -0,0 +1,122 @@
+import React from 'react';
+import { Link } from 'react-router-dom';
+import { useAuth } from './AuthContext';
+import config from './config';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { Alert, AlertDescription } from '@/components/ui/alert';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { Smartphone } from 'lucide-react';
+
+interface DeviceLogin {
+  user_code: string;
+  client_id: string;
+  expires_at: string;
+}
+
+// Verification page of the device login flow: the user enters the code shown by a CLI or
+// editor tool, checks which client asks and approves or denies the login.
+const DevicePage: React.FC = () => {
+  const { authenticatedFetch } = useAuth();
+  const [userCode, setUserCode] = React.useState(
+    () => new URLSearchParams(window.location.search).get('user_code') || ''
+  );
+  const [login, setLogin] = React.useState<DeviceLogin | null>(null);
+  const [message, setMessage] = React.useState<string | null>(null);
+  const [error, setError] = React.useState<string | null>(null);
+
+  const request = async (method: string, body?: object) => {
+    const query = method === 'GET' ? `?user_code=${encodeURIComponent(userCode)}` : '';
+    const response = await authenticatedFetch(`${config.apiBaseUrl}/api/auth/device${query}`, {
+      method,
+      body: body ? JSON.stringify(body) : undefined,
+    });
+    const responseData = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      throw new Error(responseData.message || responseData.error || 'Request failed');
+    }
+    return responseData;
+  };
+
+  const lookup = async () => {
+    setError(null);
+    setMessage(null);
+    try {
+      setLogin((await request('GET')).data);
+    } catch (err: any) {
+      setLogin(null);
+      setError(err.message);
+    }
+  };
+
+  const decide = async (approve: boolean) => {
+    setError(null);
+    try {
+      setMessage((await request('POST', { user_code: userCode, approve })).message);
+      setLogin(null);
+    } catch (err: any) {
+      setError(err.message);
+    }
+  };
+
+  React.useEffect(() => {
+    if (userCode) {
+      lookup();
+    }
+  }, []);
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-blue-50 to-indigo-100 dark:from-gray-900 dark:to-gray-800 p-4">
+      <Card className="w-full max-w-md shadow-xl dark:bg-gray-800 dark:border-gray-700">
+        <CardHeader>
+          <CardTitle className="flex items-center gap-3 text-xl dark:text-white">
+            <Smartphone className="w-5 h-5" />
+            Connect a device
+          </CardTitle>
+          <CardDescription className="dark:text-gray-400">
+            Enter the code shown by your CLI or editor. Only approve codes you requested yourself.
+          </CardDescription>
+        </CardHeader>
+        <CardContent className="space-y-4">
+          {error && (
+            <Alert variant="destructive">
+              <AlertDescription>{error}</AlertDescription>
+            </Alert>
+          )}
+          {message && (
+            <Alert>
+              <AlertDescription>{message}</AlertDescription>
+            </Alert>
+          )}
+
+          {login ? (
+            <div className="space-y-4">
+              <p className="text-sm dark:text-gray-300">
+                <span className="font-medium">{login.client_id}</span> wants to sign in to your account with
+                code <span className="font-mono">{login.user_code}</span>.
+              </p>
+              <div className="flex gap-2">
+                <Button onClick={() => decide(true)}>Approve</Button>
+                <Button variant="outline" onClick={() => decide(false)}>Deny</Button>
+              </div>
+            </div>
+          ) : (
+            <div className="flex gap-2">
+              <Input
+                className="font-mono uppercase"
+                placeholder="XXXX-XXXX"
+                value={userCode}
+                onChange={(e) => setUserCode(e.target.value)}
+              />
+              <Button onClick={lookup} disabled={!userCode.trim()}>Continue</Button>
+            </div>
+          )}
+
+          <Link to="/" className="block text-sm text-blue-600 dark:text-blue-400">Back to the app</Link>
+        </CardContent>
+      </Card>
+    </div>
+  );
+};
+
+export default DevicePage;
@@ -1,4 +1,4 @@
-import React, { useState } from 'react';
+import React, { useEffect, useState } from 'react';
 import { Link } from 'react-router-dom';
 import { useAuth } from './AuthContext';
 import { useAppSelector, useAppDispatch } from './store/hooks';
@@ -14,19 +14,44 @@ import { Loader2, Shield, Building2, User, Calendar, Mail, Key, RefreshCw, LogOu
 import { ThemeToggle } from './components/ThemeToggle';
 import { ReduxDemo } from './components/ReduxDemo';
 import { PaymentDemo } from './components/PaymentDemo';
+import { ProfileSettings } from './components/ProfileSettings';
+import { MFASettings } from './components/MFASettings';
+import { PasskeySettings } from './components/PasskeySettings';
+import { AccessTokenSettings } from './components/AccessTokenSettings';
+import { ConnectedAppsSettings } from './components/ConnectedAppsSettings';
+import { SessionSettings } from './components/SessionSettings';
+import { LoginHistory } from './components/LoginHistory';
 
 const HomePage: React.FC = () => {
   const { user, handleLogout, refreshToken, hasRole, authenticatedFetch, setError } = useAuth();
   const dispatch = useAppDispatch();
   const [setupFirstAdmin, { isLoading: setupLoading }] = useSetupFirstAdminMutation();
+  const [setupRequired, setSetupRequired] = useState<boolean>(false);
+
+  // The first admin can only be set up while no admin exists
+  useEffect(() => {
+    fetch(`${config.apiBaseUrl}/api/setup/status`)
+      .then((response) => response.json())
+      .then((status) => setSetupRequired(status.setup_required))
+      .catch(() => setSetupRequired(false));
+  }, []);
 
   const handleSetupAdmin = async (): Promise<void> => {
+    // The one-time setup token is printed in the backend log at startup
+    const setupToken = window.prompt('Enter the setup token from the server log');
+    if (!setupToken || !user) {
+      return;
+    }
+
     try {
-      const result = await setupFirstAdmin().unwrap();
+      await setupFirstAdmin({ email: user.email, setup_token: setupToken }).unwrap();
+      setSetupRequired(false);
       dispatch(showSuccess('Admin setup successful! Please refresh your token or login again to see admin features.'));
     } catch (err: any) {
-      if (err.status === 409) {
-        dispatch(showError('Admin user already exists in the system.'));
+      if (err.status === 404) {
+        dispatch(showError('Setup has already been completed.'));
+      } else if (err.status === 403) {
+        dispatch(showError('Invalid setup token.'));
       } else {
         dispatch(showError('Setup failed: ' + (err.data?.message || err.message || 'Unknown error')));
       }
@@ -141,6 +166,14 @@ const HomePage: React.FC = () => {
           </CardContent>
         </Card>
 
+        <ProfileSettings />
+        <MFASettings />
+        <PasskeySettings />
+        <AccessTokenSettings />
+        <ConnectedAppsSettings />
+        <SessionSettings />
+        <LoginHistory />
+
         {/* Redux Demo Component */}
         <div className="mb-8">
           <ReduxDemo />
@@ -162,7 +195,7 @@ const HomePage: React.FC = () => {
             </Link>
           )}
           
-          {!hasRole('admin') && (
+          {!hasRole('admin') && setupRequired && (
             <Button
               onClick={handleSetupAdmin}
               disabled={setupLoading}
@@ -1,40 +1,68 @@
 import React from 'react';
 import { useAppDispatch, useAppSelector, useGoogleOAuth } from './store/hooks';
-import { useGetGoogleAuthUrlQuery, useGoogleLoginMutation } from './store/api';
+import { useGetGoogleAuthUrlQuery, useGetAuthProvidersQuery, useLazyGetAuthUrlQuery, useGoogleLoginMutation } from './store/api';
 import { Button } from '@/components/ui/button';
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
 import { Alert, AlertDescription } from '@/components/ui/alert';
-import { Loader2, Chrome } from 'lucide-react';
+import { Loader2, Chrome, Fingerprint } from 'lucide-react';
 import { ThemeToggle } from './components/ThemeToggle';
+import PasswordLoginForm from './components/PasswordLoginForm';
+import MFAChallengeForm from './components/MFAChallengeForm';
+import { useAuth } from './AuthContext';
+import { loginWithPasskey, passkeysSupported } from './lib/webauthn';
 
 const LoginPage: React.FC = () => {
   const dispatch = useAppDispatch();
   const { handleGoogleLoginSuccess } = useGoogleOAuth();
+  const { mfaToken, error: authError, completeLogin, setError: setAuthError } = useAuth();
+  const [isPasskeyLoading, setIsPasskeyLoading] = React.useState(false);
   
   // RTK Query hooks
   const { data: authUrlData, isLoading: isLoadingUrl, error: urlError } = useGetGoogleAuthUrlQuery();
   const [googleLogin, { isLoading: isLoggingIn, error: loginError }] = useGoogleLoginMutation();
+  const { data: providersData } = useGetAuthProvidersQuery();
+  const [getAuthUrl, { isFetching: isLoadingProviderUrl }] = useLazyGetAuthUrlQuery();
+  const otherProviders = (providersData?.providers || []).filter((provider) => provider !== 'google');
   
   // Check for OAuth callback code in URL
   React.useEffect(() => {
     const urlParams = new URLSearchParams(window.location.search);
     const code = urlParams.get('code');
+    const state = urlParams.get('state') || '';
     
     if (code) {
-      handleOAuthCallback(code);
+      handleOAuthCallback(code, state);
     }
   }, []);
 
   const handleGoogleLogin = async () => {
     if (authUrlData?.auth_url) {
       // Redirect to Google OAuth
+      sessionStorage.setItem('oauth_provider', 'google');
       window.location.href = authUrlData.auth_url;
     }
   };
 
-  const handleOAuthCallback = async (code: string) => {
+  const handleProviderLogin = async (provider: string) => {
+    const result = await getAuthUrl(provider).unwrap();
+    sessionStorage.setItem('oauth_provider', provider);
+    window.location.href = result.auth_url;
+  };
+
+  const handlePasskeyLogin = async () => {
+    setIsPasskeyLoading(true);
     try {
-      const result = await googleLogin({ code }).unwrap();
+      await completeLogin(await loginWithPasskey());
+    } catch (err: any) {
+      setAuthError(err.message);
+    } finally {
+      setIsPasskeyLoading(false);
+    }
+  };
+
+  const handleOAuthCallback = async (code: string, state: string) => {
+    try {
+      const result = await googleLogin({ code, state }).unwrap();
       
       // Handle successful login
       handleGoogleLoginSuccess(result);
@@ -51,7 +79,7 @@ const LoginPage: React.FC = () => {
   };
 
   // Determine loading state and error
-  const isLoading = isLoadingUrl || isLoggingIn;
+  const isLoading = isLoadingUrl || isLoggingIn || isLoadingProviderUrl;
   const error = urlError || loginError;
 
   return (
@@ -75,40 +103,82 @@ const LoginPage: React.FC = () => {
         </CardHeader>
         
         <CardContent className="space-y-6">
-          {error && (
+          {authError && (
             <Alert variant="destructive">
-              <AlertDescription>
-                {error?.data?.message || error?.message || 'An error occurred during login'}
-              </AlertDescription>
+              <AlertDescription>{authError}</AlertDescription>
             </Alert>
           )}
+
+          {mfaToken ? (
+            <MFAChallengeForm />
+          ) : (
+            <>
+              {error && (
+                <Alert variant="destructive">
+                  <AlertDescription>
+                    {error?.data?.message || error?.message || 'An error occurred during login'}
+                  </AlertDescription>
+                </Alert>
+              )}
           
-          <Button 
-            onClick={handleGoogleLogin}
-            disabled={isLoading || !authUrlData?.auth_url}
-            className="w-full h-12 text-base font-medium bg-gradient-to-r from-blue-500 to-indigo-600 hover:from-blue-600 hover:to-indigo-700 text-white border-0 shadow-lg hover:shadow-xl transition-all duration-200"
-          >
-            {isLoading ? (
-              <>
-                <Loader2 className="mr-2 h-5 w-5 animate-spin" />
-                {isLoggingIn ? 'Signing in...' : 'Loading...'}
-              </>
-            ) : (
-              <>
-                <svg className="mr-2 h-5 w-5" viewBox="0 0 24 24">
-                  <path fill="currentColor" d="M22.56 12.25c0-.78-.07-1.53-.2-2.25H12v4.26h5.92c-.26 1.37-1.04 2.53-2.21 3.31v2.77h3.57c2.08-1.92 3.28-4.74 3.28-8.09z"/>
-                  <path fill="currentColor" d="M12 23c2.97 0 5.46-.98 7.28-2.66l-3.57-2.77c-.98.66-2.23 1.06-3.71 1.06-2.86 0-5.29-1.93-6.16-4.53H2.18v2.84C3.99 20.53 7.7 23 12 23z"/>
-                  <path fill="currentColor" d="M5.84 14.09c-.22-.66-.35-1.36-.35-2.09s.13-1.43.35-2.09V7.07H2.18C1.43 8.55 1 10.22 1 12s.43 3.45 1.18 4.93l2.85-2.22.81-.62z"/>
-                  <path fill="currentColor" d="M12 5.38c1.62 0 3.06.56 4.21 1.64l3.15-3.15C17.45 2.09 14.97 1 12 1 7.7 1 3.99 3.47 2.18 7.07l3.66 2.84c.87-2.6 3.3-4.53 6.16-4.53z"/>
-                </svg>
-                Sign in with Google
-              </>
-            )}
-          </Button>
-          
-          <p className="text-center text-sm text-gray-500 dark:text-gray-400">
-            Click the button above to sign in with your Google account
-          </p>
+              <Button 
+                onClick={handleGoogleLogin}
+                disabled={isLoading || !authUrlData?.auth_url}
+                className="w-full h-12 text-base font-medium bg-gradient-to-r from-blue-500 to-indigo-600 hover:from-blue-600 hover:to-indigo-700 text-white border-0 shadow-lg hover:shadow-xl transition-all duration-200"
+              >
+                {isLoading ? (
+                  <>
+                    <Loader2 className="mr-2 h-5 w-5 animate-spin" />
+                    {isLoggingIn ? 'Signing in...' : 'Loading...'}
+                  </>
+                ) : (
+                  <>
+                    <svg className="mr-2 h-5 w-5" viewBox="0 0 24 24">
+                      <path fill="currentColor" d="M22.56 12.25c0-.78-.07-1.53-.2-2.25H12v4.26h5.92c-.26 1.37-1.04 2.53-2.21 3.31v2.77h3.57c2.08-1.92 3.28-4.74 3.28-8.09z"/>
+                      <path fill="currentColor" d="M12 23c2.97 0 5.46-.98 7.28-2.66l-3.57-2.77c-.98.66-2.23 1.06-3.71 1.06-2.86 0-5.29-1.93-6.16-4.53H2.18v2.84C3.99 20.53 7.7 23 12 23z"/>
+                      <path fill="currentColor" d="M5.84 14.09c-.22-.66-.35-1.36-.35-2.09s.13-1.43.35-2.09V7.07H2.18C1.43 8.55 1 10.22 1 12s.43 3.45 1.18 4.93l2.85-2.22.81-.62z"/>
+                      <path fill="currentColor" d="M12 5.38c1.62 0 3.06.56 4.21 1.64l3.15-3.15C17.45 2.09 14.97 1 12 1 7.7 1 3.99 3.47 2.18 7.07l3.66 2.84c.87-2.6 3.3-4.53 6.16-4.53z"/>
+                    </svg>
+                    Sign in with Google
+                  </>
+                )}
+              </Button>
+
+              {otherProviders.map((provider) => (
+                <Button
+                  key={provider}
+                  variant="outline"
+                  onClick={() => handleProviderLogin(provider)}
+                  disabled={isLoading}
+                  className="w-full h-12 text-base font-medium"
+                >
+                  Sign in with {provider.charAt(0).toUpperCase() + provider.slice(1)}
+                </Button>
+              ))}
+
+              {passkeysSupported() && (
+                <Button
+                  variant="outline"
+                  onClick={handlePasskeyLogin}
+                  disabled={isLoading || isPasskeyLoading}
+                  className="w-full h-12 text-base font-medium"
+                >
+                  {isPasskeyLoading ? (
+                    <Loader2 className="mr-2 h-5 w-5 animate-spin" />
+                  ) : (
+                    <Fingerprint className="mr-2 h-5 w-5" />
+                  )}
+                  Sign in with a passkey
+                </Button>
+              )}
+
+              <div className="relative text-center text-sm text-gray-500 dark:text-gray-400">
+                <span>or use your email</span>
+              </div>
+
+              <PasswordLoginForm />
+            </>
+          )}
         </CardContent>
       </Card>
     </div>
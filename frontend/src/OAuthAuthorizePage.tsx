@@ -0,0 +1,120 @@
+import React from 'react';
+import { Link } from 'react-router-dom';
+import { useAuth } from './AuthContext';
+import config from './config';
+import { Button } from '@/components/ui/button';
+import { Alert, AlertDescription } from '@/components/ui/alert';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { Shield } from 'lucide-react';
+
+interface ConsentRequest {
+  client_id?: string;
+  client_name?: string;
+  scopes?: string[];
+  consented?: boolean;
+  redirect_to?: string;
+}
+
+const scopeDescriptions: Record<string, string> = {
+  openid: 'Confirm who you are',
+  profile: 'See your name and picture',
+  email: 'See your email address',
+  offline_access: 'Stay connected when you are not using it',
+  read: 'Read your data',
+  write: 'Change your data',
+};
+
+// Consent screen of the OAuth authorization code flow. Partner apps send the browser here
+// with the authorization request in the query string; the decision sends it back to the app.
+const OAuthAuthorizePage: React.FC = () => {
+  const { authenticatedFetch } = useAuth();
+  const [params] = React.useState(() => Object.fromEntries(new URLSearchParams(window.location.search)));
+  const [consent, setConsent] = React.useState<ConsentRequest | null>(null);
+  const [error, setError] = React.useState<string | null>(null);
+
+  const request = async (method: string, body?: object) => {
+    const query = method === 'GET' ? window.location.search : '';
+    const response = await authenticatedFetch(`${config.apiBaseUrl}/api/oauth/authorize${query}`, {
+      method,
+      body: body ? JSON.stringify(body) : undefined,
+    });
+    const responseData = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      throw new Error(responseData.message || responseData.error || 'Request failed');
+    }
+    return responseData.data;
+  };
+
+  const decide = async (approve: boolean) => {
+    setError(null);
+    try {
+      const result = await request('POST', { ...params, approve });
+      window.location.assign(result.redirect_to);
+    } catch (err: any) {
+      setError(err.message);
+    }
+  };
+
+  React.useEffect(() => {
+    const load = async () => {
+      try {
+        const data: ConsentRequest = await request('GET');
+        if (data.redirect_to) {
+          window.location.assign(data.redirect_to);
+        } else if (data.consented && params.prompt !== 'consent') {
+          // Every scope was granted before, so there is nothing to ask
+          await decide(true);
+        } else {
+          setConsent(data);
+        }
+      } catch (err: any) {
+        setError(err.message);
+      }
+    };
+    load();
+  }, []);
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-blue-50 to-indigo-100 dark:from-gray-900 dark:to-gray-800 p-4">
+      <Card className="w-full max-w-md shadow-xl dark:bg-gray-800 dark:border-gray-700">
+        <CardHeader>
+          <CardTitle className="flex items-center gap-3 text-xl dark:text-white">
+            <Shield className="w-5 h-5" />
+            Authorize app
+          </CardTitle>
+          <CardDescription className="dark:text-gray-400">
+            Only allow apps you trust. You can revoke access at any time from your account page.
+          </CardDescription>
+        </CardHeader>
+        <CardContent className="space-y-4">
+          {error && (
+            <Alert variant="destructive">
+              <AlertDescription>{error}</AlertDescription>
+            </Alert>
+          )}
+
+          {consent && (
+            <div className="space-y-4">
+              <p className="text-sm dark:text-gray-300">
+                <span className="font-medium">{consent.client_name}</span> would like to:
+              </p>
+              <ul className="list-disc pl-5 text-sm dark:text-gray-300">
+                {consent.scopes?.map((scope) => (
+                  <li key={scope}>{scopeDescriptions[scope] || scope}</li>
+                ))}
+              </ul>
+              <div className="flex gap-2">
+                <Button onClick={() => decide(true)}>Allow</Button>
+                <Button variant="outline" onClick={() => decide(false)}>Deny</Button>
+              </div>
+            </div>
+          )}
+
+          <Link to="/" className="block text-sm text-blue-600 dark:text-blue-400">Back to the app</Link>
+        </CardContent>
+      </Card>
+    </div>
+  );
+};
+
+export default OAuthAuthorizePage;
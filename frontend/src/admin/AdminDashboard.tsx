@@ -9,6 +9,7 @@ import { Tabs, TabsContent, TabsList, TabsTrigger } from '@/components/ui/tabs';
 import { Alert, AlertDescription } from '@/components/ui/alert';
 import { Loader2, ArrowLeft, Users, Shield, Building2, Plus, Minus } from 'lucide-react';
 import { ThemeToggle } from '../components/ThemeToggle';
+import { fetchWithStepUp } from '../lib/webauthn';
 
 interface User {
   id: number;
@@ -114,7 +115,8 @@ const AdminDashboard: React.FC = () => {
 
   const assignRole = async (userId: number, roleId: number): Promise<void> => {
     try {
-      const response = await authenticatedFetch(`${config.apiBaseUrl}/api/admin/assign-role`, {
+      // Granting roles asks for a passkey confirmation when the admin has one
+      const response = await fetchWithStepUp(authenticatedFetch, `${config.apiBaseUrl}/api/admin/assign-role`, {
         method: 'POST',
         body: JSON.stringify({ user_id: userId, role_id: roleId })
       });
@@ -0,0 +1,128 @@
+import React from 'react';
+import { useAuth } from '../AuthContext';
+import config from '../config';
+import { fetchWithStepUp } from '../lib/webauthn';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { Alert, AlertDescription } from '@/components/ui/alert';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { Key, Trash2 } from 'lucide-react';
+
+interface AccessToken {
+  id: number;
+  name: string;
+  token_prefix: string;
+  scopes: string[];
+  expires_at: string;
+  last_used_at: string | null;
+}
+
+// Personal access tokens for scripts, CI jobs and editor tooling. A new token is shown once.
+export const AccessTokenSettings: React.FC = () => {
+  const { authenticatedFetch } = useAuth();
+  const [tokens, setTokens] = React.useState<AccessToken[]>([]);
+  const [name, setName] = React.useState('');
+  const [canWrite, setCanWrite] = React.useState(false);
+  const [newToken, setNewToken] = React.useState<string | null>(null);
+  const [error, setError] = React.useState<string | null>(null);
+
+  const request = async (query = '', method = 'GET', body?: object) => {
+    const response = await fetchWithStepUp(authenticatedFetch, `${config.apiBaseUrl}/api/auth/tokens${query}`, {
+      method,
+      body: body ? JSON.stringify(body) : undefined,
+    });
+    const responseData = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      throw new Error(responseData.message || responseData.error || 'Request failed');
+    }
+    return responseData.data;
+  };
+
+  const run = async (action: () => Promise<void>) => {
+    setError(null);
+    try {
+      await action();
+    } catch (err: any) {
+      setError(err.message);
+    }
+  };
+
+  const loadTokens = () => run(async () => setTokens(await request()));
+
+  React.useEffect(() => {
+    loadTokens();
+  }, []);
+
+  const createToken = () => run(async () => {
+    const created = await request('', 'POST', { name, scopes: canWrite ? ['read', 'write'] : ['read'] });
+    setNewToken(created.token);
+    setName('');
+    await loadTokens();
+  });
+
+  const revokeToken = (id: number) => run(async () => {
+    await request(`?id=${id}`, 'DELETE');
+    await loadTokens();
+  });
+
+  return (
+    <Card className="mb-8 shadow-xl dark:bg-gray-800 dark:border-gray-700">
+      <CardHeader>
+        <CardTitle className="flex items-center gap-3 text-xl dark:text-white">
+          <Key className="w-5 h-5" />
+          Access tokens
+        </CardTitle>
+        <CardDescription className="dark:text-gray-400">
+          Tokens let scripts and tools like Cursor call the API as you. They expire after 30 days.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-4">
+        {error && (
+          <Alert variant="destructive">
+            <AlertDescription>{error}</AlertDescription>
+          </Alert>
+        )}
+
+        {newToken && (
+          <Alert>
+            <AlertDescription>
+              Copy your new token now, it will not be shown again:
+              <code className="block mt-2 break-all">{newToken}</code>
+            </AlertDescription>
+          </Alert>
+        )}
+
+        {tokens.map((token) => (
+          <div key={token.id} className="flex items-center justify-between text-sm dark:text-gray-300">
+            <div>
+              <p className="font-medium">
+                {token.name} <span className="text-gray-500 dark:text-gray-400">({token.token_prefix}…, {token.scopes.join(', ')})</span>
+              </p>
+              <p className="text-gray-500 dark:text-gray-400">
+                Expires {new Date(token.expires_at).toLocaleDateString()}
+                {token.last_used_at && `, last used ${new Date(token.last_used_at).toLocaleDateString()}`}
+              </p>
+            </div>
+            <Button variant="ghost" size="sm" onClick={() => revokeToken(token.id)}>
+              <Trash2 className="w-4 h-4" />
+            </Button>
+          </div>
+        ))}
+
+        <div className="flex flex-wrap items-center gap-2">
+          <Input
+            className="max-w-xs"
+            placeholder="Name, e.g. Cursor"
+            value={name}
+            onChange={(e) => setName(e.target.value)}
+          />
+          <label className="flex items-center gap-2 text-sm dark:text-gray-300">
+            <input type="checkbox" checked={canWrite} onChange={(e) => setCanWrite(e.target.checked)} />
+            Allow changes
+          </label>
+          <Button onClick={createToken} disabled={!name.trim()}>Create token</Button>
+        </div>
+      </CardContent>
+    </Card>
+  );
+};
@@ -0,0 +1,89 @@
+import React from 'react';
+import { useAuth } from '../AuthContext';
+import config from '../config';
+import { Button } from '@/components/ui/button';
+import { Alert, AlertDescription } from '@/components/ui/alert';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { Link2, Trash2 } from 'lucide-react';
+
+interface OAuthConsent {
+  client_id: string;
+  client_name: string;
+  scopes: string[];
+  updated_at: string;
+}
+
+// Partner apps the user granted access to. Revoking access also ends the app's sessions.
+export const ConnectedAppsSettings: React.FC = () => {
+  const { authenticatedFetch } = useAuth();
+  const [consents, setConsents] = React.useState<OAuthConsent[]>([]);
+  const [error, setError] = React.useState<string | null>(null);
+
+  const request = async (query = '', method = 'GET') => {
+    const response = await authenticatedFetch(`${config.apiBaseUrl}/api/oauth/consents${query}`, { method });
+    const responseData = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      throw new Error(responseData.message || responseData.error || 'Request failed');
+    }
+    return responseData.data;
+  };
+
+  const run = async (action: () => Promise<void>) => {
+    setError(null);
+    try {
+      await action();
+    } catch (err: any) {
+      setError(err.message);
+    }
+  };
+
+  const loadConsents = () => run(async () => setConsents(await request()));
+
+  React.useEffect(() => {
+    loadConsents();
+  }, []);
+
+  const revokeConsent = (clientId: string) => run(async () => {
+    await request(`?client_id=${encodeURIComponent(clientId)}`, 'DELETE');
+    await loadConsents();
+  });
+
+  return (
+    <Card className="mb-8 shadow-xl dark:bg-gray-800 dark:border-gray-700">
+      <CardHeader>
+        <CardTitle className="flex items-center gap-3 text-xl dark:text-white">
+          <Link2 className="w-5 h-5" />
+          Connected apps
+        </CardTitle>
+        <CardDescription className="dark:text-gray-400">
+          Apps you allowed to access your account. Revoke access to sign them out.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-4">
+        {error && (
+          <Alert variant="destructive">
+            <AlertDescription>{error}</AlertDescription>
+          </Alert>
+        )}
+
+        {consents.length === 0 && (
+          <p className="text-sm text-gray-500 dark:text-gray-400">No apps have access to your account.</p>
+        )}
+
+        {consents.map((consent) => (
+          <div key={consent.client_id} className="flex items-center justify-between text-sm dark:text-gray-300">
+            <div>
+              <p className="font-medium">{consent.client_name}</p>
+              <p className="text-gray-500 dark:text-gray-400">
+                {consent.scopes.join(', ')}, granted {new Date(consent.updated_at).toLocaleDateString()}
+              </p>
+            </div>
+            <Button variant="ghost" size="sm" onClick={() => revokeConsent(consent.client_id)}>
+              <Trash2 className="w-4 h-4" />
+            </Button>
+          </div>
+        ))}
+      </CardContent>
+    </Card>
+  );
+};
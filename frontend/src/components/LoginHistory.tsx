@@ -0,0 +1,85 @@
+import React from 'react';
+import { useAuth } from '../AuthContext';
+import config from '../config';
+import { Alert, AlertDescription } from '@/components/ui/alert';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { History } from 'lucide-react';
+
+interface LoginEvent {
+  id: number;
+  event_type: 'login' | 'refresh' | 'logout';
+  success: boolean;
+  provider?: string;
+  ip_address: string;
+  device_name: string;
+  failure_reason?: string;
+  created_at: string;
+}
+
+const eventLabels: Record<LoginEvent['event_type'], string> = {
+  login: 'Login',
+  refresh: 'Session refreshed',
+  logout: 'Logout',
+};
+
+// Recent logins, failed logins and logouts of the user, so they can spot activity that was not theirs
+export const LoginHistory: React.FC = () => {
+  const { authenticatedFetch } = useAuth();
+  const [events, setEvents] = React.useState<LoginEvent[]>([]);
+  const [error, setError] = React.useState<string | null>(null);
+
+  React.useEffect(() => {
+    const loadHistory = async () => {
+      try {
+        const response = await authenticatedFetch(`${config.apiBaseUrl}/api/auth/login-history?limit=20`);
+        const responseData = await response.json().catch(() => ({}));
+        if (!response.ok) {
+          throw new Error(responseData.message || responseData.error || 'Request failed');
+        }
+        // Refreshes happen every few minutes and would bury the logins
+        setEvents((responseData.data as LoginEvent[]).filter((event) => event.event_type !== 'refresh' || !event.success));
+      } catch (err: any) {
+        setError(err.message);
+      }
+    };
+    loadHistory();
+  }, []);
+
+  return (
+    <Card className="mb-8 shadow-xl dark:bg-gray-800 dark:border-gray-700">
+      <CardHeader>
+        <CardTitle className="flex items-center gap-3 text-xl dark:text-white">
+          <History className="w-5 h-5" />
+          Login history
+        </CardTitle>
+        <CardDescription className="dark:text-gray-400">
+          Recent sign-ins to your account. If you do not recognise one, change your password and sign out your other sessions.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-3">
+        {error && (
+          <Alert variant="destructive">
+            <AlertDescription>{error}</AlertDescription>
+          </Alert>
+        )}
+
+        {events.map((event) => (
+          <div key={event.id} className="text-sm dark:text-gray-300">
+            <p className="font-medium">
+              {eventLabels[event.event_type]}
+              {event.provider && ` with ${event.provider}`}
+              {!event.success && <span className="ml-2 text-red-600 dark:text-red-400">Failed</span>}
+            </p>
+            <p className="text-gray-500 dark:text-gray-400">
+              {event.device_name}, {event.ip_address || 'Unknown address'}, {new Date(event.created_at).toLocaleString()}
+            </p>
+          </div>
+        ))}
+
+        {events.length === 0 && !error && (
+          <p className="text-sm text-gray-500 dark:text-gray-400">No sign-ins recorded yet.</p>
+        )}
+      </CardContent>
+    </Card>
+  );
+};
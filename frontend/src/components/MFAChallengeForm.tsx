@@ -0,0 +1,45 @@
+import React from 'react';
+import { useAuth } from '../AuthContext';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { Loader2 } from 'lucide-react';
+
+// Second step of a login for accounts with multi-factor authentication
+const MFAChallengeForm: React.FC = () => {
+  const { verifyMfa, cancelMfa } = useAuth();
+  const [code, setCode] = React.useState('');
+  const [isVerifying, setIsVerifying] = React.useState(false);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setIsVerifying(true);
+    await verifyMfa(code);
+    setIsVerifying(false);
+    setCode('');
+  };
+
+  return (
+    <form onSubmit={handleSubmit} className="space-y-3">
+      <p className="text-sm text-gray-600 dark:text-gray-400">
+        Enter the 6-digit code from your authenticator app, or one of your recovery codes.
+      </p>
+      <Input
+        placeholder="123456"
+        autoComplete="one-time-code"
+        autoFocus
+        required
+        value={code}
+        onChange={(e) => setCode(e.target.value)}
+      />
+      <Button type="submit" disabled={isVerifying} className="w-full h-12 text-base font-medium">
+        {isVerifying && <Loader2 className="mr-2 h-5 w-5 animate-spin" />}
+        Verify
+      </Button>
+      <button type="button" onClick={cancelMfa} className="w-full text-sm text-gray-500 dark:text-gray-400">
+        Back to sign in
+      </button>
+    </form>
+  );
+};
+
+export default MFAChallengeForm;
@@ -0,0 +1,161 @@
+import React from 'react';
+import { useAuth } from '../AuthContext';
+import config from '../config';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { Badge } from '@/components/ui/badge';
+import { Alert, AlertDescription } from '@/components/ui/alert';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { Key } from 'lucide-react';
+
+interface MFAStatus {
+  enabled: boolean;
+  required: boolean;
+  recovery_codes_remaining: number;
+}
+
+interface MFAEnrollment {
+  secret: string;
+  provisioning_uri: string;
+}
+
+// Enrollment and management of TOTP multi-factor authentication for the current user
+export const MFASettings: React.FC = () => {
+  const { authenticatedFetch, completeLogin } = useAuth();
+  const [status, setStatus] = React.useState<MFAStatus | null>(null);
+  const [enrollment, setEnrollment] = React.useState<MFAEnrollment | null>(null);
+  const [recoveryCodes, setRecoveryCodes] = React.useState<string[] | null>(null);
+  const [code, setCode] = React.useState('');
+  const [error, setError] = React.useState<string | null>(null);
+
+  const request = async (path: string, method = 'GET', body?: object) => {
+    const response = await authenticatedFetch(`${config.apiBaseUrl}/api/auth/mfa${path}`, {
+      method,
+      body: body ? JSON.stringify(body) : undefined,
+    });
+    const responseData = await response.json();
+    if (!response.ok) {
+      throw new Error(responseData.data?.code || responseData.error || 'Request failed');
+    }
+    return responseData.data;
+  };
+
+  const run = async (action: () => Promise<void>) => {
+    setError(null);
+    try {
+      await action();
+    } catch (err: any) {
+      setError(err.message);
+    }
+  };
+
+  const loadStatus = () => run(async () => setStatus(await request('')));
+
+  React.useEffect(() => {
+    loadStatus();
+  }, []);
+
+  const startEnrollment = () => run(async () => {
+    setRecoveryCodes(null);
+    setEnrollment(await request('/enroll', 'POST'));
+  });
+
+  const confirmEnrollment = () => run(async () => {
+    const result = await request('/confirm', 'POST', { code });
+    // Enabling MFA signs out every session, this one continues with the returned tokens
+    await completeLogin(result.auth);
+    setRecoveryCodes(result.recovery_codes);
+    setEnrollment(null);
+    setCode('');
+    await loadStatus();
+  });
+
+  const regenerateCodes = () => run(async () => {
+    setRecoveryCodes(await request('/recovery-codes', 'POST', { code }));
+    setCode('');
+    await loadStatus();
+  });
+
+  const disable = () => run(async () => {
+    setStatus(await request('/disable', 'POST', { code }));
+    setRecoveryCodes(null);
+    setCode('');
+  });
+
+  if (!status) {
+    return null;
+  }
+
+  return (
+    <Card className="mb-8 shadow-xl dark:bg-gray-800 dark:border-gray-700">
+      <CardHeader>
+        <CardTitle className="flex items-center gap-3 text-xl dark:text-white">
+          <Key className="w-5 h-5" />
+          Two-factor authentication
+          <Badge variant={status.enabled ? 'default' : 'secondary'}>{status.enabled ? 'On' : 'Off'}</Badge>
+        </CardTitle>
+        <CardDescription className="dark:text-gray-400">
+          {status.required && !status.enabled
+            ? 'Your roles require an authenticator app. Admin features stay locked until you set one up.'
+            : 'Protect your account with codes from an authenticator app.'}
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-4">
+        {error && (
+          <Alert variant="destructive">
+            <AlertDescription>{error}</AlertDescription>
+          </Alert>
+        )}
+
+        {recoveryCodes && (
+          <Alert>
+            <AlertDescription>
+              <p className="mb-2">Save these recovery codes somewhere safe. Each works once and they are not shown again.</p>
+              <div className="grid grid-cols-2 gap-1 font-mono text-sm">
+                {recoveryCodes.map((recoveryCode) => <span key={recoveryCode}>{recoveryCode}</span>)}
+              </div>
+            </AlertDescription>
+          </Alert>
+        )}
+
+        {!status.enabled && !enrollment && (
+          <Button onClick={startEnrollment}>Set up authenticator app</Button>
+        )}
+
+        {enrollment && (
+          <div className="space-y-2 text-sm dark:text-gray-300">
+            <p>
+              Open <a className="underline break-all" href={enrollment.provisioning_uri}>this link</a> on your phone or
+              add this key to your authenticator app manually:
+            </p>
+            <p className="font-mono break-all">{enrollment.secret}</p>
+          </div>
+        )}
+
+        {(enrollment || status.enabled) && (
+          <div className="flex flex-wrap gap-2">
+            <Input
+              className="max-w-xs"
+              placeholder={enrollment ? 'Code from your app' : 'Code or recovery code'}
+              autoComplete="one-time-code"
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+            />
+            {enrollment ? (
+              <Button onClick={confirmEnrollment} disabled={!code}>Turn on</Button>
+            ) : (
+              <>
+                <Button variant="outline" onClick={regenerateCodes} disabled={!code}>
+                  New recovery codes ({status.recovery_codes_remaining} left)
+                </Button>
+                {!status.required && (
+                  <Button variant="destructive" onClick={disable} disabled={!code}>Turn off</Button>
+                )}
+              </>
+            )}
+          </div>
+        )}
+      </CardContent>
+    </Card>
+  );
+};
@@ -0,0 +1,115 @@
+import React from 'react';
+import { useAuth } from '../AuthContext';
+import config from '../config';
+import { createPasskey, fetchWithStepUp, passkeysSupported } from '../lib/webauthn';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { Alert, AlertDescription } from '@/components/ui/alert';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { Fingerprint, Trash2 } from 'lucide-react';
+
+interface Passkey {
+  id: number;
+  name: string;
+  created_at: string;
+  last_used_at: string | null;
+}
+
+// Registration and removal of passkeys for the current user. Adding a further passkey
+// or removing one is confirmed with an existing passkey.
+export const PasskeySettings: React.FC = () => {
+  const { authenticatedFetch } = useAuth();
+  const [passkeys, setPasskeys] = React.useState<Passkey[]>([]);
+  const [name, setName] = React.useState('');
+  const [error, setError] = React.useState<string | null>(null);
+
+  const request = async (path: string, method = 'GET', body?: object) => {
+    const response = await fetchWithStepUp(authenticatedFetch, `${config.apiBaseUrl}/api/auth/webauthn${path}`, {
+      method,
+      body: body ? JSON.stringify(body) : undefined,
+    });
+    const responseData = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      throw new Error(responseData.message || responseData.error || 'Request failed');
+    }
+    return responseData.data;
+  };
+
+  const run = async (action: () => Promise<void>) => {
+    setError(null);
+    try {
+      await action();
+    } catch (err: any) {
+      setError(err.message);
+    }
+  };
+
+  const loadPasskeys = () => run(async () => setPasskeys(await request('/credentials')));
+
+  React.useEffect(() => {
+    loadPasskeys();
+  }, []);
+
+  const addPasskey = () => run(async () => {
+    const options = await request('/register/begin', 'POST');
+    const credential = await createPasskey(options);
+    await request('/register/finish', 'POST', { name, credential });
+    setName('');
+    await loadPasskeys();
+  });
+
+  const removePasskey = (id: number) => run(async () => {
+    await request(`/credentials?id=${id}`, 'DELETE');
+    await loadPasskeys();
+  });
+
+  if (!passkeysSupported()) {
+    return null;
+  }
+
+  return (
+    <Card className="mb-8 shadow-xl dark:bg-gray-800 dark:border-gray-700">
+      <CardHeader>
+        <CardTitle className="flex items-center gap-3 text-xl dark:text-white">
+          <Fingerprint className="w-5 h-5" />
+          Passkeys
+        </CardTitle>
+        <CardDescription className="dark:text-gray-400">
+          Sign in with your device's fingerprint, face or screen lock. Sensitive actions ask you to confirm with a passkey.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-4">
+        {error && (
+          <Alert variant="destructive">
+            <AlertDescription>{error}</AlertDescription>
+          </Alert>
+        )}
+
+        {passkeys.map((passkey) => (
+          <div key={passkey.id} className="flex items-center justify-between text-sm dark:text-gray-300">
+            <div>
+              <p className="font-medium">{passkey.name}</p>
+              <p className="text-gray-500 dark:text-gray-400">
+                Added {new Date(passkey.created_at).toLocaleDateString()}
+                {passkey.last_used_at && `, last used ${new Date(passkey.last_used_at).toLocaleDateString()}`}
+              </p>
+            </div>
+            <Button variant="ghost" size="sm" onClick={() => removePasskey(passkey.id)}>
+              <Trash2 className="w-4 h-4" />
+            </Button>
+          </div>
+        ))}
+
+        <div className="flex flex-wrap gap-2">
+          <Input
+            className="max-w-xs"
+            placeholder="Name, e.g. Work laptop"
+            value={name}
+            onChange={(e) => setName(e.target.value)}
+          />
+          <Button onClick={addPasskey}>Add passkey</Button>
+        </div>
+      </CardContent>
+    </Card>
+  );
+};
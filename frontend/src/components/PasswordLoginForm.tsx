@@ -0,0 +1,160 @@
+import React from 'react';
+import { useAuth } from '../AuthContext';
+import {
+  useLocalLoginMutation,
+  useLocalRegisterMutation,
+  useVerifyEmailMutation,
+  useForgotPasswordMutation,
+  useResetPasswordMutation,
+} from '../store/api';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { Alert, AlertDescription } from '@/components/ui/alert';
+import { Loader2 } from 'lucide-react';
+
+type Mode = 'login' | 'register' | 'forgot' | 'reset';
+
+const errorMessage = (error: any) =>
+  error?.data?.message || error?.message || 'Something went wrong';
+
+// Email/password login, sign-up and password reset. Verification and reset
+// links from emails land on /login with a verify_token or reset_token parameter.
+const PasswordLoginForm: React.FC = () => {
+  const { completeLogin: storeLogin } = useAuth();
+  const [mode, setMode] = React.useState<Mode>('login');
+  const [email, setEmail] = React.useState('');
+  const [name, setName] = React.useState('');
+  const [password, setPassword] = React.useState('');
+  const [resetToken, setResetToken] = React.useState('');
+  const [notice, setNotice] = React.useState<string | null>(null);
+  const [error, setError] = React.useState<string | null>(null);
+
+  const [localLogin, { isLoading: isLoggingIn }] = useLocalLoginMutation();
+  const [localRegister, { isLoading: isRegistering }] = useLocalRegisterMutation();
+  const [verifyEmail, { isLoading: isVerifying }] = useVerifyEmailMutation();
+  const [forgotPassword, { isLoading: isRequestingReset }] = useForgotPasswordMutation();
+  const [resetPassword, { isLoading: isResetting }] = useResetPasswordMutation();
+  const isLoading = isLoggingIn || isRegistering || isVerifying || isRequestingReset || isResetting;
+
+  const completeLogin = (result: any) => {
+    if (result?.access_token || result?.mfa_required) {
+      storeLogin(result);
+    } else if (result?.pending_approval) {
+      setNotice('Your account was created and is awaiting approval by an administrator.');
+    }
+  };
+
+  React.useEffect(() => {
+    const urlParams = new URLSearchParams(window.location.search);
+    const verifyToken = urlParams.get('verify_token');
+    const token = urlParams.get('reset_token');
+
+    if (verifyToken || token) {
+      window.history.replaceState({}, document.title, window.location.pathname);
+    }
+
+    if (verifyToken) {
+      verifyEmail({ token: verifyToken })
+        .unwrap()
+        .then(completeLogin)
+        .catch((err) => setError(errorMessage(err)));
+    } else if (token) {
+      setResetToken(token);
+      setMode('reset');
+    }
+  }, []);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError(null);
+    setNotice(null);
+
+    try {
+      switch (mode) {
+        case 'login':
+          completeLogin(await localLogin({ email, password }).unwrap());
+          break;
+        case 'register':
+          await localRegister({ email, password, name }).unwrap();
+          setNotice('Check your email for a link to confirm your address.');
+          break;
+        case 'forgot':
+          await forgotPassword({ email }).unwrap();
+          setNotice('If the address belongs to an account, a reset link has been sent.');
+          break;
+        case 'reset':
+          await resetPassword({ token: resetToken, password }).unwrap();
+          setPassword('');
+          setMode('login');
+          setNotice('Your password was reset. You can now sign in.');
+          break;
+      }
+    } catch (err) {
+      setError(errorMessage(err));
+    }
+  };
+
+  const submitLabel = {
+    login: 'Sign in',
+    register: 'Create account',
+    forgot: 'Send reset link',
+    reset: 'Set new password',
+  }[mode];
+
+  return (
+    <form onSubmit={handleSubmit} className="space-y-3">
+      {error && (
+        <Alert variant="destructive">
+          <AlertDescription>{error}</AlertDescription>
+        </Alert>
+      )}
+      {notice && (
+        <Alert>
+          <AlertDescription>{notice}</AlertDescription>
+        </Alert>
+      )}
+
+      {mode === 'register' && (
+        <Input placeholder="Name" value={name} onChange={(e) => setName(e.target.value)} />
+      )}
+      {mode !== 'reset' && (
+        <Input
+          type="email"
+          placeholder="Email"
+          autoComplete="email"
+          required
+          value={email}
+          onChange={(e) => setEmail(e.target.value)}
+        />
+      )}
+      {mode !== 'forgot' && (
+        <Input
+          type="password"
+          placeholder={mode === 'login' ? 'Password' : 'New password (at least 10 characters)'}
+          autoComplete={mode === 'login' ? 'current-password' : 'new-password'}
+          required
+          value={password}
+          onChange={(e) => setPassword(e.target.value)}
+        />
+      )}
+
+      <Button type="submit" disabled={isLoading} className="w-full h-12 text-base font-medium">
+        {isLoading && <Loader2 className="mr-2 h-5 w-5 animate-spin" />}
+        {submitLabel}
+      </Button>
+
+      <div className="flex justify-between text-sm text-gray-500 dark:text-gray-400">
+        {mode === 'login' ? (
+          <>
+            <button type="button" onClick={() => setMode('register')}>Create an account</button>
+            <button type="button" onClick={() => setMode('forgot')}>Forgot password?</button>
+          </>
+        ) : (
+          <button type="button" onClick={() => setMode('login')}>Back to sign in</button>
+        )}
+      </div>
+    </form>
+  );
+};
+
+export default PasswordLoginForm;
@@ -0,0 +1,138 @@
+import React from 'react';
+import { useAuth } from '../AuthContext';
+import config from '../config';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { Alert, AlertDescription } from '@/components/ui/alert';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { UserCog } from 'lucide-react';
+
+interface Profile {
+  name: string;
+  picture: string;
+  picture_edited: boolean;
+  locale: string;
+  timezone: string;
+  notification_preferences: Record<string, boolean>;
+}
+
+const notificationLabels: Record<string, string> = {
+  security_alerts: 'Security alerts',
+  billing: 'Billing',
+  product_updates: 'Product updates',
+};
+
+// Name, avatar, locale, timezone and notification preferences. Edits are kept when signing in with a provider.
+export const ProfileSettings: React.FC = () => {
+  const { authenticatedFetch } = useAuth();
+  const [profile, setProfile] = React.useState<Profile | null>(null);
+  const [error, setError] = React.useState<string | null>(null);
+  const [saved, setSaved] = React.useState(false);
+  // The name is only sent when changed, so an untouched name keeps syncing from the provider
+  const [savedName, setSavedName] = React.useState('');
+
+  const request = async (method = 'GET', body?: object) => {
+    const response = await authenticatedFetch(`${config.apiBaseUrl}/api/users/me`, {
+      method,
+      body: body ? JSON.stringify(body) : undefined,
+    });
+    const responseData = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      // Validation errors come by field in data
+      const fieldErrors = responseData.data ? Object.values(responseData.data).join(', ') : '';
+      throw new Error(fieldErrors || responseData.message || responseData.error || 'Request failed');
+    }
+    return responseData.data as Profile;
+  };
+
+  React.useEffect(() => {
+    request().then(load).catch((err) => setError(err.message));
+  }, []);
+
+  const load = (loaded: Profile) => {
+    setProfile(loaded);
+    setSavedName(loaded.name);
+  };
+
+  const update = (changes: Partial<Profile>) => {
+    setSaved(false);
+    setProfile((current) => (current ? { ...current, ...changes } : current));
+  };
+
+  const saveProfile = async () => {
+    if (!profile) return;
+    setError(null);
+    try {
+      load(await request('PATCH', {
+        name: profile.name !== savedName ? profile.name : undefined,
+        picture: profile.picture_edited ? profile.picture : undefined,
+        locale: profile.locale,
+        timezone: profile.timezone,
+        notification_preferences: profile.notification_preferences,
+      }));
+      setSaved(true);
+    } catch (err: any) {
+      setError(err.message);
+    }
+  };
+
+  if (!profile) {
+    return null;
+  }
+
+  return (
+    <Card className="mb-8 shadow-xl dark:bg-gray-800 dark:border-gray-700">
+      <CardHeader>
+        <CardTitle className="flex items-center gap-3 text-xl dark:text-white">
+          <UserCog className="w-5 h-5" />
+          Profile
+        </CardTitle>
+        <CardDescription className="dark:text-gray-400">
+          Your name and avatar start out as your login provider reports them. Once you change them here, they are kept.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-4">
+        {error && (
+          <Alert variant="destructive">
+            <AlertDescription>{error}</AlertDescription>
+          </Alert>
+        )}
+        {saved && (
+          <Alert>
+            <AlertDescription>Profile saved.</AlertDescription>
+          </Alert>
+        )}
+
+        <div className="grid gap-3 sm:grid-cols-2">
+          <Input placeholder="Display name" value={profile.name} onChange={(e) => update({ name: e.target.value })} />
+          <Input
+            placeholder="Avatar URL (https), empty for your provider's"
+            value={profile.picture_edited ? profile.picture : ''}
+            onChange={(e) => update({ picture: e.target.value, picture_edited: true })}
+          />
+          <Input placeholder="Locale, e.g. en-GB" value={profile.locale} onChange={(e) => update({ locale: e.target.value })} />
+          <Input
+            placeholder={`Timezone, e.g. ${Intl.DateTimeFormat().resolvedOptions().timeZone}`}
+            value={profile.timezone}
+            onChange={(e) => update({ timezone: e.target.value })}
+          />
+        </div>
+
+        <div className="flex flex-wrap gap-4">
+          {Object.entries(notificationLabels).map(([key, label]) => (
+            <label key={key} className="flex items-center gap-2 text-sm dark:text-gray-300">
+              <input
+                type="checkbox"
+                checked={profile.notification_preferences[key] ?? false}
+                onChange={(e) => update({ notification_preferences: { ...profile.notification_preferences, [key]: e.target.checked } })}
+              />
+              {label}
+            </label>
+          ))}
+        </div>
+
+        <Button onClick={saveProfile}>Save profile</Button>
+      </CardContent>
+    </Card>
+  );
+};
@@ -0,0 +1,103 @@
+import React from 'react';
+import { useAuth } from '../AuthContext';
+import config from '../config';
+import { Button } from '@/components/ui/button';
+import { Alert, AlertDescription } from '@/components/ui/alert';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { Smartphone, Trash2 } from 'lucide-react';
+
+interface Session {
+  id: string;
+  device_name: string;
+  ip_address: string;
+  current: boolean;
+  created_at: string;
+  last_seen_at: string;
+}
+
+// Devices the user is signed in on, with a way to sign out the ones they do not recognise
+export const SessionSettings: React.FC = () => {
+  const { authenticatedFetch } = useAuth();
+  const [sessions, setSessions] = React.useState<Session[]>([]);
+  const [error, setError] = React.useState<string | null>(null);
+
+  const request = async (query = '', method = 'GET') => {
+    const response = await authenticatedFetch(`${config.apiBaseUrl}/api/auth/sessions${query}`, { method });
+    const responseData = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      throw new Error(responseData.message || responseData.error || 'Request failed');
+    }
+    return responseData.data;
+  };
+
+  const run = async (action: () => Promise<void>) => {
+    setError(null);
+    try {
+      await action();
+    } catch (err: any) {
+      setError(err.message);
+    }
+  };
+
+  const loadSessions = () => run(async () => setSessions(await request()));
+
+  React.useEffect(() => {
+    loadSessions();
+  }, []);
+
+  const revokeSession = (id: string) => run(async () => {
+    await request(`?id=${encodeURIComponent(id)}`, 'DELETE');
+    await loadSessions();
+  });
+
+  const revokeOthers = () => run(async () => {
+    await request('?others=true', 'DELETE');
+    await loadSessions();
+  });
+
+  return (
+    <Card className="mb-8 shadow-xl dark:bg-gray-800 dark:border-gray-700">
+      <CardHeader>
+        <CardTitle className="flex items-center gap-3 text-xl dark:text-white">
+          <Smartphone className="w-5 h-5" />
+          Sessions
+        </CardTitle>
+        <CardDescription className="dark:text-gray-400">
+          Where you are signed in. Sign out any session you do not recognise.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-4">
+        {error && (
+          <Alert variant="destructive">
+            <AlertDescription>{error}</AlertDescription>
+          </Alert>
+        )}
+
+        {sessions.map((session) => (
+          <div key={session.id} className="flex items-center justify-between text-sm dark:text-gray-300">
+            <div>
+              <p className="font-medium">
+                {session.device_name}
+                {session.current && <span className="ml-2 text-green-600 dark:text-green-400">This device</span>}
+              </p>
+              <p className="text-gray-500 dark:text-gray-400">
+                {session.ip_address || 'Unknown address'}, last active {new Date(session.last_seen_at).toLocaleString()}
+              </p>
+            </div>
+            {!session.current && (
+              <Button variant="ghost" size="sm" onClick={() => revokeSession(session.id)}>
+                <Trash2 className="w-4 h-4" />
+              </Button>
+            )}
+          </div>
+        ))}
+
+        {sessions.some((session) => !session.current) && (
+          <Button variant="outline" onClick={revokeOthers}>
+            Sign out all other sessions
+          </Button>
+        )}
+      </CardContent>
+    </Card>
+  );
+};
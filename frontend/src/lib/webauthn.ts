@@ -0,0 +1,124 @@
+import config from '../config';
+
+type FetchFn = (url: string, options?: RequestInit) => Promise<Response>;
+
+// Header carrying the single-use token from a fresh passkey assertion
+export const STEP_UP_HEADER = 'X-Step-Up-Token';
+
+export const passkeysSupported = () =>
+  typeof window !== 'undefined' && !!window.PublicKeyCredential && !!navigator.credentials;
+
+const fromBase64url = (value: string): ArrayBuffer => {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+  const binary = atob(base64.padEnd(base64.length + ((4 - (base64.length % 4)) % 4), '='));
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+  return bytes.buffer;
+};
+
+const toBase64url = (buffer: ArrayBuffer | null): string => {
+  if (!buffer) {
+    return '';
+  }
+  let binary = '';
+  new Uint8Array(buffer).forEach((b) => (binary += String.fromCharCode(b)));
+  return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+};
+
+const descriptors = (list: any[] = []): PublicKeyCredentialDescriptor[] =>
+  list.map((credential) => ({ ...credential, id: fromBase64url(credential.id) }));
+
+// Runs navigator.credentials.create() with options from /api/auth/webauthn/register/begin
+export const createPasskey = async (options: any) => {
+  const credential = (await navigator.credentials.create({
+    publicKey: {
+      ...options,
+      challenge: fromBase64url(options.challenge),
+      user: { ...options.user, id: fromBase64url(options.user.id) },
+      excludeCredentials: descriptors(options.excludeCredentials),
+    },
+  })) as PublicKeyCredential | null;
+  if (!credential) {
+    throw new Error('Passkey creation was cancelled');
+  }
+
+  const response = credential.response as AuthenticatorAttestationResponse;
+  return {
+    id: credential.id,
+    rawId: toBase64url(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64url(response.clientDataJSON),
+      attestationObject: toBase64url(response.attestationObject),
+      transports: response.getTransports?.() ?? [],
+    },
+  };
+};
+
+// Runs navigator.credentials.get() with options from a login or step-up begin endpoint
+export const getPasskeyAssertion = async (options: any) => {
+  const credential = (await navigator.credentials.get({
+    publicKey: {
+      ...options,
+      challenge: fromBase64url(options.challenge),
+      allowCredentials: descriptors(options.allowCredentials),
+    },
+  })) as PublicKeyCredential | null;
+  if (!credential) {
+    throw new Error('Passkey sign-in was cancelled');
+  }
+
+  const response = credential.response as AuthenticatorAssertionResponse;
+  return {
+    id: credential.id,
+    rawId: toBase64url(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64url(response.clientDataJSON),
+      authenticatorData: toBase64url(response.authenticatorData),
+      signature: toBase64url(response.signature),
+      userHandle: toBase64url(response.userHandle),
+    },
+  };
+};
+
+const postJSON = async (fetchFn: FetchFn, path: string, body?: object) => {
+  const response = await fetchFn(`${config.apiBaseUrl}${path}`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: body ? JSON.stringify(body) : undefined,
+  });
+  const responseData = await response.json();
+  if (!response.ok) {
+    throw new Error(responseData.message || responseData.error || 'Request failed');
+  }
+  return responseData.data;
+};
+
+// Signs in with a passkey and returns the login response (tokens or an MFA challenge)
+export const loginWithPasskey = async (email?: string) => {
+  const options = await postJSON(fetch, '/api/auth/webauthn/login/begin', email ? { email } : undefined);
+  const credential = await getPasskeyAssertion(options);
+  return postJSON(fetch, '/api/auth/webauthn/login/finish', credential);
+};
+
+// Confirms the current user with one of their passkeys and returns a step-up token
+export const stepUp = async (fetchFn: FetchFn): Promise<string> => {
+  const options = await postJSON(fetchFn, '/api/auth/webauthn/step-up/begin');
+  const credential = await getPasskeyAssertion(options);
+  const result = await postJSON(fetchFn, '/api/auth/webauthn/step-up/finish', credential);
+  return result.step_up_token;
+};
+
+// Sends a request to a sensitive endpoint, confirming with a passkey and retrying if the server asks for a step-up
+export const fetchWithStepUp = async (fetchFn: FetchFn, url: string, options: RequestInit = {}): Promise<Response> => {
+  const response = await fetchFn(url, options);
+  if (response.status !== 403 || !(await response.clone().text()).includes('step-up')) {
+    return response;
+  }
+
+  const token = await stepUp(fetchFn);
+  return fetchFn(url, { ...options, headers: { ...options.headers, [STEP_UP_HEADER]: token } });
+};
@@ -8,6 +8,8 @@ import LoginPage from './LoginPage';
 import HomePage from './HomePage';
 import ProtectedRoute from './ProtectedRoute';
 import AdminDashboard from './admin/AdminDashboard';
+import DevicePage from './DevicePage';
+import OAuthAuthorizePage from './OAuthAuthorizePage';
 import './index.css';
 
 function App() {
@@ -52,6 +54,22 @@ function App() {
             </ProtectedRoute>
           } 
         />
+        <Route 
+          path="/device" 
+          element={
+            <ProtectedRoute>
+              <DevicePage />
+            </ProtectedRoute>
+          } 
+        />
+        <Route 
+          path="/oauth/authorize" 
+          element={
+            <ProtectedRoute>
+              <OAuthAuthorizePage />
+            </ProtectedRoute>
+          } 
+        />
         <Route 
           path="*" 
           element={<Navigate to="/" replace />} 
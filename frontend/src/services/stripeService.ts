@@ -60,8 +60,9 @@ class StripeService {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
-        'Authorization': `Bearer ${this.getAuthToken()}`,
+        ...this.getAuthHeaders(),
       },
+      credentials: 'include',
       body: JSON.stringify(request),
     });
 
@@ -79,9 +80,8 @@ class StripeService {
   // Get payment history
   async getPaymentHistory(): Promise<Payment[]> {
     const response = await fetch(`${this.baseUrl}/payments`, {
-      headers: {
-        'Authorization': `Bearer ${this.getAuthToken()}`,
-      },
+      headers: this.getAuthHeaders(),
+      credentials: 'include',
     });
 
     if (!response.ok) {
@@ -94,14 +94,19 @@ class StripeService {
 
 
 
-  // Helper method to get auth token
-  private getAuthToken(): string {
+  // Helper method to get auth headers
+  private getAuthHeaders(): Record<string, string> {
     // Try both token names to handle different storage patterns
     const token = localStorage.getItem('access_token') || localStorage.getItem('accessToken');
-    if (!token) {
+    if (token) {
+      return { 'Authorization': `Bearer ${token}` };
+    }
+    // Cookie sessions authenticate with their cookies and the CSRF token
+    const csrfToken = localStorage.getItem('csrf_token');
+    if (!csrfToken) {
       throw new Error('No authentication token found');
     }
-    return token;
+    return { 'X-CSRF-Token': csrfToken };
   }
 
   // Format price for display
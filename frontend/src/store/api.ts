@@ -42,27 +42,102 @@ export const api = createApi({
   endpoints: (builder) => ({
     // Auth endpoints
     getGoogleAuthUrl: builder.query<{ auth_url: string; state: string }, void>({
-      query: () => '/api/auth/google/url',
+      // The backend sets a nonce cookie that must come back with the login request
+      query: () => ({
+        url: '/api/auth/google/url',
+        credentials: 'include',
+      }),
+      providesTags: ['Auth'],
+    }),
+
+    getAuthProviders: builder.query<{ providers: string[] }, void>({
+      query: () => '/api/auth/providers',
       providesTags: ['Auth'],
     }),
 
+    getAuthUrl: builder.query<{ provider: string; auth_url: string; state: string }, string>({
+      query: (provider) => ({
+        url: `/api/auth/${provider}/url`,
+        credentials: 'include',
+      }),
+    }),
+
     googleLogin: builder.mutation<{
       user: any;
       access_token: string;
       refresh_token: string;
       token_type: string;
       expires_in: number;
-    }, { code: string }>({
+    }, { code: string; state: string }>({
       query: (credentials) => ({
         url: '/api/auth/google/login',
         method: 'POST',
         body: credentials,
+        credentials: 'include',
+      }),
+      invalidatesTags: ['Auth', 'User'],
+    }),
+
+    localRegister: builder.mutation<void, { email: string; password: string; name?: string }>({
+      query: (body) => ({
+        url: '/api/auth/local/register',
+        method: 'POST',
+        body,
+      }),
+    }),
+
+    verifyEmail: builder.mutation<any, { token: string }>({
+      query: (body) => ({
+        url: '/api/auth/local/verify-email',
+        method: 'POST',
+        body,
+      }),
+      invalidatesTags: ['Auth', 'User'],
+    }),
+
+    localLogin: builder.mutation<{
+      user: any;
+      access_token: string;
+      refresh_token: string;
+      token_type: string;
+      expires_in: number;
+    }, { email: string; password: string }>({
+      query: (credentials) => ({
+        url: '/api/auth/local/login',
+        method: 'POST',
+        body: credentials,
       }),
       invalidatesTags: ['Auth', 'User'],
     }),
 
+    forgotPassword: builder.mutation<void, { email: string }>({
+      query: (body) => ({
+        url: '/api/auth/local/forgot-password',
+        method: 'POST',
+        body,
+      }),
+    }),
+
+    resetPassword: builder.mutation<void, { token: string; password: string }>({
+      query: (body) => ({
+        url: '/api/auth/local/reset-password',
+        method: 'POST',
+        body,
+      }),
+    }),
+
+    changePassword: builder.mutation<any, { current_password: string; new_password: string }>({
+      query: (body) => ({
+        url: '/api/auth/local/change-password',
+        method: 'POST',
+        body,
+      }),
+      invalidatesTags: ['Auth'],
+    }),
+
     refreshToken: builder.mutation<{
       access_token: string;
+      refresh_token: string;
       token_type: string;
       expires_in: string;
     }, { refresh_token: string }>({
@@ -209,10 +284,11 @@ export const api = createApi({
     }),
 
     // Setup endpoints
-    setupFirstAdmin: builder.mutation<any, void>({
-      query: () => ({
+    setupFirstAdmin: builder.mutation<any, { email: string; setup_token: string }>({
+      query: (data) => ({
         url: '/api/setup/first-admin',
         method: 'POST',
+        body: data,
       }),
       invalidatesTags: ['User', 'Role'],
     }),
@@ -229,7 +305,15 @@ export const api = createApi({
 export const {
   // Auth hooks
   useGetGoogleAuthUrlQuery,
+  useGetAuthProvidersQuery,
+  useLazyGetAuthUrlQuery,
   useGoogleLoginMutation,
+  useLocalRegisterMutation,
+  useVerifyEmailMutation,
+  useLocalLoginMutation,
+  useForgotPasswordMutation,
+  useResetPasswordMutation,
+  useChangePasswordMutation,
   useRefreshTokenMutation,
   useGetCurrentUserQuery,
   useLogoutMutation,